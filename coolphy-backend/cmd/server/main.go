@@ -9,8 +9,15 @@ import (
 	swaggerFiles "github.com/swaggo/files"
 
 	"coolphy-backend/internal/config"
+	"coolphy-backend/pkg/api/handlers"
 	"coolphy-backend/pkg/api/routes"
+	"coolphy-backend/pkg/assignments"
 	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/judge"
+	"coolphy-backend/pkg/taskimport"
+	"coolphy-backend/pkg/tikz"
+	"coolphy-backend/pkg/workflow"
+	"coolphy-backend/pkg/worksheet"
 	"coolphy-backend/docs"
 )
 
@@ -33,6 +40,14 @@ func main() {
 		log.Fatalf("db connect failed: %v", err)
 	}
 
+	judge.Start(cfg)
+	handlers.StartJudgeRetries()
+	assignments.StartReminders(cfg)
+	tikz.Start(cfg)
+	workflow.StartScheduler()
+	taskimport.Start()
+	worksheet.Start(cfg)
+
 	// Swagger metadata
 	docs.SwaggerInfo.BasePath = "/api/v1"
 
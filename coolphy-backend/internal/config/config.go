@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -15,6 +18,20 @@ type Config struct {
 	RateLimit string
 	CORSAllowedOrigins string
 	UploadDir string
+	JudgeWorkers int
+	JudgeWorkDir string
+	JudgeIsolate bool
+	JudgeUID int
+	JudgeCgroup string
+	JudgeBinds []string
+	AccessTokenTTL time.Duration
+	RefreshTokenTTL time.Duration
+	RequireEmailVerification bool
+	RequireAdmin2FA bool
+	AssignmentReminderBefore time.Duration
+	TikZWorkers int
+	TikZTimeout time.Duration
+	PDFTimeout time.Duration
 }
 
 func Load() Config {
@@ -27,6 +44,20 @@ func Load() Config {
 		RateLimit: get("RATE_LIMIT", "100-M"),
 		CORSAllowedOrigins: get("CORS_ALLOWED_ORIGINS", "*"),
 		UploadDir: get("UPLOAD_DIR", "./uploads"),
+		JudgeWorkers: getInt("JUDGE_WORKERS", 2),
+		JudgeWorkDir: get("JUDGE_WORK_DIR", ""),
+		JudgeIsolate: get("JUDGE_ISOLATE", "true") == "true",
+		JudgeUID: getInt("JUDGE_UID", 65534),
+		JudgeCgroup: get("JUDGE_CGROUP", ""),
+		JudgeBinds: getList("JUDGE_BINDS"),
+		AccessTokenTTL: getDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		RequireEmailVerification: get("REQUIRE_EMAIL_VERIFICATION", "false") == "true",
+		RequireAdmin2FA: get("REQUIRE_ADMIN_2FA", "false") == "true",
+		AssignmentReminderBefore: getDuration("ASSIGNMENT_REMINDER_BEFORE", 24*time.Hour),
+		TikZWorkers: getInt("TIKZ_WORKERS", 1),
+		TikZTimeout: getDuration("TIKZ_TIMEOUT", 20*time.Second),
+		PDFTimeout: getDuration("PDF_TIMEOUT", 60*time.Second),
 	}
 	return cfg
 }
@@ -38,6 +69,32 @@ func get(key, def string) string {
 	return def
 }
 
+func getInt(key string, def int) int {
+	v, err := strconv.Atoi(get(key, ""))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func getList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(get(key, ""), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func getDuration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(get(key, ""))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
 func MustGet(key string) string {
 	v := os.Getenv(key)
 	if v == "" {
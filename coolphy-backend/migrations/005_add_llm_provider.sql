@@ -0,0 +1,6 @@
+-- Selectable LLM provider: openrouter (default), openai_compatible (llama.cpp, Ollama, ...) or fake
+ALTER TABLE app_settings ADD COLUMN IF NOT EXISTS llm_provider VARCHAR(50) DEFAULT 'openrouter';
+ALTER TABLE app_settings ADD COLUMN IF NOT EXISTS llm_base_url TEXT;
+ALTER TABLE app_settings ADD COLUMN IF NOT EXISTS llm_api_key TEXT;
+
+UPDATE app_settings SET llm_provider = 'openrouter' WHERE llm_provider IS NULL;
@@ -0,0 +1,35 @@
+-- Full-text search over lectures, tasks and topics.
+-- The 'russian' configuration stems Cyrillic words with the Russian snowball
+-- stemmer and Latin words with the English one, so one config covers both.
+
+-- Drop LaTeX markup so that commands like \frac or \begin{equation} don't end
+-- up in the index; arguments such as the text of \textbf{...} are kept
+CREATE OR REPLACE FUNCTION strip_latex(src TEXT) RETURNS TEXT AS $$
+  SELECT regexp_replace(
+    regexp_replace(
+      regexp_replace(
+        regexp_replace(coalesce(src, ''), '\\begin\{tikzpicture\}.*?\\end\{tikzpicture\}', ' ', 'g'),
+      '\\(begin|end)\{[^}]*\}', ' ', 'g'),
+    '\\[a-zA-Z]+\*?', ' ', 'g'),
+  '[{}$^_&%~\\]', ' ', 'g')
+$$ LANGUAGE SQL IMMUTABLE;
+
+ALTER TABLE lectures ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+  setweight(to_tsvector('russian', coalesce(title, '')), 'A') ||
+  setweight(to_tsvector('russian', coalesce(summary, '')), 'B') ||
+  setweight(to_tsvector('russian', strip_latex(content_la_te_x)), 'C')
+) STORED;
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+  setweight(to_tsvector('russian', coalesce(title, '')), 'A') ||
+  setweight(to_tsvector('russian', strip_latex(description_la_te_x)), 'C')
+) STORED;
+
+ALTER TABLE topics ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+  setweight(to_tsvector('russian', coalesce(title, '')), 'A') ||
+  setweight(to_tsvector('russian', strip_latex(description)), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_lectures_search ON lectures USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_tasks_search ON tasks USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_topics_search ON topics USING GIN (search_vector);
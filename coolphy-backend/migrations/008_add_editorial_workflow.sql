@@ -0,0 +1,29 @@
+-- Editorial workflow: draft -> review -> (scheduled ->) published, archived
+ALTER TABLE lectures ADD COLUMN IF NOT EXISTS reviewer_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE lectures ADD COLUMN IF NOT EXISTS publish_at TIMESTAMP;
+ALTER TABLE lectures ADD COLUMN IF NOT EXISTS published_at TIMESTAMP;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS reviewer_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS publish_at TIMESTAMP;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS published_at TIMESTAMP;
+
+-- "active" content was visible before, it stays visible as published
+UPDATE lectures SET status = 'published', published_at = updated_at WHERE status = 'active' OR status IS NULL OR status = '';
+UPDATE tasks SET status = 'published', published_at = updated_at WHERE status = 'active' OR status IS NULL OR status = '';
+ALTER TABLE lectures ALTER COLUMN status SET DEFAULT 'draft';
+ALTER TABLE tasks ALTER COLUMN status SET DEFAULT 'draft';
+
+CREATE INDEX IF NOT EXISTS idx_lectures_status ON lectures(status);
+CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status);
+CREATE INDEX IF NOT EXISTS idx_lectures_scheduled ON lectures(publish_at) WHERE status = 'scheduled';
+CREATE INDEX IF NOT EXISTS idx_tasks_scheduled ON tasks(publish_at) WHERE status = 'scheduled';
+
+CREATE TABLE IF NOT EXISTS review_comments (
+    id SERIAL PRIMARY KEY,
+    entity_type VARCHAR(16) NOT NULL,
+    entity_id INTEGER NOT NULL,
+    author_id INTEGER NOT NULL REFERENCES users(id),
+    transition VARCHAR(32),
+    body TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_review_comment_entity ON review_comments(entity_type, entity_id);
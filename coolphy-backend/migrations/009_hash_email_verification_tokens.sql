@@ -0,0 +1,10 @@
+-- Email verification tokens are stored as their SHA-256, like refresh tokens
+-- and recovery codes; links already sent keep working
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'email_verification_tokens' AND column_name = 'token') THEN
+        ALTER TABLE email_verification_tokens RENAME COLUMN token TO token_hash;
+        UPDATE email_verification_tokens SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+    END IF;
+END $$;
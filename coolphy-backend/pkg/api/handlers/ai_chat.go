@@ -10,8 +10,11 @@ import (
 	"gorm.io/gorm"
 
 	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/grading"
 	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/tikz"
 	"coolphy-backend/pkg/utils"
+	"coolphy-backend/pkg/workflow"
 )
 
 // GetOrCreateSettings retrieves or creates app settings
@@ -24,6 +27,7 @@ func getOrCreateSettings() (*models.AppSettings, error) {
 			SystemPrompt:        models.DefaultSystemPrompt,
 			ProfessorPrompt:     models.DefaultProfessorPrompt,
 			TaskAssistantPrompt: models.DefaultTaskAssistantPrompt,
+			LLMProvider:         utils.LLMProviderOpenRouter,
 			PrimaryModel:        "anthropic/claude-3.5-sonnet",
 			FallbackModel:       "google/gemini-2.0-flash-exp:free",
 			UpdatedAt:           time.Now(),
@@ -41,9 +45,28 @@ func getOrCreateSettings() (*models.AppSettings, error) {
 	if settings.TaskAssistantPrompt == "" {
 		settings.TaskAssistantPrompt = models.DefaultTaskAssistantPrompt
 	}
+	if settings.LLMProvider == "" {
+		settings.LLMProvider = utils.LLMProviderOpenRouter
+	}
 	return &settings, nil
 }
 
+// newLLMProvider builds the chat provider the admin selected in settings.
+// Tests swap it for a utils.FakeLLMProvider.
+var newLLMProvider = func(settings *models.AppSettings) (utils.LLMProvider, error) {
+	opts := utils.LLMOptions{
+		Provider:      settings.LLMProvider,
+		APIKey:        settings.OpenRouterAPIKey,
+		PrimaryModel:  settings.PrimaryModel,
+		FallbackModel: settings.FallbackModel,
+	}
+	if settings.LLMProvider == utils.LLMProviderOpenAICompatible {
+		opts.APIKey = settings.LLMAPIKey
+		opts.BaseURL = settings.LLMBaseURL
+	}
+	return utils.NewLLMProvider(opts)
+}
+
 type chatPayload struct {
 	Message     string `json:"message" binding:"required"`
 	ContextType string `json:"context_type"` // task, lecture, topic, general
@@ -52,7 +75,7 @@ type chatPayload struct {
 
 // ProfessorChatWithAI godoc
 // @Summary      Ask AI professor with real LLM
-// @Description  Submit question to AI professor using OpenRouter
+// @Description  Submit question to AI professor using the configured LLM provider
 // @Tags         professor
 // @Security     BearerAuth
 // @Accept       json
@@ -76,110 +99,18 @@ func ProfessorChatWithAI() gin.HandlerFunc {
 			return
 		}
 
-		if settings.OpenRouterAPIKey == "" {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "OpenRouter API key not configured. Please contact admin."})
+		provider, err := newLLMProvider(settings)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI provider not configured. Please contact admin."})
 			return
 		}
 
-		// Get student stats for professor context
-		var user models.User
-		db.Get().First(&user, userID)
-		var solvedCount int64
-		db.Get().Model(&models.SolutionAttempt{}).Where("user_id = ? AND status = ?", userID, "correct").Count(&solvedCount)
-		var totalAttempts int64
-		db.Get().Model(&models.SolutionAttempt{}).Where("user_id = ?", userID).Count(&totalAttempts)
-
-		// Get subject performance
-		type SubjectPerf struct {
-			Subject     string
-			Correct     int64
-			Total       int64
-			SuccessRate float64
-		}
-		var subjectPerf []SubjectPerf
-		rows, _ := db.Get().Raw(`
-			SELECT t.subject, 
-				COUNT(CASE WHEN sa.status = 'correct' THEN 1 END) as correct,
-				COUNT(*) as total
-			FROM solution_attempts sa
-			JOIN tasks t ON sa.task_id = t.id
-			WHERE sa.user_id = ?
-			GROUP BY t.subject
-		`, userID).Rows()
-		if rows != nil {
-			defer rows.Close()
-			for rows.Next() {
-				var sp SubjectPerf
-				if err := rows.Scan(&sp.Subject, &sp.Correct, &sp.Total); err == nil {
-					if sp.Total > 0 {
-						sp.SuccessRate = float64(sp.Correct) / float64(sp.Total) * 100
-					}
-					subjectPerf = append(subjectPerf, sp)
-				}
-			}
-		}
-
-		// Build student stats context
-		statsContext := fmt.Sprintf("\n\n**Student Performance:**\nName: %s\nTotal Points: %d\nTasks Solved: %d/%d\n",
-			user.Name, user.Points, solvedCount, totalAttempts)
-		for _, sp := range subjectPerf {
-			statsContext += fmt.Sprintf("- %s: %d/%d correct (%.1f%%)\n", sp.Subject, sp.Correct, sp.Total, sp.SuccessRate)
-		}
-
-		// Get available tasks and lectures for RAG
-		var tasks []models.Task
-		db.Get().Select("id, title, subject, level").Limit(50).Find(&tasks)
-		var lectures []models.Lecture
-		db.Get().Select("id, title, subject").Limit(50).Find(&lectures)
+		messages := buildProfessorMessages(userID, p, settings.ProfessorPrompt)
 
-		ragContext := "\n\n**Available Resources:**\n"
-		if len(tasks) > 0 {
-			ragContext += "\nTasks:\n"
-			for _, t := range tasks {
-				ragContext += fmt.Sprintf("- [Task: %s](#/tasks/%d) - %s, %s\n", t.Title, t.ID, t.Subject, t.Level)
-			}
-		}
-		if len(lectures) > 0 {
-			ragContext += "\nLectures:\n"
-			for _, l := range lectures {
-				ragContext += fmt.Sprintf("- [Lecture: %s](#/lectures/%d) - %s\n", l.Title, l.ID, l.Subject)
-			}
-		}
-
-		contextInfo := statsContext + ragContext
-
-		// Get conversation history for this context (last 10 messages)
-		var history []models.ChatMessage
-		query := db.Get().Where("user_id = ?", userID).Order("timestamp desc").Limit(10)
-		if p.ContextType != "" {
-			query = query.Where("context_type = ?", p.ContextType)
-			if p.ContextID != nil {
-				query = query.Where("context_id = ?", *p.ContextID)
-			}
-		}
-		query.Find(&history)
-
-		// Build messages array for OpenRouter with professor prompt
-		messages := []utils.OpenRouterMessage{
-			{Role: "system", Content: settings.ProfessorPrompt + contextInfo},
-		}
-
-		// Add history in reverse order (oldest first)
-		for i := len(history) - 1; i >= 0; i-- {
-			messages = append(messages,
-				utils.OpenRouterMessage{Role: "user", Content: history[i].UserMessage},
-				utils.OpenRouterMessage{Role: "assistant", Content: history[i].AIReply},
-			)
-		}
-
-		// Add current user message
-		messages = append(messages, utils.OpenRouterMessage{Role: "user", Content: p.Message})
-
-		// Call OpenRouter API
-		client := utils.NewOpenRouterClient(settings.OpenRouterAPIKey, settings.PrimaryModel, settings.FallbackModel)
-		aiReply, err := client.Chat(messages)
+		// Call LLM provider
+		aiReply, err := provider.Chat(c.Request.Context(), messages)
 		if err != nil {
-			fmt.Printf("OpenRouter API error: %v\n", err)
+			fmt.Printf("LLM provider error: %v\n", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get AI response: " + err.Error()})
 			return
 		}
@@ -198,7 +129,7 @@ func ProfessorChatWithAI() gin.HandlerFunc {
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"ai_reply": aiReply})
+		c.JSON(http.StatusCreated, gin.H{"ai_reply": aiReply, "diagrams": tikz.Enqueue(aiReply)})
 	}
 }
 
@@ -220,6 +151,10 @@ func TaskChatWithAI() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if p.ContextType == "task" && p.ContextID != nil && inRunningContest(*p.ContextID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "the task is part of a running contest"})
+			return
+		}
 
 		// Get settings
 		settings, err := getOrCreateSettings()
@@ -228,19 +163,163 @@ func TaskChatWithAI() gin.HandlerFunc {
 			return
 		}
 
-		if settings.OpenRouterAPIKey == "" {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "OpenRouter API key not configured. Please contact admin."})
+		provider, err := newLLMProvider(settings)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI provider not configured. Please contact admin."})
 			return
 		}
 
-		// Build task context with solution for evaluation
-		contextInfo := ""
-		var currentTask *models.Task
-		if p.ContextType == "task" && p.ContextID != nil {
-			var task models.Task
-			if err := db.Get().First(&task, *p.ContextID).Error; err == nil {
-				currentTask = &task
-				contextInfo = fmt.Sprintf(`
+		messages, currentTask := buildTaskMessages(c, userID, p, settings.TaskAssistantPrompt)
+
+		// Call LLM provider
+		aiReply, err := provider.Chat(c.Request.Context(), messages)
+		if err != nil {
+			fmt.Printf("LLM provider error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get AI response: " + err.Error()})
+			return
+		}
+
+		aiReply, evalDecision := applyTaskEvaluation(userID.(uint), currentTask, aiReply)
+
+		// Save to database
+		msg := models.ChatMessage{
+			UserID:      userID.(uint),
+			ContextType: "task",
+			ContextID:   p.ContextID,
+			UserMessage: p.Message,
+			AIReply:     aiReply,
+			Timestamp:   time.Now(),
+		}
+		if err := db.Get().Create(&msg).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
+			return
+		}
+
+		resp := taskChatResponse(aiReply, evalDecision, currentTask)
+		resp["diagrams"] = tikz.Enqueue(aiReply)
+		c.JSON(http.StatusCreated, resp)
+	}
+}
+
+// buildProfessorMessages assembles the system prompt with student stats, the
+// RAG resource list and recent history for the professor chat
+func buildProfessorMessages(userID interface{}, p chatPayload, prompt string) []utils.LLMMessage {
+	// Get student stats for professor context
+	var user models.User
+	db.Get().First(&user, userID)
+	var solvedCount int64
+	db.Get().Model(&models.SolutionAttempt{}).Where("user_id = ? AND status = ?", userID, "correct").Count(&solvedCount)
+	var totalAttempts int64
+	db.Get().Model(&models.SolutionAttempt{}).Where("user_id = ?", userID).Count(&totalAttempts)
+
+	// Get subject performance
+	type SubjectPerf struct {
+		Subject     string
+		Correct     int64
+		Total       int64
+		SuccessRate float64
+	}
+	var subjectPerf []SubjectPerf
+	rows, _ := db.Get().Raw(`
+		SELECT t.subject, 
+			COUNT(CASE WHEN sa.status = 'correct' THEN 1 END) as correct,
+			COUNT(*) as total
+		FROM solution_attempts sa
+		JOIN tasks t ON sa.task_id = t.id
+		WHERE sa.user_id = ?
+		GROUP BY t.subject
+	`, userID).Rows()
+	if rows != nil {
+		defer rows.Close()
+		for rows.Next() {
+			var sp SubjectPerf
+			if err := rows.Scan(&sp.Subject, &sp.Correct, &sp.Total); err == nil {
+				if sp.Total > 0 {
+					sp.SuccessRate = float64(sp.Correct) / float64(sp.Total) * 100
+				}
+				subjectPerf = append(subjectPerf, sp)
+			}
+		}
+	}
+
+	// Build student stats context
+	statsContext := fmt.Sprintf("\n\n**Student Performance:**\nName: %s\nTotal Points: %d\nTasks Solved: %d/%d\n",
+		user.Name, user.Points, solvedCount, totalAttempts)
+	for _, sp := range subjectPerf {
+		statsContext += fmt.Sprintf("- %s: %d/%d correct (%.1f%%)\n", sp.Subject, sp.Correct, sp.Total, sp.SuccessRate)
+	}
+
+	// Get available tasks and lectures for RAG
+	var tasks []models.Task
+	workflow.Published(db.Get()).Select("id, title, subject, level").Limit(50).Find(&tasks)
+	var lectures []models.Lecture
+	workflow.Published(db.Get()).Select("id, title, subject").Limit(50).Find(&lectures)
+
+	ragContext := "\n\n**Available Resources:**\n"
+	if len(tasks) > 0 {
+		ragContext += "\nTasks:\n"
+		for _, t := range tasks {
+			ragContext += fmt.Sprintf("- [Task: %s](#/tasks/%d) - %s, %s\n", t.Title, t.ID, t.Subject, t.Level)
+		}
+	}
+	if len(lectures) > 0 {
+		ragContext += "\nLectures:\n"
+		for _, l := range lectures {
+			ragContext += fmt.Sprintf("- [Lecture: %s](#/lectures/%d) - %s\n", l.Title, l.ID, l.Subject)
+		}
+	}
+
+	contextInfo := statsContext + ragContext
+
+	// Get conversation history for this context (last 10 messages)
+	var history []models.ChatMessage
+	query := db.Get().Where("user_id = ?", userID).Order("timestamp desc").Limit(10)
+	if p.ContextType != "" {
+		query = query.Where("context_type = ?", p.ContextType)
+		if p.ContextID != nil {
+			query = query.Where("context_id = ?", *p.ContextID)
+		}
+	}
+	query.Find(&history)
+
+	// Build messages array for OpenRouter with professor prompt
+	messages := []utils.LLMMessage{
+		{Role: "system", Content: prompt + contextInfo},
+	}
+
+	// Add history in reverse order (oldest first)
+	for i := len(history) - 1; i >= 0; i-- {
+		messages = append(messages,
+			utils.LLMMessage{Role: "user", Content: history[i].UserMessage},
+			utils.LLMMessage{Role: "assistant", Content: history[i].AIReply},
+		)
+	}
+
+	// Add current user message
+	messages = append(messages, utils.LLMMessage{Role: "user", Content: p.Message})
+
+	return messages
+}
+
+// buildTaskMessages assembles the task assistant prompt with the task statement,
+// its reference solution and the recent in-task history. The task is returned
+// so that an evaluation decision can be recorded against it. Tasks the caller
+// can't open are left out.
+func buildTaskMessages(c *gin.Context, userID interface{}, p chatPayload, prompt string) ([]utils.LLMMessage, *models.Task) {
+	// Build task context with solution for evaluation
+	contextInfo := ""
+	var currentTask *models.Task
+	if p.ContextType == "task" && p.ContextID != nil {
+		var task models.Task
+		if err := visibleContent(c, db.Get()).First(&task, *p.ContextID).Error; err == nil {
+			// The student sees their own variant of a parametrized task
+			if uid, ok := userID.(uint); ok {
+				if err := grading.ApplyVariant(&task, uid); err != nil {
+					fmt.Printf("task %d variant error: %v\n", task.ID, err)
+				}
+			}
+			currentTask = &task
+			contextInfo = fmt.Sprintf(`
 
 **Current Task:**
 Title: %s
@@ -257,114 +336,100 @@ Description:
 - If incorrect but close, provide hints
 - If they're stuck, break down the problem into steps
 - Use LaTeX for math and TikZ for diagrams`,
-					task.Title, task.DescriptionLaTeX, task.SolutionLaTeX)
-			}
+				task.Title, task.DescriptionLaTeX, task.SolutionLaTeX)
 		}
+	}
 
-		// Get conversation history for this specific task (last 10 messages)
-		var history []models.ChatMessage
-		query := db.Get().Where("user_id = ? AND context_type = 'task'", userID).Order("timestamp desc").Limit(10)
-		if p.ContextID != nil {
-			query = query.Where("context_id = ?", *p.ContextID)
-		}
-		query.Find(&history)
+	// Get conversation history for this specific task (last 10 messages)
+	var history []models.ChatMessage
+	query := db.Get().Where("user_id = ? AND context_type = 'task'", userID).Order("timestamp desc").Limit(10)
+	if p.ContextID != nil {
+		query = query.Where("context_id = ?", *p.ContextID)
+	}
+	query.Find(&history)
 
-		// Build messages array for OpenRouter with task assistant prompt
-		messages := []utils.OpenRouterMessage{
-			{Role: "system", Content: settings.TaskAssistantPrompt + contextInfo},
-		}
+	// Build messages array for OpenRouter with task assistant prompt
+	messages := []utils.LLMMessage{
+		{Role: "system", Content: prompt + contextInfo},
+	}
 
-		// Add history in reverse order (oldest first)
-		for i := len(history) - 1; i >= 0; i-- {
-			messages = append(messages,
-				utils.OpenRouterMessage{Role: "user", Content: history[i].UserMessage},
-				utils.OpenRouterMessage{Role: "assistant", Content: history[i].AIReply},
-			)
-		}
+	// Add history in reverse order (oldest first)
+	for i := len(history) - 1; i >= 0; i-- {
+		messages = append(messages,
+			utils.LLMMessage{Role: "user", Content: history[i].UserMessage},
+			utils.LLMMessage{Role: "assistant", Content: history[i].AIReply},
+		)
+	}
 
-		// Add current user message
-		messages = append(messages, utils.OpenRouterMessage{Role: "user", Content: p.Message})
+	// Add current user message
+	messages = append(messages, utils.LLMMessage{Role: "user", Content: p.Message})
 
-		// Call OpenRouter API
-		client := utils.NewOpenRouterClient(settings.OpenRouterAPIKey, settings.PrimaryModel, settings.FallbackModel)
-		aiReply, err := client.Chat(messages)
-		if err != nil {
-			fmt.Printf("OpenRouter API error: %v\n", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get AI response: " + err.Error()})
-			return
-		}
+	return messages, currentTask
+}
 
-		// Check if AI decided to evaluate the answer
-		type EvalDecision struct {
-			Action    string `json:"action"`
-			Answer    string `json:"answer"`
-			IsCorrect bool   `json:"is_correct"`
-			Feedback  string `json:"feedback"`
-		}
-		var evalDecision EvalDecision
-		evaluationTriggered := false
-		
-		// Try to parse JSON evaluation decision from AI response
-		if err := json.Unmarshal([]byte(aiReply), &evalDecision); err == nil && evalDecision.Action == "evaluate" {
-			evaluationTriggered = true
-			// AI decided to evaluate - create solution attempt
-			if currentTask != nil {
-				status := "incorrect"
-				pointsAwarded := 0
-				if evalDecision.IsCorrect {
-					status = "correct"
-					pointsAwarded = currentTask.Points
-					// Award points to user
-					var user models.User
-					if err := db.Get().First(&user, userID).Error; err == nil {
-						user.Points += currentTask.Points
-						db.Get().Save(&user)
-					}
-				}
-				
-				// Create solution attempt record
-				attempt := models.SolutionAttempt{
-					UserID:        userID.(uint),
-					TaskID:        currentTask.ID,
-					Answer:        evalDecision.Answer,
-					Status:        status,
-					PointsAwarded: pointsAwarded,
-					AIFeedback:    evalDecision.Feedback,
-				}
-				db.Get().Create(&attempt)
-				
-				// Replace AI response with user-friendly message
-				if evalDecision.IsCorrect {
-					aiReply = fmt.Sprintf("✅ **Correct!** +%d points\n\n%s", pointsAwarded, evalDecision.Feedback)
-				} else {
-					aiReply = fmt.Sprintf("❌ **Not quite right**\n\n%s", evalDecision.Feedback)
-				}
+// taskEvalDecision is the JSON the task assistant replies with when it decides
+// to grade the student's answer
+type taskEvalDecision struct {
+	Action    string `json:"action"`
+	Answer    string `json:"answer"`
+	IsCorrect bool   `json:"is_correct"`
+	Feedback  string `json:"feedback"`
+}
+
+// applyTaskEvaluation checks whether the AI reply is an evaluation decision. If so
+// it records a solution attempt, awards points and returns a user-friendly reply
+// in place of the raw JSON. A nil decision means the reply was plain guidance.
+func applyTaskEvaluation(userID uint, currentTask *models.Task, aiReply string) (string, *taskEvalDecision) {
+	var evalDecision taskEvalDecision
+	// Try to parse JSON evaluation decision from AI response
+	if err := json.Unmarshal([]byte(aiReply), &evalDecision); err != nil || evalDecision.Action != "evaluate" {
+		return aiReply, nil
+	}
+	// AI decided to evaluate - create solution attempt
+	if currentTask != nil {
+		status := "incorrect"
+		pointsAwarded := 0
+		if evalDecision.IsCorrect {
+			status = "correct"
+			pointsAwarded = currentTask.Points
+			// Award points to user
+			var user models.User
+			if err := db.Get().First(&user, userID).Error; err == nil {
+				user.Points += currentTask.Points
+				db.Get().Save(&user)
 			}
 		}
 
-		// Save to database
-		msg := models.ChatMessage{
-			UserID:      userID.(uint),
-			ContextType: "task",
-			ContextID:   p.ContextID,
-			UserMessage: p.Message,
-			AIReply:     aiReply,
-			Timestamp:   time.Now(),
+		// Create solution attempt record
+		attempt := models.SolutionAttempt{
+			UserID:        userID,
+			TaskID:        currentTask.ID,
+			Answer:        evalDecision.Answer,
+			Status:        status,
+			PointsAwarded: pointsAwarded,
+			AIFeedback:    evalDecision.Feedback,
 		}
-		if err := db.Get().Create(&msg).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
-			return
+		db.Get().Create(&attempt)
+
+		// Replace AI response with user-friendly message
+		if evalDecision.IsCorrect {
+			aiReply = fmt.Sprintf("✅ **Correct!** +%d points\n\n%s", pointsAwarded, evalDecision.Feedback)
+		} else {
+			aiReply = fmt.Sprintf("❌ **Not quite right**\n\n%s", evalDecision.Feedback)
 		}
+	}
+	return aiReply, &evalDecision
+}
 
-		response := gin.H{"ai_reply": aiReply}
-		if evaluationTriggered {
-			response["evaluation"] = gin.H{
-				"is_correct": evalDecision.IsCorrect,
-				"score":      evalDecision.IsCorrect && currentTask != nil,
-			}
+func taskChatResponse(aiReply string, evalDecision *taskEvalDecision, currentTask *models.Task) gin.H {
+	response := gin.H{"ai_reply": aiReply}
+	if evalDecision != nil {
+		response["evaluation"] = gin.H{
+			"is_correct": evalDecision.IsCorrect,
+			"score":      evalDecision.IsCorrect && currentTask != nil,
 		}
-		c.JSON(http.StatusCreated, response)
 	}
+	return response
 }
 
 // Admin Settings Endpoints
@@ -388,7 +453,10 @@ func GetSettings() gin.HandlerFunc {
 }
 
 type updateSettingsPayload struct {
+	LLMProvider         string `json:"llm_provider"`
 	OpenRouterAPIKey    string `json:"openrouter_api_key"`
+	LLMBaseURL          string `json:"llm_base_url"`
+	LLMAPIKey           string `json:"llm_api_key"`
 	SystemPrompt        string `json:"system_prompt"`
 	ProfessorPrompt     string `json:"professor_prompt"`
 	TaskAssistantPrompt string `json:"task_assistant_prompt"`
@@ -419,9 +487,22 @@ func UpdateSettings() gin.HandlerFunc {
 			return
 		}
 
+		if p.LLMProvider != "" {
+			if !utils.IsValidLLMProvider(p.LLMProvider) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown llm_provider"})
+				return
+			}
+			settings.LLMProvider = p.LLMProvider
+		}
 		if p.OpenRouterAPIKey != "" {
 			settings.OpenRouterAPIKey = p.OpenRouterAPIKey
 		}
+		if p.LLMBaseURL != "" {
+			settings.LLMBaseURL = p.LLMBaseURL
+		}
+		if p.LLMAPIKey != "" {
+			settings.LLMAPIKey = p.LLMAPIKey
+		}
 		if p.SystemPrompt != "" {
 			settings.SystemPrompt = p.SystemPrompt
 		}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/tikz"
+	"coolphy-backend/pkg/utils"
+)
+
+// Streaming variants of the AI chats. Tokens are forwarded as Server-Sent Events:
+//   event: token  data: {"content": "..."}
+//   event: done   data: {"id": 1, "ai_reply": "...", "evaluation": {...}}
+//   event: error  data: {"error": "..."}
+// The complete reply is stored as a ChatMessage once the stream ends. If the
+// client goes away the request context is cancelled, which aborts the upstream call.
+
+// ProfessorChatStream godoc
+// @Summary      Ask AI professor with streamed reply
+// @Description  Same as /professor-chat but streams tokens as Server-Sent Events
+// @Tags         professor
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      text/event-stream
+// @Param        payload  body      chatPayload  true  "Question"
+// @Success      200      {string}  string  "SSE stream"
+// @Router       /professor-chat/stream [post]
+func ProfessorChatStream() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		var p chatPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		settings, err := getOrCreateSettings()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get settings"})
+			return
+		}
+		provider, err := newLLMProvider(settings)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI provider not configured. Please contact admin."})
+			return
+		}
+
+		messages := buildProfessorMessages(userID, p, settings.ProfessorPrompt)
+
+		aiReply, _, ok := streamChat(c, provider, messages, false)
+		if !ok {
+			return
+		}
+
+		msg := models.ChatMessage{
+			UserID:      userID.(uint),
+			ContextType: p.ContextType,
+			ContextID:   p.ContextID,
+			UserMessage: p.Message,
+			AIReply:     aiReply,
+			Timestamp:   time.Now(),
+		}
+		if err := db.Get().Create(&msg).Error; err != nil {
+			writeSSE(c, "error", gin.H{"error": "create failed"})
+			return
+		}
+		writeSSE(c, "done", gin.H{"id": msg.ID, "ai_reply": aiReply, "diagrams": tikz.Enqueue(aiReply)})
+	}
+}
+
+// TaskChatStream godoc
+// @Summary      Task assistant chat with streamed reply
+// @Description  Same as /task-chat but streams tokens as Server-Sent Events. A reply in
+// @Description  which the assistant evaluates the answer is not streamed: the verdict is
+// @Description  sent as a single token once parsed, and the "done" event carries it too.
+// @Tags         tasks
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      text/event-stream
+// @Param        payload  body      chatPayload  true  "Question"
+// @Success      200      {string}  string  "SSE stream"
+// @Router       /task-chat/stream [post]
+func TaskChatStream() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		var p chatPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if p.ContextType == "task" && p.ContextID != nil && inRunningContest(*p.ContextID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "the task is part of a running contest"})
+			return
+		}
+
+		settings, err := getOrCreateSettings()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get settings"})
+			return
+		}
+		provider, err := newLLMProvider(settings)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI provider not configured. Please contact admin."})
+			return
+		}
+
+		messages, currentTask := buildTaskMessages(c, userID, p, settings.TaskAssistantPrompt)
+
+		// Evaluation decisions are JSON, hold those back until they are parsed
+		aiReply, streamed, ok := streamChat(c, provider, messages, currentTask != nil)
+		if !ok {
+			return
+		}
+
+		aiReply, evalDecision := applyTaskEvaluation(userID.(uint), currentTask, aiReply)
+		if !streamed {
+			writeSSE(c, "token", gin.H{"content": aiReply})
+		}
+
+		msg := models.ChatMessage{
+			UserID:      userID.(uint),
+			ContextType: "task",
+			ContextID:   p.ContextID,
+			UserMessage: p.Message,
+			AIReply:     aiReply,
+			Timestamp:   time.Now(),
+		}
+		if err := db.Get().Create(&msg).Error; err != nil {
+			writeSSE(c, "error", gin.H{"error": "create failed"})
+			return
+		}
+		done := taskChatResponse(aiReply, evalDecision, currentTask)
+		done["id"] = msg.ID
+		done["diagrams"] = tikz.Enqueue(aiReply)
+		writeSSE(c, "done", done)
+	}
+}
+
+// streamChat switches the response to SSE and relays tokens from the model.
+// It returns the full reply and false if the stream failed or the client left,
+// in which case nothing should be persisted. With holdJSON a reply starting
+// with "{" is not relayed, streamed then reports that the caller has to send
+// it.
+func streamChat(c *gin.Context, provider utils.LLMProvider, messages []utils.LLMMessage, holdJSON bool) (reply string, streamed, ok bool) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ctx := c.Request.Context()
+	var held strings.Builder
+	holding := holdJSON
+	aiReply, err := provider.ChatStream(ctx, messages, func(tok string) error {
+		if holding {
+			held.WriteString(tok)
+			start := strings.TrimLeft(held.String(), " \t\r\n")
+			if start == "" || start[0] == '{' {
+				return ctx.Err()
+			}
+			holding = false
+			tok = held.String()
+		}
+		writeSSE(c, "token", gin.H{"content": tok})
+		return ctx.Err()
+	})
+	if ctx.Err() != nil {
+		// Client disconnected, upstream request has been cancelled
+		return "", false, false
+	}
+	if err != nil {
+		fmt.Printf("LLM provider stream error: %v\n", err)
+		writeSSE(c, "error", gin.H{"error": "Failed to get AI response: " + err.Error()})
+		return "", false, false
+	}
+	return aiReply, !holding, true
+}
+
+func writeSSE(c *gin.Context, event string, data interface{}) {
+	c.SSEvent(event, data)
+	c.Writer.Flush()
+}
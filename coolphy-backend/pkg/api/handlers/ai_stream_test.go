@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/utils"
+)
+
+type sseEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+func parseSSE(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var name string
+	sc := bufio.NewScanner(strings.NewReader(body))
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			var data map[string]interface{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &data); err != nil {
+				t.Fatalf("bad SSE data %q: %v", line, err)
+			}
+			events = append(events, sseEvent{name, data})
+		}
+	}
+	return events
+}
+
+// useFakeLLM makes the chat handlers talk to fake for the rest of the test
+func useFakeLLM(t *testing.T, fake *utils.FakeLLMProvider) {
+	prev := newLLMProvider
+	newLLMProvider = func(*models.AppSettings) (utils.LLMProvider, error) { return fake, nil }
+	t.Cleanup(func() { newLLMProvider = prev })
+}
+
+// tokens joins the content of the token events
+func tokens(events []sseEvent) (string, int) {
+	var b strings.Builder
+	n := 0
+	for _, e := range events {
+		if e.name == "token" {
+			b.WriteString(e.data["content"].(string))
+			n++
+		}
+	}
+	return b.String(), n
+}
+
+func TestProfessorChatStream(t *testing.T) {
+	d := testDB(t)
+	u := newUser(t, d, "student@example.com", models.RoleUser)
+	fake := &utils.FakeLLMProvider{Reply: "Force is mass times acceleration."}
+	useFakeLLM(t, fake)
+
+	w := serve(t, ProfessorChatStream(), http.MethodPost, "/professor-chat/stream", "/professor-chat/stream", &u, map[string]string{"message": "What is force?"})
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("content type %q, want an event stream", ct)
+	}
+	events := parseSSE(t, w.Body.String())
+	text, n := tokens(events)
+	if text != fake.Reply || n < 2 {
+		t.Errorf("streamed %q in %d tokens, want the reply word by word", text, n)
+	}
+	last := events[len(events)-1]
+	if last.name != "done" || last.data["ai_reply"] != fake.Reply {
+		t.Errorf("last event %v, want done with the reply", last)
+	}
+	var msg models.ChatMessage
+	if err := d.Where("user_id = ?", u.ID).First(&msg).Error; err != nil || msg.AIReply != fake.Reply {
+		t.Errorf("stored message %+v (%v), want the reply", msg, err)
+	}
+	if len(fake.Calls) != 1 || fake.Calls[0][len(fake.Calls[0])-1].Content != "What is force?" {
+		t.Errorf("provider calls %v, want one ending with the question", fake.Calls)
+	}
+}
+
+func TestTaskChatStreamHoldsEvaluation(t *testing.T) {
+	d := testDB(t)
+	u := newUser(t, d, "student@example.com", models.RoleUser)
+	task := models.Task{Title: "Speed", Points: 3, Status: models.StatusPublished}
+	d.Create(&task)
+	payload := map[string]interface{}{"message": "v = 10 m/s", "context_type": "task", "context_id": task.ID}
+
+	useFakeLLM(t, &utils.FakeLLMProvider{Reply: ` {"action":"evaluate","answer":"10 m/s","is_correct":true,"feedback":"Well done"}`})
+	w := serve(t, TaskChatStream(), http.MethodPost, "/task-chat/stream", "/task-chat/stream", &u, payload)
+	events := parseSSE(t, w.Body.String())
+	text, n := tokens(events)
+	if strings.Contains(w.Body.String(), "action") || n != 1 || !strings.Contains(text, "Correct!") || !strings.Contains(text, "Well done") {
+		t.Errorf("streamed %q in %d tokens, want only the verdict: %s", text, n, w.Body)
+	}
+	if done := events[len(events)-1]; done.name != "done" || done.data["ai_reply"] != text || done.data["evaluation"] == nil {
+		t.Errorf("done event %v, want the verdict and the evaluation", done)
+	}
+	var attempt models.SolutionAttempt
+	if err := d.Where("user_id = ? AND task_id = ?", u.ID, task.ID).First(&attempt).Error; err != nil || attempt.Status != "correct" {
+		t.Errorf("attempt %+v (%v), want a correct one", attempt, err)
+	}
+
+	// Ordinary replies, including ones that start like JSON, still arrive
+	for _, reply := range []string{"Think about the distance covered.", `{x} is a set with one element.`} {
+		useFakeLLM(t, &utils.FakeLLMProvider{Reply: reply})
+		w = serve(t, TaskChatStream(), http.MethodPost, "/task-chat/stream", "/task-chat/stream", &u, payload)
+		if text, _ := tokens(parseSSE(t, w.Body.String())); text != reply {
+			t.Errorf("streamed %q, want %q", text, reply)
+		}
+	}
+}
+
+func TestChatStreamProviderError(t *testing.T) {
+	d := testDB(t)
+	u := newUser(t, d, "student@example.com", models.RoleUser)
+	useFakeLLM(t, &utils.FakeLLMProvider{Err: errors.New("upstream down")})
+
+	w := serve(t, ProfessorChatStream(), http.MethodPost, "/professor-chat/stream", "/professor-chat/stream", &u, map[string]string{"message": "hi"})
+	events := parseSSE(t, w.Body.String())
+	if len(events) != 1 || events[0].name != "error" || !strings.Contains(events[0].data["error"].(string), "upstream down") {
+		t.Errorf("events %v, want a single error", events)
+	}
+	var n int64
+	d.Model(&models.ChatMessage{}).Count(&n)
+	if n != 0 {
+		t.Errorf("a failed reply was stored")
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/tikz"
+)
+
+var assetFileName = regexp.MustCompile(`^[0-9a-f]{64}\.svg$`)
+
+// ServeAsset godoc
+// @Summary      Get a generated asset
+// @Description  SVG compiled from a TikZ diagram, addressed by the SHA-256 of its source. 503 while it is being compiled.
+// @Tags         assets
+// @Produce      image/svg+xml
+// @Param        file  path      string  true  "<hash>.svg"
+// @Success      200   {file}    file
+// @Failure      422   {object}  map[string]interface{}
+// @Failure      503   {object}  map[string]interface{}
+// @Router       /assets/{file} [get]
+func ServeAsset() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("file")
+		if !assetFileName.MatchString(name) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "asset not found"})
+			return
+		}
+		var a models.Asset
+		if err := db.Get().Where("hash = ?", strings.TrimSuffix(name, ".svg")).First(&a).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "asset not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		switch a.Status {
+		case models.AssetPending:
+			c.Header("Retry-After", "5")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "the diagram is being compiled"})
+			return
+		case models.AssetFailed:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "the diagram failed to compile", "log": a.Error})
+			return
+		}
+		if _, err := os.Stat(a.StoragePath); err != nil {
+			c.JSON(http.StatusGone, gin.H{"error": "stored file missing"})
+			return
+		}
+		// The content never changes for a hash; the policy keeps scripts in
+		// the SVG from running if it is opened directly
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+		c.Header("Content-Type", a.MimeType)
+		c.File(a.StoragePath)
+	}
+}
+
+// ListAssets godoc
+// @Summary      List generated assets
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        status  query     string  false  "pending, ready or failed"
+// @Success      200     {array}   models.Asset
+// @Router       /admin/assets [get]
+func ListAssets() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := db.Get().Order("id desc").Limit(200)
+		if s := c.Query("status"); s != "" {
+			q = q.Where("status = ?", s)
+		}
+		var list []models.Asset
+		if err := q.Find(&list).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		for i := range list {
+			list[i].URL = tikz.URLPrefix + list[i].Hash + ".svg"
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// RebuildAsset godoc
+// @Summary      Compile a diagram again
+// @Tags         admin
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Asset ID"
+// @Success      202  {object}  map[string]interface{}
+// @Router       /admin/assets/{id}/rebuild [post]
+func RebuildAsset() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var a models.Asset
+		if err := db.Get().First(&a, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "asset not found"})
+			return
+		}
+		if err := tikz.Rebuild(&a); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"status": models.AssetPending})
+	}
+}
@@ -0,0 +1,509 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/assignments"
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+)
+
+type assignmentPayload struct {
+	Title              string     `json:"title" binding:"required"`
+	Description        string     `json:"description"`
+	TaskIDs            []uint     `json:"task_ids"`
+	LectureIDs         []uint     `json:"lecture_ids"`
+	OpensAt            *time.Time `json:"opens_at"` // now if empty
+	DueAt              time.Time  `json:"due_at" binding:"required"`
+	LatePolicy         string     `json:"late_policy"` // none (default), accept, penalty
+	LatePenaltyPercent int        `json:"late_penalty_percent"`
+	LateUntil          *time.Time `json:"late_until"`
+}
+
+// apply validates the payload and copies it into a, loading the tasks and
+// lectures. It returns a message for a 400 response.
+func (p *assignmentPayload) apply(a *models.Assignment) string {
+	if len(p.TaskIDs) == 0 && len(p.LectureIDs) == 0 {
+		return "add at least one task or lecture"
+	}
+	opens := time.Now()
+	if p.OpensAt != nil {
+		opens = *p.OpensAt
+	}
+	if !p.DueAt.After(opens) {
+		return "due_at must be after opens_at"
+	}
+	if p.LatePolicy == "" {
+		p.LatePolicy = assignments.LateNone
+	}
+	if !assignments.ValidPolicy(p.LatePolicy) {
+		return "late_policy must be none, accept or penalty"
+	}
+	if p.LatePenaltyPercent < 0 || p.LatePenaltyPercent > 100 {
+		return "late_penalty_percent must be between 0 and 100"
+	}
+	if p.LateUntil != nil && !p.LateUntil.After(p.DueAt) {
+		return "late_until must be after due_at"
+	}
+
+	var tasks []models.Task
+	if len(p.TaskIDs) > 0 {
+		db.Get().Where("id IN ?", p.TaskIDs).Find(&tasks)
+		if len(tasks) != len(uniqueIDs(p.TaskIDs)) {
+			return "unknown task in task_ids"
+		}
+		for _, t := range tasks {
+			if t.Status != models.StatusPublished {
+				return fmt.Sprintf("task %d in task_ids is not published", t.ID)
+			}
+		}
+	}
+	var lectures []models.Lecture
+	if len(p.LectureIDs) > 0 {
+		db.Get().Where("id IN ?", p.LectureIDs).Find(&lectures)
+		if len(lectures) != len(uniqueIDs(p.LectureIDs)) {
+			return "unknown lecture in lecture_ids"
+		}
+		for _, l := range lectures {
+			if l.Status != models.StatusPublished {
+				return fmt.Sprintf("lecture %d in lecture_ids is not published", l.ID)
+			}
+		}
+	}
+
+	a.Title, a.Description = p.Title, p.Description
+	a.OpensAt, a.DueAt = opens, p.DueAt
+	a.LatePolicy, a.LatePenaltyPercent, a.LateUntil = p.LatePolicy, p.LatePenaltyPercent, p.LateUntil
+	if a.LatePolicy == assignments.LateNone {
+		a.LateUntil = nil
+	}
+	a.Tasks, a.Lectures = tasks, lectures
+	return ""
+}
+
+func uniqueIDs(ids []uint) map[uint]bool {
+	set := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// assignmentView lists the assignment's tasks and lectures without their
+// content, answers or solutions
+func assignmentView(a *models.Assignment) gin.H {
+	tasks := make([]gin.H, len(a.Tasks))
+	for i, t := range a.Tasks {
+		tasks[i] = gin.H{"id": t.ID, "title": t.Title, "subject": t.Subject, "level": t.Level, "points": t.Points}
+	}
+	lectures := make([]gin.H, len(a.Lectures))
+	for i, l := range a.Lectures {
+		lectures[i] = gin.H{"id": l.ID, "title": l.Title, "subject": l.Subject}
+	}
+	return gin.H{
+		"id":                   a.ID,
+		"class_id":             a.ClassID,
+		"title":                a.Title,
+		"description":          a.Description,
+		"opens_at":             a.OpensAt,
+		"due_at":               a.DueAt,
+		"late_policy":          a.LatePolicy,
+		"late_penalty_percent": a.LatePenaltyPercent,
+		"late_until":           a.LateUntil,
+		"closes_at":            assignments.Closes(a),
+		"tasks":                tasks,
+		"lectures":             lectures,
+	}
+}
+
+// loadAssignment loads the assignment from the :id parameter with its tasks
+// and lectures, and tells whether the current user teaches its class. Students
+// of the class only see it once it is open. It writes the error response itself.
+func loadAssignment(c *gin.Context) (*models.Assignment, bool, bool) {
+	var a models.Assignment
+	err := db.Get().Preload("Class").Preload("Tasks", func(tx *gorm.DB) *gorm.DB { return tx.Order("id") }).
+		Preload("Lectures", func(tx *gorm.DB) *gorm.DB { return tx.Order("id") }).
+		First(&a, c.Param("id")).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "assignment not found"})
+			return nil, false, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return nil, false, false
+	}
+	if canTeach(c, &a.Class) {
+		return &a, true, true
+	}
+	uid, _ := c.Get("userID")
+	var n int64
+	db.Get().Model(&models.ClassMember{}).Where("class_id = ? AND user_id = ?", a.ClassID, uid).Count(&n)
+	if n == 0 || time.Now().Before(a.OpensAt) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "assignment not found"})
+		return nil, false, false
+	}
+	return &a, false, true
+}
+
+// CreateAssignment godoc
+// @Summary      Assign tasks and lectures to a class
+// @Description  Only published tasks and lectures can be assigned
+// @Tags         assignments
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int                true  "Class ID"
+// @Param        payload  body      assignmentPayload  true  "Assignment"
+// @Success      201      {object}  map[string]interface{}
+// @Failure      400      {object}  map[string]interface{}
+// @Router       /classes/{id}/assignments [post]
+func CreateAssignment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := loadTaughtClass(c)
+		if !ok {
+			return
+		}
+		var p assignmentPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		uid, _ := c.Get("userID")
+		a := models.Assignment{ClassID: class.ID, CreatedBy: uid.(uint)}
+		if msg := p.apply(&a); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		if err := db.Get().Create(&a).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
+			return
+		}
+		c.JSON(http.StatusCreated, assignmentView(&a))
+	}
+}
+
+// UpdateAssignment godoc
+// @Summary      Update an assignment
+// @Description  Only published tasks and lectures can be assigned
+// @Tags         assignments
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int                true  "Assignment ID"
+// @Param        payload  body      assignmentPayload  true  "Assignment"
+// @Success      200      {object}  map[string]interface{}
+// @Failure      400      {object}  map[string]interface{}
+// @Router       /assignments/{id} [put]
+func UpdateAssignment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a, teacher, ok := loadAssignment(c)
+		if !ok {
+			return
+		}
+		if !teacher {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not the teacher of this class"})
+			return
+		}
+		var p assignmentPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		oldDue := a.DueAt
+		if msg := p.apply(a); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		if !a.DueAt.Equal(oldDue) {
+			// A new deadline deserves a new reminder
+			a.ReminderSentAt = nil
+		}
+		err := db.Get().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Omit("Tasks", "Lectures", "Class").Save(a).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(a).Association("Tasks").Replace(a.Tasks); err != nil {
+				return err
+			}
+			return tx.Model(a).Association("Lectures").Replace(a.Lectures)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, assignmentView(a))
+	}
+}
+
+// DeleteAssignment godoc
+// @Summary      Delete an assignment
+// @Tags         assignments
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Assignment ID"
+// @Success      204
+// @Router       /assignments/{id} [delete]
+func DeleteAssignment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a, teacher, ok := loadAssignment(c)
+		if !ok {
+			return
+		}
+		if !teacher {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not the teacher of this class"})
+			return
+		}
+		if err := db.Get().Select("Tasks", "Lectures").Delete(a).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "delete failed"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// GetAssignment godoc
+// @Summary      Get an assignment with progress
+// @Description  The teacher gets every student's progress, a student gets their own
+// @Tags         assignments
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Assignment ID"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /assignments/{id} [get]
+func GetAssignment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a, teacher, ok := loadAssignment(c)
+		if !ok {
+			return
+		}
+		view := assignmentView(a)
+		if !teacher {
+			uid, _ := c.Get("userID")
+			progress, err := assignments.Compute(a, []uint{uid.(uint)}, time.Now())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+				return
+			}
+			view["progress"] = progress[uid.(uint)]
+			c.JSON(http.StatusOK, view)
+			return
+		}
+		members, err := classMembers(a.ClassID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		ids := make([]uint, len(members))
+		for i, m := range members {
+			ids[i] = m.ID
+		}
+		progress, err := assignments.Compute(a, ids, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		students := make([]gin.H, len(members))
+		for i, m := range members {
+			students[i] = gin.H{"student": m, "progress": progress[m.ID]}
+		}
+		view["students"] = students
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// ListClassAssignments godoc
+// @Summary      List a class's assignments
+// @Description  Students only see open assignments, each with their own status
+// @Tags         assignments
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Class ID"
+// @Success      200  {array}   map[string]interface{}
+// @Router       /classes/{id}/assignments [get]
+func ListClassAssignments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := loadClass(c)
+		if !ok {
+			return
+		}
+		uid, _ := c.Get("userID")
+		teacher := canTeach(c, class)
+		q := db.Get().Preload("Tasks").Preload("Lectures").Where("class_id = ?", class.ID).Order("due_at")
+		if !teacher {
+			var n int64
+			db.Get().Model(&models.ClassMember{}).Where("class_id = ? AND user_id = ?", class.ID, uid).Count(&n)
+			if n == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "class not found"})
+				return
+			}
+			q = q.Where("opens_at <= ?", time.Now())
+		}
+		var list []models.Assignment
+		if err := q.Find(&list).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		out, ok := assignmentSummaries(c, list, teacher)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// MyAssignments godoc
+// @Summary      My open assignments across all classes
+// @Tags         assignments
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}   map[string]interface{}
+// @Router       /assignments [get]
+func MyAssignments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, _ := c.Get("userID")
+		var list []models.Assignment
+		err := db.Get().Preload("Tasks").Preload("Lectures").
+			Where("class_id IN (SELECT class_id FROM class_members WHERE user_id = ?) AND opens_at <= ?", uid, time.Now()).
+			Order("due_at").Find(&list).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		out, ok := assignmentSummaries(c, list, false)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// assignmentSummaries adds the current student's status to each assignment,
+// or nothing for the teacher
+func assignmentSummaries(c *gin.Context, list []models.Assignment, teacher bool) ([]gin.H, bool) {
+	uid, _ := c.Get("userID")
+	now := time.Now()
+	out := make([]gin.H, len(list))
+	for i := range list {
+		a := &list[i]
+		view := assignmentView(a)
+		if !teacher {
+			progress, err := assignments.Compute(a, []uint{uid.(uint)}, now)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+				return nil, false
+			}
+			p := progress[uid.(uint)]
+			view["status"], view["score"] = p.Status, p.Score
+		}
+		out[i] = view
+	}
+	return out, true
+}
+
+// Gradebook godoc
+// @Summary      Class gradebook
+// @Description  Students × assignments matrix: cells[i][j] is students[i] on assignments[j]
+// @Tags         assignments
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Class ID"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /classes/{id}/gradebook [get]
+func Gradebook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := loadTaughtClass(c)
+		if !ok {
+			return
+		}
+		var list []models.Assignment
+		if err := db.Get().Preload("Tasks").Preload("Lectures").
+			Where("class_id = ?", class.ID).Order("due_at").Find(&list).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		members, err := classMembers(class.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		ids := make([]uint, len(members))
+		for i, m := range members {
+			ids[i] = m.ID
+		}
+
+		type cell struct {
+			Status string  `json:"status"`
+			Score  float64 `json:"score"`
+			Earned float64 `json:"earned"`
+		}
+		now := time.Now()
+		cells := make([][]cell, len(members))
+		for i := range cells {
+			cells[i] = make([]cell, len(list))
+		}
+		columns := make([]gin.H, len(list))
+		for j := range list {
+			a := &list[j]
+			progress, err := assignments.Compute(a, ids, now)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+				return
+			}
+			for i, m := range members {
+				p := progress[m.ID]
+				cells[i][j] = cell{Status: p.Status, Score: p.Score, Earned: p.Earned}
+			}
+			possible := 0
+			for _, t := range a.Tasks {
+				possible += t.Points
+			}
+			columns[j] = gin.H{"id": a.ID, "title": a.Title, "opens_at": a.OpensAt, "due_at": a.DueAt, "possible": possible}
+		}
+
+		// Average over the assignments already due, open ones would drag it down
+		rows := make([]gin.H, len(members))
+		for i, m := range members {
+			var sum float64
+			n := 0
+			for j := range list {
+				if now.After(list[j].DueAt) {
+					sum += cells[i][j].Score
+					n++
+				}
+			}
+			avg := 0.0
+			if n > 0 {
+				avg = sum / float64(n)
+			}
+			rows[i] = gin.H{"student": m, "average": avg}
+		}
+		c.JSON(http.StatusOK, gin.H{"class": class, "assignments": columns, "students": rows, "cells": cells})
+	}
+}
+
+// attemptEditable refuses to let a student change or delete an attempt that
+// counts towards an assignment of one of their classes, which would rewrite
+// the gradebook. Contest answers are ContestSubmissions and can't be touched
+// at all. It writes the error response itself.
+func attemptEditable(c *gin.Context, at *models.SolutionAttempt) bool {
+	var list []models.Assignment
+	err := db.Get().Joins("JOIN assignment_tasks ON assignment_tasks.assignment_id = assignments.id").
+		Where("assignment_tasks.task_id = ? AND assignments.opens_at <= ?", at.TaskID, at.CreatedAt).
+		Where("assignments.class_id IN (SELECT class_id FROM class_members WHERE user_id = ?)", at.UserID).
+		Find(&list).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return false
+	}
+	for i := range list {
+		if closes := assignments.Closes(&list[i]); closes == nil || !at.CreatedAt.After(*closes) {
+			c.JSON(http.StatusConflict, gin.H{"error": "the attempt counts towards the assignment \"" + list[i].Title + "\" and can't be changed"})
+			return false
+		}
+	}
+	return true
+}
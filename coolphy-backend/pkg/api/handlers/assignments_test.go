@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"coolphy-backend/pkg/models"
+)
+
+func TestAssignOnlyPublishedContent(t *testing.T) {
+	d := testDB(t)
+	teacher := newUser(t, d, "teacher@example.com", models.RoleTeacher)
+	class := models.Class{Name: "9A", TeacherID: teacher.ID, JoinCode: "AAAAAAAA"}
+	d.Create(&class)
+
+	published := models.Task{Title: "Speed", Status: models.StatusPublished}
+	draft := models.Task{Title: "Draft", Status: models.StatusDraft}
+	d.Create(&published)
+	d.Create(&draft)
+	lecture := models.Lecture{Title: "Motion", Status: models.StatusReview}
+	d.Create(&lecture)
+
+	create := func(body map[string]interface{}) (int, string) {
+		body["title"], body["due_at"] = "Homework", time.Now().Add(24*time.Hour)
+		w := serve(t, CreateAssignment(), http.MethodPost, "/classes/:id/assignments",
+			fmt.Sprintf("/classes/%d/assignments", class.ID), &teacher, body)
+		return w.Code, w.Body.String()
+	}
+	for _, body := range []map[string]interface{}{
+		{"task_ids": []uint{published.ID, draft.ID}},
+		{"task_ids": []uint{published.ID}, "lecture_ids": []uint{lecture.ID}},
+	} {
+		if code, out := create(body); code != http.StatusBadRequest || !strings.Contains(out, "not published") {
+			t.Errorf("assigning %v: status %d %s, want 400 not published", body, code, out)
+		}
+	}
+	var n int64
+	d.Model(&models.Assignment{}).Count(&n)
+	if n != 0 {
+		t.Errorf("%d assignments stored from rejected requests", n)
+	}
+	if code, out := create(map[string]interface{}{"task_ids": []uint{published.ID}}); code != http.StatusCreated {
+		t.Errorf("assigning a published task: status %d %s, want 201", code, out)
+	}
+}
@@ -13,11 +13,18 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"coolphy-backend/internal/config"
 	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/latex"
 	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/revisions"
+	"coolphy-backend/pkg/taskcheck"
+	"coolphy-backend/pkg/tikz"
 	"coolphy-backend/pkg/utils"
+	"coolphy-backend/pkg/workflow"
 )
 
 type registerPayload struct {
@@ -33,7 +40,7 @@ type loginPayload struct {
 
 // RegisterHandler godoc
 // @Summary      Register a new user
-// @Description  Create a user and return JWT token
+// @Description  Create a user and return an access token and a refresh token
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -58,18 +65,22 @@ func RegisterHandler(cfg config.Config) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "create user failed"})
 			return
 		}
-		token, err := utils.SignJWT(cfg.JWTSecret, u.ID, u.Role, 24*time.Hour)
+		if err := sendVerificationEmail(&u); err != nil {
+			log.Printf("Failed to create verification token: %v", err)
+		}
+		resp, err := startSession(c, cfg, &u)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "jwt error"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "session error"})
 			return
 		}
-		c.JSON(http.StatusCreated, gin.H{"token": token, "user": gin.H{"id": u.ID, "email": u.Email, "name": u.Name}})
+		resp["user"] = gin.H{"id": u.ID, "email": u.Email, "name": u.Name, "email_verified": false}
+		c.JSON(http.StatusCreated, resp)
 	}
 }
 
 // LoginHandler godoc
 // @Summary      Login
-// @Description  Returns JWT token for valid credentials
+// @Description  Returns an access token and a refresh token for valid credentials, or mfa_required and an mfa_token for /auth/login/2fa when 2FA is on
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -97,12 +108,27 @@ func LoginHandler(cfg config.Config) gin.HandlerFunc {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 			return
 		}
-		token, err := utils.SignJWT(cfg.JWTSecret, u.ID, u.Role, 24*time.Hour)
+		// With 2FA on, the password only earns a token for the second step
+		if u.TOTPEnabled {
+			mfaToken, err := utils.SignMFAPendingJWT(cfg.JWTSecret, u.ID, u.Role, mfaPendingTTL)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "jwt error"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": mfaToken, "expires_in": int(mfaPendingTTL.Seconds())})
+			return
+		}
+		resp, err := startSession(c, cfg, &u)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "jwt error"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "session error"})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"token": token, "user": gin.H{"id": u.ID, "email": u.Email, "name": u.Name}})
+		resp["user"] = gin.H{"id": u.ID, "email": u.Email, "name": u.Name, "email_verified": u.EmailVerifiedAt != nil}
+		if cfg.RequireAdmin2FA && u.Role == models.RoleAdmin {
+			// Admin routes stay closed until 2FA is set up
+			resp["mfa_enrollment_required"] = true
+		}
+		c.JSON(http.StatusOK, resp)
 	}
 }
 
@@ -130,6 +156,9 @@ func Profile() gin.HandlerFunc {
 			"points":   u.Points,
 			"subjects": u.Subjects,
 			"settings": u.Settings,
+			"email_verified": u.EmailVerifiedAt != nil,
+			"totp_enabled": u.TOTPEnabled,
+			"permissions": models.Permissions(u.Role),
 		})
 	}
 }
@@ -217,53 +246,7 @@ func ProfileStats() gin.HandlerFunc {
 			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 			return
 		}
-		var solvedCount int64
-		db.Get().Model(&models.SolutionAttempt{}).Where("user_id = ? AND status = ?", uid, "correct").Count(&solvedCount)
-		var totalAttempts int64
-		db.Get().Model(&models.SolutionAttempt{}).Where("user_id = ?", uid).Count(&totalAttempts)
-		
-		// Get subject-specific performance
-		type SubjectPerformance struct {
-			Subject        string `json:"subject"`
-			Correct        int64  `json:"correct"`
-			Total          int64  `json:"total"`
-			PointsEarned   int    `json:"points_earned"`
-			SuccessRate    float64 `json:"success_rate"`
-		}
-		var subjectPerf []SubjectPerformance
-		
-		rows, err := db.Get().Raw(`
-			SELECT 
-				t.subject,
-				COUNT(CASE WHEN sa.status = 'correct' THEN 1 END) as correct,
-				COUNT(*) as total,
-				COALESCE(SUM(sa.points_awarded), 0) as points_earned
-			FROM solution_attempts sa
-			JOIN tasks t ON sa.task_id = t.id
-			WHERE sa.user_id = ?
-			GROUP BY t.subject
-		`, uid).Rows()
-		
-		if err == nil {
-			defer rows.Close()
-			for rows.Next() {
-				var sp SubjectPerformance
-				if err := rows.Scan(&sp.Subject, &sp.Correct, &sp.Total, &sp.PointsEarned); err == nil {
-					if sp.Total > 0 {
-						sp.SuccessRate = float64(sp.Correct) / float64(sp.Total) * 100
-					}
-					subjectPerf = append(subjectPerf, sp)
-				}
-			}
-		}
-		
-		c.JSON(http.StatusOK, gin.H{
-			"points":              u.Points,
-			"solved_count":        solvedCount,
-			"total_attempts":      totalAttempts,
-			"subjects":            u.Subjects,
-			"subject_performance": subjectPerf,
-		})
+		c.JSON(http.StatusOK, userStats(&u))
 	}
 }
 
@@ -308,6 +291,11 @@ func ChangePassword() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
 			return
 		}
+		// Log out other devices, the current one stays signed in
+		sid, _ := c.Get("sessionID")
+		if err := revokeUserSessions(u.ID, sid.(uint)); err != nil {
+			log.Printf("Failed to revoke sessions: %v", err)
+		}
 		c.JSON(http.StatusOK, gin.H{"message": "password changed"})
 	}
 }
@@ -316,13 +304,21 @@ func ChangePassword() gin.HandlerFunc {
 // @Summary      List lectures
 // @Tags         lectures
 // @Produce      json
+// @Param        subject  query     string  false  "Subjects, comma-separated"
+// @Param        level    query     string  false  "Levels, comma-separated"
+// @Param        tags     query     string  false  "Tags, comma-separated (tags_match=any|all)"
+// @Param        topic_id query     int     false  "Topic, including subtopics"
+// @Param        sort     query     string  false  "Sort key, prefix with - for descending"
+// @Param        limit    query     int     false  "Page size"
+// @Param        cursor   query     string  false  "X-Next-Cursor of the previous page"
 // @Success      200  {array}   models.Lecture
+// @Header       200  {string}  X-Total-Count  "Number of matching lectures"
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, empty on the last one"
 // @Router       /lectures [get]
 func ListLectures() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var items []models.Lecture
-		if err := db.Get().Preload("VideoAsset").Limit(50).Order("id desc").Find(&items).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		if !findPage(c, workflow.Published(db.Get().Preload("VideoAsset")), lectureListSpec, &items) {
 			return
 		}
 		for i := range items {
@@ -344,7 +340,7 @@ func GetLecture() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		var item models.Lecture
-		if err := db.Get().Preload("VideoAsset").First(&item, id).Error; err != nil {
+		if err := visibleContent(c, db.Get().Preload("VideoAsset")).First(&item, id).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				c.JSON(http.StatusNotFound, gin.H{"error": "lecture not found"})
 				return
@@ -353,6 +349,7 @@ func GetLecture() gin.HandlerFunc {
 			return
 		}
 		attachVideoAssetURL(&item)
+		item.ContentHTML = latex.HTML(item.ContentLaTeX)
 		c.JSON(http.StatusOK, item)
 	}
 }
@@ -361,21 +358,40 @@ func GetLecture() gin.HandlerFunc {
 // @Summary      List tasks
 // @Tags         tasks
 // @Produce      json
+// @Param        subject  query     string  false  "Subjects, comma-separated"
+// @Param        level    query     string  false  "Levels, comma-separated"
+// @Param        type     query     string  false  "Task types, comma-separated"
+// @Param        tags     query     string  false  "Tags, comma-separated (tags_match=any|all)"
+// @Param        topic_id query     int     false  "Topic, including subtopics"
+// @Param        status   query     string  false  "Statuses, comma-separated"
+// @Param        sort     query     string  false  "Sort key, prefix with - for descending"
+// @Param        limit    query     int     false  "Page size"
+// @Param        cursor   query     string  false  "X-Next-Cursor of the previous page"
 // @Success      200  {array}   models.Task
+// @Header       200  {string}  X-Total-Count  "Number of matching tasks"
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, empty on the last one"
 // @Router       /tasks [get]
 func ListTasks() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var items []models.Task
-		if err := db.Get().Limit(50).Order("id desc").Find(&items).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		if !findPage(c, workflow.Published(db.Get()), taskListSpec, &items) {
 			return
 		}
+		locked := runningContestTasks()
+		for i := range items {
+			applyVariant(c, &items[i])
+			attachAnswerForm(&items[i])
+			if locked[items[i].ID] {
+				items[i].SolutionLaTeX, items[i].HintLaTeX = "", ""
+			}
+		}
 		c.JSON(http.StatusOK, items)
 	}
 }
 
 // GetTask godoc
 // @Summary      Get task by ID
+// @Description  Content editors also get correct_answer, answer_spec and answer_formula.
 // @Tags         tasks
 // @Produce      json
 // @Param        id   path      int  true  "Task ID"
@@ -386,7 +402,7 @@ func GetTask() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 		var item models.Task
-		if err := db.Get().First(&item, id).Error; err != nil {
+		if err := visibleContent(c, db.Get()).First(&item, id).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
 				return
@@ -394,10 +410,25 @@ func GetTask() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 			return
 		}
+		applyVariant(c, &item)
+		attachAnswerForm(&item)
+		hideContestSolutions(&item)
+		renderTaskHTML(&item)
+		if editsContent(c) {
+			c.JSON(http.StatusOK, editorTask(item))
+			return
+		}
 		c.JSON(http.StatusOK, item)
 	}
 }
 
+// renderTaskHTML fills in the HTML of the statement and solution, after the
+// student's parameter values went into the LaTeX
+func renderTaskHTML(task *models.Task) {
+	task.ContentHTML = latex.HTML(task.DescriptionLaTeX)
+	task.SolutionHTML = latex.HTML(task.SolutionLaTeX)
+}
+
 // ListTopics godoc
 // @Summary      List topics
 // @Tags         topics
@@ -455,10 +486,23 @@ func CreateLecture() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := db.Get().Create(&in).Error; err != nil {
+		if rejectLaTeX(c, latexField{"content_latex", in.ContentLaTeX}) {
+			return
+		}
+		// New content starts as a draft, see ChangeContentStatus
+		in.Status, in.ReviewerID, in.PublishAt, in.PublishedAt = models.StatusDraft, nil, nil, nil
+		err := db.Get().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&in).Error; err != nil {
+				return err
+			}
+			_, err := revisions.Record(tx, models.ContentLecture, in.ID, revisionAuthor(c), models.RevisionCreate, nil)
+			return err
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
 			return
 		}
+		tikz.Enqueue(in.ContentLaTeX)
 		if err := db.Get().Preload("VideoAsset").First(&in, in.ID).Error; err == nil {
 			attachVideoAssetURL(&in)
 		}
@@ -472,6 +516,7 @@ func CreateLecture() gin.HandlerFunc {
 // @Security     BearerAuth
 // @Accept       json
 // @Produce      json
+// @Description  Changes the content in place, whatever its status: edits to a published lecture are live at once. Only status changes go through review (see ChangeContentStatus); move the lecture back to draft to have an edit reviewed.
 // @Param        id       path      int             true  "Lecture ID"
 // @Param        lecture  body      models.Lecture  true  "Lecture"
 // @Success      200      {object}  models.Lecture
@@ -493,13 +538,29 @@ func UpdateLecture() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if rejectLaTeX(c, latexField{"content_latex", in.ContentLaTeX}) {
+			return
+		}
 		in.ID = existing.ID
-		if err := db.Get().Model(&existing).Updates(&in).Error; err != nil {
+		// The workflow fields only change through ChangeContentStatus
+		in.Status, in.ReviewerID, in.PublishAt, in.PublishedAt = "", nil, nil, nil
+		err := db.Get().Transaction(func(tx *gorm.DB) error {
+			if err := revisions.Baseline(tx, models.ContentLecture, existing.ID); err != nil {
+				return err
+			}
+			if err := tx.Model(&existing).Updates(&in).Error; err != nil {
+				return err
+			}
+			_, err := revisions.Record(tx, models.ContentLecture, existing.ID, revisionAuthor(c), models.RevisionUpdate, nil)
+			return err
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
 			return
 		}
 		if err := db.Get().Preload("VideoAsset").First(&existing, id).Error; err == nil {
 			attachVideoAssetURL(&existing)
+			tikz.Enqueue(existing.ContentLaTeX)
 		}
 		c.JSON(http.StatusOK, existing)
 	}
@@ -529,21 +590,39 @@ func DeleteLecture() gin.HandlerFunc {
 // @Security     BearerAuth
 // @Accept       json
 // @Produce      json
-// @Param        task  body      models.Task  true  "Task"
-// @Success      201   {object}  models.Task
+// @Param        task  body      taskPayload  true  "Task"
+// @Success      201   {object}  taskPayload
 // @Router       /admin/tasks [post]
 func CreateTask() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var in models.Task
-		if err := c.ShouldBindJSON(&in); err != nil {
+		var p taskPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if err := db.Get().Create(&in).Error; err != nil {
+		in := p.toTask()
+		if err := taskcheck.Validate(&in); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if rejectLaTeX(c, taskLaTeXFields(p)...) {
+			return
+		}
+		in.Status = models.StatusDraft // see ChangeContentStatus
+		err := db.Get().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&in).Error; err != nil {
+				return err
+			}
+			_, err := revisions.Record(tx, models.ContentTask, in.ID, revisionAuthor(c), models.RevisionCreate, nil)
+			return err
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
 			return
 		}
-		c.JSON(http.StatusCreated, in)
+		tikz.Enqueue(in.DescriptionLaTeX, in.SolutionLaTeX, in.HintLaTeX)
+		attachAnswerForm(&in)
+		c.JSON(http.StatusCreated, editorTask(in))
 	}
 }
 
@@ -554,8 +633,10 @@ func CreateTask() gin.HandlerFunc {
 // @Accept       json
 // @Produce      json
 // @Param        id    path      int          true  "Task ID"
-// @Param        task  body      models.Task  true  "Task"
-// @Success      200   {object}  models.Task
+// @Description  Fields left out or empty keep their stored values. The grading settings are checked on the task as it ends up. Changes the task in place, whatever its status: edits to a published task are live at once. Only status changes go through review (see ChangeContentStatus); move the task back to draft to have an edit reviewed.
+// @Param        task  body      taskPayload  true  "Task"
+// @Success      200   {object}  taskPayload
+// @Failure      400   {object}  map[string]interface{}
 // @Router       /tasks/{id} [put]
 func UpdateTask() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -569,17 +650,47 @@ func UpdateTask() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 			return
 		}
-		var in models.Task
-		if err := c.ShouldBindJSON(&in); err != nil {
+		var p taskPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if rejectLaTeX(c, taskLaTeXFields(p)...) {
+			return
+		}
+		in := p.toTask()
 		in.ID = existing.ID
-		if err := db.Get().Model(&existing).Updates(&in).Error; err != nil {
+		in.Status = "" // left alone by Updates
+		var updated models.Task
+		var invalid error
+		err := db.Get().Transaction(func(tx *gorm.DB) error {
+			if err := revisions.Baseline(tx, models.ContentTask, existing.ID); err != nil {
+				return err
+			}
+			if err := tx.Model(&existing).Updates(&in).Error; err != nil {
+				return err
+			}
+			// Check the merged task: a payload with only answer_spec must still fit the stored answer_type
+			if err := tx.First(&updated, existing.ID).Error; err != nil {
+				return err
+			}
+			if invalid = taskcheck.Validate(&updated); invalid != nil {
+				return invalid
+			}
+			_, err := revisions.Record(tx, models.ContentTask, existing.ID, revisionAuthor(c), models.RevisionUpdate, nil)
+			return err
+		})
+		if invalid != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Error()})
+			return
+		}
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
 			return
 		}
-		c.JSON(http.StatusOK, in)
+		tikz.Enqueue(updated.DescriptionLaTeX, updated.SolutionLaTeX, updated.HintLaTeX)
+		attachAnswerForm(&updated)
+		c.JSON(http.StatusOK, editorTask(updated))
 	}
 }
 
@@ -685,6 +796,7 @@ type solvePayload struct {
 	Answer       string `json:"answer" binding:"required"`
 	SolutionText string `json:"solution_text"`
 	TimeSpent    int    `json:"time_spent"`
+	Language     string `json:"language"` // code tasks: python, cpp, c, go, pascal
 }
 
 // SolveTask godoc
@@ -706,73 +818,44 @@ func SolveTask() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		// Verify task exists
+		// Verify task exists and is published
 		var task models.Task
-		if err := db.Get().First(&task, taskID).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		if !findVisible(c, &task, taskID, "task") {
+			return
+		}
+		if inRunningContest(task.ID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "the task is part of a running contest"})
 			return
 		}
 		
-		// Evaluate answer using AI
-		isCorrect := false
-		feedback := "Your answer has been submitted."
+		if task.AnswerType == grading.AnswerCode {
+			submitCode(c, &task, userID.(uint), p)
+			return
+		}
+
+		// Grade parametrized tasks against this student's own numbers
+		applyVariant(c, &task)
+		// Check against the stored correct answer first, the LLM is only a fallback
+		result := gradeAnswer(c.Request.Context(), &task, p.Answer)
+		isCorrect := result.Status == grading.StatusCorrect
+		feedback := result.Feedback
 		pointsAwarded := 0
-		status := "incorrect"
-		
-		// Get AI settings
-		settings, err := getOrCreateSettings()
-		if err == nil && settings.OpenRouterAPIKey != "" {
-			// Use AI to evaluate
-			prompt := fmt.Sprintf(`You are evaluating a student's answer to a physics/math problem.
-
-Problem: %s
-
-Correct Solution: %s
-
-Student's Answer: %s
-
-Evaluate if the student's answer is correct. Respond in JSON format:
-{
-  "is_correct": true/false,
-  "feedback": "brief explanation",
-  "score_percentage": 0-100
-}`, task.DescriptionLaTeX, task.SolutionLaTeX, p.Answer)
-			
-			client := utils.NewOpenRouterClient(settings.OpenRouterAPIKey, settings.PrimaryModel, settings.FallbackModel)
-			messages := []utils.OpenRouterMessage{
-				{Role: "system", Content: "You are an expert teacher evaluating student work. Be fair but strict."},
-				{Role: "user", Content: prompt},
-			}
-			
-			aiResponse, err := client.Chat(messages)
-			if err == nil {
-				// Parse AI response
-				var evalResult struct {
-					IsCorrect       bool   `json:"is_correct"`
-					Feedback        string `json:"feedback"`
-					ScorePercentage int    `json:"score_percentage"`
-				}
-				if err := json.Unmarshal([]byte(aiResponse), &evalResult); err == nil {
-					isCorrect = evalResult.IsCorrect
-					feedback = evalResult.Feedback
-					if isCorrect {
-						status = "correct"
-						pointsAwarded = task.Points
-						// Award points to user
-						var user models.User
-						if err := db.Get().First(&user, userID).Error; err == nil {
-							user.Points += task.Points
-							db.Get().Save(&user)
-						}
-					}
-				}
+		status := string(result.Status)
+		if !result.Decided() {
+			// Nobody could grade it, leave it for review
+			status = "pending"
+		}
+		if result.Score > 0 {
+			// Partly correct structured answers earn their share of the points
+			pointsAwarded = task.Points * result.Score / 100
+			// Award points to user
+			var user models.User
+			if err := db.Get().First(&user, userID).Error; err == nil {
+				user.Points += pointsAwarded
+				db.Get().Save(&user)
 			}
 		}
-		
+
 		attempt := models.SolutionAttempt{
 			UserID:        userID.(uint),
 			TaskID:        task.ID,
@@ -811,8 +894,12 @@ func GetTaskSolutions() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		taskID := c.Param("id")
 		userID, _ := c.Get("userID")
+		var task models.Task
+		if !findVisible(c, &task, taskID, "task") {
+			return
+		}
 		var attempts []models.SolutionAttempt
-		if err := db.Get().Where("task_id = ? AND user_id = ?", taskID, userID).Order("created_at desc").Find(&attempts).Error; err != nil {
+		if err := db.Get().Where("task_id = ? AND user_id = ?", task.ID, userID).Order("created_at desc").Find(&attempts).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 			return
 		}
@@ -825,14 +912,18 @@ func GetTaskSolutions() gin.HandlerFunc {
 // @Tags         solutions
 // @Security     BearerAuth
 // @Produce      json
+// @Param        sort     query     string  false  "Sort key (id, created_at, points_awarded), prefix with - for descending; -created_at by default"
+// @Param        limit    query     int     false  "Page size"
+// @Param        cursor   query     string  false  "X-Next-Cursor of the previous page"
 // @Success      200  {array}   models.SolutionAttempt
+// @Header       200  {string}  X-Total-Count  "Number of matching solution attempts"
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, empty on the last one"
 // @Router       /solutions [get]
 func ListSolutions() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _ := c.Get("userID")
 		var attempts []models.SolutionAttempt
-		if err := db.Get().Where("user_id = ?", userID).Order("created_at desc").Limit(100).Find(&attempts).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		if !findPage(c, db.Get().Where("user_id = ?", userID), solutionListSpec, &attempts) {
 			return
 		}
 		c.JSON(http.StatusOK, attempts)
@@ -857,8 +948,12 @@ func GetLectureNotes() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		lectureID := c.Param("id")
 		userID, _ := c.Get("userID")
+		var lecture models.Lecture
+		if !findVisible(c, &lecture, lectureID, "lecture") {
+			return
+		}
 		var notes []models.Note
-		if err := db.Get().Where("lecture_id = ? AND user_id = ?", lectureID, userID).Order("created_at desc").Find(&notes).Error; err != nil {
+		if err := db.Get().Where("lecture_id = ? AND user_id = ?", lecture.ID, userID).Order("created_at desc").Find(&notes).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 			return
 		}
@@ -885,14 +980,9 @@ func CreateLectureNote() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		// Verify lecture exists
+		// Verify lecture exists and is published
 		var lecture models.Lecture
-		if err := db.Get().First(&lecture, lectureID).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				c.JSON(http.StatusNotFound, gin.H{"error": "lecture not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		if !findVisible(c, &lecture, lectureID, "lecture") {
 			return
 		}
 		note := models.Note{
@@ -915,13 +1005,17 @@ func CreateLectureNote() gin.HandlerFunc {
 // @Tags         admin
 // @Security     BearerAuth
 // @Produce      json
+// @Param        sort     query     string  false  "Sort key (id, created_at, points, name, email), prefix with - for descending; -created_at by default"
+// @Param        limit    query     int     false  "Page size"
+// @Param        cursor   query     string  false  "X-Next-Cursor of the previous page"
 // @Success      200  {array}   models.User
+// @Header       200  {string}  X-Total-Count  "Number of matching users"
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, empty on the last one"
 // @Router       /users [get]
 func ListUsers() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var users []models.User
-		if err := db.Get().Select("id, email, name, role, points, created_at").Limit(100).Order("created_at desc").Find(&users).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		if !findPage(c, db.Get(), userListSpec, &users) {
 			return
 		}
 		c.JSON(http.StatusOK, users)
@@ -952,29 +1046,31 @@ func GetUser() gin.HandlerFunc {
 	}
 }
 
+type updateUserPayload struct {
+	Name     string   `json:"name"`
+	Subjects []string `json:"subjects"`
+	Role     *string  `json:"role"`
+}
+
 // UpdateUser godoc
 // @Summary      Update user (admin)
+// @Description  Changing role needs the roles.assign permission; users with permissions the caller lacks can't be edited
 // @Tags         admin
 // @Security     BearerAuth
 // @Accept       json
 // @Produce      json
-// @Param        id    path      int                   true  "User ID"
-// @Param        user  body      updateProfilePayload  true  "User data"
+// @Param        id    path      int                true  "User ID"
+// @Param        user  body      updateUserPayload  true  "User data"
 // @Success      200   {object}  models.User
+// @Failure      403   {object}  map[string]interface{}
 // @Router       /users/{id} [put]
 func UpdateUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		var existing models.User
-		if err := db.Get().First(&existing, id).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		existing, ok := loadManagedUser(c)
+		if !ok {
 			return
 		}
-		var p updateProfilePayload
+		var p updateUserPayload
 		if err := c.ShouldBindJSON(&p); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -985,10 +1081,25 @@ func UpdateUser() gin.HandlerFunc {
 		if p.Subjects != nil {
 			existing.Subjects = p.Subjects
 		}
-		if err := db.Get().Save(&existing).Error; err != nil {
+		roleChanged := false
+		if p.Role != nil && *p.Role != existing.Role {
+			if err := checkRoleChange(c, existing, *p.Role); err != nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			existing.Role = *p.Role
+			roleChanged = true
+		}
+		if err := db.Get().Save(existing).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
 			return
 		}
+		if roleChanged {
+			// Access tokens carry the role, make the user log in again to pick up the new one
+			if err := revokeUserSessions(existing.ID, 0); err != nil {
+				log.Printf("Failed to revoke sessions: %v", err)
+			}
+		}
 		c.JSON(http.StatusOK, existing)
 	}
 }
@@ -999,14 +1110,21 @@ func UpdateUser() gin.HandlerFunc {
 // @Security     BearerAuth
 // @Param        id   path      int  true  "User ID"
 // @Success      204
+// @Failure      403  {object}  map[string]interface{}
 // @Router       /users/{id} [delete]
 func DeleteUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		if err := db.Get().Delete(&models.User{}, id).Error; err != nil {
+		u, ok := loadManagedUser(c)
+		if !ok {
+			return
+		}
+		if err := db.Get().Delete(u).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "delete failed"})
 			return
 		}
+		if err := db.Get().Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", u.ID).Update("revoked_at", time.Now()).Error; err != nil {
+			log.Printf("Failed to revoke sessions: %v", err)
+		}
 		c.Status(http.StatusNoContent)
 	}
 }
@@ -1018,14 +1136,18 @@ func DeleteUser() gin.HandlerFunc {
 // @Tags         notifications
 // @Security     BearerAuth
 // @Produce      json
+// @Param        sort     query     string  false  "Sort key (id, created_at), prefix with - for descending; -created_at by default"
+// @Param        limit    query     int     false  "Page size"
+// @Param        cursor   query     string  false  "X-Next-Cursor of the previous page"
 // @Success      200  {array}   models.Notification
+// @Header       200  {string}  X-Total-Count  "Number of matching notifications"
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, empty on the last one"
 // @Router       /notifications [get]
 func ListNotifications() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _ := c.Get("userID")
 		var notifications []models.Notification
-		if err := db.Get().Where("user_id = ?", userID).Order("created_at desc").Limit(50).Find(&notifications).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		if !findPage(c, db.Get().Where("user_id = ?", userID), notificationListSpec, &notifications) {
 			return
 		}
 		c.JSON(http.StatusOK, notifications)
@@ -1103,14 +1225,18 @@ func ProfessorChat() gin.HandlerFunc {
 // @Tags         professor
 // @Security     BearerAuth
 // @Produce      json
+// @Param        sort     query     string  false  "Sort key (id, timestamp), prefix with - for descending; -timestamp by default"
+// @Param        limit    query     int     false  "Page size"
+// @Param        cursor   query     string  false  "X-Next-Cursor of the previous page"
 // @Success      200  {array}   models.ChatMessage
+// @Header       200  {string}  X-Total-Count  "Number of matching messages"
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, empty on the last one"
 // @Router       /professor-chat/history [get]
 func ChatHistory() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _ := c.Get("userID")
 		var messages []models.ChatMessage
-		if err := db.Get().Where("user_id = ?", userID).Order("timestamp desc").Limit(50).Find(&messages).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		if !findPage(c, db.Get().Where("user_id = ?", userID), chatListSpec, &messages) {
 			return
 		}
 		c.JSON(http.StatusOK, messages)
@@ -1199,14 +1325,18 @@ func Achievements() gin.HandlerFunc {
 // @Tags         history
 // @Security     BearerAuth
 // @Produce      json
+// @Param        sort     query     string  false  "Sort key (id, created_at, points_awarded), prefix with - for descending; -created_at by default"
+// @Param        limit    query     int     false  "Page size"
+// @Param        cursor   query     string  false  "X-Next-Cursor of the previous page"
 // @Success      200  {array}   models.SolutionAttempt
+// @Header       200  {string}  X-Total-Count  "Number of matching solution attempts"
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, empty on the last one"
 // @Router       /history/tasks [get]
 func TaskHistory() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _ := c.Get("userID")
 		var attempts []models.SolutionAttempt
-		if err := db.Get().Where("user_id = ?", userID).Order("created_at desc").Limit(100).Find(&attempts).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		if !findPage(c, db.Get().Where("user_id = ?", userID), solutionListSpec, &attempts) {
 			return
 		}
 		c.JSON(http.StatusOK, attempts)
@@ -1218,14 +1348,18 @@ func TaskHistory() gin.HandlerFunc {
 // @Tags         history
 // @Security     BearerAuth
 // @Produce      json
+// @Param        sort     query     string  false  "Sort key (id, created_at), prefix with - for descending; -created_at by default"
+// @Param        limit    query     int     false  "Page size"
+// @Param        cursor   query     string  false  "X-Next-Cursor of the previous page"
 // @Success      200  {array}   models.Note
+// @Header       200  {string}  X-Total-Count  "Number of matching notes"
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, empty on the last one"
 // @Router       /history/lectures [get]
 func LectureHistory() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _ := c.Get("userID")
 		var notes []models.Note
-		if err := db.Get().Where("user_id = ?", userID).Order("created_at desc").Limit(100).Find(&notes).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		if !findPage(c, db.Get().Where("user_id = ?", userID), noteListSpec, &notes) {
 			return
 		}
 		c.JSON(http.StatusOK, notes)
@@ -1286,13 +1420,17 @@ func AdminDashboard() gin.HandlerFunc {
 // @Tags         admin
 // @Security     BearerAuth
 // @Produce      json
+// @Param        sort     query     string  false  "Sort key (id, created_at, updated_at, view_count, level, title), prefix with - for descending; -created_at by default"
+// @Param        limit    query     int     false  "Page size"
+// @Param        cursor   query     string  false  "X-Next-Cursor of the previous page"
 // @Success      200  {array}   models.Lecture
+// @Header       200  {string}  X-Total-Count  "Number of matching lectures"
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, empty on the last one"
 // @Router       /admin/lectures [get]
 func AdminLectures() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var lectures []models.Lecture
-		if err := db.Get().Preload("VideoAsset").Order("created_at desc").Limit(100).Find(&lectures).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		if !findPage(c, db.Get().Preload("VideoAsset"), adminSpec(lectureListSpec), &lectures) {
 			return
 		}
 		for i := range lectures {
@@ -1307,16 +1445,25 @@ func AdminLectures() gin.HandlerFunc {
 // @Tags         admin
 // @Security     BearerAuth
 // @Produce      json
-// @Success      200  {array}   models.Task
+// @Param        sort     query     string  false  "Sort key (id, created_at, updated_at, points, level, title), prefix with - for descending; -created_at by default"
+// @Param        limit    query     int     false  "Page size"
+// @Param        cursor   query     string  false  "X-Next-Cursor of the previous page"
+// @Success      200  {array}   taskPayload
+// @Header       200  {string}  X-Total-Count  "Number of matching tasks"
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, empty on the last one"
 // @Router       /admin/tasks [get]
 func AdminTasks() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var tasks []models.Task
-		if err := db.Get().Order("created_at desc").Limit(100).Find(&tasks).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		if !findPage(c, db.Get(), adminSpec(taskListSpec), &tasks) {
 			return
 		}
-		c.JSON(http.StatusOK, tasks)
+		out := make([]taskPayload, len(tasks))
+		for i := range tasks {
+			attachAnswerForm(&tasks[i])
+			out[i] = editorTask(tasks[i])
+		}
+		c.JSON(http.StatusOK, out)
 	}
 }
 
@@ -1350,20 +1497,6 @@ func Ping() gin.HandlerFunc {
 	}
 }
 
-// Logout godoc
-// @Summary      User logout (JWT stateless - client-side token removal)
-// @Tags         auth
-// @Security     BearerAuth
-// @Produce      json
-// @Success      200  {object}  map[string]interface{}
-// @Router       /auth/logout [post]
-func Logout() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// JWT is stateless, so logout is handled client-side by removing token
-		c.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
-	}
-}
-
 // PasswordReset godoc
 // @Summary      Request password reset email
 // @Tags         auth
@@ -1474,6 +1607,11 @@ func PasswordResetConfirm() gin.HandlerFunc {
 			log.Printf("Failed to mark token as used: %v", err)
 		}
 
+		// Whoever had the old password is logged out everywhere
+		if err := revokeUserSessions(user.ID, 0); err != nil {
+			log.Printf("Failed to revoke sessions: %v", err)
+		}
+
 		c.JSON(http.StatusOK, gin.H{"message": "password reset successfully"})
 	}
 }
@@ -1489,12 +1627,17 @@ func PasswordResetConfirm() gin.HandlerFunc {
 func CompleteLecture() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var lect models.Lecture
-		if err := db.Get().First(&lect, c.Param("id")).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "lecture not found"})
+		if !findVisible(c, &lect, c.Param("id"), "lecture") {
 			return
 		}
 		// Record completion by incrementing view count
 		db.Get().Model(&lect).Update("view_count", lect.ViewCount+1)
+		// and per user for homework; the first completion is the one that counts
+		uid, _ := c.Get("userID")
+		completion := models.LectureCompletion{UserID: uid.(uint), LectureID: lect.ID, CompletedAt: time.Now()}
+		if err := db.Get().Clauses(clause.OnConflict{DoNothing: true}).Create(&completion).Error; err != nil {
+			log.Printf("Failed to record lecture completion: %v", err)
+		}
 		c.JSON(http.StatusOK, gin.H{"message": "lecture marked as complete"})
 	}
 }
@@ -1543,35 +1686,17 @@ func buildTopicTree(topics []models.Topic) []map[string]interface{} {
 
 // UpdateTaskStatus godoc
 // @Summary      Update task status
+// @Description  Same as PUT /admin/tasks/{id}/status, kept for older clients
 // @Tags         tasks
 // @Security     BearerAuth
 // @Accept       json
 // @Produce      json
-// @Param        id    path      int                 true  "Task ID"
-// @Param        body  body      map[string]string   true  "Status"
-// @Success      200   {object}  models.Task
+// @Param        id    path      int               true  "Task ID"
+// @Param        body  body      workflow.Request  true  "Status"
+// @Success      200   {object}  workflow.State
 // @Router       /tasks/{id}/status [put]
 func UpdateTaskStatus() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var req struct {
-			Status string `json:"status" binding:"required"`
-		}
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
-			return
-		}
-		var task models.Task
-		if err := db.Get().First(&task, c.Param("id")).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
-			return
-		}
-		task.Status = req.Status
-		if err := db.Get().Save(&task).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update"})
-			return
-		}
-		c.JSON(http.StatusOK, task)
-	}
+	return ChangeContentStatus(models.ContentTask)
 }
 
 // GetSolution godoc
@@ -1594,6 +1719,11 @@ func GetSolution() gin.HandlerFunc {
 	}
 }
 
+// solutionUpdate is what a student may change in their own attempt
+type solutionUpdate struct {
+	Answer string `json:"answer"`
+}
+
 // UpdateSolution godoc
 // @Summary      Update solution attempt
 // @Tags         solutions
@@ -1601,8 +1731,10 @@ func GetSolution() gin.HandlerFunc {
 // @Accept       json
 // @Produce      json
 // @Param        id    path      int                        true  "Solution ID"
-// @Param        body  body      models.SolutionAttempt     true  "Solution data"
+// @Description  Only the answer text can be changed; the status comes from grading. Attempts that count towards an assignment can't be changed.
+// @Param        body  body      solutionUpdate             true  "Solution data"
 // @Success      200   {object}  models.SolutionAttempt
+// @Failure      409   {object}  map[string]interface{}
 // @Router       /solutions/{id} [put]
 func UpdateSolution() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -1612,13 +1744,15 @@ func UpdateSolution() gin.HandlerFunc {
 			c.JSON(http.StatusNotFound, gin.H{"error": "solution not found"})
 			return
 		}
-		var req models.SolutionAttempt
+		var req solutionUpdate
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
 			return
 		}
+		if !attemptEditable(c, &attempt) {
+			return
+		}
 		attempt.Answer = req.Answer
-		attempt.Status = req.Status
 		if err := db.Get().Save(&attempt).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update"})
 			return
@@ -1634,6 +1768,7 @@ func UpdateSolution() gin.HandlerFunc {
 // @Produce      json
 // @Param        id   path      int  true  "Solution ID"
 // @Success      200  {object}  map[string]interface{}
+// @Failure      409  {object}  map[string]interface{}
 // @Router       /solutions/{id} [delete]
 func DeleteSolution() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -1643,6 +1778,9 @@ func DeleteSolution() gin.HandlerFunc {
 			c.JSON(http.StatusNotFound, gin.H{"error": "solution not found"})
 			return
 		}
+		if !attemptEditable(c, &attempt) {
+			return
+		}
 		if err := db.Get().Delete(&attempt).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete"})
 			return
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"archive/zip"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"coolphy-backend/internal/config"
+	"coolphy-backend/pkg/bundle"
+	"coolphy-backend/pkg/db"
+)
+
+const maxBundleSize = int64(4 << 30) // 4 GiB, videos included
+
+// idList parses a comma separated list of IDs
+func idList(s string) ([]uint, error) {
+	var ids []uint
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// ExportBundle godoc
+// @Summary      Export lectures, tasks and topics as a bundle
+// @Description  A zip with manifest.json, the LaTeX as .tex files, lecture videos and compiled diagrams. Without filters everything is exported; the tasks of exported lectures and the topics of everything, with their ancestors, are always included.
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      application/zip
+// @Param        subject      query     string  false  "Comma separated subjects"
+// @Param        topic_id     query     int     false  "Topic, with its subtopics"
+// @Param        lecture_ids  query     string  false  "Comma separated lecture IDs"
+// @Param        task_ids     query     string  false  "Comma separated task IDs"
+// @Param        videos       query     bool    false  "false leaves video files out"
+// @Success      200          {file}    file
+// @Router       /admin/export [get]
+func ExportBundle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var sel bundle.Selection
+		for _, s := range strings.Split(c.Query("subject"), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				sel.Subjects = append(sel.Subjects, s)
+			}
+		}
+		if v := c.Query("topic_id"); v != "" {
+			id, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid topic_id"})
+				return
+			}
+			topicID := uint(id)
+			sel.TopicID = &topicID
+		}
+		var err error
+		if sel.LectureIDs, err = idList(c.Query("lecture_ids")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid lecture_ids"})
+			return
+		}
+		if sel.TaskIDs, err = idList(c.Query("task_ids")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid task_ids"})
+			return
+		}
+		sel.NoVideos = c.Query("videos") == "false"
+
+		// Build it on disk first so a failure is still an error response
+		tmp, err := os.CreateTemp("", "coolphy-bundle-*.zip")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "storage error"})
+			return
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		now := time.Now()
+		if _, err := bundle.Export(tmp, sel, now); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "export failed"})
+			return
+		}
+		c.Header("Content-Type", "application/zip")
+		c.FileAttachment(tmp.Name(), "coolphy-bundle-"+now.Format("20060102")+".zip")
+	}
+}
+
+// ImportBundle godoc
+// @Summary      Import a bundle made by export
+// @Description  IDs are remapped and the links between topics, lectures and tasks rebuilt. strategy decides about content that exists already (same subject and title): skip (default), overwrite or duplicate. dry_run reports what would happen without changing anything. New content arrives as drafts unless an admin asks for keep_status.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        bundle       formData  file    true   "Bundle zip"
+// @Param        strategy     formData  string  false  "skip, overwrite or duplicate"
+// @Param        dry_run      formData  bool    false  "Only report"
+// @Param        keep_status  formData  bool    false  "Keep published and archived statuses (admins)"
+// @Success      200          {object}  bundle.Report
+// @Router       /admin/import [post]
+func ImportBundle(cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBundleSize)
+		if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid upload payload"})
+			return
+		}
+		fh, err := c.FormFile("bundle")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bundle is required"})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "storage error"})
+			return
+		}
+		defer f.Close()
+		zr, err := zip.NewReader(f, fh.Size)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bundle is not a zip file"})
+			return
+		}
+
+		actor := workflowActor(c)
+		opts := bundle.Options{
+			Strategy:   c.PostForm("strategy"),
+			DryRun:     c.PostForm("dry_run") == "true",
+			AuthorID:   actor.UserID,
+			KeepStatus: actor.Admin && c.PostForm("keep_status") == "true",
+			VideoPath: func(ext string) (string, error) {
+				if _, ok := allowedVideoExtensions[ext]; !ok {
+					return "", errors.New("unsupported video format")
+				}
+				return buildDestinationPath(cfg.UploadDir, ext)
+			},
+		}
+		switch opts.Strategy {
+		case "", bundle.StrategySkip, bundle.StrategyOverwrite, bundle.StrategyDuplicate:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "strategy must be skip, overwrite or duplicate"})
+			return
+		}
+		report, err := bundle.Import(db.Get(), zr, opts)
+		if err != nil {
+			if errors.Is(err, bundle.ErrFormat) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "import failed"})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,549 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/utils"
+)
+
+const joinCodeLength = 8
+
+type classPayload struct {
+	Name        string `json:"name" binding:"required,min=2"`
+	Description string `json:"description"`
+	Subject     string `json:"subject"`
+}
+
+// classMemberView is a student as the teacher sees them in a class
+type classMemberView struct {
+	ID       uint      `json:"id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Points   int       `json:"points"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+func newJoinCode() (string, error) {
+	return utils.RandomCode(joinCodeLength)
+}
+
+// canTeach reports whether the current user runs the class. Admins can see
+// every class.
+func canTeach(c *gin.Context, class *models.Class) bool {
+	uid, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	return class.TeacherID == uid.(uint) || role == models.RoleAdmin
+}
+
+// loadClass loads the class from the :id parameter. It writes the error
+// response itself.
+func loadClass(c *gin.Context) (*models.Class, bool) {
+	var class models.Class
+	if err := db.Get().First(&class, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "class not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return nil, false
+	}
+	return &class, true
+}
+
+// loadTaughtClass is loadClass for endpoints only the class's teacher may use
+func loadTaughtClass(c *gin.Context) (*models.Class, bool) {
+	class, ok := loadClass(c)
+	if !ok {
+		return nil, false
+	}
+	if !canTeach(c, class) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not the teacher of this class"})
+		return nil, false
+	}
+	return class, true
+}
+
+// loadClassStudent loads the class and checks that :user_id is one of its
+// students, for the teacher's per-student views
+func loadClassStudent(c *gin.Context) (*models.Class, *models.User, bool) {
+	class, ok := loadTaughtClass(c)
+	if !ok {
+		return nil, nil, false
+	}
+	var u models.User
+	err := db.Get().Joins("JOIN class_members cm ON cm.user_id = users.id AND cm.class_id = ?", class.ID).
+		First(&u, c.Param("user_id")).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "student not found in this class"})
+		return nil, nil, false
+	}
+	return class, &u, true
+}
+
+func classMembers(classID uint) ([]classMemberView, error) {
+	members := []classMemberView{}
+	err := db.Get().Table("class_members cm").
+		Select("u.id, u.name, u.email, u.points, cm.joined_at").
+		Joins("JOIN users u ON u.id = cm.user_id").
+		Where("cm.class_id = ?", classID).
+		Order("u.name").Scan(&members).Error
+	return members, err
+}
+
+// CreateClass godoc
+// @Summary      Create a class
+// @Tags         classes
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      classPayload  true  "Class"
+// @Success      201      {object}  models.Class
+// @Router       /classes [post]
+func CreateClass() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, _ := c.Get("userID")
+		var p classPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		code, err := newJoinCode()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate join code"})
+			return
+		}
+		class := models.Class{Name: p.Name, Description: p.Description, Subject: p.Subject, TeacherID: uid.(uint), JoinCode: code}
+		if err := db.Get().Create(&class).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
+			return
+		}
+		c.JSON(http.StatusCreated, class)
+	}
+}
+
+// ListClasses godoc
+// @Summary      List my classes
+// @Description  Classes the user teaches and classes they are a student in
+// @Tags         classes
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Router       /classes [get]
+func ListClasses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, _ := c.Get("userID")
+		var owned []models.Class
+		if err := db.Get().Where("teacher_id = ?", uid).Order("name").Find(&owned).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		var counts []struct {
+			ClassID uint
+			N       int64
+		}
+		db.Get().Model(&models.ClassMember{}).Select("class_id, COUNT(*) AS n").
+			Where("class_id IN (SELECT id FROM classes WHERE teacher_id = ?)", uid).
+			Group("class_id").Scan(&counts)
+		memberCount := map[uint]int64{}
+		for _, r := range counts {
+			memberCount[r.ClassID] = r.N
+		}
+		teaching := make([]gin.H, len(owned))
+		for i, cl := range owned {
+			teaching[i] = gin.H{"class": cl, "member_count": memberCount[cl.ID]}
+		}
+		studying := []gin.H{}
+		var joined []models.Class
+		if err := db.Get().Preload("Teacher").
+			Joins("JOIN class_members cm ON cm.class_id = classes.id AND cm.user_id = ?", uid).
+			Order("classes.name").Find(&joined).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		for _, cl := range joined {
+			studying = append(studying, studentClassView(&cl))
+		}
+		c.JSON(http.StatusOK, gin.H{"teaching": teaching, "studying": studying})
+	}
+}
+
+// studentClassView is what a student sees of a class: no join code, no classmates
+func studentClassView(class *models.Class) gin.H {
+	return gin.H{
+		"id":           class.ID,
+		"name":         class.Name,
+		"description":  class.Description,
+		"subject":      class.Subject,
+		"teacher_id":   class.TeacherID,
+		"teacher_name": class.Teacher.Name,
+	}
+}
+
+// GetClass godoc
+// @Summary      Get a class
+// @Description  The teacher gets the join code and the students, a student gets the class info
+// @Tags         classes
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Class ID"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /classes/{id} [get]
+func GetClass() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := loadClass(c)
+		if !ok {
+			return
+		}
+		if canTeach(c, class) {
+			members, err := classMembers(class.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"class": class, "members": members})
+			return
+		}
+		uid, _ := c.Get("userID")
+		var n int64
+		db.Get().Model(&models.ClassMember{}).Where("class_id = ? AND user_id = ?", class.ID, uid).Count(&n)
+		if n == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "class not found"})
+			return
+		}
+		db.Get().First(&class.Teacher, class.TeacherID)
+		c.JSON(http.StatusOK, studentClassView(class))
+	}
+}
+
+// UpdateClass godoc
+// @Summary      Update a class
+// @Tags         classes
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int           true  "Class ID"
+// @Param        payload  body      classPayload  true  "Class"
+// @Success      200      {object}  models.Class
+// @Router       /classes/{id} [put]
+func UpdateClass() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := loadTaughtClass(c)
+		if !ok {
+			return
+		}
+		var p classPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		class.Name, class.Description, class.Subject = p.Name, p.Description, p.Subject
+		if err := db.Get().Save(class).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, class)
+	}
+}
+
+// DeleteClass godoc
+// @Summary      Delete a class
+// @Tags         classes
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Class ID"
+// @Success      204
+// @Router       /classes/{id} [delete]
+func DeleteClass() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := loadTaughtClass(c)
+		if !ok {
+			return
+		}
+		err := db.Get().Transaction(func(tx *gorm.DB) error {
+			var homework []models.Assignment
+			if err := tx.Where("class_id = ?", class.ID).Find(&homework).Error; err != nil {
+				return err
+			}
+			for i := range homework {
+				if err := tx.Select("Tasks", "Lectures").Delete(&homework[i]).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Where("class_id = ?", class.ID).Delete(&models.ClassMember{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(class).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "delete failed"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// ResetJoinCode godoc
+// @Summary      Issue a new join code
+// @Description  The old code stops working; students who already joined stay
+// @Tags         classes
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Class ID"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /classes/{id}/join-code [post]
+func ResetJoinCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := loadTaughtClass(c)
+		if !ok {
+			return
+		}
+		code, err := newJoinCode()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate join code"})
+			return
+		}
+		if err := db.Get().Model(class).Update("join_code", code).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"join_code": code})
+	}
+}
+
+// JoinClass godoc
+// @Summary      Join a class with its code
+// @Tags         classes
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      map[string]string  true  "Join code"
+// @Success      200   {object}  map[string]interface{}
+// @Failure      404   {object}  map[string]interface{}
+// @Router       /classes/join [post]
+func JoinClass() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, _ := c.Get("userID")
+		var req struct {
+			Code string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+			return
+		}
+		var class models.Class
+		code := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(req.Code), "-", ""))
+		if err := db.Get().Preload("Teacher").Where("join_code = ?", code).First(&class).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invalid join code"})
+			return
+		}
+		if class.TeacherID == uid.(uint) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "you teach this class"})
+			return
+		}
+		member := models.ClassMember{ClassID: class.ID, UserID: uid.(uint)}
+		if err := db.Get().Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "join failed"})
+			return
+		}
+		c.JSON(http.StatusOK, studentClassView(&class))
+	}
+}
+
+// AddClassMember godoc
+// @Summary      Add a student to a class by email
+// @Description  Only students already in one of the teacher's classes can be added this way, everyone else joins with the class code
+// @Tags         classes
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path      int                true  "Class ID"
+// @Param        body  body      map[string]string  true  "Student email"
+// @Success      201   {object}  map[string]interface{}
+// @Failure      404   {object}  map[string]interface{}
+// @Router       /classes/{id}/members [post]
+func AddClassMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := loadTaughtClass(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			Email string `json:"email" binding:"required,email"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email"})
+			return
+		}
+		// The teacher sees the attempts of everyone in the class, so strangers
+		// have to join with the code themselves
+		var u models.User
+		err := db.Get().Where("email = ?", req.Email).
+			Where("id IN (SELECT cm.user_id FROM class_members cm JOIN classes cl ON cl.id = cm.class_id WHERE cl.teacher_id = ?)", class.TeacherID).
+			First(&u).Error
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not a student in your other classes, share the join code instead"})
+			return
+		}
+		member := models.ClassMember{ClassID: class.ID, UserID: u.ID}
+		if err := db.Get().Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "add failed"})
+			return
+		}
+		c.JSON(http.StatusCreated, classMemberView{ID: u.ID, Name: u.Name, Email: u.Email, Points: u.Points, JoinedAt: member.JoinedAt})
+	}
+}
+
+// RemoveClassMember godoc
+// @Summary      Remove a student from a class
+// @Description  The teacher can remove anyone, a student can remove themselves to leave
+// @Tags         classes
+// @Security     BearerAuth
+// @Param        id       path      int  true  "Class ID"
+// @Param        user_id  path      int  true  "Student ID"
+// @Success      204
+// @Router       /classes/{id}/members/{user_id} [delete]
+func RemoveClassMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := loadClass(c)
+		if !ok {
+			return
+		}
+		uid, _ := c.Get("userID")
+		if !canTeach(c, class) && c.Param("user_id") != strconv.FormatUint(uint64(uid.(uint)), 10) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not the teacher of this class"})
+			return
+		}
+		res := db.Get().Where("class_id = ? AND user_id = ?", class.ID, c.Param("user_id")).Delete(&models.ClassMember{})
+		if res.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "remove failed"})
+			return
+		}
+		if res.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "student not found in this class"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// ClassStats godoc
+// @Summary      Class overview for the teacher
+// @Description  Every student's points, attempts and per-subject results, plus the class totals per subject
+// @Tags         classes
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Class ID"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /classes/{id}/stats [get]
+func ClassStats() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, ok := loadTaughtClass(c)
+		if !ok {
+			return
+		}
+		members, err := classMembers(class.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		ids := make([]uint, len(members))
+		for i, m := range members {
+			ids[i] = m.ID
+		}
+		perf := subjectPerformance(ids)
+
+		totals := map[string]*SubjectPerformance{}
+		var subjects []string
+		students := make([]gin.H, len(members))
+		for i, m := range members {
+			var solved, attempts int64
+			for _, sp := range perf[m.ID] {
+				solved += sp.Correct
+				attempts += sp.Total
+				t, ok := totals[sp.Subject]
+				if !ok {
+					t = &SubjectPerformance{Subject: sp.Subject}
+					totals[sp.Subject] = t
+					subjects = append(subjects, sp.Subject)
+				}
+				t.Correct += sp.Correct
+				t.Total += sp.Total
+				t.PointsEarned += sp.PointsEarned
+			}
+			students[i] = gin.H{
+				"student":             m,
+				"solved_count":        solved,
+				"total_attempts":      attempts,
+				"subject_performance": perf[m.ID],
+			}
+		}
+		sort.Strings(subjects)
+		bySubject := make([]SubjectPerformance, 0, len(subjects))
+		for _, s := range subjects {
+			t := totals[s]
+			if t.Total > 0 {
+				t.SuccessRate = float64(t.Correct) / float64(t.Total) * 100
+			}
+			bySubject = append(bySubject, *t)
+		}
+		c.JSON(http.StatusOK, gin.H{"class": class, "students": students, "subject_performance": bySubject})
+	}
+}
+
+// ClassStudentStats godoc
+// @Summary      A student's stats, for their teacher
+// @Tags         classes
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id       path      int  true  "Class ID"
+// @Param        user_id  path      int  true  "Student ID"
+// @Success      200      {object}  map[string]interface{}
+// @Router       /classes/{id}/students/{user_id}/stats [get]
+func ClassStudentStats() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, u, ok := loadClassStudent(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, userStats(u))
+	}
+}
+
+// ClassStudentAttempts godoc
+// @Summary      A student's solution attempts, for their teacher
+// @Tags         classes
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id       path      int     true   "Class ID"
+// @Param        user_id  path      int     true   "Student ID"
+// @Param        status   query     string  false  "Statuses, comma-separated"
+// @Param        task_id  query     string  false  "Task IDs, comma-separated"
+// @Param        sort     query     string  false  "Sort key, prefix with - for descending"
+// @Param        limit    query     int     false  "Page size"
+// @Param        cursor   query     string  false  "X-Next-Cursor of the previous page"
+// @Success      200      {array}   models.SolutionAttempt
+// @Header       200  {string}  X-Total-Count  "Number of matching solution attempts"
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next page, empty on the last one"
+// @Router       /classes/{id}/students/{user_id}/attempts [get]
+func ClassStudentAttempts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, u, ok := loadClassStudent(c)
+		if !ok {
+			return
+		}
+		var attempts []models.SolutionAttempt
+		if !findPage(c, db.Get().Where("user_id = ?", u.ID), solutionListSpec, &attempts) {
+			return
+		}
+		c.JSON(http.StatusOK, attempts)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"coolphy-backend/pkg/models"
+)
+
+func TestClassMembersNeedConsent(t *testing.T) {
+	d := testDB(t)
+	teacher := newUser(t, d, "teacher@example.com", models.RoleTeacher)
+	student := newUser(t, d, "student@example.com", models.RoleUser)
+	stranger := newUser(t, d, "stranger@example.com", models.RoleUser)
+
+	first := models.Class{Name: "9A", TeacherID: teacher.ID, JoinCode: "AAAAAAAA"}
+	second := models.Class{Name: "9B", TeacherID: teacher.ID, JoinCode: "BBBBBBBB"}
+	d.Create(&first)
+	d.Create(&second)
+	d.Create(&models.ClassMember{ClassID: first.ID, UserID: student.ID})
+
+	task := models.Task{Title: "t", Subject: "physics", Status: models.StatusPublished}
+	d.Create(&task)
+	d.Create(&models.SolutionAttempt{UserID: stranger.ID, TaskID: task.ID, Answer: "1", Status: "correct"})
+
+	add := func(class models.Class, email string) int {
+		return serve(t, AddClassMember(), http.MethodPost, "/classes/:id/members",
+			fmt.Sprintf("/classes/%d/members", class.ID), &teacher, map[string]string{"email": email}).Code
+	}
+	if code := add(second, stranger.Email); code != http.StatusNotFound {
+		t.Errorf("adding a stranger by email: status %d, want 404", code)
+	}
+	var n int64
+	d.Model(&models.ClassMember{}).Where("user_id = ?", stranger.ID).Count(&n)
+	if n != 0 {
+		t.Errorf("the stranger was enrolled without joining")
+	}
+	if code := add(second, student.Email); code != http.StatusCreated {
+		t.Errorf("adding a student from another class: status %d, want 201", code)
+	}
+
+	// The stranger's work stays hidden from the teacher
+	for _, view := range []struct {
+		path string
+		h    gin.HandlerFunc
+	}{{"stats", ClassStudentStats()}, {"attempts", ClassStudentAttempts()}} {
+		w := serve(t, view.h, http.MethodGet, "/classes/:id/students/:user_id/"+view.path,
+			fmt.Sprintf("/classes/%d/students/%d/%s", second.ID, stranger.ID, view.path), &teacher, nil)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("stranger's %s: status %d, want 404", view.path, w.Code)
+		}
+	}
+	w := serve(t, ClassStats(), http.MethodGet, "/classes/:id/stats", fmt.Sprintf("/classes/%d/stats", second.ID), &teacher, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("class stats: status %d: %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), stranger.Email) || !strings.Contains(w.Body.String(), student.Email) {
+		t.Errorf("class stats list the wrong students: %s", w.Body)
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/judge"
+	"coolphy-backend/pkg/models"
+)
+
+// submitCode stores a code submission as a "judging" attempt and queues it on
+// the judge. The attempt is updated with the verdicts once all tests have run;
+// clients poll GET /solutions/:id. While the judge is busy the attempt waits
+// as "pending" for StartJudgeRetries.
+func submitCode(c *gin.Context, task *models.Task, userID uint, p solvePayload) {
+	if !judge.Running() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "code submissions are disabled on this server"})
+		return
+	}
+	spec, err := task.DecodeAnswerSpec()
+	if err != nil || spec == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "task has no tests"})
+		return
+	}
+	if !judge.Allows(spec, p.Language) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("language %q is not accepted for this task", p.Language)})
+		return
+	}
+
+	attempt := models.SolutionAttempt{
+		UserID:       userID,
+		TaskID:       task.ID,
+		Answer:       p.Answer,
+		SolutionText: p.SolutionText,
+		TimeSpent:    p.TimeSpent,
+		Language:     p.Language,
+		Status:       "judging",
+	}
+	if err := db.Get().Create(&attempt).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
+		return
+	}
+
+	job := judge.Job{
+		Submission: judge.NewSubmission(spec, p.Language, p.Answer),
+		Done: func(r judge.Report, err error) {
+			finishCodeAttempt(attempt.ID, userID, task.Points, spec.PartialCredit, r, err)
+		},
+	}
+	feedback := "Your solution is being judged."
+	if err := judge.Submit(job); err != nil {
+		feedback = busyFeedback
+		attempt.Status = "pending"
+		db.Get().Model(&attempt).Updates(map[string]interface{}{"status": attempt.Status, "ai_feedback": feedback})
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"id":         attempt.ID,
+		"is_correct": false,
+		"score":      0,
+		"feedback":   feedback,
+		"status":     attempt.Status,
+	})
+}
+
+const busyFeedback = "The judge is busy, your solution will be checked in a few minutes."
+
+// judgeRetryInterval is how often code left pending is queued again
+const judgeRetryInterval = time.Minute
+
+// StartJudgeRetries queues again the code attempts and contest submissions
+// the judge hasn't finished: at start those left "judging" by the previous
+// run, then every judgeRetryInterval those "pending" because the queue was
+// full or the judge failed.
+func StartJudgeRetries() {
+	go func() {
+		requeueCode([]string{"pending", "judging"})
+		for range time.Tick(judgeRetryInterval) {
+			requeueCode([]string{"pending"})
+		}
+	}()
+}
+
+// requeueCode submits waiting code until the judge queue is full
+func requeueCode(statuses []string) {
+	if !judge.Running() {
+		return
+	}
+	loaded := map[uint]*models.Task{}
+	task := func(id uint) (*models.Task, *models.AnswerSpec) {
+		t, ok := loaded[id]
+		if !ok {
+			t = &models.Task{}
+			if err := db.Get().First(t, id).Error; err != nil || t.AnswerType != grading.AnswerCode {
+				t = nil
+			}
+			loaded[id] = t
+		}
+		if t == nil {
+			return nil, nil
+		}
+		spec, err := t.DecodeAnswerSpec()
+		if err != nil || spec == nil {
+			return nil, nil
+		}
+		return t, spec
+	}
+	// claim moves a row to "judging" unless someone else already did
+	claim := func(model interface{}, id uint, status string) bool {
+		res := db.Get().Model(model).Where("id = ? AND status = ?", id, status).Update("status", "judging")
+		return res.Error == nil && res.RowsAffected == 1
+	}
+
+	var attempts []models.SolutionAttempt
+	db.Get().Where("status IN ? AND language <> ''", statuses).Order("id").Limit(500).Find(&attempts)
+	for _, a := range attempts {
+		t, spec := task(a.TaskID)
+		if t == nil || !claim(&models.SolutionAttempt{}, a.ID, a.Status) {
+			continue
+		}
+		a := a
+		job := judge.Job{
+			Submission: judge.NewSubmission(spec, a.Language, a.Answer),
+			Done: func(r judge.Report, err error) {
+				finishCodeAttempt(a.ID, a.UserID, t.Points, spec.PartialCredit, r, err)
+			},
+		}
+		if err := judge.Submit(job); err != nil {
+			db.Get().Model(&models.SolutionAttempt{}).Where("id = ?", a.ID).Update("status", "pending")
+			return
+		}
+	}
+
+	var subs []models.ContestSubmission
+	db.Get().Where("status IN ? AND language <> ''", statuses).Order("id").Limit(500).Find(&subs)
+	for _, s := range subs {
+		t, spec := task(s.TaskID)
+		if t == nil || !claim(&models.ContestSubmission{}, s.ID, s.Status) {
+			continue
+		}
+		s := s
+		job := judge.Job{
+			Submission: judge.NewSubmission(spec, s.Language, s.Answer),
+			Done: func(r judge.Report, err error) {
+				finishContestCode(s.ID, spec.PartialCredit, r, err)
+			},
+		}
+		if err := judge.Submit(job); err != nil {
+			db.Get().Model(&models.ContestSubmission{}).Where("id = ?", s.ID).Update("status", "pending")
+			return
+		}
+	}
+	if len(attempts)+len(subs) > 0 {
+		log.Printf("judge: requeued waiting code (%d attempts, %d contest submissions)", len(attempts), len(subs))
+	}
+}
+
+// finishCodeAttempt records the judge's report on the attempt and awards points
+func finishCodeAttempt(attemptID, userID uint, taskPoints int, partialCredit bool, r judge.Report, judgeErr error) {
+	updates := map[string]interface{}{}
+	if judgeErr != nil {
+		updates["status"] = "pending"
+		updates["ai_feedback"] = "The judge failed to check your solution, it will be checked again in a few minutes."
+		db.Get().Model(&models.SolutionAttempt{}).Where("id = ?", attemptID).Updates(updates)
+		return
+	}
+
+	score, status, feedback := judgeOutcome(r, partialCredit)
+	points := taskPoints * score / 100
+	results, _ := json.Marshal(r.Tests)
+
+	updates["status"] = string(status)
+	updates["verdict"] = r.Verdict
+	updates["test_results"] = results
+	updates["points_awarded"] = points
+	updates["ai_feedback"] = feedback
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SolutionAttempt{}).Where("id = ?", attemptID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if points == 0 {
+			return nil
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("points", gorm.Expr("points + ?", points)).Error
+	})
+	if err != nil {
+		log.Printf("saving judge result for attempt %d: %v", attemptID, err)
+	}
+}
+
+// judgeOutcome turns a judge report into a score out of 100, a status and
+// feedback for the student
+func judgeOutcome(r judge.Report, partialCredit bool) (int, grading.Status, string) {
+	score := 0
+	if r.Verdict == judge.VerdictOK {
+		score = 100
+	} else if partialCredit {
+		score = r.Score()
+	}
+	status := grading.StatusIncorrect
+	switch {
+	case score == 100:
+		status = grading.StatusCorrect
+	case score > 0:
+		status = grading.StatusPartial
+	}
+
+	feedback := fmt.Sprintf("%s: %d of %d tests passed.", r.Verdict, r.Passed, len(r.Tests))
+	if r.Verdict == judge.VerdictCE {
+		feedback = "Compilation error:\n" + r.CompileOutput
+	}
+	return score, status, feedback
+}
@@ -0,0 +1,912 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"coolphy-backend/pkg/contest"
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/judge"
+	"coolphy-backend/pkg/models"
+)
+
+// Contest phases
+const (
+	contestUpcoming = "upcoming"
+	contestRunning  = "running"
+	contestEnded    = "ended"
+)
+
+type contestTaskPayload struct {
+	TaskID uint   `json:"task_id" binding:"required"`
+	Points int    `json:"points"` // task's points if 0
+	Label  string `json:"label"`  // A, B, ... for icpc, 1, 2, ... otherwise
+}
+
+type contestPayload struct {
+	Title           string               `json:"title" binding:"required"`
+	Description     string               `json:"description"`
+	StartsAt        time.Time            `json:"starts_at" binding:"required"`
+	EndsAt          time.Time            `json:"ends_at" binding:"required"`
+	DurationMinutes int                  `json:"duration_minutes"`
+	FreezeMinutes   int                  `json:"freeze_minutes"`
+	Scoring         string               `json:"scoring"` // ioi (default), icpc, ege
+	PenaltyMinutes  int                  `json:"penalty_minutes"`
+	EGEScale        []int                `json:"ege_scale"`
+	ShowVerdicts    bool                 `json:"show_verdicts"`
+	ClassID         *uint                `json:"class_id"`
+	Tasks           []contestTaskPayload `json:"tasks" binding:"required,min=1"`
+}
+
+// apply validates the payload and copies it into ct. It returns a message
+// for a 400 response.
+func (p *contestPayload) apply(c *gin.Context, ct *models.Contest) string {
+	if !p.EndsAt.After(p.StartsAt) {
+		return "ends_at must be after starts_at"
+	}
+	if p.DurationMinutes < 0 || p.FreezeMinutes < 0 {
+		return "duration_minutes and freeze_minutes must not be negative"
+	}
+	if p.Scoring == "" {
+		p.Scoring = contest.ScoringIOI
+	}
+	if p.ClassID != nil {
+		var class models.Class
+		if err := db.Get().First(&class, *p.ClassID).Error; err != nil {
+			return "class not found"
+		}
+		if !canTeach(c, &class) {
+			return "not the teacher of this class"
+		}
+	} else {
+		// Open contests are for content editors, teachers run them for their classes
+		role, _ := c.Get("role")
+		if !models.HasPermission(role.(string), models.PermContentWrite) {
+			return "class_id is required"
+		}
+	}
+
+	ids := make([]uint, len(p.Tasks))
+	for i, t := range p.Tasks {
+		ids[i] = t.TaskID
+	}
+	var tasks []models.Task
+	db.Get().Where("id IN ?", ids).Find(&tasks)
+	if len(tasks) != len(uniqueIDs(ids)) || len(ids) != len(uniqueIDs(ids)) {
+		return "tasks must be distinct existing tasks"
+	}
+	byID := make(map[uint]*models.Task, len(tasks))
+	for i := range tasks {
+		byID[tasks[i].ID] = &tasks[i]
+	}
+	maxPrimary := 0
+	ct.Tasks = make([]models.ContestTask, len(p.Tasks))
+	for i, t := range p.Tasks {
+		points := t.Points
+		if points <= 0 {
+			points = byID[t.TaskID].Points
+		}
+		label := t.Label
+		if label == "" {
+			label = strconv.Itoa(i + 1)
+			if p.Scoring == contest.ScoringICPC && i < 26 {
+				label = string(rune('A' + i))
+			}
+		}
+		ct.Tasks[i] = models.ContestTask{TaskID: t.TaskID, Position: i + 1, Label: label, Points: points}
+		maxPrimary += points
+	}
+	rules := contest.Rules{Scoring: p.Scoring, PenaltyMinutes: p.PenaltyMinutes, EGEScale: p.EGEScale}
+	if err := rules.Validate(maxPrimary); err != nil {
+		return err.Error()
+	}
+
+	ct.Title, ct.Description = p.Title, p.Description
+	ct.StartsAt, ct.EndsAt = p.StartsAt, p.EndsAt
+	ct.DurationMinutes, ct.FreezeMinutes = p.DurationMinutes, p.FreezeMinutes
+	ct.Scoring, ct.PenaltyMinutes = p.Scoring, p.PenaltyMinutes
+	ct.EGEScale = make(pq.Int64Array, len(p.EGEScale))
+	for i, v := range p.EGEScale {
+		ct.EGEScale[i] = int64(v)
+	}
+	ct.ShowVerdicts, ct.ClassID = p.ShowVerdicts, p.ClassID
+	return ""
+}
+
+func contestRules(ct *models.Contest) contest.Rules {
+	scale := make([]int, len(ct.EGEScale))
+	for i, v := range ct.EGEScale {
+		scale[i] = int(v)
+	}
+	return contest.Rules{Scoring: ct.Scoring, PenaltyMinutes: ct.PenaltyMinutes, EGEScale: scale}
+}
+
+func contestPhase(ct *models.Contest, now time.Time) string {
+	switch {
+	case now.Before(ct.StartsAt):
+		return contestUpcoming
+	case now.Before(ct.EndsAt):
+		return contestRunning
+	}
+	return contestEnded
+}
+
+// canManageContest reports whether the current user may edit the contest and
+// see everything on it before it ends
+func canManageContest(c *gin.Context, ct *models.Contest) bool {
+	uid, ok := c.Get("userID")
+	if !ok {
+		return false
+	}
+	role, _ := c.Get("role")
+	return ct.CreatedBy == uid.(uint) || models.HasPermission(role.(string), models.PermContentWrite)
+}
+
+// canEnterContest reports whether the current user may see and take part in
+// the contest: anyone for open contests, class members for class contests
+func canEnterContest(c *gin.Context, ct *models.Contest) bool {
+	if ct.ClassID == nil || canManageContest(c, ct) {
+		return true
+	}
+	uid, ok := c.Get("userID")
+	if !ok {
+		return false
+	}
+	var n int64
+	db.Get().Model(&models.ClassMember{}).Where("class_id = ? AND user_id = ?", *ct.ClassID, uid).Count(&n)
+	if n > 0 {
+		return true
+	}
+	var class models.Class
+	return db.Get().First(&class, *ct.ClassID).Error == nil && canTeach(c, &class)
+}
+
+// loadContest loads the contest from the :id parameter with its tasks in
+// order. It writes the error response itself.
+func loadContest(c *gin.Context) (*models.Contest, bool) {
+	var ct models.Contest
+	err := db.Get().Preload("Tasks", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		First(&ct, c.Param("id")).Error
+	if err == nil && !canEnterContest(c, &ct) {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "contest not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return nil, false
+	}
+	return &ct, true
+}
+
+// participation returns the current user's run through the contest, nil if
+// they haven't started
+func participation(c *gin.Context, contestID uint) *models.ContestParticipant {
+	uid, ok := c.Get("userID")
+	if !ok {
+		return nil
+	}
+	var p models.ContestParticipant
+	if err := db.Get().Where("contest_id = ? AND user_id = ?", contestID, uid).First(&p).Error; err != nil {
+		return nil
+	}
+	return &p
+}
+
+func participantActive(p *models.ContestParticipant, now time.Time) bool {
+	return p != nil && p.FinishedAt == nil && now.Before(p.EndsAt)
+}
+
+func contestView(c *gin.Context, ct *models.Contest, now time.Time) gin.H {
+	view := gin.H{
+		"id":               ct.ID,
+		"title":            ct.Title,
+		"description":      ct.Description,
+		"starts_at":        ct.StartsAt,
+		"ends_at":          ct.EndsAt,
+		"duration_minutes": ct.DurationMinutes,
+		"freeze_minutes":   ct.FreezeMinutes,
+		"scoring":          ct.Scoring,
+		"penalty_minutes":  ct.PenaltyMinutes,
+		"ege_scale":        ct.EGEScale,
+		"show_verdicts":    ct.ShowVerdicts,
+		"class_id":         ct.ClassID,
+		"phase":            contestPhase(ct, now),
+		"task_count":       len(ct.Tasks),
+	}
+	if p := participation(c, ct.ID); p != nil {
+		view["participation"] = gin.H{
+			"started_at":  p.StartedAt,
+			"ends_at":     p.EndsAt,
+			"finished_at": p.FinishedAt,
+			"active":      participantActive(p, now),
+		}
+	}
+	return view
+}
+
+// ListContests godoc
+// @Summary      List contests
+// @Tags         contests
+// @Produce      json
+// @Param        phase  query     string  false  "upcoming, running or ended"
+// @Success      200    {array}   map[string]interface{}
+// @Router       /contests [get]
+func ListContests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		q := db.Get().Preload("Tasks").Order("starts_at desc")
+		switch c.Query("phase") {
+		case "":
+		case contestUpcoming:
+			q = q.Where("starts_at > ?", now)
+		case contestRunning:
+			q = q.Where("starts_at <= ? AND ends_at > ?", now, now)
+		case contestEnded:
+			q = q.Where("ends_at <= ?", now)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "phase must be upcoming, running or ended"})
+			return
+		}
+		if uid, ok := c.Get("userID"); ok {
+			role, _ := c.Get("role")
+			if !models.HasPermission(role.(string), models.PermContentWrite) {
+				q = q.Where("class_id IS NULL OR created_by = ? OR class_id IN (SELECT class_id FROM class_members WHERE user_id = ?) OR class_id IN (SELECT id FROM classes WHERE teacher_id = ?)", uid, uid, uid)
+			}
+		} else {
+			q = q.Where("class_id IS NULL")
+		}
+		var list []models.Contest
+		if err := q.Find(&list).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		out := make([]gin.H, len(list))
+		for i := range list {
+			out[i] = contestView(c, &list[i], now)
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// GetContest godoc
+// @Summary      Get a contest
+// @Description  Contest rules and times, and the current user's participation
+// @Tags         contests
+// @Produce      json
+// @Param        id   path      int  true  "Contest ID"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /contests/{id} [get]
+func GetContest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ct, ok := loadContest(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, contestView(c, ct, time.Now()))
+	}
+}
+
+// CreateContest godoc
+// @Summary      Create a contest or mock exam
+// @Tags         contests
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      contestPayload  true  "Contest"
+// @Success      201      {object}  map[string]interface{}
+// @Failure      400      {object}  map[string]interface{}
+// @Router       /contests [post]
+func CreateContest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var p contestPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		uid, _ := c.Get("userID")
+		ct := models.Contest{CreatedBy: uid.(uint)}
+		if msg := p.apply(c, &ct); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		if err := db.Get().Create(&ct).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
+			return
+		}
+		c.JSON(http.StatusCreated, contestView(c, &ct, time.Now()))
+	}
+}
+
+// UpdateContest godoc
+// @Summary      Update a contest
+// @Description  The task list and scoring can't change once someone has started
+// @Tags         contests
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int             true  "Contest ID"
+// @Param        payload  body      contestPayload  true  "Contest"
+// @Success      200      {object}  map[string]interface{}
+// @Failure      409      {object}  map[string]interface{}
+// @Router       /contests/{id} [put]
+func UpdateContest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ct, ok := loadContest(c)
+		if !ok {
+			return
+		}
+		if !canManageContest(c, ct) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not your contest"})
+			return
+		}
+		var p contestPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		oldTasks, oldScoring := ct.Tasks, ct.Scoring
+		if msg := p.apply(c, ct); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		var started int64
+		db.Get().Model(&models.ContestParticipant{}).Where("contest_id = ?", ct.ID).Count(&started)
+		if started > 0 && (ct.Scoring != oldScoring || !sameContestTasks(oldTasks, ct.Tasks)) {
+			c.JSON(http.StatusConflict, gin.H{"error": "participants have started, the tasks and scoring can't change"})
+			return
+		}
+		err := db.Get().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Omit("Tasks").Save(ct).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("contest_id = ?", ct.ID).Delete(&models.ContestTask{}).Error; err != nil {
+				return err
+			}
+			for i := range ct.Tasks {
+				ct.Tasks[i].ContestID = ct.ID
+			}
+			return tx.Create(&ct.Tasks).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, contestView(c, ct, time.Now()))
+	}
+}
+
+func sameContestTasks(a, b []models.ContestTask) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].TaskID != b[i].TaskID || a[i].Points != b[i].Points {
+			return false
+		}
+	}
+	return true
+}
+
+// DeleteContest godoc
+// @Summary      Delete a contest with its results
+// @Tags         contests
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Contest ID"
+// @Success      204
+// @Router       /contests/{id} [delete]
+func DeleteContest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ct, ok := loadContest(c)
+		if !ok {
+			return
+		}
+		if !canManageContest(c, ct) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not your contest"})
+			return
+		}
+		err := db.Get().Transaction(func(tx *gorm.DB) error {
+			for _, m := range []interface{}{&models.ContestSubmission{}, &models.ContestParticipant{}, &models.ContestTask{}} {
+				if err := tx.Where("contest_id = ?", ct.ID).Delete(m).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Delete(ct).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "delete failed"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// StartContest godoc
+// @Summary      Start my timer
+// @Description  Starts the participant's own timer; it runs for duration_minutes but never past the contest end
+// @Tags         contests
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Contest ID"
+// @Success      201  {object}  models.ContestParticipant
+// @Failure      403  {object}  map[string]interface{}
+// @Router       /contests/{id}/start [post]
+func StartContest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ct, ok := loadContest(c)
+		if !ok {
+			return
+		}
+		now := time.Now()
+		if contestPhase(ct, now) != contestRunning {
+			c.JSON(http.StatusForbidden, gin.H{"error": "the contest is not running"})
+			return
+		}
+		if p := participation(c, ct.ID); p != nil {
+			c.JSON(http.StatusOK, p)
+			return
+		}
+		uid, _ := c.Get("userID")
+		p := models.ContestParticipant{ContestID: ct.ID, UserID: uid.(uint), StartedAt: now, EndsAt: ct.EndsAt}
+		if ct.DurationMinutes > 0 {
+			if ends := now.Add(time.Duration(ct.DurationMinutes) * time.Minute); ends.Before(ct.EndsAt) {
+				p.EndsAt = ends
+			}
+		}
+		// A double click must not restart the timer
+		res := db.Get().Clauses(clause.OnConflict{DoNothing: true}).Create(&p)
+		if res.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "start failed"})
+			return
+		}
+		if res.RowsAffected == 0 {
+			c.JSON(http.StatusOK, participation(c, ct.ID))
+			return
+		}
+		c.JSON(http.StatusCreated, p)
+	}
+}
+
+// FinishContest godoc
+// @Summary      Hand in early
+// @Tags         contests
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Contest ID"
+// @Success      200  {object}  models.ContestParticipant
+// @Router       /contests/{id}/finish [post]
+func FinishContest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ct, ok := loadContest(c)
+		if !ok {
+			return
+		}
+		p := participation(c, ct.ID)
+		if !participantActive(p, time.Now()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you are not taking part right now"})
+			return
+		}
+		now := time.Now()
+		p.FinishedAt = &now
+		if err := db.Get().Model(p).Update("finished_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// ContestTasks godoc
+// @Summary      Contest tasks
+// @Description  Statements for participants once they start; solutions and answers only after the contest ends
+// @Tags         contests
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Contest ID"
+// @Success      200  {array}   map[string]interface{}
+// @Router       /contests/{id}/tasks [get]
+func ContestTasks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ct, ok := loadContest(c)
+		if !ok {
+			return
+		}
+		ended := contestPhase(ct, time.Now()) == contestEnded
+		if !ended && !canManageContest(c, ct) && participation(c, ct.ID) == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "start the contest to see its tasks"})
+			return
+		}
+		ids := make([]uint, len(ct.Tasks))
+		for i, t := range ct.Tasks {
+			ids[i] = t.TaskID
+		}
+		var tasks []models.Task
+		if err := db.Get().Where("id IN ?", ids).Find(&tasks).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		byID := make(map[uint]*models.Task, len(tasks))
+		for i := range tasks {
+			byID[tasks[i].ID] = &tasks[i]
+		}
+		out := make([]gin.H, 0, len(ct.Tasks))
+		for _, t := range ct.Tasks {
+			task := byID[t.TaskID]
+			if task == nil {
+				continue
+			}
+			applyVariant(c, task)
+			attachAnswerForm(task)
+			item := gin.H{"label": t.Label, "position": t.Position, "points": t.Points, "task": task}
+			if ended {
+				item["correct_answer"] = task.CorrectAnswer
+			} else {
+				task.SolutionLaTeX, task.HintLaTeX = "", ""
+			}
+			out = append(out, item)
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// SubmitContestAnswer godoc
+// @Summary      Submit an answer during a contest
+// @Description  Accepted only while the participant's timer runs. Without show_verdicts the result stays hidden until the end.
+// @Tags         contests
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int           true  "Contest ID"
+// @Param        task_id  path      int           true  "Task ID"
+// @Param        payload  body      solvePayload  true  "Answer"
+// @Success      201      {object}  map[string]interface{}
+// @Failure      403      {object}  map[string]interface{}
+// @Router       /contests/{id}/tasks/{task_id}/submit [post]
+func SubmitContestAnswer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ct, ok := loadContest(c)
+		if !ok {
+			return
+		}
+		var p solvePayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		part := participation(c, ct.ID)
+		if part == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "start the contest first"})
+			return
+		}
+		if !participantActive(part, time.Now()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "your time is over"})
+			return
+		}
+		var inContest bool
+		for _, t := range ct.Tasks {
+			inContest = inContest || strconv.FormatUint(uint64(t.TaskID), 10) == c.Param("task_id")
+		}
+		var task models.Task
+		if !inContest || db.Get().First(&task, c.Param("task_id")).Error != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "task not found in this contest"})
+			return
+		}
+
+		sub := models.ContestSubmission{
+			ContestID:     ct.ID,
+			ParticipantID: part.ID,
+			UserID:        part.UserID,
+			TaskID:        task.ID,
+			Answer:        p.Answer,
+			Language:      p.Language,
+		}
+		var spec *models.AnswerSpec
+		if task.AnswerType == grading.AnswerCode {
+			var err error
+			if spec, err = task.DecodeAnswerSpec(); err != nil || spec == nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "task has no tests"})
+				return
+			}
+			if !judge.Allows(spec, p.Language) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("language %q is not accepted for this task", p.Language)})
+				return
+			}
+			if !judge.Running() {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "code submissions are disabled on this server"})
+				return
+			}
+			sub.Status = "judging"
+		} else {
+			applyVariant(c, &task)
+			result := gradeAnswer(c.Request.Context(), &task, p.Answer)
+			sub.Status, sub.Score, sub.Feedback = string(result.Status), result.Score, result.Feedback
+			if !result.Decided() {
+				sub.Status = "pending"
+			}
+		}
+		if err := db.Get().Create(&sub).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
+			return
+		}
+		if spec != nil {
+			job := judge.Job{
+				Submission: judge.NewSubmission(spec, p.Language, p.Answer),
+				Done: func(r judge.Report, err error) {
+					finishContestCode(sub.ID, spec.PartialCredit, r, err)
+				},
+			}
+			if err := judge.Submit(job); err != nil {
+				sub.Status, sub.Feedback = "pending", busyFeedback
+				db.Get().Model(&sub).Updates(map[string]interface{}{"status": sub.Status, "feedback": sub.Feedback})
+			}
+		}
+		c.JSON(http.StatusCreated, submissionView(ct, &sub, false))
+	}
+}
+
+// finishContestCode records the judge's report on a contest submission
+func finishContestCode(subID uint, partialCredit bool, r judge.Report, judgeErr error) {
+	updates := map[string]interface{}{}
+	if judgeErr != nil {
+		updates["status"] = "pending"
+		updates["feedback"] = "The judge failed to check your solution, it will be checked again in a few minutes."
+	} else {
+		score, status, feedback := judgeOutcome(r, partialCredit)
+		updates["status"], updates["score"], updates["feedback"], updates["verdict"] = string(status), score, feedback, r.Verdict
+	}
+	if err := db.Get().Model(&models.ContestSubmission{}).Where("id = ?", subID).Updates(updates).Error; err != nil {
+		log.Printf("saving judge result for contest submission %d: %v", subID, err)
+	}
+}
+
+// submissionView hides the result of a submission until the contest ends,
+// unless the contest shows verdicts or reveal is set
+func submissionView(ct *models.Contest, s *models.ContestSubmission, reveal bool) gin.H {
+	view := gin.H{"id": s.ID, "task_id": s.TaskID, "answer": s.Answer, "language": s.Language, "created_at": s.CreatedAt}
+	if reveal || ct.ShowVerdicts || contestPhase(ct, time.Now()) == contestEnded {
+		view["status"], view["score"], view["verdict"], view["feedback"] = s.Status, s.Score, s.Verdict, s.Feedback
+	} else {
+		view["status"] = "received"
+	}
+	return view
+}
+
+// ContestSubmissions godoc
+// @Summary      Contest submissions
+// @Description  A participant's own submissions. Contest managers pass all=true to see everyone's with their results, status=pending lists the answers that need grading by hand.
+// @Tags         contests
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id      path      int     true   "Contest ID"
+// @Param        all     query     bool    false  "Every participant's submissions, for contest managers"
+// @Param        status  query     string  false  "Only submissions with this status"
+// @Success      200  {array}   map[string]interface{}
+// @Failure      403  {object}  map[string]interface{}
+// @Router       /contests/{id}/submissions [get]
+func ContestSubmissions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ct, ok := loadContest(c)
+		if !ok {
+			return
+		}
+		all := c.Query("all") == "true"
+		if all && !canManageContest(c, ct) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only contest managers see every submission"})
+			return
+		}
+		q := db.Get().Where("contest_id = ?", ct.ID)
+		if !all {
+			uid, _ := c.Get("userID")
+			q = q.Where("user_id = ?", uid)
+		}
+		if status := c.Query("status"); status != "" {
+			q = q.Where("status = ?", status)
+		}
+		var subs []models.ContestSubmission
+		if err := q.Order("id").Find(&subs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		out := make([]gin.H, len(subs))
+		for i := range subs {
+			out[i] = submissionView(ct, &subs[i], all)
+			if all {
+				out[i]["user_id"] = subs[i].UserID
+			}
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+type contestGradePayload struct {
+	Score    *int   `json:"score" binding:"required"` // 0-100
+	Feedback string `json:"feedback"`
+}
+
+// GradeContestSubmission godoc
+// @Summary      Grade a contest submission by hand
+// @Description  For answers the checker and the AI couldn't decide, which stay pending and don't count until graded. Contest managers only.
+// @Tags         contests
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id         path      int                  true  "Contest ID"
+// @Param        sub_id     path      int                  true  "Submission ID"
+// @Param        payload    body      contestGradePayload  true  "Score out of 100 and feedback"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      403  {object}  map[string]interface{}
+// @Failure      409  {object}  map[string]interface{}
+// @Router       /contests/{id}/submissions/{sub_id} [put]
+func GradeContestSubmission() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ct, ok := loadContest(c)
+		if !ok {
+			return
+		}
+		if !canManageContest(c, ct) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only contest managers grade submissions"})
+			return
+		}
+		var p contestGradePayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if *p.Score < 0 || *p.Score > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "score must be between 0 and 100"})
+			return
+		}
+		var sub models.ContestSubmission
+		if err := db.Get().Where("contest_id = ?", ct.ID).First(&sub, c.Param("sub_id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "submission not found"})
+			return
+		}
+		if sub.Status == "judging" {
+			c.JSON(http.StatusConflict, gin.H{"error": "the judge is checking this submission"})
+			return
+		}
+		status := grading.StatusIncorrect
+		switch {
+		case *p.Score == 100:
+			status = grading.StatusCorrect
+		case *p.Score > 0:
+			status = grading.StatusPartial
+		}
+		sub.Status, sub.Score, sub.Feedback = string(status), *p.Score, p.Feedback
+		// Leave a code submission the judge picked up meanwhile to the judge
+		res := db.Get().Model(&sub).Where("status <> ?", "judging").
+			Updates(map[string]interface{}{"status": sub.Status, "score": sub.Score, "feedback": sub.Feedback})
+		if res.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+			return
+		}
+		if res.RowsAffected == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "the judge is checking this submission"})
+			return
+		}
+		view := submissionView(ct, &sub, true)
+		view["user_id"] = sub.UserID
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// ContestScoreboard godoc
+// @Summary      Contest scoreboard
+// @Description  While the contest runs, answers from each participant's last freeze_minutes are hidden (all answers if the contest doesn't show verdicts). Contest managers always see the live board.
+// @Tags         contests
+// @Produce      json
+// @Param        id   path      int  true  "Contest ID"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /contests/{id}/scoreboard [get]
+func ContestScoreboard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ct, ok := loadContest(c)
+		if !ok {
+			return
+		}
+		now := time.Now()
+		frozen := contestPhase(ct, now) != contestEnded && !canManageContest(c, ct)
+
+		var parts []models.ContestParticipant
+		if err := db.Get().Preload("User").Where("contest_id = ?", ct.ID).Order("id").Find(&parts).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		var subs []models.ContestSubmission
+		if err := db.Get().Where("contest_id = ?", ct.ID).Order("created_at, id").Find(&subs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+
+		byUser := make(map[uint]*models.ContestParticipant, len(parts))
+		users := make([]uint, len(parts))
+		for i := range parts {
+			byUser[parts[i].UserID] = &parts[i]
+			users[i] = parts[i].UserID
+		}
+		freeze := time.Duration(ct.FreezeMinutes) * time.Minute
+		entries := make([]contest.Submission, 0, len(subs))
+		for _, s := range subs {
+			p := byUser[s.UserID]
+			if p == nil {
+				continue
+			}
+			entries = append(entries, contest.Submission{
+				UserID:  s.UserID,
+				TaskID:  s.TaskID,
+				Score:   s.Score,
+				Pending: s.Status == "pending" || s.Status == "judging",
+				Frozen:  frozen && (!ct.ShowVerdicts || (freeze > 0 && s.CreatedAt.After(p.EndsAt.Add(-freeze)))),
+				Elapsed: s.CreatedAt.Sub(p.StartedAt),
+			})
+		}
+		problems := make([]contest.Problem, len(ct.Tasks))
+		columns := make([]gin.H, len(ct.Tasks))
+		for i, t := range ct.Tasks {
+			problems[i] = contest.Problem{TaskID: t.TaskID, Points: t.Points}
+			columns[i] = gin.H{"task_id": t.TaskID, "label": t.Label, "points": t.Points}
+		}
+
+		standings := contest.Standings(contestRules(ct), problems, users, entries)
+		rows := make([]gin.H, len(standings))
+		for i, s := range standings {
+			rows[i] = gin.H{
+				"rank":       s.Rank,
+				"user":       gin.H{"id": s.UserID, "name": byUser[s.UserID].User.Name},
+				"score":      s.Score,
+				"penalty":    s.Penalty,
+				"test_score": s.TestScore,
+				"problems":   s.Problems,
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"contest":  contestView(c, ct, now),
+			"frozen":   frozen,
+			"problems": columns,
+			"rows":     rows,
+		})
+	}
+}
+
+// runningContestTasks returns the IDs of tasks in contests that are running
+// now. Their solutions stay hidden and they can't be solved or discussed with
+// the AI outside the contest.
+func runningContestTasks() map[uint]bool {
+	now := time.Now()
+	var ids []uint
+	db.Get().Model(&models.ContestTask{}).
+		Joins("JOIN contests ON contests.id = contest_tasks.contest_id").
+		Where("contests.starts_at <= ? AND contests.ends_at > ?", now, now).
+		Distinct().Pluck("contest_tasks.task_id", &ids)
+	set := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// hideContestSolutions strips solutions and hints from tasks in running contests
+func hideContestSolutions(tasks ...*models.Task) {
+	locked := runningContestTasks()
+	for _, t := range tasks {
+		if locked[t.ID] {
+			t.SolutionLaTeX, t.HintLaTeX = "", ""
+		}
+	}
+}
+
+// inRunningContest reports whether the task is part of a running contest
+func inRunningContest(taskID uint) bool {
+	return runningContestTasks()[taskID]
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/models"
+)
+
+func TestGradeContestSubmissionByHand(t *testing.T) {
+	d := testDB(t)
+	manager := newUser(t, d, "editor@example.com", models.RoleEditor)
+	student := newUser(t, d, "student@example.com", models.RoleUser)
+
+	// Free answers go to the AI, which isn't configured, so they stay pending
+	task := models.Task{Title: "Explain", AnswerType: grading.AnswerFree, Points: 5, Status: models.StatusPublished}
+	d.Create(&task)
+	now := time.Now()
+	ct := models.Contest{Title: "Round", StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour), ShowVerdicts: true, CreatedBy: manager.ID,
+		Tasks: []models.ContestTask{{TaskID: task.ID, Position: 1, Label: "1", Points: 5}}}
+	d.Create(&ct)
+	base := fmt.Sprintf("/contests/%d", ct.ID)
+
+	if w := serve(t, StartContest(), http.MethodPost, "/contests/:id/start", base+"/start", &student, nil); w.Code != http.StatusCreated {
+		t.Fatalf("start: status %d %s", w.Code, w.Body)
+	}
+	w := serve(t, SubmitContestAnswer(), http.MethodPost, "/contests/:id/tasks/:task_id/submit",
+		fmt.Sprintf("%s/tasks/%d/submit", base, task.ID), &student, map[string]string{"answer": "because"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("submit: status %d %s", w.Code, w.Body)
+	}
+	var sub struct {
+		ID     uint   `json:"id"`
+		Status string `json:"status"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &sub)
+	if sub.Status != "pending" {
+		t.Fatalf("undecided answer has status %q, want pending", sub.Status)
+	}
+
+	list := func(u *models.User) (int, []map[string]interface{}) {
+		w := serve(t, ContestSubmissions(), http.MethodGet, "/contests/:id/submissions", base+"/submissions?all=true&status=pending", u, nil)
+		var out []map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &out)
+		return w.Code, out
+	}
+	if code, _ := list(&student); code != http.StatusForbidden {
+		t.Errorf("participant listing everyone's submissions: status %d, want 403", code)
+	}
+	if code, out := list(&manager); code != http.StatusOK || len(out) != 1 || out[0]["user_id"] != float64(student.ID) {
+		t.Errorf("manager's pending list: status %d %v, want the student's submission", code, out)
+	}
+
+	grade := func(u *models.User, body interface{}) int {
+		return serve(t, GradeContestSubmission(), http.MethodPut, "/contests/:id/submissions/:sub_id",
+			fmt.Sprintf("%s/submissions/%d", base, sub.ID), u, body).Code
+	}
+	if code := grade(&student, map[string]interface{}{"score": 100}); code != http.StatusForbidden {
+		t.Errorf("participant grading: status %d, want 403", code)
+	}
+	if code := grade(&manager, map[string]interface{}{"score": 101}); code != http.StatusBadRequest {
+		t.Errorf("score 101: status %d, want 400", code)
+	}
+	if code := grade(&manager, map[string]interface{}{"score": 60, "feedback": "half right"}); code != http.StatusOK {
+		t.Fatalf("grading: status %d, want 200", code)
+	}
+	var stored models.ContestSubmission
+	d.First(&stored, sub.ID)
+	if stored.Status != string(grading.StatusPartial) || stored.Score != 60 || stored.Feedback != "half right" {
+		t.Errorf("graded submission is %s %d %q, want partial 60", stored.Status, stored.Score, stored.Feedback)
+	}
+	if _, out := list(&manager); len(out) != 0 {
+		t.Errorf("graded submission still listed as pending: %v", out)
+	}
+
+	d.Model(&stored).Update("status", "judging")
+	if code := grade(&manager, map[string]interface{}{"score": 0}); code != http.StatusConflict {
+		t.Errorf("grading a submission being judged: status %d, want 409", code)
+	}
+}
@@ -0,0 +1,542 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/exam"
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/models"
+)
+
+type examPositionPayload struct {
+	Number  int      `json:"number"` // the position in the list if 0
+	TopicID *uint    `json:"topic_id"`
+	Type    string   `json:"type"`
+	Levels  []string `json:"levels"`
+	Tags    []string `json:"tags"`
+	Points  int      `json:"points"`
+}
+
+type blueprintPayload struct {
+	Title       string                `json:"title" binding:"required"`
+	Subject     string                `json:"subject" binding:"required"`
+	Description string                `json:"description"`
+	Positions   []examPositionPayload `json:"positions" binding:"required,min=1"`
+}
+
+// apply validates the payload and copies it into bp. It returns a message
+// for a 400 response.
+func (p *blueprintPayload) apply(bp *models.ExamBlueprint) string {
+	seen := map[int]bool{}
+	bp.Positions = make([]models.ExamPosition, len(p.Positions))
+	for i, pos := range p.Positions {
+		if pos.Number == 0 {
+			pos.Number = i + 1
+		}
+		if pos.Number < 0 || seen[pos.Number] {
+			return fmt.Sprintf("position %d: numbers must be positive and distinct", pos.Number)
+		}
+		seen[pos.Number] = true
+		if pos.Points < 0 {
+			return fmt.Sprintf("position %d: points must not be negative", pos.Number)
+		}
+		if pos.TopicID != nil {
+			var n int64
+			db.Get().Model(&models.Topic{}).Where("id = ?", *pos.TopicID).Count(&n)
+			if n == 0 {
+				return fmt.Sprintf("position %d: topic not found", pos.Number)
+			}
+		}
+		bp.Positions[i] = models.ExamPosition{
+			Number:  pos.Number,
+			TopicID: pos.TopicID,
+			Type:    pos.Type,
+			Levels:  pq.StringArray(pos.Levels),
+			Tags:    pq.StringArray(pos.Tags),
+			Points:  pos.Points,
+		}
+	}
+	sort.Slice(bp.Positions, func(a, b int) bool { return bp.Positions[a].Number < bp.Positions[b].Number })
+	bp.Title, bp.Subject, bp.Description = p.Title, p.Subject, p.Description
+	return ""
+}
+
+// canEditBlueprint reports whether the current user may change the blueprint
+func canEditBlueprint(c *gin.Context, bp *models.ExamBlueprint) bool {
+	uid, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	return bp.CreatedBy == uid.(uint) || models.HasPermission(role.(string), models.PermContentWrite)
+}
+
+// loadBlueprint loads the blueprint from the :id parameter with its
+// positions. It writes the error response itself.
+func loadBlueprint(c *gin.Context) (*models.ExamBlueprint, bool) {
+	var bp models.ExamBlueprint
+	err := db.Get().Preload("Positions", func(tx *gorm.DB) *gorm.DB { return tx.Order("number") }).
+		First(&bp, c.Param("id")).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "blueprint not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return nil, false
+	}
+	return &bp, true
+}
+
+// ListExamBlueprints godoc
+// @Summary      List exam blueprints
+// @Tags         exams
+// @Security     BearerAuth
+// @Produce      json
+// @Param        subject  query     string  false  "Subject"
+// @Success      200      {array}   models.ExamBlueprint
+// @Router       /exam-blueprints [get]
+func ListExamBlueprints() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := db.Get().Preload("Positions", func(tx *gorm.DB) *gorm.DB { return tx.Order("number") }).Order("title")
+		if s := c.Query("subject"); s != "" {
+			q = q.Where("subject = ?", s)
+		}
+		var list []models.ExamBlueprint
+		if err := q.Find(&list).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// GetExamBlueprint godoc
+// @Summary      Get an exam blueprint
+// @Tags         exams
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Blueprint ID"
+// @Success      200  {object}  models.ExamBlueprint
+// @Router       /exam-blueprints/{id} [get]
+func GetExamBlueprint() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bp, ok := loadBlueprint(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, bp)
+	}
+}
+
+// CreateExamBlueprint godoc
+// @Summary      Create an exam blueprint
+// @Description  Positions 1..N, each with optional topic, task type, difficulty levels and tags
+// @Tags         exams
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      blueprintPayload  true  "Blueprint"
+// @Success      201      {object}  models.ExamBlueprint
+// @Router       /exam-blueprints [post]
+func CreateExamBlueprint() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var p blueprintPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		uid, _ := c.Get("userID")
+		bp := models.ExamBlueprint{CreatedBy: uid.(uint)}
+		if msg := p.apply(&bp); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		if err := db.Get().Create(&bp).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
+			return
+		}
+		c.JSON(http.StatusCreated, bp)
+	}
+}
+
+// UpdateExamBlueprint godoc
+// @Summary      Update an exam blueprint
+// @Description  Variants generated earlier keep their tasks
+// @Tags         exams
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int               true  "Blueprint ID"
+// @Param        payload  body      blueprintPayload  true  "Blueprint"
+// @Success      200      {object}  models.ExamBlueprint
+// @Router       /exam-blueprints/{id} [put]
+func UpdateExamBlueprint() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bp, ok := loadBlueprint(c)
+		if !ok {
+			return
+		}
+		if !canEditBlueprint(c, bp) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not your blueprint"})
+			return
+		}
+		var p blueprintPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if msg := p.apply(bp); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		err := db.Get().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Omit("Positions").Save(bp).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("blueprint_id = ?", bp.ID).Delete(&models.ExamPosition{}).Error; err != nil {
+				return err
+			}
+			for i := range bp.Positions {
+				bp.Positions[i].BlueprintID = bp.ID
+			}
+			return tx.Create(&bp.Positions).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, bp)
+	}
+}
+
+// DeleteExamBlueprint godoc
+// @Summary      Delete an exam blueprint with its variants
+// @Tags         exams
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Blueprint ID"
+// @Success      204
+// @Router       /exam-blueprints/{id} [delete]
+func DeleteExamBlueprint() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bp, ok := loadBlueprint(c)
+		if !ok {
+			return
+		}
+		if !canEditBlueprint(c, bp) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not your blueprint"})
+			return
+		}
+		err := db.Get().Transaction(func(tx *gorm.DB) error {
+			variants := tx.Model(&models.ExamVariant{}).Select("id").Where("blueprint_id = ?", bp.ID)
+			if err := tx.Where("variant_id IN (?)", variants).Delete(&models.ExamVariantItem{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("blueprint_id = ?", bp.ID).Delete(&models.ExamVariant{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("blueprint_id = ?", bp.ID).Delete(&models.ExamPosition{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(bp).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "delete failed"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+type variantPayload struct {
+	UserID      *uint  `json:"user_id"`      // the student, the current user if empty
+	Anonymous   bool   `json:"anonymous"`    // a paper for nobody in particular
+	Seed        *int64 `json:"seed"`         // random if empty
+	AvoidRecent *int   `json:"avoid_recent"` // how many of the student's latest variants not to repeat tasks from
+}
+
+// canPrepareFor reports whether the current user may generate papers for
+// the user: themselves, students of their classes, anyone for content editors
+func canPrepareFor(c *gin.Context, userID uint) bool {
+	uid, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	if userID == uid.(uint) || role == models.RoleAdmin || models.HasPermission(role.(string), models.PermContentWrite) {
+		return true
+	}
+	var n int64
+	db.Get().Model(&models.ClassMember{}).
+		Where("user_id = ? AND class_id IN (SELECT id FROM classes WHERE teacher_id = ?)", userID, uid).
+		Count(&n)
+	return n > 0
+}
+
+// preparesExams reports whether the current user's role writes papers:
+// teachers and content editors
+func preparesExams(c *gin.Context) bool {
+	role, _ := c.Get("role")
+	return models.HasPermission(role.(string), models.PermContentWrite) || models.HasPermission(role.(string), models.PermClassesManage)
+}
+
+// canSeeAnswerKey reports whether the current user may see the variant's
+// answers: the teacher or editor who generated it
+func canSeeAnswerKey(c *gin.Context, v *models.ExamVariant) bool {
+	uid, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	return role == models.RoleAdmin || (v.CreatedBy == uid.(uint) && preparesExams(c))
+}
+
+// CreateExamVariant godoc
+// @Summary      Generate an exam variant
+// @Description  Picks a task for every position of the blueprint, avoiding tasks from the student's recent variants. The picks are stored so the paper can be printed again.
+// @Tags         exams
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int             true  "Blueprint ID"
+// @Param        payload  body      variantPayload  false  "Options"
+// @Success      201      {object}  map[string]interface{}
+// @Failure      422      {object}  map[string]interface{}
+// @Router       /exam-blueprints/{id}/variants [post]
+func CreateExamVariant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bp, ok := loadBlueprint(c)
+		if !ok {
+			return
+		}
+		var p variantPayload
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&p); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		uid, _ := c.Get("userID")
+		var student *uint
+		if !p.Anonymous {
+			id := uid.(uint)
+			if p.UserID != nil {
+				id = *p.UserID
+			}
+			if !canPrepareFor(c, id) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "not your student"})
+				return
+			}
+			student = &id
+		} else if !preparesExams(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only teachers and editors can generate anonymous papers"})
+			return
+		}
+		seed := time.Now().UnixNano()
+		if p.Seed != nil {
+			seed = *p.Seed
+		}
+		recent := exam.DefaultRecent
+		if p.AvoidRecent != nil {
+			recent = *p.AvoidRecent
+		}
+
+		v, reused, err := exam.Generate(bp, student, recent, seed)
+		if err != nil {
+			var short *exam.ShortageError
+			if errors.As(err, &short) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "position": short.Number})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		v.CreatedBy = uid.(uint)
+		if err := db.Get().Create(v).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
+			return
+		}
+		v.Blueprint = *bp
+		view, err := variantView(c, v)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		view["reused"] = reused
+		c.JSON(http.StatusCreated, view)
+	}
+}
+
+// loadVariant loads the variant from the :id parameter. Only its creator,
+// its student and content editors see it. It writes the error response itself.
+func loadVariant(c *gin.Context) (*models.ExamVariant, bool) {
+	var v models.ExamVariant
+	err := db.Get().Preload("Blueprint").Preload("Items", func(tx *gorm.DB) *gorm.DB { return tx.Order("number") }).
+		First(&v, c.Param("id")).Error
+	if err == nil {
+		uid, _ := c.Get("userID")
+		role, _ := c.Get("role")
+		own := v.CreatedBy == uid.(uint) || (v.UserID != nil && *v.UserID == uid.(uint))
+		if !own && !models.HasPermission(role.(string), models.PermContentWrite) {
+			err = gorm.ErrRecordNotFound
+		}
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "variant not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return nil, false
+	}
+	return &v, true
+}
+
+// variantTasks loads the variant's tasks with the student's parameter values
+func variantTasks(v *models.ExamVariant) ([]exam.SheetTask, error) {
+	ids := make([]uint, len(v.Items))
+	for i, it := range v.Items {
+		ids[i] = it.TaskID
+	}
+	var tasks []models.Task
+	if err := db.Get().Where("id IN ?", ids).Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*models.Task, len(tasks))
+	for i := range tasks {
+		byID[tasks[i].ID] = &tasks[i]
+	}
+	var student uint
+	if v.UserID != nil {
+		student = *v.UserID
+	}
+	out := make([]exam.SheetTask, 0, len(v.Items))
+	for _, it := range v.Items {
+		task := byID[it.TaskID]
+		if task == nil {
+			// Deleted from the bank since
+			continue
+		}
+		if err := grading.ApplyVariant(task, student); err != nil {
+			fmt.Printf("task %d variant error: %v\n", task.ID, err)
+		}
+		out = append(out, exam.SheetTask{Number: it.Number, Points: it.Points, Task: task})
+	}
+	return out, nil
+}
+
+func variantView(c *gin.Context, v *models.ExamVariant) (gin.H, error) {
+	tasks, err := variantTasks(v)
+	if err != nil {
+		return nil, err
+	}
+	key := canSeeAnswerKey(c, v)
+	items := make([]gin.H, len(tasks))
+	total := 0
+	for i, t := range tasks {
+		attachAnswerForm(t.Task)
+		hideContestSolutions(t.Task)
+		item := gin.H{"number": t.Number, "points": t.Points, "task": t.Task}
+		if key {
+			item["answer"] = grading.KeyAnswer(t.Task)
+		}
+		items[i] = item
+		total += t.Points
+	}
+	return gin.H{
+		"id":           v.ID,
+		"blueprint_id": v.BlueprintID,
+		"title":        v.Blueprint.Title,
+		"user_id":      v.UserID,
+		"seed":         v.Seed,
+		"created_by":   v.CreatedBy,
+		"created_at":   v.CreatedAt,
+		"max_points":   total,
+		"items":        items,
+	}, nil
+}
+
+// ListExamVariants godoc
+// @Summary      My exam variants
+// @Description  Variants generated by or for the current user, newest first
+// @Tags         exams
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}   models.ExamVariant
+// @Router       /exam-variants [get]
+func ListExamVariants() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, _ := c.Get("userID")
+		var list []models.ExamVariant
+		err := db.Get().Preload("Items", func(tx *gorm.DB) *gorm.DB { return tx.Order("number") }).
+			Where("created_by = ? OR user_id = ?", uid, uid).Order("id desc").Limit(100).Find(&list).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// GetExamVariant godoc
+// @Summary      Get an exam variant
+// @Description  Tasks with the student's numbers; answers only for the teacher who generated it
+// @Tags         exams
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Variant ID"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /exam-variants/{id} [get]
+func GetExamVariant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := loadVariant(c)
+		if !ok {
+			return
+		}
+		view, err := variantView(c, v)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+// ExamVariantSheet godoc
+// @Summary      Download a variant as a printable sheet
+// @Description  A LaTeX document with the tasks; key=true appends the answer key for the teacher who generated it
+// @Tags         exams
+// @Security     BearerAuth
+// @Produce      application/x-tex
+// @Param        id   path      int   true   "Variant ID"
+// @Param        key  query     bool  false  "Append the answer key"
+// @Success      200  {file}    file
+// @Router       /exam-variants/{id}/sheet [get]
+func ExamVariantSheet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := loadVariant(c)
+		if !ok {
+			return
+		}
+		key := c.Query("key") == "true" || c.Query("key") == "1"
+		if key && !canSeeAnswerKey(c, v) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "the answer key is for the teacher who generated the variant"})
+			return
+		}
+		tasks, err := variantTasks(v)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		var student string
+		if v.UserID != nil {
+			var u models.User
+			if db.Get().Select("id", "name").First(&u, *v.UserID).Error == nil {
+				student = u.Name
+			}
+		}
+		sheet := exam.Sheet(v.Blueprint.Title, student, v.ID, tasks, key)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="variant-%d.tex"`, v.ID))
+		c.Data(http.StatusOK, "application/x-tex; charset=utf-8", sheet)
+	}
+}
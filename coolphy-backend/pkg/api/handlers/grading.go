@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/judge"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/utils"
+)
+
+// taskPayload is what admins send to create or update a task, and what they
+// get back. models.Task never serializes CorrectAnswer or AnswerSpec, so they
+// are carried separately here.
+type taskPayload struct {
+	models.Task
+	CorrectAnswer *string            `json:"correct_answer"`
+	AnswerSpec    *models.AnswerSpec `json:"answer_spec"`
+	AnswerFormula *string            `json:"answer_formula"`
+}
+
+func (p taskPayload) toTask() models.Task {
+	t := p.Task
+	// The workflow fields only change through ChangeContentStatus
+	t.ReviewerID, t.PublishAt, t.PublishedAt = nil, nil, nil
+	if p.CorrectAnswer != nil {
+		t.CorrectAnswer = *p.CorrectAnswer
+	}
+	if p.AnswerSpec != nil {
+		t.AnswerSpec, _ = json.Marshal(p.AnswerSpec)
+	}
+	if p.AnswerFormula != nil {
+		t.AnswerFormula = *p.AnswerFormula
+	}
+	return t
+}
+
+// editorTask shows a task to the people who edit it, with the answer fields
+// a student never sees, in the shape the editor sends back
+func editorTask(t models.Task) taskPayload {
+	p := taskPayload{Task: t, CorrectAnswer: &t.CorrectAnswer, AnswerFormula: &t.AnswerFormula}
+	p.AnswerSpec, _ = t.DecodeAnswerSpec()
+	return p
+}
+
+// applyVariant personalizes a parametrized task for the user in the request
+// context. Anonymous visitors see the variant of user 0.
+func applyVariant(c *gin.Context, task *models.Task) {
+	var uid uint
+	if v, ok := c.Get("userID"); ok {
+		uid = v.(uint)
+	}
+	if err := grading.ApplyVariant(task, uid); err != nil {
+		fmt.Printf("task %d variant error: %v\n", task.ID, err)
+	}
+}
+
+// attachAnswerForm exposes the options and part labels of a structured task
+// without its correct answers
+func attachAnswerForm(task *models.Task) {
+	if task == nil {
+		return
+	}
+	spec, err := task.DecodeAnswerSpec()
+	if err != nil {
+		return
+	}
+	task.AnswerForm = grading.Form(task.AnswerType, spec)
+	if task.AnswerForm != nil && task.AnswerType == grading.AnswerCode {
+		if task.AnswerForm.TimeLimitMS == 0 {
+			task.AnswerForm.TimeLimitMS = judge.DefaultTimeLimitMS
+		}
+		if task.AnswerForm.MemoryLimitMB == 0 {
+			task.AnswerForm.MemoryLimitMB = judge.DefaultMemoryLimitMB
+		}
+		if len(task.AnswerForm.Languages) == 0 {
+			task.AnswerForm.Languages = judge.LanguageIDs()
+		}
+	}
+}
+
+// gradeAnswer checks the answer against the task's correct answer and only asks
+// the LLM when the deterministic checker can't decide
+func gradeAnswer(ctx context.Context, task *models.Task, answer string) grading.Result {
+	result := grading.Check(task, answer)
+	if result.Decided() {
+		return result
+	}
+	return gradeWithLLM(ctx, task, answer)
+}
+
+// gradeWithLLM asks the configured provider to evaluate a free-form answer. The
+// result stays undecided if no provider is configured or the reply is unusable.
+func gradeWithLLM(ctx context.Context, task *models.Task, answer string) grading.Result {
+	result := grading.Result{Status: grading.StatusUndecided, Feedback: "Your answer has been submitted."}
+
+	settings, err := getOrCreateSettings()
+	if err != nil {
+		return result
+	}
+	provider, err := newLLMProvider(settings)
+	if err != nil {
+		return result
+	}
+
+	prompt := fmt.Sprintf(`You are evaluating a student's answer to a physics/math problem.
+
+Problem: %s
+
+Correct Solution: %s
+
+Student's Answer: %s
+
+Evaluate if the student's answer is correct. Respond in JSON format:
+{
+  "is_correct": true/false,
+  "feedback": "brief explanation",
+  "score_percentage": 0-100
+}`, task.DescriptionLaTeX, task.SolutionLaTeX, answer)
+
+	messages := []utils.LLMMessage{
+		{Role: "system", Content: "You are an expert teacher evaluating student work. Be fair but strict."},
+		{Role: "user", Content: prompt},
+	}
+
+	aiResponse, err := provider.Chat(ctx, messages)
+	if err != nil {
+		fmt.Printf("LLM provider error: %v\n", err)
+		return result
+	}
+
+	var evalResult struct {
+		IsCorrect       bool   `json:"is_correct"`
+		Feedback        string `json:"feedback"`
+		ScorePercentage int    `json:"score_percentage"`
+	}
+	if err := json.Unmarshal([]byte(aiResponse), &evalResult); err != nil {
+		return result
+	}
+	if evalResult.IsCorrect {
+		return grading.Result{Status: grading.StatusCorrect, Score: 100, Feedback: evalResult.Feedback}
+	}
+	return grading.Result{Status: grading.StatusIncorrect, Feedback: evalResult.Feedback}
+}
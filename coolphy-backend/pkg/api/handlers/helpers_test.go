@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/db/dbtest"
+	"coolphy-backend/pkg/models"
+)
+
+func init() { gin.SetMode(gin.TestMode) }
+
+// testDB opens a fresh database for the test
+func testDB(t *testing.T) *gorm.DB {
+	return dbtest.Open(t)
+}
+
+// newUser stores a user with the given role
+func newUser(t *testing.T, d *gorm.DB, email, role string) models.User {
+	t.Helper()
+	u := models.User{Email: email, Name: email, PasswordHash: "x", Role: role}
+	if err := d.Create(&u).Error; err != nil {
+		t.Fatalf("create user %s: %v", email, err)
+	}
+	return u
+}
+
+// serve runs one request through h mounted at route, signed in as u the way
+// middleware.Auth would. A nil u makes an anonymous request.
+func serve(t *testing.T, h gin.HandlerFunc, method, route, path string, u *models.User, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	r := gin.New()
+	r.Handle(method, route, func(c *gin.Context) {
+		if u != nil {
+			c.Set("userID", u.ID)
+			c.Set("role", u.Role)
+		}
+		c.Next()
+	}, h)
+	var reader *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"coolphy-backend/pkg/latex"
+)
+
+// latexField is a LaTeX field of the content being saved, named as in its JSON
+type latexField struct {
+	name, src string
+}
+
+// lintFields lints every field and tags the issues with the field name
+func lintFields(fields []latexField) []latex.Issue {
+	issues := []latex.Issue{}
+	for _, f := range fields {
+		for _, is := range latex.Lint(f.src) {
+			is.Field = f.name
+			issues = append(issues, is)
+		}
+	}
+	return issues
+}
+
+// rejectLaTeX answers 400 with the lint issues and returns true if any of
+// the fields has errors. Warnings alone don't block saving.
+func rejectLaTeX(c *gin.Context, fields ...latexField) bool {
+	issues := lintFields(fields)
+	if !latex.HasErrors(issues) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "invalid LaTeX", "issues": issues})
+	return true
+}
+
+// taskLaTeXFields lists the LaTeX of a task, including its choice options
+func taskLaTeXFields(p taskPayload) []latexField {
+	fields := []latexField{
+		{"description_latex", p.DescriptionLaTeX},
+		{"solution_latex", p.SolutionLaTeX},
+		{"hint_latex", p.HintLaTeX},
+	}
+	if p.AnswerSpec != nil {
+		for k, o := range p.AnswerSpec.Options {
+			fields = append(fields, latexField{fmt.Sprintf("answer_spec.options[%d].text", k), o.Text})
+		}
+	}
+	return fields
+}
+
+type latexValidatePayload struct {
+	LaTeX  string            `json:"latex"`
+	Fields map[string]string `json:"fields"` // several named fields at once
+}
+
+// ValidateLaTeX godoc
+// @Summary      Check LaTeX without saving it
+// @Description  Runs the checks done when lectures and tasks are saved: balanced braces, math and environments, forbidden commands (\input, \write18, ...), unsafe links and unknown commands. Errors block saving, warnings don't.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      latexValidatePayload  true  "latex or fields"
+// @Success      200   {object}  map[string]interface{}
+// @Router       /admin/latex/validate [post]
+func ValidateLaTeX() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var p latexValidatePayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var fields []latexField
+		if p.LaTeX != "" {
+			fields = append(fields, latexField{"latex", p.LaTeX})
+		}
+		names := make([]string, 0, len(p.Fields))
+		for name := range p.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fields = append(fields, latexField{name, p.Fields[name]})
+		}
+		issues := lintFields(fields)
+		c.JSON(http.StatusOK, gin.H{"valid": !latex.HasErrors(issues), "issues": issues})
+	}
+}
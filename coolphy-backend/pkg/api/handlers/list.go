@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/listing"
+)
+
+var (
+	taskListSpec = listing.Spec{
+		Filters: map[string]listing.Column{
+			"subject":     {Name: "subject"},
+			"level":       {Name: "level"},
+			"type":        {Name: "type"},
+			"status":      {Name: "status"},
+			"answer_type": {Name: "answer_type"},
+		},
+		Tags:   "tags",
+		Topics: &listing.TopicJoin{Table: "task_topics", Column: "task_id"},
+		Sorts: map[string]listing.Column{
+			"id":         {Name: "id", Kind: listing.Int},
+			"created_at": {Name: "created_at", Kind: listing.Time},
+			"updated_at": {Name: "updated_at", Kind: listing.Time},
+			"points":     {Name: "points", Kind: listing.Int},
+			"level":      {Name: "level"},
+			"title":      {Name: "title"},
+		},
+		DefaultSort:  "-id",
+		DefaultLimit: 50,
+		MaxLimit:     200,
+	}
+
+	lectureListSpec = listing.Spec{
+		Filters: map[string]listing.Column{
+			"subject": {Name: "subject"},
+			"level":   {Name: "level"},
+			"status":  {Name: "status"},
+		},
+		Tags:   "tags",
+		Topics: &listing.TopicJoin{Table: "lecture_topics", Column: "lecture_id"},
+		Sorts: map[string]listing.Column{
+			"id":         {Name: "id", Kind: listing.Int},
+			"created_at": {Name: "created_at", Kind: listing.Time},
+			"updated_at": {Name: "updated_at", Kind: listing.Time},
+			"view_count": {Name: "view_count", Kind: listing.Int},
+			"level":      {Name: "level"},
+			"title":      {Name: "title"},
+		},
+		DefaultSort:  "-id",
+		DefaultLimit: 50,
+		MaxLimit:     200,
+	}
+
+	userListSpec = listing.Spec{
+		Filters: map[string]listing.Column{
+			"role": {Name: "role"},
+		},
+		Sorts: map[string]listing.Column{
+			"id":         {Name: "id", Kind: listing.Int},
+			"created_at": {Name: "created_at", Kind: listing.Time},
+			"points":     {Name: "points", Kind: listing.Int},
+			"name":       {Name: "name"},
+			"email":      {Name: "email"},
+		},
+		DefaultSort:  "-created_at",
+		DefaultLimit: 100,
+		MaxLimit:     200,
+		Select:       []string{"id", "email", "name", "role", "points", "created_at"},
+	}
+
+	solutionListSpec = listing.Spec{
+		Filters: map[string]listing.Column{
+			"status":  {Name: "status"},
+			"task_id": {Name: "task_id", Kind: listing.Int},
+			"verdict": {Name: "verdict"},
+		},
+		Sorts: map[string]listing.Column{
+			"id":             {Name: "id", Kind: listing.Int},
+			"created_at":     {Name: "created_at", Kind: listing.Time},
+			"points_awarded": {Name: "points_awarded", Kind: listing.Int},
+		},
+		DefaultSort:  "-created_at",
+		DefaultLimit: 100,
+		MaxLimit:     200,
+	}
+
+	noteListSpec = listing.Spec{
+		Filters: map[string]listing.Column{
+			"lecture_id": {Name: "lecture_id", Kind: listing.Int},
+		},
+		Sorts: map[string]listing.Column{
+			"id":         {Name: "id", Kind: listing.Int},
+			"created_at": {Name: "created_at", Kind: listing.Time},
+		},
+		DefaultSort:  "-created_at",
+		DefaultLimit: 100,
+		MaxLimit:     200,
+	}
+
+	notificationListSpec = listing.Spec{
+		Filters: map[string]listing.Column{
+			"type":    {Name: "type"},
+			"is_read": {Name: "is_read", Kind: listing.Bool},
+		},
+		Sorts: map[string]listing.Column{
+			"id":         {Name: "id", Kind: listing.Int},
+			"created_at": {Name: "created_at", Kind: listing.Time},
+		},
+		DefaultSort:  "-created_at",
+		DefaultLimit: 50,
+		MaxLimit:     200,
+	}
+
+	chatListSpec = listing.Spec{
+		Filters: map[string]listing.Column{
+			"context_type": {Name: "context_type"},
+			"context_id":   {Name: "context_id", Kind: listing.Int},
+		},
+		Sorts: map[string]listing.Column{
+			"id":        {Name: "id", Kind: listing.Int},
+			"timestamp": {Name: "timestamp", Kind: listing.Time},
+		},
+		DefaultSort:  "-timestamp",
+		DefaultLimit: 50,
+		MaxLimit:     200,
+	}
+)
+
+// adminSpec is spec with the admin panel's defaults: newest first, 100 per page
+func adminSpec(spec listing.Spec) listing.Spec {
+	spec.DefaultSort = "-created_at"
+	spec.DefaultLimit = 100
+	return spec
+}
+
+// findPage loads one page of a list endpoint and reports the total count and
+// the next cursor in the X-Total-Count and X-Next-Cursor headers, so the body
+// stays a plain array; middleware.CORS exposes them to browsers. It writes the
+// error response itself and returns false on failure.
+func findPage[T any](c *gin.Context, tx *gorm.DB, spec listing.Spec, out *[]T) bool {
+	page, err := listing.Find(tx, c.Request.URL.Query(), spec, out)
+	if err != nil {
+		var perr *listing.ParamError
+		if errors.As(err, &perr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": perr.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		}
+		return false
+	}
+	if *out == nil {
+		*out = []T{}
+	}
+	c.Header("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	c.Header("X-Next-Cursor", page.NextCursor)
+	return true
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/latex"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/revisions"
+	"coolphy-backend/pkg/taskcheck"
+	"coolphy-backend/pkg/tikz"
+)
+
+// revisionAuthor returns the signed in user as a revision author
+func revisionAuthor(c *gin.Context) *uint {
+	uid, ok := c.Get("userID")
+	if !ok {
+		return nil
+	}
+	id := uid.(uint)
+	return &id
+}
+
+// revisionTarget reads the entity ID from the path and checks it exists
+func revisionTarget(c *gin.Context, entityType string) (uint, bool) {
+	id, ok := contentID(c)
+	if !ok {
+		return 0, false
+	}
+	var model any = &models.Lecture{}
+	if entityType == models.ContentTask {
+		model = &models.Task{}
+	}
+	var n int64
+	if err := db.Get().Model(model).Where("id = ?", id).Count(&n).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return 0, false
+	}
+	if n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": entityType + " not found"})
+		return 0, false
+	}
+	return id, true
+}
+
+// findRevision loads revision number from the path or query parameter name
+func findRevision(c *gin.Context, entityType string, id uint, number string) (*models.Revision, bool) {
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision number"})
+		return nil, false
+	}
+	rev, err := revisions.Find(db.Get(), entityType, id, n)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return nil, false
+	}
+	return rev, true
+}
+
+// ListRevisions godoc
+// @Summary      List the revisions of a lecture or task
+// @Description  Newest first, without snapshots
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Lecture or task ID"
+// @Success      200  {array}   models.Revision
+// @Router       /admin/lectures/{id}/revisions [get]
+// @Router       /admin/tasks/{id}/revisions [get]
+func ListRevisions(entityType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := revisionTarget(c, entityType)
+		if !ok {
+			return
+		}
+		var items []models.Revision
+		if err := db.Get().Omit("snapshot").Preload("Author").
+			Where("entity_type = ? AND entity_id = ?", entityType, id).
+			Order("number DESC").Find(&items).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	}
+}
+
+// GetRevision godoc
+// @Summary      Get a revision with its snapshot
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Lecture or task ID"
+// @Param        rev  path      int  true  "Revision number"
+// @Success      200  {object}  models.Revision
+// @Router       /admin/lectures/{id}/revisions/{rev} [get]
+// @Router       /admin/tasks/{id}/revisions/{rev} [get]
+func GetRevision(entityType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := revisionTarget(c, entityType)
+		if !ok {
+			return
+		}
+		rev, ok := findRevision(c, entityType, id, c.Param("rev"))
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, rev)
+	}
+}
+
+// DiffRevisions godoc
+// @Summary      Compare two revisions
+// @Description  Changed fields from revision rev to revision to (the latest by default). Text fields come as unified diff hunks of lines.
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true   "Lecture or task ID"
+// @Param        rev  path      int  true   "Revision number to compare from"
+// @Param        to   query     int  false  "Revision number to compare to"
+// @Success      200  {object}  map[string]interface{}
+// @Router       /admin/lectures/{id}/revisions/{rev}/diff [get]
+// @Router       /admin/tasks/{id}/revisions/{rev}/diff [get]
+func DiffRevisions(entityType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := revisionTarget(c, entityType)
+		if !ok {
+			return
+		}
+		from, ok := findRevision(c, entityType, id, c.Param("rev"))
+		if !ok {
+			return
+		}
+		var to *models.Revision
+		if q := c.Query("to"); q != "" {
+			if to, ok = findRevision(c, entityType, id, q); !ok {
+				return
+			}
+		} else {
+			var err error
+			if to, err = revisions.Latest(db.Get(), entityType, id); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+				return
+			}
+		}
+		changes, err := revisions.Compare(from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"from": from.Number, "to": to.Number, "changes": changes})
+	}
+}
+
+// errRestoreRejected rolls back a restore whose content no longer passes the
+// checks done on save
+var errRestoreRejected = errors.New("restored content is invalid")
+
+// checkRestored runs the checks of the lecture and task editors on the
+// restored entity. It returns the response body to reject it with, or nil.
+func checkRestored(tx *gorm.DB, entityType string, id uint) (gin.H, error) {
+	var fields []latexField
+	if entityType == models.ContentLecture {
+		var l models.Lecture
+		if err := tx.First(&l, id).Error; err != nil {
+			return nil, err
+		}
+		fields = []latexField{{"content_latex", l.ContentLaTeX}}
+	} else {
+		var t models.Task
+		if err := tx.First(&t, id).Error; err != nil {
+			return nil, err
+		}
+		if err := taskcheck.Validate(&t); err != nil {
+			return gin.H{"error": err.Error()}, nil
+		}
+		fields = taskLaTeXFields(editorTask(t))
+	}
+	if issues := lintFields(fields); latex.HasErrors(issues) {
+		return gin.H{"error": "invalid LaTeX", "issues": issues}, nil
+	}
+	return nil, nil
+}
+
+// RestoreRevision godoc
+// @Summary      Restore a revision
+// @Description  Writes the content of the revision back and records it as a new revision. Status and author are kept. The restored content goes through the checks of the editor; an old revision that fails them (LaTeX errors, grading settings no longer accepted) is not restored. Like any save it is not reviewed: restoring a revision of published content is live at once.
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Lecture or task ID"
+// @Param        rev  path      int  true  "Revision number"
+// @Success      200  {object}  models.Revision
+// @Failure      422  {object}  map[string]interface{}
+// @Router       /admin/lectures/{id}/revisions/{rev}/restore [post]
+// @Router       /admin/tasks/{id}/revisions/{rev}/restore [post]
+func RestoreRevision(entityType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := revisionTarget(c, entityType)
+		if !ok {
+			return
+		}
+		number, err := strconv.Atoi(c.Param("rev"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision number"})
+			return
+		}
+		var rev *models.Revision
+		var rejected gin.H
+		err = db.Get().Transaction(func(tx *gorm.DB) error {
+			if rev, err = revisions.Restore(tx, entityType, id, number, revisionAuthor(c)); err != nil {
+				return err
+			}
+			if rejected, err = checkRestored(tx, entityType, id); err != nil {
+				return err
+			}
+			if rejected != nil {
+				return errRestoreRejected
+			}
+			return nil
+		})
+		if rejected != nil {
+			c.JSON(http.StatusUnprocessableEntity, rejected)
+			return
+		}
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "restore failed"})
+			return
+		}
+		if entityType == models.ContentLecture {
+			var l models.Lecture
+			if db.Get().First(&l, id).Error == nil {
+				tikz.Enqueue(l.ContentLaTeX)
+			}
+		} else {
+			var t models.Task
+			if db.Get().First(&t, id).Error == nil {
+				tikz.Enqueue(t.DescriptionLaTeX, t.SolutionLaTeX, t.HintLaTeX)
+			}
+		}
+		c.JSON(http.StatusOK, rev)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/revisions"
+)
+
+func TestRestoreRevisionValidates(t *testing.T) {
+	d := testDB(t)
+	editor := newUser(t, d, "editor@example.com", models.RoleEditor)
+
+	// Revisions 1 and 2 hold content saved before today's checks existed
+	task := models.Task{Title: "Speed", DescriptionLaTeX: `\input{/etc/passwd}`, AnswerType: grading.AnswerNumeric, CorrectAnswer: "10", Status: models.StatusDraft}
+	d.Create(&task)
+	record := func() {
+		if _, err := revisions.Record(d, models.ContentTask, task.ID, &editor.ID, models.RevisionUpdate, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record()
+	d.Model(&task).Updates(models.Task{DescriptionLaTeX: "Find $v$.", CorrectAnswer: "ten"})
+	record()
+	d.Model(&task).Updates(models.Task{CorrectAnswer: "10 m/s"})
+	record()
+
+	restore := func(number int) *httptest.ResponseRecorder {
+		return serve(t, RestoreRevision(models.ContentTask), http.MethodPost, "/admin/tasks/:id/revisions/:rev/restore",
+			fmt.Sprintf("/admin/tasks/%d/revisions/%d/restore", task.ID, number), &editor, nil)
+	}
+	for _, c := range []struct {
+		number int
+		reason string
+	}{{1, "invalid LaTeX"}, {2, "correct_answer is not a number"}} {
+		if w := restore(c.number); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), c.reason) {
+			t.Errorf("restoring revision %d: status %d %s, want 422 %s", c.number, w.Code, w.Body, c.reason)
+		}
+	}
+	var stored models.Task
+	d.First(&stored, task.ID)
+	if stored.DescriptionLaTeX != "Find $v$." || stored.CorrectAnswer != "10 m/s" {
+		t.Errorf("rejected restores changed the task: %q %q", stored.DescriptionLaTeX, stored.CorrectAnswer)
+	}
+	var n int64
+	d.Model(&models.Revision{}).Where("entity_id = ?", task.ID).Count(&n)
+	if n != 3 {
+		t.Errorf("%d revisions after rejected restores, want 3", n)
+	}
+
+	if w := restore(3); w.Code != http.StatusOK {
+		t.Errorf("restoring a valid revision: status %d %s, want 200", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+)
+
+// loadManagedUser loads the user from the :id parameter and checks that the
+// caller's role covers every permission of the user's role, so moderators
+// can't act on admins. It writes the error response itself.
+func loadManagedUser(c *gin.Context) (*models.User, bool) {
+	var u models.User
+	if err := db.Get().First(&u, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return nil, false
+	}
+	role, _ := c.Get("role")
+	if !models.Outranks(role.(string), u.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "cannot manage a user with more permissions than you"})
+		return nil, false
+	}
+	return &u, true
+}
+
+// checkRoleChange returns why the caller may not give u the role, nil if they may
+func checkRoleChange(c *gin.Context, u *models.User, role string) error {
+	actorRole, _ := c.Get("role")
+	actorID, _ := c.Get("userID")
+	switch {
+	case !models.ValidRole(role):
+		return fmt.Errorf("unknown role %q", role)
+	case !models.HasPermission(actorRole.(string), models.PermRolesAssign):
+		return errors.New("insufficient permissions to assign roles")
+	case u.ID == actorID.(uint):
+		return errors.New("cannot change your own role")
+	case !models.Outranks(actorRole.(string), role):
+		return errors.New("cannot assign a role with more permissions than yours")
+	}
+	return nil
+}
+
+// ListRoles godoc
+// @Summary      List roles and their permissions (admin)
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}   map[string]interface{}
+// @Router       /admin/roles [get]
+func ListRoles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roles := models.Roles()
+		out := make([]gin.H, len(roles))
+		for i, r := range roles {
+			out[i] = gin.H{"role": r, "permissions": models.Permissions(r)}
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
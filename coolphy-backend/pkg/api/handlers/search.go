@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	"coolphy-backend/pkg/db"
+)
+
+// searchHit is one ranked search result
+type searchHit struct {
+	Type    string         `json:"type"` // lecture, task, topic
+	ID      uint           `json:"id"`
+	Title   string         `json:"title"`
+	Subject string         `json:"subject"`
+	Level   string         `json:"level,omitempty"`
+	Tags    pq.StringArray `json:"tags" gorm:"type:text[]"`
+	Rank    float64        `json:"rank"`
+	Snippet string         `json:"snippet"` // HTML: escaped text, matches in <mark>
+}
+
+// Per type: the matching query and the text snippets are cut from. Both read
+// the search_vector columns from migrations/006_add_search.sql.
+var searchSources = map[string]struct{ match, snippetTable, snippetText string }{
+	"lecture": {
+		match: `SELECT 'lecture' AS type, l.id, l.title, l.subject, l.level, l.tags, ts_rank_cd(l.search_vector, q.query) AS rank
+			FROM lectures l, q WHERE l.search_vector @@ q.query AND l.status = 'published'`,
+		snippetTable: "lectures",
+		snippetText:  "coalesce(summary, '') || ' ' || strip_latex(content_la_te_x)",
+	},
+	"task": {
+		match: `SELECT 'task' AS type, t.id, t.title, t.subject, t.level, t.tags, ts_rank_cd(t.search_vector, q.query) AS rank
+			FROM tasks t, q WHERE t.search_vector @@ q.query AND t.status = 'published'`,
+		snippetTable: "tasks",
+		snippetText:  "strip_latex(description_la_te_x)",
+	},
+	"topic": {
+		match: `SELECT 'topic' AS type, tp.id, tp.title, tp.subject, '' AS level, NULL::text[] AS tags, ts_rank_cd(tp.search_vector, q.query) AS rank
+			FROM topics tp, q WHERE tp.search_vector @@ q.query`,
+		snippetTable: "topics",
+		snippetText:  "strip_latex(description)",
+	},
+}
+
+var searchTypes = []string{"lecture", "task", "topic"}
+
+// ts_headline marks matches with private use characters, which are removed
+// from the text first; the snippet is escaped before they become <mark> tags,
+// so markup in the content can't get into the page
+const (
+	markStart       = "\uE000"
+	markStop        = "\uE001"
+	headlineOptions = `StartSel="` + markStart + `", StopSel="` + markStop + `", MinWords=10, MaxWords=30, MaxFragments=2, FragmentDelimiter=" … "`
+)
+
+var markReplacer = strings.NewReplacer(markStart, "<mark>", markStop, "</mark>")
+
+// snippetHTML escapes a ts_headline snippet and turns the marks into tags
+func snippetHTML(s string) string {
+	return markReplacer.Replace(html.EscapeString(s))
+}
+
+// Search godoc
+// @Summary      Full-text search across lectures, tasks and topics
+// @Tags         search
+// @Produce      json
+// @Param        q        query     string  true   "Search query (websearch syntax: quotes, OR, -word)"
+// @Param        type     query     string  false  "lecture, task or topic"
+// @Param        subject  query     string  false  "Subject filter"
+// @Param        level    query     string  false  "Level filter"
+// @Param        tag      query     string  false  "Tag filter"
+// @Param        limit    query     int     false  "Page size (default 20, max 50)"
+// @Param        offset   query     int     false  "Offset"
+// @Success      200      {object}  map[string]interface{}
+// @Failure      400      {object}  map[string]interface{}
+// @Router       /search [get]
+func Search() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := strings.TrimSpace(c.Query("q"))
+		if q == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+			return
+		}
+		types := searchTypes
+		if t := c.Query("type"); t != "" {
+			if _, ok := searchSources[t]; !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "type must be lecture, task or topic"})
+				return
+			}
+			types = []string{t}
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if limit <= 0 || limit > 50 {
+			limit = 20
+		}
+		offset, _ := strconv.Atoi(c.Query("offset"))
+		if offset < 0 {
+			offset = 0
+		}
+
+		f := searchFilter{subject: c.Query("subject"), level: c.Query("level"), tag: c.Query("tag")}
+		pageSQL, pageArgs := searchPageQuery(types, q, f, limit, offset)
+		hits := []searchHit{}
+		if err := db.Get().Raw(pageSQL, pageArgs...).Scan(&hits).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
+			return
+		}
+		var total int64
+		totalSQL, totalArgs := searchTotalQuery(types, q, f)
+		if err := db.Get().Raw(totalSQL, totalArgs...).Scan(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
+			return
+		}
+		var counts []searchFacetCount
+		facetSQL, facetArgs := searchFacetQuery(types, q)
+		if err := db.Get().Raw(facetSQL, facetArgs...).Scan(&counts).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
+			return
+		}
+		attachSnippets(q, hits)
+
+		c.JSON(http.StatusOK, gin.H{
+			"query":   q,
+			"total":   total,
+			"results": hits,
+			"facets":  searchFacets(counts),
+		})
+	}
+}
+
+// searchFilter narrows the matches to a subject, level and tag, each
+// optional
+type searchFilter struct {
+	subject, level, tag string
+}
+
+func (f searchFilter) where() (string, []any) {
+	var conds []string
+	var args []any
+	if f.subject != "" {
+		conds, args = append(conds, "m.subject = ?"), append(args, f.subject)
+	}
+	if f.level != "" {
+		conds, args = append(conds, "m.level = ?"), append(args, f.level)
+	}
+	if f.tag != "" {
+		conds, args = append(conds, "? = ANY(m.tags)"), append(args, f.tag)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// searchMatches is the common table m of everything of the types matching
+// the query, which the page, total and facet queries read from
+func searchMatches(types []string) string {
+	parts := make([]string, len(types))
+	for i, t := range types {
+		parts[i] = searchSources[t].match
+	}
+	return "WITH q AS (SELECT websearch_to_tsquery('russian', ?) AS query),\nm AS (\n" +
+		strings.Join(parts, "\nUNION ALL\n") + "\n)\n"
+}
+
+// searchPageQuery selects one page of the filtered matches, best first
+func searchPageQuery(types []string, q string, f searchFilter, limit, offset int) (string, []any) {
+	where, args := f.where()
+	return searchMatches(types) + "SELECT * FROM m" + where + " ORDER BY rank DESC, id DESC LIMIT ? OFFSET ?",
+		append(append([]any{q}, args...), limit, offset)
+}
+
+// searchTotalQuery counts all the filtered matches
+func searchTotalQuery(types []string, q string, f searchFilter) (string, []any) {
+	where, args := f.where()
+	return searchMatches(types) + "SELECT count(*) FROM m" + where, append([]any{q}, args...)
+}
+
+// searchFacetCount is a row of searchFacetQuery
+type searchFacetCount struct {
+	Facet string
+	Value string
+	N     int
+}
+
+// searchFacetQuery counts the matches per subject, level and tag. Facets
+// are counted before the facet filters so the client can still offer the
+// other values.
+func searchFacetQuery(types []string, q string) (string, []any) {
+	return searchMatches(types) +
+		`SELECT 'subject' AS facet, m.subject AS value, count(*) AS n FROM m WHERE m.subject <> '' GROUP BY m.subject
+UNION ALL SELECT 'level', m.level, count(*) FROM m WHERE m.level <> '' GROUP BY m.level
+UNION ALL SELECT 'tag', tag, count(*) FROM m, unnest(m.tags) AS tag GROUP BY tag`, []any{q}
+}
+
+func searchFacets(counts []searchFacetCount) gin.H {
+	facets := map[string]map[string]int{"subject": {}, "level": {}, "tag": {}}
+	for _, fc := range counts {
+		facets[fc.Facet][fc.Value] = fc.N
+	}
+	return gin.H{"subject": facets["subject"], "level": facets["level"], "tag": facets["tag"]}
+}
+
+// attachSnippets fills in highlighted snippets for the current page only,
+// ts_headline is too slow to run on every match
+func attachSnippets(q string, hits []searchHit) {
+	ids := map[string][]uint{}
+	for _, h := range hits {
+		ids[h.Type] = append(ids[h.Type], h.ID)
+	}
+	snippets := map[string]map[uint]string{}
+	for t, list := range ids {
+		src := searchSources[t]
+		var rows []struct {
+			ID      uint
+			Snippet string
+		}
+		err := db.Get().Raw(
+			"SELECT id, ts_headline('russian', translate("+src.snippetText+", ?, ''), websearch_to_tsquery('russian', ?), ?) AS snippet FROM "+src.snippetTable+" WHERE id IN ?",
+			markStart+markStop, q, headlineOptions, list,
+		).Scan(&rows).Error
+		if err != nil {
+			continue
+		}
+		snippets[t] = map[uint]string{}
+		for _, r := range rows {
+			snippets[t][r.ID] = snippetHTML(r.Snippet)
+		}
+	}
+	for i := range hits {
+		hits[i].Snippet = snippets[hits[i].Type][hits[i].ID]
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearchQueriesFilterInSQL(t *testing.T) {
+	f := searchFilter{subject: "physics", level: "school", tag: "optics"}
+	sql, args := searchPageQuery([]string{"lecture", "task"}, "lens", f, 20, 40)
+	if !strings.Contains(sql, "WHERE m.subject = ? AND m.level = ? AND ? = ANY(m.tags) ORDER BY rank DESC, id DESC LIMIT ? OFFSET ?") {
+		t.Errorf("page query does not filter and page in SQL:\n%s", sql)
+	}
+	if want := []any{"lens", "physics", "school", "optics", 20, 40}; !reflect.DeepEqual(args, want) {
+		t.Errorf("page args %v, want %v", args, want)
+	}
+	if strings.Contains(sql, "FROM topics") || strings.Count(sql, "UNION ALL") != 1 {
+		t.Errorf("page query searches other types:\n%s", sql)
+	}
+	if strings.Count(sql, "?") != len(args) {
+		t.Errorf("page query has %d placeholders for %d args", strings.Count(sql, "?"), len(args))
+	}
+
+	sql, args = searchTotalQuery(searchTypes, "lens", searchFilter{tag: "optics"})
+	if !strings.HasSuffix(sql, "SELECT count(*) FROM m WHERE ? = ANY(m.tags)") || !reflect.DeepEqual(args, []any{"lens", "optics"}) {
+		t.Errorf("total query %q %v, want a filtered count", sql, args)
+	}
+	if strings.Contains(sql, "LIMIT") {
+		t.Errorf("total query is cut off:\n%s", sql)
+	}
+
+	sql, args = searchTotalQuery(searchTypes, "lens", searchFilter{})
+	if strings.Contains(sql, "WHERE m.") || len(args) != 1 {
+		t.Errorf("unfiltered total query %q %v has filters", sql, args)
+	}
+
+	sql, args = searchFacetQuery(searchTypes, "lens")
+	if strings.Contains(sql, "LIMIT") || strings.Count(sql, "?") != 1 || len(args) != 1 {
+		t.Errorf("facet query %q %v, want every match counted", sql, args)
+	}
+}
+
+func TestSearchFacets(t *testing.T) {
+	got := searchFacets([]searchFacetCount{
+		{"subject", "physics", 3}, {"level", "school", 2}, {"tag", "optics", 1}, {"tag", "waves", 2},
+	})
+	want := map[string]map[string]int{
+		"subject": {"physics": 3}, "level": {"school": 2}, "tag": {"optics": 1, "waves": 2},
+	}
+	for facet, values := range want {
+		if !reflect.DeepEqual(got[facet], values) {
+			t.Errorf("%s facet %v, want %v", facet, got[facet], values)
+		}
+	}
+	if empty := searchFacets(nil); len(empty["tag"].(map[string]int)) != 0 {
+		t.Errorf("facets of no matches: %v", empty)
+	}
+}
+
+func TestSnippetHTML(t *testing.T) {
+	got := snippetHTML("a <b>" + markStart + "lens" + markStop + " & more")
+	if want := "a &lt;b&gt;<mark>lens</mark> &amp; more"; got != want {
+		t.Errorf("snippet %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"coolphy-backend/internal/config"
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/utils"
+)
+
+// startSession creates a session for the user and returns the token pair
+// to send to the client
+func startSession(c *gin.Context, cfg config.Config, u *models.User) (gin.H, error) {
+	refresh, err := utils.RandomToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	s := models.Session{
+		UserID:           u.ID,
+		RefreshTokenHash: utils.HashToken(refresh),
+		UserAgent:        c.Request.UserAgent(),
+		IP:               c.ClientIP(),
+		ExpiresAt:        now.Add(cfg.RefreshTokenTTL),
+		LastUsedAt:       now,
+	}
+	if err := db.Get().Create(&s).Error; err != nil {
+		return nil, err
+	}
+	return issueTokens(cfg, u, &s, refresh)
+}
+
+func issueTokens(cfg config.Config, u *models.User, s *models.Session, refresh string) (gin.H, error) {
+	token, err := utils.SignSessionJWT(cfg.JWTSecret, u.ID, u.Role, s.ID, cfg.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"token":         token,
+		"refresh_token": refresh,
+		"expires_in":    int(cfg.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// revokeUserSessions ends all sessions of a user except keep (0 for none)
+func revokeUserSessions(userID, keep uint) error {
+	return db.Get().Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keep).
+		Update("revoked_at", time.Now()).Error
+}
+
+type refreshPayload struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshToken godoc
+// @Summary      Refresh access token
+// @Description  Exchanges a refresh token for a new access token and a new refresh token; the old one stops working
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      refreshPayload  true  "Refresh token"
+// @Success      200      {object}  map[string]interface{}
+// @Failure      401      {object}  map[string]interface{}
+// @Router       /auth/refresh [post]
+func RefreshToken(cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var p refreshPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		hash := utils.HashToken(p.RefreshToken)
+		var s models.Session
+		if err := db.Get().Where("refresh_token_hash = ?", hash).First(&s).Error; err != nil {
+			if err != gorm.ErrRecordNotFound {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+				return
+			}
+			// A rotated-out token coming back means it was stolen: end that session
+			if err := db.Get().Where("previous_token_hash = ?", hash).First(&s).Error; err == nil {
+				db.Get().Model(&s).Update("revoked_at", time.Now())
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+			return
+		}
+		if !s.Active() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "session expired"})
+			return
+		}
+		var u models.User
+		if err := db.Get().First(&u, s.UserID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+			return
+		}
+
+		refresh, err := utils.RandomToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "token error"})
+			return
+		}
+		// Rotate only if nobody else rotated this token in the meantime
+		res := db.Get().Model(&models.Session{}).
+			Where("id = ? AND refresh_token_hash = ?", s.ID, hash).
+			Updates(map[string]interface{}{
+				"refresh_token_hash":  utils.HashToken(refresh),
+				"previous_token_hash": hash,
+				"last_used_at":        time.Now(),
+				"ip":                  c.ClientIP(),
+			})
+		if res.Error != nil || res.RowsAffected == 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+			return
+		}
+		tokens, err := issueTokens(cfg, &u, &s, refresh)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "jwt error"})
+			return
+		}
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// Logout godoc
+// @Summary      Logout
+// @Description  Revokes the current session, identified by the access token or by a refresh token in the body
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      refreshPayload  false  "Refresh token"
+// @Success      200      {object}  map[string]interface{}
+// @Router       /auth/logout [post]
+func Logout(cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The access token may already be expired, so the refresh token works too
+		q := db.Get().Model(&models.Session{}).Where("revoked_at IS NULL")
+		h := c.GetHeader("Authorization")
+		var p refreshPayload
+		if claims, err := utils.ParseJWT(cfg.JWTSecret, strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))); err == nil && claims.SessionID != 0 {
+			q = q.Where("id = ?", claims.SessionID)
+		} else if c.ShouldBindJSON(&p) == nil {
+			q = q.Where("refresh_token_hash = ?", utils.HashToken(p.RefreshToken))
+		} else {
+			c.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
+			return
+		}
+		if err := q.Update("revoked_at", time.Now()).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "logout failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
+	}
+}
+
+// ListSessions godoc
+// @Summary      List my active sessions
+// @Tags         auth
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}   map[string]interface{}
+// @Router       /sessions [get]
+func ListSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		current, _ := c.Get("sessionID")
+		var sessions []models.Session
+		if err := db.Get().Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+			Order("last_used_at desc").Find(&sessions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		out := make([]gin.H, len(sessions))
+		for i, s := range sessions {
+			out[i] = gin.H{
+				"id":           s.ID,
+				"user_agent":   s.UserAgent,
+				"ip":           s.IP,
+				"created_at":   s.CreatedAt,
+				"last_used_at": s.LastUsedAt,
+				"expires_at":   s.ExpiresAt,
+				"current":      s.ID == current,
+			}
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// RevokeSession godoc
+// @Summary      Revoke one of my sessions
+// @Tags         auth
+// @Security     BearerAuth
+// @Param        id   path      int  true  "Session ID"
+// @Success      204
+// @Failure      404  {object}  map[string]interface{}
+// @Router       /sessions/{id} [delete]
+func RevokeSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		res := db.Get().Model(&models.Session{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), userID).
+			Update("revoked_at", time.Now())
+		if res.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke failed"})
+			return
+		}
+		if res.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// RevokeOtherSessions godoc
+// @Summary      Log out everywhere else
+// @Tags         auth
+// @Security     BearerAuth
+// @Success      204
+// @Router       /sessions [delete]
+func RevokeOtherSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		current, _ := c.Get("sessionID")
+		if err := revokeUserSessions(userID.(uint), current.(uint)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke failed"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+)
+
+// SubjectPerformance is a user's result in one subject
+type SubjectPerformance struct {
+	Subject      string  `json:"subject"`
+	Correct      int64   `json:"correct"`
+	Total        int64   `json:"total"`
+	PointsEarned int     `json:"points_earned"`
+	SuccessRate  float64 `json:"success_rate"`
+}
+
+// subjectPerformance computes per-subject results for each of the users
+func subjectPerformance(userIDs []uint) map[uint][]SubjectPerformance {
+	out := map[uint][]SubjectPerformance{}
+	if len(userIDs) == 0 {
+		return out
+	}
+	rows, err := db.Get().Raw(`
+		SELECT
+			sa.user_id,
+			t.subject,
+			COUNT(CASE WHEN sa.status = 'correct' THEN 1 END) as correct,
+			COUNT(*) as total,
+			COALESCE(SUM(sa.points_awarded), 0) as points_earned
+		FROM solution_attempts sa
+		JOIN tasks t ON sa.task_id = t.id
+		WHERE sa.user_id IN ?
+		GROUP BY sa.user_id, t.subject
+		ORDER BY t.subject
+	`, userIDs).Rows()
+	if err != nil {
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var uid uint
+		var sp SubjectPerformance
+		if err := rows.Scan(&uid, &sp.Subject, &sp.Correct, &sp.Total, &sp.PointsEarned); err == nil {
+			if sp.Total > 0 {
+				sp.SuccessRate = float64(sp.Correct) / float64(sp.Total) * 100
+			}
+			out[uid] = append(out[uid], sp)
+		}
+	}
+	return out
+}
+
+// userStats is the body of the profile stats endpoints
+func userStats(u *models.User) gin.H {
+	var solvedCount int64
+	db.Get().Model(&models.SolutionAttempt{}).Where("user_id = ? AND status = ?", u.ID, "correct").Count(&solvedCount)
+	var totalAttempts int64
+	db.Get().Model(&models.SolutionAttempt{}).Where("user_id = ?", u.ID).Count(&totalAttempts)
+
+	return gin.H{
+		"points":              u.Points,
+		"solved_count":        solvedCount,
+		"total_attempts":      totalAttempts,
+		"subjects":            u.Subjects,
+		"subject_performance": subjectPerformance([]uint{u.ID})[u.ID],
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/taskimport"
+)
+
+const maxTaskImportSize = int64(32 << 20) // 32 MiB
+
+// ImportTasks godoc
+// @Summary      Import tasks from a spreadsheet or question bank
+// @Description  Accepts CSV, XLSX, Moodle XML and QTI 2.1 (an item or a content package zip). The file is processed in the background; poll the returned job. Spreadsheet headers are matched to task fields (title, description, subject, level, type, tags, answer_type, answer, unit, tolerance, tolerance_mode, solution, hint, points, options, answer_spec); `columns` maps other headers. Valid rows become draft tasks, the others are listed with their errors.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file      formData  file    true   "File to import"
+// @Param        format    formData  string  false  "csv, xlsx, moodle or qti; guessed from the file otherwise"
+// @Param        subject   formData  string  false  "Subject of rows without one"
+// @Param        level     formData  string  false  "Level of rows without one"
+// @Param        type      formData  string  false  "Type of rows without one"
+// @Param        topic_id  formData  int     false  "Topic for all imported tasks"
+// @Param        columns   formData  string  false  "JSON object mapping headers to task fields"
+// @Param        sheet     formData  string  false  "XLSX sheet name"
+// @Param        dry_run   formData  bool    false  "Only validate"
+// @Success      202       {object}  models.ImportJob
+// @Router       /admin/tasks/import [post]
+func ImportTasks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxTaskImportSize)
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "storage error"})
+			return
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid upload payload"})
+			return
+		}
+
+		format := c.PostForm("format")
+		if format == "" {
+			format = taskimport.Detect(fh.Filename, data)
+		}
+		switch format {
+		case taskimport.FormatCSV, taskimport.FormatXLSX, taskimport.FormatMoodle, taskimport.FormatQTI:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, xlsx, moodle or qti"})
+			return
+		}
+		opts := taskimport.Options{
+			Subject: c.PostForm("subject"),
+			Level:   c.PostForm("level"),
+			Type:    c.PostForm("type"),
+			Sheet:   c.PostForm("sheet"),
+		}
+		if v := c.PostForm("columns"); v != "" {
+			if err := json.Unmarshal([]byte(v), &opts.Columns); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "columns must be a JSON object of header to field"})
+				return
+			}
+		}
+		if v := c.PostForm("topic_id"); v != "" {
+			id, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid topic_id"})
+				return
+			}
+			var topic models.Topic
+			if err := db.Get().Select("id").First(&topic, id).Error; err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "topic not found"})
+				return
+			}
+			opts.TopicID = &topic.ID
+		}
+		rawOpts, _ := json.Marshal(opts)
+
+		uid, _ := c.Get("userID")
+		job := models.ImportJob{
+			UserID:   uid.(uint),
+			Format:   format,
+			FileName: fh.Filename,
+			Options:  rawOpts,
+			DryRun:   c.PostForm("dry_run") == "true",
+			Status:   models.ImportPending,
+		}
+		if err := db.Get().Create(&job).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
+			return
+		}
+		if err := taskimport.Submit(job.ID, data); err != nil {
+			db.Get().Model(&job).Updates(map[string]interface{}{"status": models.ImportFailed, "error": err.Error()})
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// GetImportJob godoc
+// @Summary      Progress and row errors of a task import
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Job ID"
+// @Success      200  {object}  models.ImportJob
+// @Router       /admin/tasks/import/{id} [get]
+func GetImportJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var job models.ImportJob
+		if err := db.Get().First(&job, c.Param("id")).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "import not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// ListImportJobs godoc
+// @Summary      Recent task imports
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        mine  query     bool  false  "Only my imports"
+// @Success      200   {array}   models.ImportJob
+// @Router       /admin/tasks/import [get]
+func ListImportJobs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := db.Get().Omit("errors", "task_ids").Order("id DESC").Limit(50)
+		if c.Query("mine") == "true" {
+			uid, _ := c.Get("userID")
+			q = q.Where("user_id = ?", uid)
+		}
+		var jobs []models.ImportJob
+		if err := q.Find(&jobs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(http.StatusOK, jobs)
+	}
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ulule/limiter/v3"
+	memory "github.com/ulule/limiter/v3/drivers/store/memory"
+	"gorm.io/gorm"
+
+	"coolphy-backend/internal/config"
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/utils"
+)
+
+const (
+	totpIssuer        = "CoolPhy"
+	mfaPendingTTL     = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// A 6-digit code is guessable without a per-account limit on top of the per-IP one
+var totpAttempts = limiter.New(memory.NewStore(), limiter.Rate{Period: 5 * time.Minute, Limit: 5})
+
+func totpAttemptAllowed(userID uint) bool {
+	ctx, err := totpAttempts.Get(context.Background(), "totp:"+strconv.FormatUint(uint64(userID), 10))
+	return err == nil && !ctx.Reached
+}
+
+// checkTOTP validates a code for the user and records its time step so the
+// same code can't be used twice
+func checkTOTP(u *models.User, code string) bool {
+	step, ok := utils.ValidateTOTP(u.TOTPSecret, code, time.Now(), u.TOTPLastStep)
+	if !ok {
+		return false
+	}
+	res := db.Get().Model(&models.User{}).Where("id = ? AND totp_last_step < ?", u.ID, step).Update("totp_last_step", step)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false
+	}
+	u.TOTPLastStep = step
+	return true
+}
+
+// useRecoveryCode spends one of the user's recovery codes
+func useRecoveryCode(userID uint, code string) bool {
+	hash := utils.HashToken(utils.NormalizeRecoveryCode(code))
+	res := db.Get().Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	return res.Error == nil && res.RowsAffected > 0
+}
+
+// replaceRecoveryCodes drops the user's recovery codes and returns a new set
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	codes, err := utils.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	rows := make([]models.RecoveryCode, len(codes))
+	for i, code := range codes {
+		rows[i] = models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(utils.NormalizeRecoveryCode(code))}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+type loginTwoFactorPayload struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// LoginTwoFactor godoc
+// @Summary      Second login step for accounts with 2FA
+// @Description  Exchanges the mfa_token from /auth/login and a TOTP code (or a recovery code) for an access token and a refresh token
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      loginTwoFactorPayload  true  "MFA token and code"
+// @Success      200      {object}  map[string]interface{}
+// @Failure      401      {object}  map[string]interface{}
+// @Failure      429      {object}  map[string]interface{}
+// @Router       /auth/login/2fa [post]
+func LoginTwoFactor(cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var p loginTwoFactorPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if p.Code == "" && p.RecoveryCode == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+			return
+		}
+		claims, err := utils.ParseJWT(cfg.JWTSecret, p.MFAToken)
+		if err != nil || claims.Purpose != utils.PurposeMFAPending {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token, please log in again"})
+			return
+		}
+		var u models.User
+		if err := db.Get().First(&u, claims.UserID).Error; err != nil || !u.TOTPEnabled {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token, please log in again"})
+			return
+		}
+		if !totpAttemptAllowed(u.ID) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many attempts, try again later"})
+			return
+		}
+
+		usedRecovery := false
+		if p.Code != "" {
+			if !checkTOTP(&u, p.Code) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+				return
+			}
+		} else {
+			if !useRecoveryCode(u.ID, p.RecoveryCode) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid recovery code"})
+				return
+			}
+			usedRecovery = true
+		}
+
+		resp, err := startSession(c, cfg, &u)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "session error"})
+			return
+		}
+		resp["user"] = gin.H{"id": u.ID, "email": u.Email, "name": u.Name, "email_verified": u.EmailVerifiedAt != nil}
+		if usedRecovery {
+			var left int64
+			db.Get().Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", u.ID).Count(&left)
+			resp["recovery_codes_left"] = left
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// TwoFactorSetup godoc
+// @Summary      Start 2FA enrollment
+// @Description  Generates a new TOTP secret; show otpauth_uri as a QR code and confirm with /auth/2fa/enable
+// @Tags         auth
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Failure      409  {object}  map[string]interface{}
+// @Router       /auth/2fa/setup [post]
+func TwoFactorSetup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, _ := c.Get("userID")
+		var u models.User
+		if err := db.Get().First(&u, uid).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if u.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+			return
+		}
+		secret, err := utils.NewTOTPSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate secret"})
+			return
+		}
+		if err := db.Get().Model(&u).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"secret":      secret,
+			"otpauth_uri": utils.TOTPURI(totpIssuer, u.Email, secret),
+		})
+	}
+}
+
+type totpCodePayload struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorEnable godoc
+// @Summary      Finish 2FA enrollment
+// @Description  Confirms the first code from the authenticator app and returns recovery codes, shown only once
+// @Tags         auth
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      totpCodePayload  true  "Code from the app"
+// @Success      200      {object}  map[string]interface{}
+// @Failure      400      {object}  map[string]interface{}
+// @Router       /auth/2fa/enable [post]
+func TwoFactorEnable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, _ := c.Get("userID")
+		var p totpCodePayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var u models.User
+		if err := db.Get().First(&u, uid).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if u.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+			return
+		}
+		if u.TOTPSecret == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "call /auth/2fa/setup first"})
+			return
+		}
+		if !totpAttemptAllowed(u.ID) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many attempts, try again later"})
+			return
+		}
+		if !checkTOTP(&u, p.Code) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+			return
+		}
+
+		var codes []string
+		err := db.Get().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&u).Update("totp_enabled", true).Error; err != nil {
+				return err
+			}
+			var err error
+			codes, err = replaceRecoveryCodes(tx, u.ID)
+			return err
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable two-factor authentication"})
+			return
+		}
+		// Sessions opened with the password alone don't get to keep going
+		sid, _ := c.Get("sessionID")
+		if err := revokeUserSessions(u.ID, sid.(uint)); err != nil {
+			log.Printf("Failed to revoke sessions: %v", err)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication enabled", "recovery_codes": codes})
+	}
+}
+
+type disableTwoFactorPayload struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// TwoFactorDisable godoc
+// @Summary      Turn off 2FA
+// @Tags         auth
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      disableTwoFactorPayload  true  "Password and current code"
+// @Success      200      {object}  map[string]interface{}
+// @Failure      403      {object}  map[string]interface{}
+// @Router       /auth/2fa/disable [post]
+func TwoFactorDisable(cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, _ := c.Get("userID")
+		var p disableTwoFactorPayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var u models.User
+		if err := db.Get().First(&u, uid).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if !u.TOTPEnabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "two-factor authentication is not enabled"})
+			return
+		}
+		if cfg.RequireAdmin2FA && u.Role == models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "two-factor authentication is required for admins"})
+			return
+		}
+		if !totpAttemptAllowed(u.ID) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many attempts, try again later"})
+			return
+		}
+		if !utils.CheckPassword(u.PasswordHash, p.Password) || !checkTOTP(&u, p.Code) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid password or code"})
+			return
+		}
+		if err := disableTwoFactor(u.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+	}
+}
+
+func disableTwoFactor(userID uint) error {
+	return db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_enabled": false, "totp_secret": "", "totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary      Replace 2FA recovery codes
+// @Description  Invalidates the old recovery codes and returns a new set
+// @Tags         auth
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      totpCodePayload  true  "Code from the app"
+// @Success      200      {object}  map[string]interface{}
+// @Router       /auth/2fa/recovery-codes [post]
+func RegenerateRecoveryCodes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, _ := c.Get("userID")
+		var p totpCodePayload
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var u models.User
+		if err := db.Get().First(&u, uid).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if !u.TOTPEnabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "two-factor authentication is not enabled"})
+			return
+		}
+		if !totpAttemptAllowed(u.ID) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many attempts, try again later"})
+			return
+		}
+		if !checkTOTP(&u, p.Code) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+			return
+		}
+		codes, err := replaceRecoveryCodes(db.Get(), u.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create recovery codes"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+// ResetUserTwoFactor godoc
+// @Summary      Turn off 2FA for a user who lost their device (admin)
+// @Tags         admin
+// @Security     BearerAuth
+// @Param        id   path      int  true  "User ID"
+// @Success      204
+// @Router       /admin/users/{id}/2fa [delete]
+func ResetUserTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, ok := loadManagedUser(c)
+		if !ok {
+			return
+		}
+		if err := disableTwoFactor(u.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
+			return
+		}
+		if err := revokeUserSessions(u.ID, 0); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke failed"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
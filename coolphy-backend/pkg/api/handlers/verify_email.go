@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/utils"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+// sendVerificationEmail creates a verification token for the user and mails it.
+// Delivery errors are only logged, the user can ask for another email.
+func sendVerificationEmail(u *models.User) error {
+	token, err := utils.RandomToken()
+	if err != nil {
+		return err
+	}
+	vt := models.EmailVerificationToken{
+		UserID:    u.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	}
+	if err := db.Get().Create(&vt).Error; err != nil {
+		return err
+	}
+	if err := utils.SendVerificationEmail(u.Email, u.Name, token); err != nil {
+		log.Printf("Failed to send verification email: %v", err)
+	}
+	return nil
+}
+
+// VerifyEmail godoc
+// @Summary      Confirm email address
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      map[string]string  true  "Token from the email"
+// @Success      200   {object}  map[string]interface{}
+// @Failure      400   {object}  map[string]interface{}
+// @Router       /auth/verify-email [post]
+func VerifyEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Token string `json:"token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+			return
+		}
+
+		var vt models.EmailVerificationToken
+		if err := db.Get().Where("token_hash = ? AND used = ? AND expires_at > ?", utils.HashToken(req.Token), false, time.Now()).First(&vt).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+
+		now := time.Now()
+		if err := db.Get().Model(&models.User{}).Where("id = ? AND email_verified_at IS NULL", vt.UserID).
+			Update("email_verified_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+			return
+		}
+		// Every outstanding link for the account is spent now
+		if err := db.Get().Model(&models.EmailVerificationToken{}).Where("user_id = ?", vt.UserID).
+			Update("used", true).Error; err != nil {
+			log.Printf("Failed to mark token as used: %v", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "email verified"})
+	}
+}
+
+// ResendVerificationEmail godoc
+// @Summary      Send the verification email again
+// @Tags         auth
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Failure      429  {object}  map[string]interface{}
+// @Router       /auth/verify-email/resend [post]
+func ResendVerificationEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, _ := c.Get("userID")
+		var u models.User
+		if err := db.Get().First(&u, uid).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if u.EmailVerifiedAt != nil {
+			c.JSON(http.StatusOK, gin.H{"message": "email already verified"})
+			return
+		}
+		// One email per minute is plenty
+		var recent int64
+		db.Get().Model(&models.EmailVerificationToken{}).
+			Where("user_id = ? AND created_at > ?", u.ID, time.Now().Add(-time.Minute)).Count(&recent)
+		if recent > 0 {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "please wait before requesting another email"})
+			return
+		}
+		if err := sendVerificationEmail(&u); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create verification token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "verification email sent"})
+	}
+}
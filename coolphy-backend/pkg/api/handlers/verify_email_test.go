@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/utils"
+)
+
+func TestVerifyEmailMatchesTokenHash(t *testing.T) {
+	d := testDB(t)
+	u := newUser(t, d, "student@example.com", models.RoleUser)
+	token, err := utils.RandomToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Create(&models.EmailVerificationToken{UserID: u.ID, TokenHash: utils.HashToken(token), ExpiresAt: time.Now().Add(time.Hour)})
+
+	verify := func(token string) int {
+		return serve(t, VerifyEmail(), http.MethodPost, "/auth/verify-email", "/auth/verify-email", nil, map[string]string{"token": token}).Code
+	}
+	// What a database leak would show is not a usable token
+	if code := verify(utils.HashToken(token)); code != http.StatusBadRequest {
+		t.Errorf("verifying with the stored hash: status %d, want 400", code)
+	}
+	if code := verify(token); code != http.StatusOK {
+		t.Fatalf("verifying with the emailed token: status %d, want 200", code)
+	}
+	d.First(&u, u.ID)
+	if u.EmailVerifiedAt == nil {
+		t.Errorf("email not marked verified")
+	}
+	if code := verify(token); code != http.StatusBadRequest {
+		t.Errorf("reusing the token: status %d, want 400", code)
+	}
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/workflow"
+)
+
+// editsContent reports whether the signed in user, if any, may see
+// unpublished lectures and tasks
+func editsContent(c *gin.Context) bool {
+	role, ok := c.Get("role")
+	return ok && models.HasPermission(role.(string), models.PermContentWrite)
+}
+
+// visibleContent limits q to published content unless the caller edits it
+func visibleContent(c *gin.Context, q *gorm.DB) *gorm.DB {
+	if editsContent(c) {
+		return q
+	}
+	return workflow.Published(q)
+}
+
+// findVisible loads the lecture or task with the given id into dest, as
+// visibleContent allows. Otherwise it answers 404 (or 500) and returns false.
+func findVisible(c *gin.Context, dest interface{}, id interface{}, what string) bool {
+	if err := visibleContent(c, db.Get()).First(dest, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": what + " not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return false
+	}
+	return true
+}
+
+func workflowActor(c *gin.Context) workflow.Actor {
+	uid, _ := c.Get("userID")
+	role, _ := c.Get("role")
+	return workflow.Actor{UserID: uid.(uint), Admin: role == models.RoleAdmin}
+}
+
+// workflowError answers with the status matching a workflow error
+func workflowError(c *gin.Context, kind string, err error) {
+	var te *workflow.TransitionError
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": kind + " not found"})
+	case errors.As(err, &te):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err == workflow.ErrNotReviewer || err == workflow.ErrOwnSubmission:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case err == workflow.ErrInvalidReviewer || err == workflow.ErrPastPublishAt:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+	}
+}
+
+func contentID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// ChangeContentStatus godoc
+// @Summary      Move a lecture or task through the editorial workflow
+// @Description  draft → review → published, or scheduled when publish_at is in the future; published → draft unpublishes; anything → archived → draft. Approving or sending back a review is up to the assigned reviewer (any editor if none) or an admin. Admins may publish drafts directly. Only these status changes are reviewed; content edits apply in place (see PUT /lectures/{id} and /tasks/{id}).
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path      int               true  "Lecture or task ID"
+// @Param        body  body      workflow.Request  true  "Target status"
+// @Success      200   {object}  workflow.State
+// @Failure      403   {object}  map[string]interface{}
+// @Failure      409   {object}  map[string]interface{}
+// @Router       /admin/lectures/{id}/status [put]
+// @Router       /admin/tasks/{id}/status [put]
+func ChangeContentStatus(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := contentID(c)
+		if !ok {
+			return
+		}
+		var req workflow.Request
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var st *workflow.State
+		err := db.Get().Transaction(func(tx *gorm.DB) error {
+			var err error
+			st, err = workflow.Transition(tx, kind, id, workflowActor(c), req, time.Now())
+			return err
+		})
+		if err != nil {
+			workflowError(c, kind, err)
+			return
+		}
+		c.JSON(http.StatusOK, st)
+	}
+}
+
+// AssignContentReviewer godoc
+// @Summary      Assign the reviewer of a lecture or task
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path      int                true  "Lecture or task ID"
+// @Param        body  body      map[string]uint    true  "reviewer_id"
+// @Success      200   {object}  workflow.State
+// @Router       /admin/lectures/{id}/reviewer [put]
+// @Router       /admin/tasks/{id}/reviewer [put]
+func AssignContentReviewer(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := contentID(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			ReviewerID uint `json:"reviewer_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var st *workflow.State
+		err := db.Get().Transaction(func(tx *gorm.DB) error {
+			var err error
+			st, err = workflow.AssignReviewer(tx, kind, id, workflowActor(c), req.ReviewerID)
+			return err
+		})
+		if err != nil {
+			workflowError(c, kind, err)
+			return
+		}
+		c.JSON(http.StatusOK, st)
+	}
+}
+
+// ListReviewComments godoc
+// @Summary      Review comments and status changes of a lecture or task
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Lecture or task ID"
+// @Success      200  {array}   models.ReviewComment
+// @Router       /admin/lectures/{id}/comments [get]
+// @Router       /admin/tasks/{id}/comments [get]
+func ListReviewComments(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := contentID(c)
+		if !ok {
+			return
+		}
+		var items []models.ReviewComment
+		if err := db.Get().Preload("Author").Where("entity_type = ? AND entity_id = ?", kind, id).
+			Order("id").Find(&items).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	}
+}
+
+// AddReviewComment godoc
+// @Summary      Comment on a lecture or task under review
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path      int                true  "Lecture or task ID"
+// @Param        body  body      map[string]string  true  "body"
+// @Success      201   {object}  models.ReviewComment
+// @Router       /admin/lectures/{id}/comments [post]
+// @Router       /admin/tasks/{id}/comments [post]
+func AddReviewComment(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := contentID(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			Body string `json:"body" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Body) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "body is required"})
+			return
+		}
+		if _, err := workflow.Load(db.Get(), kind, id); err != nil {
+			workflowError(c, kind, err)
+			return
+		}
+		comment := models.ReviewComment{EntityType: kind, EntityID: id, AuthorID: workflowActor(c).UserID, Body: req.Body}
+		if err := db.Get().Create(&comment).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
+			return
+		}
+		c.JSON(http.StatusCreated, comment)
+	}
+}
+
+// ReviewQueue godoc
+// @Summary      Lectures and tasks waiting for review
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        mine  query     bool  false  "Only those assigned to me"
+// @Success      200   {object}  map[string]interface{}
+// @Router       /admin/reviews [get]
+func ReviewQueue() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queue := gin.H{}
+		for _, kind := range []string{models.ContentLecture, models.ContentTask} {
+			q := db.Get().Model(&models.Lecture{})
+			if kind == models.ContentTask {
+				q = db.Get().Model(&models.Task{})
+			}
+			q = q.Where("status = ?", models.StatusReview)
+			if c.Query("mine") == "true" {
+				q = q.Where("reviewer_id = ?", workflowActor(c).UserID)
+			}
+			var items []workflow.State
+			if err := q.Select("id, title, status, reviewer_id, publish_at, published_at").
+				Order("updated_at").Find(&items).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+				return
+			}
+			queue[kind+"s"] = items
+		}
+		c.JSON(http.StatusOK, queue)
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/tikz"
+	"coolphy-backend/pkg/worksheet"
+)
+
+const maxWorksheetTasks = 200
+
+// Worksheet godoc
+// @Summary      Printable worksheet or lecture handout
+// @Description  task_ids prints those tasks in the given order; lecture_id prints the lecture followed by its related tasks, or by task_ids if given. The answer key and the solutions go on separate pages at the end; they are left out for tasks of a running contest. The output is cached by the hash of the LaTeX source, which is also the ETag. format defaults to pdf when the server has pdflatex and to tex otherwise.
+// @Tags         worksheets
+// @Security     BearerAuth
+// @Produce      application/pdf
+// @Produce      application/x-tex
+// @Param        task_ids    query     string  false  "Comma separated task IDs"
+// @Param        lecture_id  query     int     false  "Lecture for a handout"
+// @Param        title       query     string  false  "Heading, the lecture title by default"
+// @Param        key         query     bool    false  "Append the answer key"
+// @Param        solutions   query     bool    false  "Append the solutions"
+// @Param        format      query     string  false  "pdf or tex"
+// @Success      200  {file}    file
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      422  {object}  map[string]interface{}
+// @Failure      501  {object}  map[string]interface{}
+// @Router       /worksheet [get]
+func Worksheet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := c.DefaultQuery("format", "pdf")
+		if c.Query("format") == "" && !worksheet.Available() {
+			format = "tex"
+		}
+		if format != "pdf" && format != "tex" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be pdf or tex"})
+			return
+		}
+		opts := worksheet.Options{
+			Title:     strings.TrimSpace(c.Query("title")),
+			AnswerKey: c.Query("key") == "true" || c.Query("key") == "1",
+			Solutions: c.Query("solutions") == "true" || c.Query("solutions") == "1",
+		}
+
+		var ids []uint
+		for _, s := range strings.Split(c.Query("task_ids"), ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			id, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid task_ids"})
+				return
+			}
+			ids = append(ids, uint(id))
+		}
+		if v := c.Query("lecture_id"); v != "" {
+			var lecture models.Lecture
+			if err := visibleContent(c, db.Get()).First(&lecture, v).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					c.JSON(http.StatusNotFound, gin.H{"error": "lecture not found"})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+				return
+			}
+			opts.Lecture = &lecture
+			if opts.Title == "" {
+				opts.Title = lecture.Title
+			}
+			if ids == nil {
+				if err := db.Get().Table("lecture_tasks").Where("lecture_id = ?", lecture.ID).
+					Order("task_id").Pluck("task_id", &ids).Error; err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+					return
+				}
+			}
+		} else if len(ids) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "task_ids or lecture_id is required"})
+			return
+		}
+		if len(ids) > maxWorksheetTasks {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "too many tasks, at most " + strconv.Itoa(maxWorksheetTasks)})
+			return
+		}
+		if opts.Title == "" {
+			opts.Title = "Worksheet"
+		}
+
+		tasks, ok := worksheetTasks(c, ids, opts.Lecture != nil && c.Query("task_ids") == "")
+		if !ok {
+			return
+		}
+		locked := map[uint]bool{}
+		if !editsContent(c) {
+			locked = runningContestTasks()
+		}
+		for i, t := range tasks {
+			// One set of numbers for the whole class, the same whoever prints
+			if err := grading.ApplyVariant(t, 0); err != nil {
+				fmt.Printf("task %d variant error: %v\n", t.ID, err)
+			}
+			opts.Items = append(opts.Items, worksheet.Item{Number: i + 1, Task: t, HideKey: locked[t.ID]})
+		}
+		if issues := worksheet.Check(opts); len(issues) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the content uses commands that can't be compiled", "issues": issues})
+			return
+		}
+
+		doc := worksheet.Document(opts)
+		etag := `"` + worksheet.Hash(doc) + "-" + format + `"`
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "private, no-cache")
+		if c.GetHeader("If-None-Match") == etag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		name := worksheetFileName(opts)
+		if format == "tex" {
+			path, err := worksheet.TeX(doc)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "storage error"})
+				return
+			}
+			c.Header("Content-Type", "application/x-tex; charset=utf-8")
+			c.FileAttachment(path, name+".tex")
+			return
+		}
+		path, err := worksheet.PDF(c.Request.Context(), doc)
+		if err != nil {
+			var ce *tikz.CompileError
+			switch {
+			case errors.Is(err, worksheet.ErrUnavailable):
+				c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			case errors.As(err, &ce):
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": ce.Reason, "log": ce.Log})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not make the PDF"})
+			}
+			return
+		}
+		c.Header("Content-Type", "application/pdf")
+		c.FileAttachment(path, name+".pdf")
+	}
+}
+
+// worksheetTasks loads the tasks in the order of ids. Tasks linked to a
+// lecture that the caller can't see are skipped; asked-for ones are a 404.
+func worksheetTasks(c *gin.Context, ids []uint, linked bool) ([]*models.Task, bool) {
+	if len(ids) == 0 {
+		return nil, true
+	}
+	var found []models.Task
+	if err := visibleContent(c, db.Get()).Where("id IN ?", ids).Find(&found).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return nil, false
+	}
+	byID := make(map[uint]*models.Task, len(found))
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+	tasks := make([]*models.Task, 0, len(ids))
+	seen := map[uint]bool{}
+	for _, id := range ids {
+		t, ok := byID[id]
+		if !ok {
+			if linked {
+				continue
+			}
+			c.JSON(http.StatusNotFound, gin.H{"error": "task " + strconv.FormatUint(uint64(id), 10) + " not found"})
+			return nil, false
+		}
+		if !seen[id] {
+			seen[id] = true
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks, true
+}
+
+func worksheetFileName(opts worksheet.Options) string {
+	if opts.Lecture != nil {
+		return "lecture-" + strconv.FormatUint(uint64(opts.Lecture.ID), 10)
+	}
+	return "worksheet"
+}
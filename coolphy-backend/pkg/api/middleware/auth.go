@@ -6,9 +6,24 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"coolphy-backend/internal/config"
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
 	"coolphy-backend/pkg/utils"
 )
 
+// activeSession reports whether the session the token was issued for is
+// still valid, so logout and revocation take effect before the token expires
+func activeSession(claims *utils.Claims) bool {
+	if claims.SessionID == 0 || claims.Purpose != "" {
+		return false
+	}
+	var s models.Session
+	if err := db.Get().Select("id", "user_id", "expires_at", "revoked_at").First(&s, claims.SessionID).Error; err != nil {
+		return false
+	}
+	return s.UserID == claims.UserID && s.Active()
+}
+
 // Auth middleware validates JWT and stores user id and role in context
 func Auth(cfg config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -23,8 +38,30 @@ func Auth(cfg config.Config) gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
 		}
+		if !activeSession(claims) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session expired"})
+			return
+		}
 		c.Set("userID", claims.UserID)
 		c.Set("role", claims.Role)
+		c.Set("sessionID", claims.SessionID)
+		c.Next()
+	}
+}
+
+// OptionalAuth stores user id and role in context when a valid JWT is sent,
+// but lets anonymous requests through
+func OptionalAuth(cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h := c.GetHeader("Authorization")
+		if strings.HasPrefix(strings.ToLower(h), "bearer ") {
+			tok := strings.TrimSpace(h[len("Bearer "):])
+			if claims, err := utils.ParseJWT(cfg.JWTSecret, tok); err == nil && activeSession(claims) {
+				c.Set("userID", claims.UserID)
+				c.Set("role", claims.Role)
+				c.Set("sessionID", claims.SessionID)
+			}
+		}
 		c.Next()
 	}
 }
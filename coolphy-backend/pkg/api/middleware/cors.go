@@ -16,7 +16,7 @@ func CORS(allowedOrigins string) gin.HandlerFunc {
 	}
 	cfg.AllowCredentials = true
 	cfg.AllowHeaders = []string{"Authorization", "Content-Type"}
-	cfg.ExposeHeaders = []string{"Content-Length"}
+	cfg.ExposeHeaders = []string{"Content-Length", "X-Total-Count", "X-Next-Cursor"}
 	cfg.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
 	return cors.New(cfg)
 }
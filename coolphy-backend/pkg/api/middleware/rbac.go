@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+
+	"coolphy-backend/pkg/models"
 )
 
 // RBAC ensures the user has at least one of the required roles
@@ -26,3 +28,22 @@ func RBAC(roles ...string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// Permission ensures the user's role grants at least one of the permissions
+func Permission(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		val, exists := c.Get("role")
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "no role in context"})
+			return
+		}
+		userRole, _ := val.(string)
+		for _, p := range perms {
+			if models.HasPermission(userRole, p) {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"coolphy-backend/internal/config"
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+)
+
+// RequireAdmin2FA closes the routes it guards to admins without 2FA when
+// REQUIRE_ADMIN_2FA is on. The router puts it on everything but the
+// account routes needed to set 2FA up. Must run after Auth.
+func RequireAdmin2FA(cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if role, _ := c.Get("role"); !cfg.RequireAdmin2FA || role != models.RoleAdmin {
+			c.Next()
+			return
+		}
+		uid, _ := c.Get("userID")
+		var u models.User
+		if err := db.Get().Select("id", "totp_enabled").First(&u, uid).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+			return
+		}
+		if !u.TOTPEnabled {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "two-factor authentication required", "code": "mfa_enrollment_required"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"coolphy-backend/internal/config"
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+)
+
+// VerifiedEmail lets the request through only if the user has confirmed their
+// email. It is a no-op unless REQUIRE_EMAIL_VERIFICATION is on. Must run after Auth.
+func VerifiedEmail(cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cfg.RequireEmailVerification {
+			c.Next()
+			return
+		}
+		uid, _ := c.Get("userID")
+		var u models.User
+		if err := db.Get().Select("id", "email_verified_at").First(&u, uid).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+			return
+		}
+		if u.EmailVerifiedAt == nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "email not verified", "code": "email_not_verified"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"coolphy-backend/internal/config"
 	"coolphy-backend/pkg/api/handlers"
 	"coolphy-backend/pkg/api/middleware"
+	"coolphy-backend/pkg/models"
 )
 
 func Register(r *gin.Engine, cfg config.Config) {
@@ -24,33 +25,59 @@ func Register(r *gin.Engine, cfg config.Config) {
 	{
 		api.POST("/auth/register", handlers.RegisterHandler(cfg))
 		api.POST("/auth/login", handlers.LoginHandler(cfg))
-		api.POST("/auth/logout", handlers.Logout())
+		api.POST("/auth/login/2fa", handlers.LoginTwoFactor(cfg))
+		api.POST("/auth/refresh", handlers.RefreshToken(cfg))
+		api.POST("/auth/logout", handlers.Logout(cfg))
+		api.POST("/auth/verify-email", handlers.VerifyEmail())
 		api.POST("/password/reset", handlers.PasswordReset())
 		api.POST("/password/reset/confirm", handlers.PasswordResetConfirm())
 		api.GET("/ping", handlers.Ping())
 
 		api.GET("/lectures", handlers.ListLectures())
-		api.GET("/lectures/:id", handlers.GetLecture())
+		api.GET("/lectures/:id", middleware.OptionalAuth(cfg), handlers.GetLecture())
 		api.GET("/videos/:id/stream", handlers.StreamVideo(cfg))
-		api.GET("/tasks", handlers.ListTasks())
-		api.GET("/tasks/:id", handlers.GetTask())
+		api.GET("/assets/:file", handlers.ServeAsset())
+		api.GET("/tasks", middleware.OptionalAuth(cfg), handlers.ListTasks())
+		api.GET("/tasks/:id", middleware.OptionalAuth(cfg), handlers.GetTask())
 		api.GET("/topics", handlers.ListTopics())
 		api.GET("/topics/:id", handlers.GetTopic())
 		api.GET("/topics/tree", handlers.GetTopicsTree())
+		api.GET("/search", handlers.Search())
+		api.GET("/contests", middleware.OptionalAuth(cfg), handlers.ListContests())
+		api.GET("/contests/:id", middleware.OptionalAuth(cfg), handlers.GetContest())
+		api.GET("/contests/:id/scoreboard", middleware.OptionalAuth(cfg), handlers.ContestScoreboard())
 
-		// Protected routes
-		auth := api.Group("")
-		auth.Use(middleware.Auth(cfg))
+		// Own account, open to admins who still have to set up 2FA
+		account := api.Group("")
+		account.Use(middleware.Auth(cfg))
 		{
 			// Profile
-			auth.GET("/profile", handlers.Profile())
-			auth.PUT("/profile", handlers.UpdateProfile())
-			auth.GET("/profile/stats", handlers.ProfileStats())
-			auth.POST("/password/change", handlers.ChangePassword())
+			account.GET("/profile", handlers.Profile())
+			account.PUT("/profile", handlers.UpdateProfile())
+			account.GET("/profile/stats", handlers.ProfileStats())
+			account.POST("/password/change", handlers.ChangePassword())
+			account.POST("/auth/verify-email/resend", handlers.ResendVerificationEmail())
+			// Two-factor authentication
+			account.POST("/auth/2fa/setup", handlers.TwoFactorSetup())
+			account.POST("/auth/2fa/enable", handlers.TwoFactorEnable())
+			account.POST("/auth/2fa/disable", handlers.TwoFactorDisable(cfg))
+			account.POST("/auth/2fa/recovery-codes", handlers.RegenerateRecoveryCodes())
+			// Sessions
+			account.GET("/sessions", handlers.ListSessions())
+			account.DELETE("/sessions", handlers.RevokeOtherSessions())
+			account.DELETE("/sessions/:id", handlers.RevokeSession())
+		}
+
+		// Protected routes. Admins use their permissions here too, so
+		// REQUIRE_ADMIN_2FA covers all of them, not just /admin.
+		auth := api.Group("")
+		auth.Use(middleware.Auth(cfg), middleware.RequireAdmin2FA(cfg))
+		{
+			verified := middleware.VerifiedEmail(cfg)
 			// Solutions
-			auth.POST("/tasks/:id/solve", handlers.SolveTask())
+			auth.POST("/tasks/:id/solve", verified, handlers.SolveTask())
 			auth.GET("/tasks/:id/solutions", handlers.GetTaskSolutions())
-			auth.PUT("/tasks/:id/status", handlers.UpdateTaskStatus())
+			auth.PUT("/tasks/:id/status", middleware.Permission(models.PermContentWrite), handlers.UpdateTaskStatus())
 			auth.GET("/solutions", handlers.ListSolutions())
 			auth.GET("/solutions/:id", handlers.GetSolution())
 			auth.PUT("/solutions/:id", handlers.UpdateSolution())
@@ -64,46 +91,123 @@ func Register(r *gin.Engine, cfg config.Config) {
 			auth.GET("/notifications", handlers.ListNotifications())
 			auth.PUT("/notifications/:id/read", handlers.MarkNotificationRead())
 			// Professor Chat (with AI)
-			auth.POST("/professor-chat", handlers.ProfessorChatWithAI())
-			auth.POST("/task-chat", handlers.TaskChatWithAI())
+			auth.POST("/professor-chat", verified, handlers.ProfessorChatWithAI())
+			auth.POST("/task-chat", verified, handlers.TaskChatWithAI())
+			auth.POST("/professor-chat/stream", verified, handlers.ProfessorChatStream())
+			auth.POST("/task-chat/stream", verified, handlers.TaskChatStream())
 			auth.GET("/professor-chat/history", handlers.ChatHistory())
 			auth.GET("/professor-chat/:id", handlers.GetChatMessage())
+			// Classes
+			teacher := middleware.Permission(models.PermClassesManage)
+			auth.GET("/classes", handlers.ListClasses())
+			auth.POST("/classes", teacher, handlers.CreateClass())
+			auth.POST("/classes/join", handlers.JoinClass())
+			auth.GET("/classes/:id", handlers.GetClass())
+			auth.PUT("/classes/:id", teacher, handlers.UpdateClass())
+			auth.DELETE("/classes/:id", teacher, handlers.DeleteClass())
+			auth.POST("/classes/:id/join-code", teacher, handlers.ResetJoinCode())
+			auth.POST("/classes/:id/members", teacher, handlers.AddClassMember())
+			auth.DELETE("/classes/:id/members/:user_id", handlers.RemoveClassMember())
+			auth.GET("/classes/:id/stats", teacher, handlers.ClassStats())
+			auth.GET("/classes/:id/students/:user_id/stats", teacher, handlers.ClassStudentStats())
+			auth.GET("/classes/:id/students/:user_id/attempts", teacher, handlers.ClassStudentAttempts())
+			// Assignments
+			auth.GET("/assignments", handlers.MyAssignments())
+			auth.GET("/assignments/:id", handlers.GetAssignment())
+			auth.PUT("/assignments/:id", teacher, handlers.UpdateAssignment())
+			auth.DELETE("/assignments/:id", teacher, handlers.DeleteAssignment())
+			auth.GET("/classes/:id/assignments", handlers.ListClassAssignments())
+			auth.POST("/classes/:id/assignments", teacher, handlers.CreateAssignment())
+			auth.GET("/classes/:id/gradebook", teacher, handlers.Gradebook())
+			// Contests and mock exams
+			organizer := middleware.Permission(models.PermContentWrite, models.PermClassesManage)
+			auth.POST("/contests", organizer, handlers.CreateContest())
+			auth.PUT("/contests/:id", organizer, handlers.UpdateContest())
+			auth.DELETE("/contests/:id", organizer, handlers.DeleteContest())
+			auth.POST("/contests/:id/start", handlers.StartContest())
+			auth.POST("/contests/:id/finish", handlers.FinishContest())
+			auth.GET("/contests/:id/tasks", handlers.ContestTasks())
+			auth.POST("/contests/:id/tasks/:task_id/submit", verified, handlers.SubmitContestAnswer())
+			auth.GET("/contests/:id/submissions", handlers.ContestSubmissions())
+			auth.PUT("/contests/:id/submissions/:sub_id", handlers.GradeContestSubmission())
+			// Exam variants
+			auth.GET("/exam-blueprints", handlers.ListExamBlueprints())
+			auth.GET("/exam-blueprints/:id", handlers.GetExamBlueprint())
+			auth.POST("/exam-blueprints", organizer, handlers.CreateExamBlueprint())
+			auth.PUT("/exam-blueprints/:id", organizer, handlers.UpdateExamBlueprint())
+			auth.DELETE("/exam-blueprints/:id", organizer, handlers.DeleteExamBlueprint())
+			auth.POST("/exam-blueprints/:id/variants", handlers.CreateExamVariant())
+			auth.GET("/exam-variants", handlers.ListExamVariants())
+			auth.GET("/exam-variants/:id", handlers.GetExamVariant())
+			auth.GET("/exam-variants/:id/sheet", handlers.ExamVariantSheet())
+			auth.GET("/worksheet", middleware.Permission(models.PermClassesManage, models.PermContentWrite), handlers.Worksheet())
 			// Achievements
 			auth.GET("/achievements", handlers.Achievements())
 			// History
 			auth.GET("/history/tasks", handlers.TaskHistory())
 			auth.GET("/history/lectures", handlers.LectureHistory())
 			auth.GET("/history/profile", handlers.ProfileHistory())
-			// Admin
+			// Admin: every route needs a permission, see models.rolePermissions
 			admin := auth.Group("/admin")
-			admin.Use(middleware.RBAC("admin"))
 			{
+				content := middleware.Permission(models.PermContentWrite)
+				users := middleware.Permission(models.PermUsersManage)
+				settings := middleware.Permission(models.PermSettingsManage)
 				// Admin dashboard
-				admin.GET("", handlers.AdminDashboard())
-				admin.GET("/logs", handlers.AdminLogs())
-				admin.GET("/lectures", handlers.AdminLectures())
-				admin.GET("/tasks", handlers.AdminTasks())
-				admin.GET("/topics", handlers.AdminTopics())
+				admin.GET("", middleware.Permission(models.PermContentWrite, models.PermUsersManage, models.PermSettingsManage, models.PermGradesView), handlers.AdminDashboard())
+				admin.GET("/logs", settings, handlers.AdminLogs())
+				admin.GET("/lectures", content, handlers.AdminLectures())
+				admin.GET("/tasks", content, handlers.AdminTasks())
+				admin.GET("/topics", content, handlers.AdminTopics())
 				// Admin CRUD
-				admin.POST("/lectures", handlers.CreateLecture())
-				admin.POST("/videos", handlers.UploadVideo(cfg))
-				admin.POST("/tasks", handlers.CreateTask())
-				admin.POST("/topics", handlers.CreateTopic())
+				admin.POST("/lectures", content, handlers.CreateLecture())
+				admin.POST("/videos", content, handlers.UploadVideo(cfg))
+				admin.POST("/tasks", content, handlers.CreateTask())
+				admin.GET("/tasks/import", content, handlers.ListImportJobs())
+				admin.POST("/tasks/import", content, handlers.ImportTasks())
+				admin.GET("/tasks/import/:id", content, handlers.GetImportJob())
+				admin.POST("/topics", content, handlers.CreateTopic())
 				// Admin update/delete
-				admin.PUT("/lectures/:id", handlers.UpdateLecture())
-				admin.DELETE("/lectures/:id", handlers.DeleteLecture())
-				admin.PUT("/tasks/:id", handlers.UpdateTask())
-				admin.DELETE("/tasks/:id", handlers.DeleteTask())
-				admin.PUT("/topics/:id", handlers.UpdateTopic())
-				admin.DELETE("/topics/:id", handlers.DeleteTopic())
+				admin.PUT("/lectures/:id", content, handlers.UpdateLecture())
+				admin.DELETE("/lectures/:id", content, handlers.DeleteLecture())
+				admin.PUT("/tasks/:id", content, handlers.UpdateTask())
+				admin.DELETE("/tasks/:id", content, handlers.DeleteTask())
+				// Revision history
+				admin.GET("/lectures/:id/revisions", content, handlers.ListRevisions(models.ContentLecture))
+				admin.GET("/lectures/:id/revisions/:rev", content, handlers.GetRevision(models.ContentLecture))
+				admin.GET("/lectures/:id/revisions/:rev/diff", content, handlers.DiffRevisions(models.ContentLecture))
+				admin.POST("/lectures/:id/revisions/:rev/restore", content, handlers.RestoreRevision(models.ContentLecture))
+				admin.GET("/tasks/:id/revisions", content, handlers.ListRevisions(models.ContentTask))
+				admin.GET("/tasks/:id/revisions/:rev", content, handlers.GetRevision(models.ContentTask))
+				admin.GET("/tasks/:id/revisions/:rev/diff", content, handlers.DiffRevisions(models.ContentTask))
+				admin.POST("/tasks/:id/revisions/:rev/restore", content, handlers.RestoreRevision(models.ContentTask))
+				// Editorial workflow
+				admin.GET("/reviews", content, handlers.ReviewQueue())
+				admin.PUT("/lectures/:id/status", content, handlers.ChangeContentStatus(models.ContentLecture))
+				admin.PUT("/lectures/:id/reviewer", content, handlers.AssignContentReviewer(models.ContentLecture))
+				admin.GET("/lectures/:id/comments", content, handlers.ListReviewComments(models.ContentLecture))
+				admin.POST("/lectures/:id/comments", content, handlers.AddReviewComment(models.ContentLecture))
+				admin.PUT("/tasks/:id/status", content, handlers.ChangeContentStatus(models.ContentTask))
+				admin.PUT("/tasks/:id/reviewer", content, handlers.AssignContentReviewer(models.ContentTask))
+				admin.GET("/tasks/:id/comments", content, handlers.ListReviewComments(models.ContentTask))
+				admin.POST("/tasks/:id/comments", content, handlers.AddReviewComment(models.ContentTask))
+				admin.PUT("/topics/:id", content, handlers.UpdateTopic())
+				admin.DELETE("/topics/:id", content, handlers.DeleteTopic())
+				admin.GET("/assets", content, handlers.ListAssets())
+				admin.POST("/assets/:id/rebuild", content, handlers.RebuildAsset())
+				admin.POST("/latex/validate", content, handlers.ValidateLaTeX())
+				admin.GET("/export", content, handlers.ExportBundle())
+				admin.POST("/import", content, handlers.ImportBundle(cfg))
 				// Admin user management
-				admin.GET("/users", handlers.ListUsers())
-				admin.GET("/users/:id", handlers.GetUser())
-				admin.PUT("/users/:id", handlers.UpdateUser())
-				admin.DELETE("/users/:id", handlers.DeleteUser())
+				admin.GET("/roles", users, handlers.ListRoles())
+				admin.GET("/users", users, handlers.ListUsers())
+				admin.GET("/users/:id", users, handlers.GetUser())
+				admin.PUT("/users/:id", users, handlers.UpdateUser())
+				admin.DELETE("/users/:id", users, handlers.DeleteUser())
+				admin.DELETE("/users/:id/2fa", users, handlers.ResetUserTwoFactor())
 				// Admin AI settings
-				admin.GET("/settings", handlers.GetSettings())
-				admin.PUT("/settings", handlers.UpdateSettings())
+				admin.GET("/settings", settings, handlers.GetSettings())
+				admin.PUT("/settings", settings, handlers.UpdateSettings())
 			}
 		}
 		// Leaderboard (public)
@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"coolphy-backend/internal/config"
+	"coolphy-backend/pkg/db/dbtest"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/utils"
+)
+
+func TestAdminTwoFactorCoversEveryRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	d := dbtest.Open(t)
+	cfg := config.Config{JWTSecret: "secret", RequireAdmin2FA: true, RateLimit: "1000-S", UploadDir: t.TempDir()}
+	r := gin.New()
+	Register(r, cfg)
+
+	admin := models.User{Email: "admin@example.com", Name: "admin", PasswordHash: "x", Role: models.RoleAdmin}
+	d.Create(&admin)
+	session := models.Session{UserID: admin.ID, RefreshTokenHash: "h", ExpiresAt: time.Now().Add(time.Hour)}
+	d.Create(&session)
+	token, err := utils.SignSessionJWT(cfg.JWTSecret, admin.ID, admin.Role, session.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Routes admins reach through their permissions outside /admin
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/admin/users"},
+		{http.MethodGet, "/classes"},
+		{http.MethodGet, "/classes/1/gradebook"},
+		{http.MethodPost, "/contests"},
+		{http.MethodGet, "/contests/1/submissions"},
+		{http.MethodPost, "/exam-blueprints"},
+		{http.MethodGet, "/exam-variants/1/sheet"},
+		{http.MethodGet, "/worksheet"},
+		{http.MethodPut, "/tasks/1/status"},
+		{http.MethodGet, "/solutions"},
+	} {
+		w := request(route.method, route.path)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "mfa_enrollment_required") {
+			t.Errorf("%s %s without 2FA: status %d %s, want 403 mfa_enrollment_required", route.method, route.path, w.Code, w.Body)
+		}
+	}
+
+	// Setting 2FA up stays possible
+	for _, path := range []string{"/profile", "/sessions"} {
+		if w := request(http.MethodGet, path); w.Code != http.StatusOK {
+			t.Errorf("GET %s without 2FA: status %d %s, want 200", path, w.Code, w.Body)
+		}
+	}
+	if w := request(http.MethodPost, "/auth/2fa/setup"); w.Code != http.StatusOK {
+		t.Errorf("POST /auth/2fa/setup without 2FA: status %d %s, want 200", w.Code, w.Body)
+	}
+
+	d.Model(&admin).Update("totp_enabled", true)
+	if w := request(http.MethodGet, "/classes"); w.Code != http.StatusOK {
+		t.Errorf("GET /classes with 2FA: status %d %s, want 200", w.Code, w.Body)
+	}
+}
+
+func TestListHeadersAreExposed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	d := dbtest.Open(t)
+	cfg := config.Config{JWTSecret: "secret", RateLimit: "1000-S", UploadDir: t.TempDir(), CORSAllowedOrigins: "https://app.example.com"}
+	r := gin.New()
+	Register(r, cfg)
+	for i := 0; i < 3; i++ {
+		d.Create(&models.Lecture{Title: "Lecture", Status: models.StatusPublished})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/lectures?limit=2", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d %s", w.Code, w.Body)
+	}
+	if w.Header().Get("X-Total-Count") != "3" || w.Header().Get("X-Next-Cursor") == "" {
+		t.Errorf("paging headers %v, want the total and a next cursor", w.Header())
+	}
+	exposed := w.Header().Get("Access-Control-Expose-Headers")
+	for _, h := range []string{"X-Total-Count", "X-Next-Cursor"} {
+		if !strings.Contains(strings.ToLower(exposed), strings.ToLower(h)) {
+			t.Errorf("%s is not exposed to browsers: %q", h, exposed)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package assignments derives each student's homework status from their
+// solution attempts and lecture completions, and sends deadline reminders.
+package assignments
+
+import (
+	"time"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+)
+
+// Late policies
+const (
+	LateNone    = "none"    // work after the due date doesn't count
+	LateAccept  = "accept"  // late work counts in full but is flagged
+	LatePenalty = "penalty" // late work loses LatePenaltyPercent
+)
+
+// Student statuses
+const (
+	StatusNotOpen    = "not_open"
+	StatusNotStarted = "not_started"
+	StatusInProgress = "in_progress"
+	StatusSubmitted  = "submitted" // everything done by the due date
+	StatusLate       = "late"      // everything done, some of it late
+	StatusMissing    = "missing"   // past the due date and not done
+)
+
+// ValidPolicy reports whether p is a known late policy
+func ValidPolicy(p string) bool {
+	return p == LateNone || p == LateAccept || p == LatePenalty
+}
+
+// Closes is when the assignment stops accepting work, nil if never
+func Closes(a *models.Assignment) *time.Time {
+	if a.LatePolicy == LateNone || a.LatePolicy == "" {
+		return &a.DueAt
+	}
+	return a.LateUntil
+}
+
+// Item is a student's result on one task or lecture of an assignment
+type Item struct {
+	Type  string     `json:"type"` // task, lecture
+	ID    uint       `json:"id"`
+	Done  bool       `json:"done"`
+	Late  bool       `json:"late,omitempty"`
+	Score int        `json:"score"` // 0-100 after the late penalty, tasks only
+	At    *time.Time `json:"at,omitempty"`
+}
+
+// Progress is a student's standing on an assignment
+type Progress struct {
+	UserID   uint    `json:"user_id"`
+	Status   string  `json:"status"`
+	Earned   float64 `json:"earned"`   // task points after penalties
+	Possible int     `json:"possible"` // task points available
+	Score    float64 `json:"score"`    // Earned/Possible, 0-100
+	Items    []Item  `json:"items"`
+}
+
+// attemptScore is how much of the task an attempt solved, 0-100
+func attemptScore(status string, awarded, points int) int {
+	switch status {
+	case "correct":
+		return 100
+	case "partial":
+		if points > 0 {
+			return min(100, awarded*100/points)
+		}
+	}
+	return 0
+}
+
+type attemptRow struct {
+	UserID        uint
+	TaskID        uint
+	Status        string
+	PointsAwarded int
+	CreatedAt     time.Time
+}
+
+type completionRow struct {
+	UserID      uint
+	LectureID   uint
+	CompletedAt time.Time
+}
+
+// Compute returns the progress of each user on the assignment. a.Tasks and
+// a.Lectures must be loaded.
+func Compute(a *models.Assignment, userIDs []uint, now time.Time) (map[uint]*Progress, error) {
+	out := make(map[uint]*Progress, len(userIDs))
+	if len(userIDs) == 0 {
+		return out, nil
+	}
+	closes := Closes(a)
+
+	taskIDs := make([]uint, len(a.Tasks))
+	for i, t := range a.Tasks {
+		taskIDs[i] = t.ID
+	}
+	var attempts []attemptRow
+	if len(taskIDs) > 0 {
+		q := db.Get().Model(&models.SolutionAttempt{}).
+			Select("user_id, task_id, status, points_awarded, created_at").
+			Where("user_id IN ? AND task_id IN ? AND created_at >= ?", userIDs, taskIDs, a.OpensAt).
+			Where("status IN ?", []string{"correct", "partial", "incorrect"})
+		if closes != nil {
+			q = q.Where("created_at <= ?", *closes)
+		}
+		if err := q.Scan(&attempts).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	lectureIDs := make([]uint, len(a.Lectures))
+	for i, l := range a.Lectures {
+		lectureIDs[i] = l.ID
+	}
+	var completions []completionRow
+	if len(lectureIDs) > 0 {
+		// A lecture read before the assignment opened still counts as read
+		q := db.Get().Model(&models.LectureCompletion{}).
+			Select("user_id, lecture_id, completed_at").
+			Where("user_id IN ? AND lecture_id IN ?", userIDs, lectureIDs)
+		if closes != nil {
+			q = q.Where("completed_at <= ?", *closes)
+		}
+		if err := q.Scan(&completions).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	type key struct{ user, id uint }
+	best := map[key]Item{}
+	for _, at := range attempts {
+		late := at.CreatedAt.After(a.DueAt)
+		score := attemptScore(at.Status, at.PointsAwarded, taskPoints(a, at.TaskID))
+		if late && a.LatePolicy == LatePenalty {
+			score = score * (100 - a.LatePenaltyPercent) / 100
+		}
+		k := key{at.UserID, at.TaskID}
+		cur, seen := best[k]
+		// Keep the best score; on a tie the earlier attempt, so a late retry doesn't mark on-time work late
+		if !seen || score > cur.Score || (score == cur.Score && at.CreatedAt.Before(*cur.At)) {
+			t := at.CreatedAt
+			best[k] = Item{Type: "task", ID: at.TaskID, Done: true, Late: late, Score: score, At: &t}
+		}
+	}
+	done := map[key]completionRow{}
+	for _, cr := range completions {
+		done[key{cr.UserID, cr.LectureID}] = cr
+	}
+
+	for _, uid := range userIDs {
+		p := &Progress{UserID: uid, Items: make([]Item, 0, len(a.Tasks)+len(a.Lectures))}
+		finished, late, started := true, false, false
+		for _, t := range a.Tasks {
+			p.Possible += t.Points
+			it, ok := best[key{uid, t.ID}]
+			if !ok {
+				it = Item{Type: "task", ID: t.ID}
+				finished = false
+			} else {
+				started = true
+				late = late || it.Late
+				p.Earned += float64(t.Points*it.Score) / 100
+			}
+			p.Items = append(p.Items, it)
+		}
+		for _, l := range a.Lectures {
+			it := Item{Type: "lecture", ID: l.ID}
+			if cr, ok := done[key{uid, l.ID}]; ok {
+				at := cr.CompletedAt
+				it.Done, it.At, it.Late = true, &at, at.After(a.DueAt)
+				if at.After(a.OpensAt) {
+					started = true
+				}
+				late = late || it.Late
+			} else {
+				finished = false
+			}
+			p.Items = append(p.Items, it)
+		}
+		if p.Possible > 0 {
+			p.Score = p.Earned * 100 / float64(p.Possible)
+		}
+		switch {
+		case now.Before(a.OpensAt):
+			p.Status = StatusNotOpen
+		case finished && late:
+			p.Status = StatusLate
+		case finished:
+			p.Status = StatusSubmitted
+		case now.After(a.DueAt):
+			p.Status = StatusMissing
+		case started:
+			p.Status = StatusInProgress
+		default:
+			p.Status = StatusNotStarted
+		}
+		out[uid] = p
+	}
+	return out, nil
+}
+
+func taskPoints(a *models.Assignment, taskID uint) int {
+	for _, t := range a.Tasks {
+		if t.ID == taskID {
+			return t.Points
+		}
+	}
+	return 0
+}
@@ -0,0 +1,89 @@
+package assignments
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"coolphy-backend/internal/config"
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+)
+
+const reminderInterval = 10 * time.Minute
+
+// StartReminders checks for assignments due within cfg.AssignmentReminderBefore
+// every few minutes and notifies the students who haven't finished them
+func StartReminders(cfg config.Config) {
+	if cfg.AssignmentReminderBefore <= 0 {
+		return
+	}
+	go func() {
+		for {
+			if err := SendReminders(time.Now(), cfg.AssignmentReminderBefore); err != nil {
+				log.Printf("assignment reminders: %v", err)
+			}
+			time.Sleep(reminderInterval)
+		}
+	}()
+}
+
+// SendReminders notifies unfinished students of open assignments due
+// between now and now+before. Each assignment gets one round of reminders.
+func SendReminders(now time.Time, before time.Duration) error {
+	var due []models.Assignment
+	err := db.Get().Preload("Tasks").Preload("Lectures").
+		Where("reminder_sent_at IS NULL AND opens_at <= ? AND due_at > ? AND due_at <= ?", now, now, now.Add(before)).
+		Find(&due).Error
+	if err != nil {
+		return err
+	}
+	for i := range due {
+		a := &due[i]
+		// Claim the assignment first so two instances don't both send
+		res := db.Get().Model(&models.Assignment{}).Where("id = ? AND reminder_sent_at IS NULL", a.ID).Update("reminder_sent_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+		var members []uint
+		if err := db.Get().Model(&models.ClassMember{}).Where("class_id = ?", a.ClassID).Pluck("user_id", &members).Error; err != nil {
+			return err
+		}
+		progress, err := Compute(a, members, now)
+		if err != nil {
+			return err
+		}
+		var notes []models.Notification
+		for _, uid := range members {
+			p := progress[uid]
+			if p.Status == StatusSubmitted || p.Status == StatusLate {
+				continue
+			}
+			notes = append(notes, models.Notification{
+				UserID:  uid,
+				Type:    "reminder",
+				Title:   "Homework due soon: " + a.Title,
+				Content: fmt.Sprintf("\"%s\" is due %s UTC. Done %d of %d items.", a.Title, a.DueAt.UTC().Format("2006-01-02 15:04"), doneItems(p), len(p.Items)),
+			})
+		}
+		if len(notes) > 0 {
+			if err := db.Get().Create(&notes).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func doneItems(p *Progress) int {
+	n := 0
+	for _, it := range p.Items {
+		if it.Done {
+			n++
+		}
+	}
+	return n
+}
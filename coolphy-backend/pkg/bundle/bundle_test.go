@@ -0,0 +1,151 @@
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/db/dbtest"
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/models"
+)
+
+// exportFixture fills a database and exports all of it
+func exportFixture(t *testing.T) []byte {
+	t.Helper()
+	d := dbtest.Open(t)
+	parent := models.Topic{Title: "Mechanics", Subject: "physics"}
+	d.Create(&parent)
+	child := models.Topic{Title: "Kinematics", Subject: "physics", ParentID: &parent.ID}
+	d.Create(&child)
+	task := models.Task{
+		Title: "Speed", Subject: "physics", DescriptionLaTeX: "Find $v$.", SolutionLaTeX: "$v = s/t$",
+		Tags: pq.StringArray{"ege", "speed"}, AnswerType: grading.AnswerNumeric, CorrectAnswer: "10 m/s",
+		Tolerance: 0.05, Points: 2, Status: models.StatusPublished, Topics: []models.Topic{child},
+	}
+	d.Create(&task)
+	draft := models.Task{Title: "Unfinished", Subject: "physics", AnswerType: grading.AnswerText, Status: models.StatusReview}
+	d.Create(&draft)
+	lecture := models.Lecture{
+		Title: "Motion", Subject: "physics", ContentLaTeX: `\section{Motion} $s = vt$`, Status: models.StatusPublished,
+		Topics: []models.Topic{child}, RelatedTasks: []models.Task{task},
+	}
+	d.Create(&lecture)
+
+	var buf bytes.Buffer
+	m, err := Export(&buf, Selection{}, time.Now())
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(m.Topics) != 2 || len(m.Tasks) != 2 || len(m.Lectures) != 1 {
+		t.Fatalf("manifest has %d topics, %d tasks, %d lectures, want 2, 2, 1", len(m.Topics), len(m.Tasks), len(m.Lectures))
+	}
+	return buf.Bytes()
+}
+
+func importBundle(t *testing.T, data []byte, opts Options) *Report {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := db.Get()
+	r, err := Import(d, zr, opts)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	return r
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := exportFixture(t)
+
+	d := dbtest.Open(t)
+	author := models.User{Email: "editor@example.com", Name: "editor", PasswordHash: "x", Role: models.RoleEditor}
+	d.Create(&author)
+	// Something already here shifts the IDs
+	d.Create(&models.Topic{Title: "Algebra", Subject: "math"})
+
+	if r := importBundle(t, data, Options{DryRun: true, AuthorID: author.ID}); r.Summary["task"][ActionCreated] != 2 {
+		t.Errorf("dry run summary %v, want 2 tasks created", r.Summary)
+	}
+	var n int64
+	d.Model(&models.Task{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("dry run stored %d tasks", n)
+	}
+
+	r := importBundle(t, data, Options{AuthorID: author.ID, KeepStatus: true})
+	for typ, want := range map[string]int{"topic": 2, "task": 2, "lecture": 1} {
+		if got := r.Summary[typ][ActionCreated]; got != want {
+			t.Errorf("%d %ss created, want %d: %v", got, typ, want, r.Items)
+		}
+	}
+
+	var task models.Task
+	if err := d.Preload("Topics").Where("title = ?", "Speed").First(&task).Error; err != nil {
+		t.Fatal(err)
+	}
+	if task.DescriptionLaTeX != "Find $v$." || task.SolutionLaTeX != "$v = s/t$" || task.CorrectAnswer != "10 m/s" ||
+		task.Tolerance != 0.05 || task.Points != 2 || len(task.Tags) != 2 || task.Status != models.StatusPublished {
+		t.Errorf("task came back as %+v", task)
+	}
+	if len(task.Topics) != 1 || task.Topics[0].Title != "Kinematics" || task.Topics[0].ParentID == nil {
+		t.Fatalf("task topics %+v, want Kinematics under Mechanics", task.Topics)
+	}
+	var parent models.Topic
+	d.First(&parent, *task.Topics[0].ParentID)
+	if parent.Title != "Mechanics" {
+		t.Errorf("Kinematics is under %q, want Mechanics", parent.Title)
+	}
+	var draft models.Task
+	d.Where("title = ?", "Unfinished").First(&draft)
+	if draft.Status != models.StatusDraft {
+		t.Errorf("content under review arrived as %s, want draft", draft.Status)
+	}
+
+	var lecture models.Lecture
+	if err := d.Preload("RelatedTasks").Preload("Topics").First(&lecture).Error; err != nil {
+		t.Fatal(err)
+	}
+	if lecture.ContentLaTeX != `\section{Motion} $s = vt$` || len(lecture.RelatedTasks) != 1 || lecture.RelatedTasks[0].ID != task.ID || len(lecture.Topics) != 1 {
+		t.Errorf("lecture came back as %+v", lecture)
+	}
+	var revs int64
+	d.Model(&models.Revision{}).Where("author_id = ?", author.ID).Count(&revs)
+	if revs != 3 {
+		t.Errorf("%d revisions recorded for the import, want 3", revs)
+	}
+
+	// Importing again finds everything
+	r = importBundle(t, data, Options{AuthorID: author.ID})
+	for typ, want := range map[string]int{"topic": 2, "task": 2, "lecture": 1} {
+		if got := r.Summary[typ][ActionSkipped]; got != want {
+			t.Errorf("second import skipped %d %ss, want %d", got, typ, want)
+		}
+	}
+	d.Model(&models.Task{}).Count(&n)
+	if n != 2 {
+		t.Errorf("%d tasks after importing twice, want 2", n)
+	}
+}
+
+func TestImportRejectsOtherArchives(t *testing.T) {
+	dbtest.Open(t)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create(ManifestFile)
+	w.Write([]byte(`{"format":"something else","version":1}`))
+	zw.Close()
+	zr, _ := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if _, err := Import(db.Get(), zr, Options{}); err != ErrFormat {
+		t.Errorf("foreign manifest: %v, want ErrFormat", err)
+	}
+	if _, err := Import(db.Get(), zr, Options{Strategy: "merge"}); err == nil {
+		t.Errorf("unknown strategy gave no error")
+	}
+}
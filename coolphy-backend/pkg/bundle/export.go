@@ -0,0 +1,334 @@
+package bundle
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/tikz"
+)
+
+// Selection picks what to export. Lectures and tasks are those listed by
+// ID plus those matching Subjects and TopicID; with no selection at all
+// everything is exported. The tasks of exported lectures, the topics of
+// everything (with their ancestors) and the videos of the lectures come
+// along.
+type Selection struct {
+	Subjects   []string
+	TopicID    *uint // the topic and its subtopics
+	LectureIDs []uint
+	TaskIDs    []uint
+	NoVideos   bool // leave video files out, keeping their metadata
+}
+
+func (s Selection) filtered() bool { return len(s.Subjects) > 0 || s.TopicID != nil }
+
+func (s Selection) everything() bool {
+	return !s.filtered() && len(s.LectureIDs) == 0 && len(s.TaskIDs) == 0
+}
+
+const subtopics = "WITH RECURSIVE sub AS (SELECT id FROM topics WHERE id = ? UNION ALL SELECT t.id FROM topics t JOIN sub ON t.parent_id = sub.id) SELECT id FROM sub"
+
+// match returns the lectures or tasks matching the subject and topic filters
+func (s Selection) match(q *gorm.DB, joinTable, joinColumn string) *gorm.DB {
+	if len(s.Subjects) > 0 {
+		q = q.Where("subject IN ?", s.Subjects)
+	}
+	if s.TopicID != nil {
+		q = q.Where("id IN (SELECT "+joinColumn+" FROM "+joinTable+" WHERE topic_id IN ("+subtopics+"))", *s.TopicID)
+	}
+	return q
+}
+
+type link struct{ From, To uint }
+
+// links reads a many2many table as pairs
+func links(table, from, to string, ids []uint) (map[uint][]uint, error) {
+	var rows []link
+	if err := db.Get().Table(table).Select(from+" AS \"from\", "+to+" AS \"to\"").
+		Where(from+" IN ?", ids).Order(to).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := map[uint][]uint{}
+	for _, r := range rows {
+		out[r.From] = append(out[r.From], r.To)
+	}
+	return out, nil
+}
+
+// Export writes a bundle of the selection to w and returns its manifest
+func Export(w io.Writer, sel Selection, now time.Time) (*Manifest, error) {
+	var lectures []models.Lecture
+	var tasks []models.Task
+	q := db.Get().Order("id")
+	switch {
+	case sel.everything():
+		if err := q.Find(&lectures).Error; err != nil {
+			return nil, err
+		}
+	default:
+		lq := db.Get().Where("id IN ?", append([]uint{0}, sel.LectureIDs...))
+		if sel.filtered() {
+			lq = lq.Or(sel.match(db.Get(), "lecture_topics", "lecture_id"))
+		}
+		if err := q.Where(lq).Find(&lectures).Error; err != nil {
+			return nil, err
+		}
+	}
+	lectureIDs := make([]uint, len(lectures))
+	for i, l := range lectures {
+		lectureIDs[i] = l.ID
+	}
+	lectureTopics, err := links("lecture_topics", "lecture_id", "topic_id", lectureIDs)
+	if err != nil {
+		return nil, err
+	}
+	lectureTasks, err := links("lecture_tasks", "lecture_id", "task_id", lectureIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	tq := db.Get().Order("id")
+	if !sel.everything() {
+		wanted := append([]uint{0}, sel.TaskIDs...)
+		for _, ids := range lectureTasks {
+			wanted = append(wanted, ids...)
+		}
+		cond := db.Get().Where("id IN ?", wanted)
+		if sel.filtered() {
+			cond = cond.Or(sel.match(db.Get(), "task_topics", "task_id"))
+		}
+		tq = tq.Where(cond)
+	}
+	if err := tq.Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	taskIDs := make([]uint, len(tasks))
+	for i, t := range tasks {
+		taskIDs[i] = t.ID
+	}
+	taskTopics, err := links("task_topics", "task_id", "topic_id", taskIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	topics, err := exportTopics(sel, lectureTopics, taskTopics)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Format: Format, Version: Version, ExportedAt: now.UTC()}
+	files := map[string]string{} // archive name → text
+	for _, t := range topics {
+		m.Topics = append(m.Topics, TopicEntry{
+			ID: t.ID, ParentID: t.ParentID, Title: t.Title, Subject: t.Subject,
+			Description: t.Description, Level: t.Level, OrderIndex: t.OrderIndex,
+		})
+	}
+	var texts []string
+	videoIDs := map[uint]bool{}
+	for _, l := range lectures {
+		e := LectureEntry{
+			ID: l.ID, Title: l.Title, Subject: l.Subject, ContentFile: fmt.Sprintf("lectures/%d.tex", l.ID),
+			Summary: l.Summary, Tags: l.Tags, Level: l.Level, VideoURL: l.VideoURL, VideoID: l.VideoAssetID,
+			Status: l.Status, TopicIDs: lectureTopics[l.ID], TaskIDs: lectureTasks[l.ID],
+		}
+		if l.VideoAssetID != nil {
+			videoIDs[*l.VideoAssetID] = true
+		}
+		files[e.ContentFile] = l.ContentLaTeX
+		texts = append(texts, l.ContentLaTeX)
+		m.Lectures = append(m.Lectures, e)
+	}
+	for _, t := range tasks {
+		e := TaskEntry{
+			ID: t.ID, Title: t.Title, Subject: t.Subject, DescriptionFile: fmt.Sprintf("tasks/%d/description.tex", t.ID),
+			Tags: t.Tags, Level: t.Level, Type: t.Type, CorrectAnswer: t.CorrectAnswer, AnswerType: t.AnswerType,
+			AnswerSpec: json.RawMessage(t.AnswerSpec), Params: json.RawMessage(t.Params), AnswerFormula: t.AnswerFormula,
+			AnswerUnit: t.AnswerUnit, Tolerance: t.Tolerance, ToleranceMode: t.ToleranceMode, Points: t.Points,
+			Status: t.Status, TopicIDs: taskTopics[t.ID],
+		}
+		files[e.DescriptionFile] = t.DescriptionLaTeX
+		if t.SolutionLaTeX != "" {
+			e.SolutionFile = fmt.Sprintf("tasks/%d/solution.tex", t.ID)
+			files[e.SolutionFile] = t.SolutionLaTeX
+		}
+		if t.HintLaTeX != "" {
+			e.HintFile = fmt.Sprintf("tasks/%d/hint.tex", t.ID)
+			files[e.HintFile] = t.HintLaTeX
+		}
+		texts = append(texts, t.DescriptionLaTeX, t.SolutionLaTeX, t.HintLaTeX)
+		m.Tasks = append(m.Tasks, e)
+	}
+
+	paths := map[string]string{} // archive name → file on disk
+	if len(videoIDs) > 0 {
+		ids := make([]uint, 0, len(videoIDs))
+		for id := range videoIDs {
+			ids = append(ids, id)
+		}
+		var videos []models.VideoAsset
+		if err := db.Get().Where("id IN ?", ids).Order("id").Find(&videos).Error; err != nil {
+			return nil, err
+		}
+		for _, v := range videos {
+			e := VideoEntry{ID: v.ID, OriginalName: v.OriginalName, MimeType: v.MimeType, SizeBytes: v.SizeBytes}
+			if _, err := os.Stat(v.StoragePath); err == nil && !sel.NoVideos {
+				e.File = fmt.Sprintf("videos/%d%s", v.ID, strings.ToLower(filepath.Ext(v.StoragePath)))
+				paths[e.File] = v.StoragePath
+			}
+			m.Videos = append(m.Videos, e)
+		}
+	}
+	if diagrams := tikz.Diagrams(texts...); len(diagrams) > 0 {
+		hashes := make([]string, len(diagrams))
+		for i, d := range diagrams {
+			hashes[i] = tikz.Hash(d)
+		}
+		var assets []models.Asset
+		if err := db.Get().Where("hash IN ? AND status = ?", hashes, models.AssetReady).Order("hash").Find(&assets).Error; err != nil {
+			return nil, err
+		}
+		for _, a := range assets {
+			if _, err := os.Stat(a.StoragePath); err != nil {
+				continue
+			}
+			e := AssetEntry{Hash: a.Hash, File: "assets/" + a.Hash + ".svg"}
+			paths[e.File] = a.StoragePath
+			m.Assets = append(m.Assets, e)
+		}
+	}
+
+	zw := zip.NewWriter(w)
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(zw, ManifestFile, manifest, now); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := writeFile(zw, name, []byte(files[name]), now); err != nil {
+			return nil, err
+		}
+	}
+	names = names[:0]
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := copyFile(zw, name, paths[name], now); err != nil {
+			return nil, err
+		}
+	}
+	return m, zw.Close()
+}
+
+// exportTopics returns the topics the content is filed under, the selected
+// topic trees, and all their ancestors
+func exportTopics(sel Selection, linked ...map[uint][]uint) ([]models.Topic, error) {
+	var topics []models.Topic
+	if sel.everything() {
+		err := db.Get().Order("id").Find(&topics).Error
+		return topics, err
+	}
+	want := map[uint]bool{}
+	for _, l := range linked {
+		for _, ids := range l {
+			for _, id := range ids {
+				want[id] = true
+			}
+		}
+	}
+	q := db.Get().Where("id IN ?", append([]uint{0}, keys(want)...))
+	if len(sel.Subjects) > 0 {
+		q = q.Or("subject IN ?", sel.Subjects)
+	}
+	if sel.TopicID != nil {
+		q = q.Or("id IN ("+subtopics+")", *sel.TopicID)
+	}
+	if err := db.Get().Where(q).Find(&topics).Error; err != nil {
+		return nil, err
+	}
+	have := map[uint]bool{}
+	for _, t := range topics {
+		have[t.ID] = true
+	}
+	// Walk up until every parent is in
+	for {
+		missing := map[uint]bool{}
+		for _, t := range topics {
+			if t.ParentID != nil && !have[*t.ParentID] {
+				missing[*t.ParentID] = true
+			}
+		}
+		if len(missing) == 0 {
+			break
+		}
+		var parents []models.Topic
+		if err := db.Get().Where("id IN ?", keys(missing)).Find(&parents).Error; err != nil {
+			return nil, err
+		}
+		for _, p := range parents {
+			have[p.ID] = true
+		}
+		for id := range missing {
+			// A dangling parent_id, don't look for it again
+			have[id] = true
+		}
+		topics = append(topics, parents...)
+	}
+	sort.Slice(topics, func(a, b int) bool { return topics[a].ID < topics[b].ID })
+	return topics, nil
+}
+
+func keys(set map[uint]bool) []uint {
+	out := make([]uint, 0, len(set))
+	for id := range set {
+		out = append(out, id)
+	}
+	return out
+}
+
+func writeFile(zw *zip.Writer, name string, data []byte, now time.Time) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// copyFile stores a file from disk without compression; videos and SVGs
+// gain little from it
+func copyFile(zw *zip.Writer, name, path string, now time.Time) error {
+	src, err := os.Open(path)
+	if err != nil {
+		log.Printf("bundle: %s: %v", path, err)
+		return err
+	}
+	defer src.Close()
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: now})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, src)
+	return err
+}
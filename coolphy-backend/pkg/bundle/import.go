@@ -0,0 +1,637 @@
+package bundle
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"coolphy-backend/pkg/latex"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/revisions"
+	"coolphy-backend/pkg/taskcheck"
+	"coolphy-backend/pkg/tikz"
+)
+
+// What to do with a topic, lecture or task that already exists here. Topics
+// match by subject, title and parent, lectures and tasks by subject and
+// title, videos by file name and size.
+const (
+	StrategySkip      = "skip"      // keep ours and link to it
+	StrategyOverwrite = "overwrite" // replace ours with the bundle's
+	StrategyDuplicate = "duplicate" // import a copy next to ours
+)
+
+// Item actions in the report
+const (
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionSkipped = "skipped"
+	ActionFailed  = "failed"
+)
+
+const (
+	maxManifestSize = 64 << 20
+	maxTextSize     = 8 << 20
+	maxAssetSize    = 16 << 20
+)
+
+// ErrFormat is a file that isn't a bundle this version can read
+var ErrFormat = errors.New("not a content bundle")
+
+// Options control an import
+type Options struct {
+	Strategy string
+	DryRun   bool // report what would happen and change nothing
+	AuthorID uint // recorded as author of new lectures and of the revisions
+	// KeepStatus keeps published and archived content as it is; otherwise
+	// everything new arrives as a draft. Content under review or scheduled
+	// in the source always arrives as a draft.
+	KeepStatus bool
+	// VideoPath returns where to store a video file with extension ext
+	VideoPath func(ext string) (string, error)
+}
+
+// Item is what happened to one entry of the manifest. IDs are those of
+// the bundle and of this instance; new items have no target ID on a dry run.
+type Item struct {
+	Type     string        `json:"type"` // topic, lecture, task, video, asset
+	SourceID uint          `json:"source_id,omitempty"`
+	TargetID uint          `json:"target_id,omitempty"`
+	Title    string        `json:"title,omitempty"`
+	Action   string        `json:"action"`
+	Error    string        `json:"error,omitempty"`
+	Issues   []latex.Issue `json:"issues,omitempty"`
+}
+
+// Report is the outcome of an import, or what it would be on a dry run
+type Report struct {
+	DryRun   bool                      `json:"dry_run"`
+	Strategy string                    `json:"strategy"`
+	Version  int                       `json:"version"`
+	Summary  map[string]map[string]int `json:"summary"` // type → action → count
+	Items    []Item                    `json:"items"`
+}
+
+func (r *Report) add(it Item) {
+	if r.DryRun && it.Action == ActionCreated {
+		it.TargetID = 0
+	}
+	if r.Summary[it.Type] == nil {
+		r.Summary[it.Type] = map[string]int{}
+	}
+	r.Summary[it.Type][it.Action]++
+	r.Items = append(r.Items, it)
+}
+
+var errDryRun = errors.New("dry run")
+
+type importer struct {
+	tx     *gorm.DB
+	opts   Options
+	files  map[string]*zip.File
+	report *Report
+
+	topics, lectures, tasks, videos map[uint]uint // bundle ID → our ID
+	written                         []string      // video files copied so far
+	texts                           []string      // imported LaTeX, for the diagrams
+}
+
+// Import reads a bundle into the database in one transaction. Topics come
+// first, parents before children, then videos, tasks and lectures, then the
+// links between them, all mapped to the IDs given here. An entry that can't
+// be imported is reported and left out; errors returned are about the
+// archive or the database.
+func Import(tx *gorm.DB, zr *zip.Reader, opts Options) (*Report, error) {
+	switch opts.Strategy {
+	case "":
+		opts.Strategy = StrategySkip
+	case StrategySkip, StrategyOverwrite, StrategyDuplicate:
+	default:
+		return nil, fmt.Errorf("unknown strategy %q", opts.Strategy)
+	}
+	im := &importer{
+		opts:     opts,
+		files:    map[string]*zip.File{},
+		topics:   map[uint]uint{},
+		lectures: map[uint]uint{},
+		tasks:    map[uint]uint{},
+		videos:   map[uint]uint{},
+	}
+	for _, f := range zr.File {
+		im.files[f.Name] = f
+	}
+	raw, err := im.read(ManifestFile, maxManifestSize)
+	if err != nil {
+		return nil, ErrFormat
+	}
+	var m Manifest
+	if err := json.Unmarshal(raw, &m); err != nil || m.Format != Format {
+		return nil, ErrFormat
+	}
+	if m.Version < 1 || m.Version > Version {
+		return nil, fmt.Errorf("%w: version %d, this server reads up to %d", ErrFormat, m.Version, Version)
+	}
+	im.report = &Report{DryRun: opts.DryRun, Strategy: opts.Strategy, Version: m.Version, Summary: map[string]map[string]int{}, Items: []Item{}}
+
+	err = tx.Transaction(func(tx *gorm.DB) error {
+		im.tx = tx
+		if err := im.importTopics(m.Topics); err != nil {
+			return err
+		}
+		if err := im.importVideos(m.Videos); err != nil {
+			return err
+		}
+		for _, e := range m.Tasks {
+			if err := im.importTask(e); err != nil {
+				return err
+			}
+		}
+		for _, e := range m.Lectures {
+			if err := im.importLecture(e); err != nil {
+				return err
+			}
+		}
+		if err := im.link(m); err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		for _, path := range im.written {
+			os.Remove(path)
+		}
+		return nil, err
+	}
+	im.importAssets(m.Assets)
+	return im.report, nil
+}
+
+// read returns a file of the archive, refusing anything over limit bytes
+func (im *importer) read(name string, limit int64) ([]byte, error) {
+	f, ok := im.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is missing from the bundle", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is too large", name)
+	}
+	return data, nil
+}
+
+// readTeX reads an optional LaTeX file; an empty name is an empty text
+func (im *importer) readTeX(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	data, err := im.read(name, maxTextSize)
+	return string(data), err
+}
+
+// status is the status new content gets
+func (im *importer) status(s string) string {
+	if im.opts.KeepStatus && (s == models.StatusPublished || s == models.StatusArchived) {
+		return s
+	}
+	return models.StatusDraft
+}
+
+func (im *importer) importTopics(entries []TopicEntry) error {
+	// Parents first; a parent missing from the bundle makes a root topic
+	inBundle := map[uint]bool{}
+	for _, e := range entries {
+		inBundle[e.ID] = true
+	}
+	done := map[uint]bool{}
+	for len(done) < len(inBundle) {
+		progress := false
+		for _, e := range entries {
+			if done[e.ID] {
+				continue
+			}
+			var parent *uint
+			if e.ParentID != nil && inBundle[*e.ParentID] {
+				if !done[*e.ParentID] {
+					continue
+				}
+				if id, ok := im.topics[*e.ParentID]; ok {
+					parent = &id
+				}
+			}
+			if err := im.importTopic(e, parent); err != nil {
+				return err
+			}
+			done[e.ID], progress = true, true
+		}
+		if !progress {
+			// A cycle of parents; report the rest instead of looping
+			for _, e := range entries {
+				if !done[e.ID] {
+					im.report.add(Item{Type: "topic", SourceID: e.ID, Title: e.Title, Action: ActionFailed, Error: "parent cycle"})
+					done[e.ID] = true
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (im *importer) importTopic(e TopicEntry, parent *uint) error {
+	it := Item{Type: "topic", SourceID: e.ID, Title: e.Title}
+	var existing models.Topic
+	found := false
+	if im.opts.Strategy != StrategyDuplicate {
+		q := im.tx.Where("subject = ? AND title = ?", e.Subject, e.Title)
+		if parent == nil {
+			q = q.Where("parent_id IS NULL")
+		} else {
+			q = q.Where("parent_id = ?", *parent)
+		}
+		err := q.Order("id").First(&existing).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		found = err == nil
+	}
+	switch {
+	case found && im.opts.Strategy == StrategySkip:
+		it.TargetID, it.Action = existing.ID, ActionSkipped
+	case found:
+		if err := im.tx.Model(&existing).Updates(map[string]any{
+			"Description": e.Description, "Level": e.Level, "OrderIndex": e.OrderIndex,
+		}).Error; err != nil {
+			return err
+		}
+		it.TargetID, it.Action = existing.ID, ActionUpdated
+	default:
+		t := models.Topic{
+			Title: e.Title, Subject: e.Subject, Description: e.Description,
+			ParentID: parent, Level: e.Level, OrderIndex: e.OrderIndex,
+		}
+		if err := im.tx.Create(&t).Error; err != nil {
+			return err
+		}
+		it.TargetID, it.Action = t.ID, ActionCreated
+	}
+	im.topics[e.ID] = it.TargetID
+	im.report.add(it)
+	return nil
+}
+
+// importVideos links to videos we already have and copies the others.
+// Videos are never overwritten; a lecture that needs a video missing from
+// the bundle and from here keeps only its video_url.
+func (im *importer) importVideos(entries []VideoEntry) error {
+	for _, e := range entries {
+		it := Item{Type: "video", SourceID: e.ID, Title: e.OriginalName}
+		if im.opts.Strategy != StrategyDuplicate || e.File == "" {
+			var existing models.VideoAsset
+			err := im.tx.Where("original_name = ? AND size_bytes = ?", e.OriginalName, e.SizeBytes).
+				Order("id").First(&existing).Error
+			if err != nil && err != gorm.ErrRecordNotFound {
+				return err
+			}
+			if err == nil {
+				it.TargetID, it.Action = existing.ID, ActionSkipped
+				im.videos[e.ID] = existing.ID
+				im.report.add(it)
+				continue
+			}
+		}
+		if e.File == "" {
+			it.Action, it.Error = ActionFailed, "video file not in bundle"
+			im.report.add(it)
+			continue
+		}
+		path, err := im.copyVideo(e.File)
+		if err != nil {
+			it.Action, it.Error = ActionFailed, err.Error()
+			im.report.add(it)
+			continue
+		}
+		v := models.VideoAsset{StoragePath: path, OriginalName: e.OriginalName, MimeType: e.MimeType, SizeBytes: e.SizeBytes}
+		if err := im.tx.Create(&v).Error; err != nil {
+			return err
+		}
+		it.TargetID, it.Action = v.ID, ActionCreated
+		im.videos[e.ID] = v.ID
+		im.report.add(it)
+	}
+	return nil
+}
+
+// copyVideo stores a video of the archive as a new upload. A dry run only
+// checks that it is there.
+func (im *importer) copyVideo(name string) (string, error) {
+	f, ok := im.files[name]
+	if !ok {
+		return "", fmt.Errorf("%s is missing from the bundle", name)
+	}
+	if im.opts.VideoPath == nil {
+		return "", errors.New("video storage is not configured")
+	}
+	path, err := im.opts.VideoPath(strings.ToLower(filepath.Ext(name)))
+	if err != nil {
+		return "", err
+	}
+	if im.opts.DryRun {
+		return path, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	src, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	im.written = append(im.written, path)
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", err
+	}
+	return path, dst.Close()
+}
+
+// existing looks up content with the same subject and title unless every
+// entry should be a new copy
+func (im *importer) existing(model any, subject, title string) (uint, error) {
+	if im.opts.Strategy == StrategyDuplicate {
+		return 0, nil
+	}
+	var id uint
+	err := im.tx.Model(model).Select("id").Where("subject = ? AND title = ?", subject, title).
+		Order("id").Limit(1).Scan(&id).Error
+	return id, err
+}
+
+func (im *importer) importTask(e TaskEntry) error {
+	it := Item{Type: "task", SourceID: e.ID, Title: e.Title}
+	id, err := im.existing(&models.Task{}, e.Subject, e.Title)
+	if err != nil {
+		return err
+	}
+	if id != 0 && im.opts.Strategy == StrategySkip {
+		it.TargetID, it.Action = id, ActionSkipped
+		im.tasks[e.ID] = id
+		im.report.add(it)
+		return nil
+	}
+
+	var desc, solution, hint string
+	if desc, err = im.readTeX(e.DescriptionFile); err == nil {
+		if solution, err = im.readTeX(e.SolutionFile); err == nil {
+			hint, err = im.readTeX(e.HintFile)
+		}
+	}
+	if err != nil {
+		it.Action, it.Error = ActionFailed, err.Error()
+		im.report.add(it)
+		return nil
+	}
+	if issues := lint("description_latex", desc, "solution_latex", solution, "hint_latex", hint); latex.HasErrors(issues) {
+		it.Action, it.Error, it.Issues = ActionFailed, "invalid LaTeX", issues
+		im.report.add(it)
+		return nil
+	}
+
+	t := models.Task{
+		Title: e.Title, DescriptionLaTeX: desc, Subject: e.Subject, Tags: e.Tags, Level: e.Level,
+		Type: e.Type, CorrectAnswer: e.CorrectAnswer, AnswerType: e.AnswerType,
+		AnswerSpec: datatypes.JSON(e.AnswerSpec), Params: datatypes.JSON(e.Params),
+		AnswerFormula: e.AnswerFormula, AnswerUnit: e.AnswerUnit, Tolerance: e.Tolerance,
+		ToleranceMode: e.ToleranceMode, SolutionLaTeX: solution, HintLaTeX: hint, Points: e.Points,
+	}
+	// The same checks as the task editor, so a bundle can't bring in a task that can't be graded
+	if err := taskcheck.Validate(&t); err != nil {
+		it.Action, it.Error = ActionFailed, err.Error()
+		im.report.add(it)
+		return nil
+	}
+	if id == 0 {
+		t.Status = im.status(e.Status)
+		if err := im.tx.Create(&t).Error; err != nil {
+			return err
+		}
+		if _, err := revisions.Record(im.tx, models.ContentTask, t.ID, &im.opts.AuthorID, models.RevisionCreate, nil); err != nil {
+			return err
+		}
+		it.TargetID, it.Action = t.ID, ActionCreated
+	} else {
+		if err := revisions.Baseline(im.tx, models.ContentTask, id); err != nil {
+			return err
+		}
+		// Select writes empty values too; the status stays ours
+		if err := im.tx.Model(&models.Task{ID: id}).Select(
+			"Title", "DescriptionLaTeX", "Subject", "Tags", "Level", "Type", "CorrectAnswer", "AnswerType",
+			"AnswerSpec", "Params", "AnswerFormula", "AnswerUnit", "Tolerance", "ToleranceMode",
+			"SolutionLaTeX", "HintLaTeX", "Points",
+		).Updates(&t).Error; err != nil {
+			return err
+		}
+		if _, err := revisions.Record(im.tx, models.ContentTask, id, &im.opts.AuthorID, models.RevisionUpdate, nil); err != nil {
+			return err
+		}
+		it.TargetID, it.Action = id, ActionUpdated
+	}
+	im.tasks[e.ID] = it.TargetID
+	im.texts = append(im.texts, desc, solution, hint)
+	im.report.add(it)
+	return nil
+}
+
+func (im *importer) importLecture(e LectureEntry) error {
+	it := Item{Type: "lecture", SourceID: e.ID, Title: e.Title}
+	id, err := im.existing(&models.Lecture{}, e.Subject, e.Title)
+	if err != nil {
+		return err
+	}
+	if id != 0 && im.opts.Strategy == StrategySkip {
+		it.TargetID, it.Action = id, ActionSkipped
+		im.lectures[e.ID] = id
+		im.report.add(it)
+		return nil
+	}
+	content, err := im.readTeX(e.ContentFile)
+	if err != nil {
+		it.Action, it.Error = ActionFailed, err.Error()
+		im.report.add(it)
+		return nil
+	}
+	if issues := lint("content_latex", content); latex.HasErrors(issues) {
+		it.Action, it.Error, it.Issues = ActionFailed, "invalid LaTeX", issues
+		im.report.add(it)
+		return nil
+	}
+
+	l := models.Lecture{
+		Title: e.Title, Subject: e.Subject, ContentLaTeX: content, Summary: e.Summary,
+		Tags: e.Tags, Level: e.Level, VideoURL: e.VideoURL,
+	}
+	if e.VideoID != nil {
+		if vid, ok := im.videos[*e.VideoID]; ok {
+			l.VideoAssetID = &vid
+		}
+	}
+	if id == 0 {
+		l.AuthorID, l.Status = im.opts.AuthorID, im.status(e.Status)
+		if err := im.tx.Create(&l).Error; err != nil {
+			return err
+		}
+		if _, err := revisions.Record(im.tx, models.ContentLecture, l.ID, &im.opts.AuthorID, models.RevisionCreate, nil); err != nil {
+			return err
+		}
+		it.TargetID, it.Action = l.ID, ActionCreated
+	} else {
+		if err := revisions.Baseline(im.tx, models.ContentLecture, id); err != nil {
+			return err
+		}
+		if err := im.tx.Model(&models.Lecture{ID: id}).Select(
+			"Title", "Subject", "ContentLaTeX", "Summary", "Tags", "Level", "VideoURL", "VideoAssetID",
+		).Updates(&l).Error; err != nil {
+			return err
+		}
+		if _, err := revisions.Record(im.tx, models.ContentLecture, id, &im.opts.AuthorID, models.RevisionUpdate, nil); err != nil {
+			return err
+		}
+		it.TargetID, it.Action = id, ActionUpdated
+	}
+	im.lectures[e.ID] = it.TargetID
+	im.texts = append(im.texts, content)
+	im.report.add(it)
+	return nil
+}
+
+// lint checks LaTeX fields given as name, text pairs
+func lint(fields ...string) []latex.Issue {
+	var issues []latex.Issue
+	for i := 0; i+1 < len(fields); i += 2 {
+		for _, is := range latex.Lint(fields[i+1]) {
+			is.Field = fields[i]
+			issues = append(issues, is)
+		}
+	}
+	return issues
+}
+
+// link rebuilds the topics of the lectures and tasks written by this
+// import and the tasks of its lectures. Skipped content keeps its links.
+func (im *importer) link(m Manifest) error {
+	written := func(action string) bool { return action == ActionCreated || action == ActionUpdated }
+	actions := map[string]map[uint]string{"lecture": {}, "task": {}}
+	for _, it := range im.report.Items {
+		if actions[it.Type] != nil {
+			actions[it.Type][it.SourceID] = it.Action
+		}
+	}
+	for _, e := range m.Tasks {
+		if !written(actions["task"][e.ID]) {
+			continue
+		}
+		id := im.tasks[e.ID]
+		if err := im.relink("task_topics", "task_id", "topic_id", id, im.mapIDs(e.TopicIDs, im.topics)); err != nil {
+			return err
+		}
+	}
+	for _, e := range m.Lectures {
+		if !written(actions["lecture"][e.ID]) {
+			continue
+		}
+		id := im.lectures[e.ID]
+		if err := im.relink("lecture_topics", "lecture_id", "topic_id", id, im.mapIDs(e.TopicIDs, im.topics)); err != nil {
+			return err
+		}
+		if err := im.relink("lecture_tasks", "lecture_id", "task_id", id, im.mapIDs(e.TaskIDs, im.tasks)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *importer) mapIDs(ids []uint, to map[uint]uint) []uint {
+	var out []uint
+	for _, id := range ids {
+		if mapped, ok := to[id]; ok {
+			out = append(out, mapped)
+		}
+	}
+	return out
+}
+
+func (im *importer) relink(table, owner, other string, id uint, ids []uint) error {
+	if err := im.tx.Exec("DELETE FROM "+table+" WHERE "+owner+" = ?", id).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	rows := make([]map[string]any, len(ids))
+	for i, o := range ids {
+		rows[i] = map[string]any{owner: id, other: o}
+	}
+	return im.tx.Table(table).Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+}
+
+// importAssets stores the compiled diagrams of the imported LaTeX and
+// queues those the bundle didn't bring. It runs after the commit: assets
+// are shared by hash, not owned by the content.
+func (im *importer) importAssets(entries []AssetEntry) {
+	sources := map[string]string{}
+	for _, d := range tikz.Diagrams(im.texts...) {
+		sources[tikz.Hash(d)] = d
+	}
+	for _, e := range entries {
+		it := Item{Type: "asset", Title: e.Hash}
+		source, ok := sources[e.Hash]
+		if !ok {
+			// Its lecture or task was skipped or failed
+			it.Action = ActionSkipped
+			im.report.add(it)
+			continue
+		}
+		if im.opts.DryRun {
+			it.Action = ActionCreated
+			im.report.add(it)
+			continue
+		}
+		svg, err := im.read(e.File, maxAssetSize)
+		if err == nil {
+			err = tikz.Store(source, svg)
+		}
+		if err != nil {
+			log.Printf("bundle: asset %s: %v", e.Hash, err)
+			it.Action, it.Error = ActionFailed, err.Error()
+		} else {
+			it.Action = ActionCreated
+		}
+		im.report.add(it)
+	}
+	if !im.opts.DryRun {
+		tikz.Enqueue(im.texts...)
+	}
+}
@@ -0,0 +1,96 @@
+// Package bundle moves lectures, tasks and topic trees between instances as
+// a zip archive: manifest.json describes the content and its relations by
+// the IDs of the source instance, the LaTeX lives in .tex files next to it,
+// and video and diagram files are copied as they are.
+package bundle
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Format names the archive type in the manifest
+const Format = "coolphy-bundle"
+
+// Version is the manifest version written by Export. Import reads this and
+// earlier versions.
+const Version = 1
+
+// ManifestFile is the name of the manifest inside the archive
+const ManifestFile = "manifest.json"
+
+// Manifest lists the content of a bundle. IDs are those of the exporting
+// instance and are only used to link entries to each other.
+type Manifest struct {
+	Format     string         `json:"format"`
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Topics     []TopicEntry   `json:"topics"`
+	Lectures   []LectureEntry `json:"lectures"`
+	Tasks      []TaskEntry    `json:"tasks"`
+	Videos     []VideoEntry   `json:"videos"`
+	Assets     []AssetEntry   `json:"assets"`
+}
+
+type TopicEntry struct {
+	ID          uint   `json:"id"`
+	ParentID    *uint  `json:"parent_id"`
+	Title       string `json:"title"`
+	Subject     string `json:"subject"`
+	Description string `json:"description"`
+	Level       int    `json:"level"`
+	OrderIndex  int    `json:"order_index"`
+}
+
+type LectureEntry struct {
+	ID          uint     `json:"id"`
+	Title       string   `json:"title"`
+	Subject     string   `json:"subject"`
+	ContentFile string   `json:"content_file"` // lectures/<id>.tex
+	Summary     string   `json:"summary"`
+	Tags        []string `json:"tags"`
+	Level       string   `json:"level"`
+	VideoURL    string   `json:"video_url"`
+	VideoID     *uint    `json:"video_id"`
+	Status      string   `json:"status"`
+	TopicIDs    []uint   `json:"topic_ids"`
+	TaskIDs     []uint   `json:"task_ids"` // lecture_tasks
+}
+
+type TaskEntry struct {
+	ID              uint            `json:"id"`
+	Title           string          `json:"title"`
+	Subject         string          `json:"subject"`
+	DescriptionFile string          `json:"description_file"` // tasks/<id>/description.tex
+	SolutionFile    string          `json:"solution_file,omitempty"`
+	HintFile        string          `json:"hint_file,omitempty"`
+	Tags            []string        `json:"tags"`
+	Level           string          `json:"level"`
+	Type            string          `json:"type"`
+	CorrectAnswer   string          `json:"correct_answer"`
+	AnswerType      string          `json:"answer_type"`
+	AnswerSpec      json.RawMessage `json:"answer_spec,omitempty"`
+	Params          json.RawMessage `json:"params,omitempty"`
+	AnswerFormula   string          `json:"answer_formula"`
+	AnswerUnit      string          `json:"answer_unit"`
+	Tolerance       float64         `json:"tolerance"`
+	ToleranceMode   string          `json:"tolerance_mode"`
+	Points          int             `json:"points"`
+	Status          string          `json:"status"`
+	TopicIDs        []uint          `json:"topic_ids"`
+}
+
+type VideoEntry struct {
+	ID           uint   `json:"id"`
+	File         string `json:"file,omitempty"` // videos/<id><ext>, empty if left out of the bundle
+	OriginalName string `json:"original_name"`
+	MimeType     string `json:"mime_type"`
+	SizeBytes    int64  `json:"size_bytes"`
+}
+
+// AssetEntry is a compiled TikZ diagram, identified by the hash of its
+// source in one of the LaTeX files
+type AssetEntry struct {
+	Hash string `json:"hash"`
+	File string `json:"file"` // assets/<hash>.svg
+}
@@ -0,0 +1,200 @@
+// Package contest ranks contest participants under IOI, ICPC or EGE rules.
+package contest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Scoring rules
+const (
+	// IOI: the best submission on each task counts, partial answers earn their share
+	ScoringIOI = "ioi"
+	// ICPC: tasks are solved or not; ties are broken by time plus a penalty per rejected attempt
+	ScoringICPC = "icpc"
+	// EGE: the last answer on each task counts, the primary score is converted to a test score
+	ScoringEGE = "ege"
+)
+
+// DefaultPenaltyMinutes is the ICPC penalty for a rejected attempt
+const DefaultPenaltyMinutes = 20
+
+// Rules configure scoring
+type Rules struct {
+	Scoring        string
+	PenaltyMinutes int   // ICPC, per rejected attempt before the accepted one
+	EGEScale       []int // EGE, test score for each primary score (index); linear if empty
+}
+
+// Validate checks the rules for a contest worth maxPrimary points
+func (r Rules) Validate(maxPrimary int) error {
+	switch r.Scoring {
+	case ScoringIOI, ScoringICPC:
+	case ScoringEGE:
+		if len(r.EGEScale) > 0 && len(r.EGEScale) != maxPrimary+1 {
+			return fmt.Errorf("ege_scale needs %d entries, one for each primary score from 0 to %d", maxPrimary+1, maxPrimary)
+		}
+		for i := 1; i < len(r.EGEScale); i++ {
+			if r.EGEScale[i] < r.EGEScale[i-1] {
+				return fmt.Errorf("ege_scale must not decrease")
+			}
+		}
+	default:
+		return fmt.Errorf("scoring must be ioi, icpc or ege")
+	}
+	if r.PenaltyMinutes < 0 {
+		return fmt.Errorf("penalty_minutes must not be negative")
+	}
+	return nil
+}
+
+// Problem is a task of the contest
+type Problem struct {
+	TaskID uint
+	Points int // full score of the task
+}
+
+// Submission is a graded answer. Score is 0-100, Pending means it isn't
+// graded yet and Frozen that the scoreboard must not reveal it.
+type Submission struct {
+	UserID  uint
+	TaskID  uint
+	Score   int
+	Pending bool
+	Frozen  bool
+	Elapsed time.Duration // since the participant started
+}
+
+// ProblemResult is a participant's result on one task
+type ProblemResult struct {
+	TaskID   uint    `json:"task_id"`
+	Points   float64 `json:"points"`
+	Attempts int     `json:"attempts"`
+	Solved   bool    `json:"solved"`
+	Minute   int     `json:"minute,omitempty"` // ICPC, when it was solved
+	Frozen   int     `json:"frozen,omitempty"` // attempts hidden by the freeze
+}
+
+// Standing is a participant's row on the scoreboard
+type Standing struct {
+	Rank      int             `json:"rank"`
+	UserID    uint            `json:"user_id"`
+	Score     float64         `json:"score"`                // IOI points, ICPC solved count or EGE primary score
+	Penalty   int             `json:"penalty,omitempty"`    // ICPC, minutes
+	TestScore *int            `json:"test_score,omitempty"` // EGE
+	Problems  []ProblemResult `json:"problems"`
+}
+
+// Standings ranks the users. subs must be in the order they were made.
+func Standings(rules Rules, problems []Problem, users []uint, subs []Submission) []Standing {
+	penalty := rules.PenaltyMinutes
+	if penalty == 0 {
+		penalty = DefaultPenaltyMinutes
+	}
+	maxPrimary := 0
+	index := make(map[uint]int, len(problems))
+	for i, p := range problems {
+		index[p.TaskID] = i
+		maxPrimary += p.Points
+	}
+	rows := make(map[uint]*Standing, len(users))
+	out := make([]Standing, len(users))
+	for i, uid := range users {
+		out[i] = Standing{UserID: uid, Problems: make([]ProblemResult, len(problems))}
+		for j, p := range problems {
+			out[i].Problems[j].TaskID = p.TaskID
+		}
+		rows[uid] = &out[i]
+	}
+
+	for _, s := range subs {
+		row, ok := rows[s.UserID]
+		j, known := index[s.TaskID]
+		if !ok || !known || s.Pending {
+			continue
+		}
+		pr := &row.Problems[j]
+		if s.Frozen {
+			pr.Frozen++
+			continue
+		}
+		points := float64(problems[j].Points*s.Score) / 100
+		switch rules.Scoring {
+		case ScoringICPC:
+			if pr.Solved {
+				continue
+			}
+			pr.Attempts++
+			if s.Score == 100 {
+				pr.Solved = true
+				pr.Points = float64(problems[j].Points)
+				pr.Minute = int(s.Elapsed / time.Minute)
+			}
+		case ScoringEGE:
+			pr.Attempts++
+			// The answer a student ends up with is the one that counts; primary scores are whole
+			pr.Points = float64(problems[j].Points * s.Score / 100)
+			pr.Solved = s.Score == 100
+		default:
+			pr.Attempts++
+			if points > pr.Points {
+				pr.Points = points
+			}
+			pr.Solved = pr.Solved || s.Score == 100
+		}
+	}
+
+	for i := range out {
+		row := &out[i]
+		for _, pr := range row.Problems {
+			switch rules.Scoring {
+			case ScoringICPC:
+				if pr.Solved {
+					row.Score++
+					row.Penalty += pr.Minute + penalty*(pr.Attempts-1)
+				}
+			default:
+				row.Score += pr.Points
+			}
+		}
+		if rules.Scoring == ScoringEGE {
+			t := testScore(rules.EGEScale, int(row.Score), maxPrimary)
+			row.TestScore = &t
+		}
+	}
+
+	sort.SliceStable(out, func(a, b int) bool { return better(rules, &out[a], &out[b]) })
+	for i := range out {
+		if i > 0 && !better(rules, &out[i-1], &out[i]) {
+			out[i].Rank = out[i-1].Rank
+		} else {
+			out[i].Rank = i + 1
+		}
+	}
+	return out
+}
+
+func better(rules Rules, a, b *Standing) bool {
+	switch rules.Scoring {
+	case ScoringICPC:
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Penalty < b.Penalty
+	case ScoringEGE:
+		return *a.TestScore > *b.TestScore
+	}
+	return a.Score > b.Score
+}
+
+// testScore converts an EGE primary score with the scale, or linearly to 0-100
+func testScore(scale []int, primary, maxPrimary int) int {
+	if len(scale) > 0 {
+		return scale[max(0, min(primary, len(scale)-1))]
+	}
+	if maxPrimary == 0 {
+		return 0
+	}
+	return primary * 100 / maxPrimary
+}
@@ -26,6 +26,13 @@ func Connect(cfg config.Config) error {
 	return autoMigrate()
 }
 
+// Use makes d the database handlers work with and migrates it, for tests that
+// run against a throwaway database
+func Use(d *gorm.DB) error {
+	DB = d
+	return autoMigrate()
+}
+
 func autoMigrate() error {
 	return DB.AutoMigrate(
 		&models.User{},
@@ -37,6 +44,24 @@ func autoMigrate() error {
 		&models.Note{},
 		&models.ChatMessage{},
 		&models.Notification{},
+		&models.Session{},
+		&models.RecoveryCode{},
+		&models.Class{},
+		&models.ClassMember{},
+		&models.Assignment{},
+		&models.LectureCompletion{},
+		&models.Contest{},
+		&models.ContestTask{},
+		&models.ContestParticipant{},
+		&models.ContestSubmission{},
+		&models.ExamBlueprint{},
+		&models.ExamPosition{},
+		&models.ExamVariant{},
+		&models.ExamVariantItem{},
+		&models.Asset{},
+		&models.Revision{},
+		&models.ImportJob{},
+		&models.ReviewComment{},
 	)
 }
 
@@ -0,0 +1,39 @@
+// Package dbtest gives tests a migrated throwaway database in place of
+// Postgres. It is SQLite, so code under test sticks to portable SQL.
+package dbtest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+)
+
+// Open creates an empty database in the test's temp dir and makes it the
+// global one
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	d, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := db.Use(d); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	// Created by the SQL migrations in production
+	if err := d.AutoMigrate(&models.AppSettings{}, &models.PasswordResetToken{}, &models.EmailVerificationToken{}); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := d.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return d
+}
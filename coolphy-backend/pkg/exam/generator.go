@@ -0,0 +1,182 @@
+// Package exam assembles exam variants from a blueprint: one task per
+// position matching the position's topic, type and difficulty, without
+// repeating tasks the student got in their recent variants.
+package exam
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+)
+
+// DefaultRecent is how many of a student's latest variants new ones avoid
+// repeating tasks from
+const DefaultRecent = 3
+
+// Slot is a blueprint position with the IDs of the tasks that fit it
+type Slot struct {
+	Number     int
+	Candidates []uint
+}
+
+// ShortageError means no unused task fits a position
+type ShortageError struct{ Number int }
+
+func (e *ShortageError) Error() string {
+	return fmt.Sprintf("no task left for position %d", e.Number)
+}
+
+// Pick chooses a task for every slot. A task appears at most once in a
+// variant. Tasks in recent are only picked when the slots can't be filled
+// otherwise, as few as possible; reused counts them. The same slots, recent
+// set and seed always give the same picks.
+//
+// Picking is a bipartite matching of slots to tasks: the slots are first
+// matched with fresh tasks only, then the rest with any task. Augmenting
+// paths move earlier picks aside when a slot needs their task, so a variant
+// is found whenever one exists.
+func Pick(slots []Slot, recent map[uint]bool, seed int64) (picks []uint, reused int, err error) {
+	rng := rand.New(rand.NewSource(seed))
+	cands := make([][]uint, len(slots))
+	for i, s := range slots {
+		c := append([]uint(nil), s.Candidates...)
+		sort.Slice(c, func(a, b int) bool { return c[a] < c[b] })
+		rng.Shuffle(len(c), func(a, b int) { c[a], c[b] = c[b], c[a] })
+		cands[i] = c
+	}
+	// Constrained positions first, so they keep their shuffled first choice
+	order := make([]int, len(slots))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return len(cands[order[a]]) < len(cands[order[b]]) })
+
+	picks = make([]uint, len(slots))
+	owner := map[uint]int{} // task -> slot it is picked for
+	var assign func(i int, fresh bool, seen map[uint]bool) bool
+	assign = func(i int, fresh bool, seen map[uint]bool) bool {
+		for _, id := range cands[i] {
+			if seen[id] || fresh && recent[id] {
+				continue
+			}
+			seen[id] = true
+			if j, taken := owner[id]; !taken || assign(j, fresh, seen) {
+				owner[id], picks[i] = i, id
+				return true
+			}
+		}
+		return false
+	}
+	for _, i := range order {
+		assign(i, true, map[uint]bool{})
+	}
+	// Every augmenting path now ends at a recent task, so each slot filled
+	// here reuses exactly one
+	for _, i := range order {
+		if picks[i] != 0 {
+			continue
+		}
+		if !assign(i, false, map[uint]bool{}) {
+			return nil, 0, &ShortageError{Number: slots[i].Number}
+		}
+		reused++
+	}
+	return picks, reused, nil
+}
+
+// Candidates returns the IDs of published tasks of the subject that fit the
+// position
+func Candidates(subject string, p models.ExamPosition) ([]uint, error) {
+	q := db.Get().Model(&models.Task{}).Where("status = ? AND subject = ?", models.StatusPublished, subject)
+	if p.TopicID != nil {
+		q = q.Where("id IN (SELECT task_id FROM task_topics WHERE topic_id IN ("+
+			"WITH RECURSIVE sub AS (SELECT id FROM topics WHERE id = ? UNION ALL SELECT t.id FROM topics t JOIN sub ON t.parent_id = sub.id) SELECT id FROM sub))", *p.TopicID)
+	}
+	if p.Type != "" {
+		q = q.Where("type = ?", p.Type)
+	}
+	if len(p.Levels) > 0 {
+		q = q.Where("level IN ?", []string(p.Levels))
+	}
+	if len(p.Tags) > 0 {
+		q = q.Where("tags && ?", p.Tags)
+	}
+	var ids []uint
+	err := q.Pluck("id", &ids).Error
+	return ids, err
+}
+
+// RecentTasks returns the tasks of the user's last n variants
+func RecentTasks(userID uint, n int) (map[uint]bool, error) {
+	recent := map[uint]bool{}
+	if n <= 0 {
+		return recent, nil
+	}
+	var ids []uint
+	err := db.Get().Model(&models.ExamVariantItem{}).
+		Where("variant_id IN (?)", db.Get().Model(&models.ExamVariant{}).Select("id").
+			Where("user_id = ?", userID).Order("id desc").Limit(n)).
+		Pluck("task_id", &ids).Error
+	for _, id := range ids {
+		recent[id] = true
+	}
+	return recent, err
+}
+
+// Generate assembles a variant of the blueprint for the user (nil for an
+// anonymous paper), avoiding the tasks of their last recent variants. The
+// variant is not saved.
+func Generate(bp *models.ExamBlueprint, userID *uint, recent int, seed int64) (*models.ExamVariant, int, error) {
+	positions := append([]models.ExamPosition(nil), bp.Positions...)
+	sort.Slice(positions, func(a, b int) bool { return positions[a].Number < positions[b].Number })
+
+	slots := make([]Slot, len(positions))
+	for i, p := range positions {
+		ids, err := Candidates(bp.Subject, p)
+		if err != nil {
+			return nil, 0, err
+		}
+		slots[i] = Slot{Number: p.Number, Candidates: ids}
+	}
+	avoid := map[uint]bool{}
+	if userID != nil {
+		var err error
+		if avoid, err = RecentTasks(*userID, recent); err != nil {
+			return nil, 0, err
+		}
+	}
+	picks, reused, err := Pick(slots, avoid, seed)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	points, err := taskPoints(picks)
+	if err != nil {
+		return nil, 0, err
+	}
+	v := &models.ExamVariant{BlueprintID: bp.ID, UserID: userID, Seed: seed}
+	v.Items = make([]models.ExamVariantItem, len(positions))
+	for i, p := range positions {
+		item := models.ExamVariantItem{Number: p.Number, TaskID: picks[i], Points: p.Points}
+		if item.Points <= 0 {
+			item.Points = points[picks[i]]
+		}
+		v.Items[i] = item
+	}
+	return v, reused, nil
+}
+
+func taskPoints(ids []uint) (map[uint]int, error) {
+	var tasks []models.Task
+	if err := db.Get().Select("id", "points").Where("id IN ?", ids).Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	points := make(map[uint]int, len(tasks))
+	for _, t := range tasks {
+		points[t.ID] = t.Points
+	}
+	return points, nil
+}
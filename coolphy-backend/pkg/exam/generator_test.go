@@ -0,0 +1,118 @@
+package exam
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func slots(cands ...[]uint) []Slot {
+	out := make([]Slot, len(cands))
+	for i, c := range cands {
+		out[i] = Slot{Number: i + 1, Candidates: c}
+	}
+	return out
+}
+
+// checkPicks fails unless every slot got one of its own candidates and no
+// task appears twice
+func checkPicks(t *testing.T, s []Slot, picks []uint) {
+	t.Helper()
+	if len(picks) != len(s) {
+		t.Fatalf("%d picks for %d slots", len(picks), len(s))
+	}
+	used := map[uint]bool{}
+	for i, id := range picks {
+		ok := false
+		for _, c := range s[i].Candidates {
+			ok = ok || c == id
+		}
+		if !ok || used[id] {
+			t.Fatalf("picks %v don't fit the slots %v", picks, s)
+		}
+		used[id] = true
+	}
+}
+
+func TestPickFindsAVariantWheneverOneExists(t *testing.T) {
+	// Greedy picking fails whenever position 1 takes task 2
+	s := slots([]uint{2, 3}, []uint{1, 2}, []uint{1, 2})
+	for seed := int64(0); seed < 50; seed++ {
+		picks, reused, err := Pick(s, nil, seed)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		checkPicks(t, s, picks)
+		if picks[0] != 3 || reused != 0 {
+			t.Fatalf("seed %d: picks %v reused %d, want position 1 to take task 3", seed, picks, reused)
+		}
+	}
+}
+
+func TestPickReusesAsFewAsPossible(t *testing.T) {
+	tests := []struct {
+		name   string
+		slots  []Slot
+		recent map[uint]bool
+		reused int
+	}{
+		{"fresh tasks suffice", slots([]uint{1, 2}, []uint{2, 3}), map[uint]bool{3: true}, 0},
+		{"one must repeat", slots([]uint{1, 2}, []uint{1, 2}, []uint{2, 3, 4}), map[uint]bool{1: true, 3: true}, 1},
+		{"all recent", slots([]uint{1}, []uint{2}), map[uint]bool{1: true, 2: true}, 2},
+		{"chain", slots([]uint{1, 2}, []uint{2, 3}, []uint{3, 4}, []uint{4, 5}), map[uint]bool{1: true}, 0},
+	}
+	for _, tt := range tests {
+		for seed := int64(0); seed < 50; seed++ {
+			picks, reused, err := Pick(tt.slots, tt.recent, seed)
+			if err != nil {
+				t.Fatalf("%s, seed %d: %v", tt.name, seed, err)
+			}
+			checkPicks(t, tt.slots, picks)
+			n := 0
+			for _, id := range picks {
+				if tt.recent[id] {
+					n++
+				}
+			}
+			if reused != tt.reused || n != tt.reused {
+				t.Fatalf("%s, seed %d: picks %v reuse %d (reported %d), want %d", tt.name, seed, picks, n, reused, tt.reused)
+			}
+		}
+	}
+}
+
+func TestPickShortage(t *testing.T) {
+	for _, s := range [][]Slot{
+		slots([]uint{1}, []uint{1}),
+		slots([]uint{1, 2}, []uint{1, 2}, []uint{3}, []uint{2, 1}),
+		slots([]uint{1}, nil),
+	} {
+		_, _, err := Pick(s, map[uint]bool{1: true}, 1)
+		var short *ShortageError
+		if !errors.As(err, &short) {
+			t.Errorf("slots %v: %v, want a ShortageError", s, err)
+		}
+	}
+}
+
+func TestPickIsRepeatable(t *testing.T) {
+	s := slots([]uint{1, 2, 3, 4}, []uint{2, 3, 4, 5}, []uint{5, 6, 7})
+	recent := map[uint]bool{2: true}
+	first, _, err := Pick(s, recent, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if again, _, _ := Pick(s, recent, 42); !reflect.DeepEqual(again, first) {
+			t.Fatalf("seed 42 gave %v, then %v", first, again)
+		}
+	}
+	differ := false
+	for seed := int64(0); seed < 20 && !differ; seed++ {
+		picks, _, _ := Pick(s, recent, seed)
+		differ = !reflect.DeepEqual(picks, first)
+	}
+	if !differ {
+		t.Errorf("every seed gives the same variant")
+	}
+}
@@ -0,0 +1,75 @@
+package exam
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/models"
+)
+
+// SheetTask is a task as printed at a position of the paper. The task
+// should already carry the student's parameter values.
+type SheetTask struct {
+	Number int
+	Points int
+	Task   *models.Task
+}
+
+var latexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`, `{`, `\{`, `}`, `\}`, `$`, `\$`, `&`, `\&`,
+	`#`, `\#`, `%`, `\%`, `_`, `\_`, `^`, `\^{}`, `~`, `\~{}`,
+)
+
+// EscapeLaTeX makes plain text safe to put into a LaTeX document
+func EscapeLaTeX(s string) string { return latexEscaper.Replace(s) }
+
+// Sheet renders the paper as a LaTeX document. With key set, the answer key
+// follows on a separate page.
+func Sheet(title, student string, variantID uint, tasks []SheetTask, key bool) []byte {
+	var b bytes.Buffer
+	b.WriteString("\\documentclass[11pt,a4paper]{article}\n")
+	b.WriteString("\\usepackage[T2A]{fontenc}\n\\usepackage[utf8]{inputenc}\n\\usepackage[english,russian]{babel}\n")
+	b.WriteString("\\usepackage{amsmath,amssymb}\n\\usepackage{graphicx}\n\\usepackage[margin=2cm]{geometry}\n")
+	b.WriteString("\\pagestyle{plain}\n\\begin{document}\n\n")
+	fmt.Fprintf(&b, "\\begin{center}\n{\\Large %s}\\\\[2mm]\nVariant %d\\\\\n", EscapeLaTeX(title), variantID)
+	if student != "" {
+		fmt.Fprintf(&b, "%s\\\\\n", EscapeLaTeX(student))
+	}
+	b.WriteString("\\end{center}\n\n")
+
+	for _, t := range tasks {
+		fmt.Fprintf(&b, "\\subsection*{%d \\hfill \\normalsize\\textmd{(%d)}}\n", t.Number, t.Points)
+		b.WriteString(strings.TrimSpace(t.Task.DescriptionLaTeX))
+		b.WriteString("\n")
+		if t.Task.AnswerType == grading.AnswerChoice {
+			if spec, err := t.Task.DecodeAnswerSpec(); err == nil && spec != nil && len(spec.Options) > 0 {
+				b.WriteString("\\begin{enumerate}\n")
+				for _, o := range spec.Options {
+					fmt.Fprintf(&b, "\\item[%s)] %s\n", EscapeLaTeX(o.ID), o.Text)
+				}
+				b.WriteString("\\end{enumerate}\n")
+			}
+		}
+		if t.Task.AnswerType != grading.AnswerCode && t.Task.AnswerType != grading.AnswerFree {
+			b.WriteString("\n\\noindent Answer: \\rule{5cm}{0.4pt}\n")
+		}
+		b.WriteString("\n")
+	}
+
+	if key {
+		fmt.Fprintf(&b, "\\newpage\n\\section*{Answer key, variant %d}\n", variantID)
+		b.WriteString("\\begin{tabular}{|r|l|r|}\n\\hline\nNo. & Answer & Points \\\\\n\\hline\n")
+		for _, t := range tasks {
+			answer := grading.KeyAnswer(t.Task)
+			if answer == "" {
+				answer = "see solution"
+			}
+			fmt.Fprintf(&b, "%d & %s & %d \\\\\n", t.Number, EscapeLaTeX(answer), t.Points)
+		}
+		b.WriteString("\\hline\n\\end{tabular}\n")
+	}
+	b.WriteString("\n\\end{document}\n")
+	return b.Bytes()
+}
@@ -0,0 +1,301 @@
+package grading
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/big"
+	"math/rand"
+)
+
+// constants are names that are never treated as free variables
+var constants = map[string]float64{"pi": math.Pi, "e": math.E}
+
+var errUndefined = errors.New("undefined at this point")
+
+// value is exact when rat is set, otherwise it is a float approximation
+type value struct {
+	rat *big.Rat
+	f   float64
+}
+
+func exact(r *big.Rat) value { return value{rat: r, f: ratFloat(r)} }
+
+func approx(f float64) value { return value{f: f} }
+
+func ratFloat(r *big.Rat) float64 {
+	f, _ := r.Float64()
+	return f
+}
+
+func (v value) float() float64 {
+	if v.rat != nil {
+		return ratFloat(v.rat)
+	}
+	return v.f
+}
+
+// Keep exact arithmetic from blowing up on deep expressions
+const maxRatBits = 4096
+
+func limit(r *big.Rat) value {
+	if r.Num().BitLen()+r.Denom().BitLen() > maxRatBits {
+		return approx(ratFloat(r))
+	}
+	return exact(r)
+}
+
+// Eval evaluates the expression with the given variable values
+func (e *Expr) Eval(vars map[string]*big.Rat) (float64, error) {
+	v, err := e.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	return v.float(), nil
+}
+
+func (e *Expr) eval(vars map[string]*big.Rat) (value, error) {
+	switch e.Op {
+	case "num":
+		return exact(e.Num), nil
+	case "var":
+		if r, ok := vars[e.Name]; ok {
+			return exact(r), nil
+		}
+		if c, ok := constants[e.Name]; ok {
+			return approx(c), nil
+		}
+		return value{}, errors.New("unbound variable " + e.Name)
+	}
+
+	args := make([]value, len(e.Args))
+	for i, a := range e.Args {
+		v, err := a.eval(vars)
+		if err != nil {
+			return value{}, err
+		}
+		args[i] = v
+	}
+
+	var out value
+	switch e.Op {
+	case "neg":
+		if args[0].rat != nil {
+			out = exact(new(big.Rat).Neg(args[0].rat))
+		} else {
+			out = approx(-args[0].f)
+		}
+	case "+", "-", "*", "/":
+		out = arith(e.Op, args[0], args[1])
+	case "^":
+		out = pow(args[0], args[1])
+	case "sqrt":
+		out = sqrt(args[0])
+	case "abs":
+		if args[0].rat != nil {
+			out = exact(new(big.Rat).Abs(args[0].rat))
+		} else {
+			out = approx(math.Abs(args[0].f))
+		}
+	default:
+		f, ok := floatFunctions[e.Op]
+		if !ok {
+			return value{}, errors.New("unknown function " + e.Op)
+		}
+		out = approx(f(args[0].float()))
+	}
+	if out.rat == nil && (math.IsNaN(out.f) || math.IsInf(out.f, 0)) {
+		return value{}, errUndefined
+	}
+	return out, nil
+}
+
+var floatFunctions = map[string]func(float64) float64{
+	"sin": math.Sin, "cos": math.Cos, "tan": math.Tan,
+	"cot":  func(x float64) float64 { return 1 / math.Tan(x) },
+	"sec":  func(x float64) float64 { return 1 / math.Cos(x) },
+	"csc":  func(x float64) float64 { return 1 / math.Sin(x) },
+	"asin": math.Asin, "acos": math.Acos, "atan": math.Atan,
+	"acot": func(x float64) float64 { return math.Pi/2 - math.Atan(x) },
+	"sinh": math.Sinh, "cosh": math.Cosh, "tanh": math.Tanh,
+	"ln": math.Log, "log": math.Log, "lg": math.Log10, "exp": math.Exp,
+}
+
+func arith(op string, a, b value) value {
+	if a.rat != nil && b.rat != nil {
+		r := new(big.Rat)
+		switch op {
+		case "+":
+			r.Add(a.rat, b.rat)
+		case "-":
+			r.Sub(a.rat, b.rat)
+		case "*":
+			r.Mul(a.rat, b.rat)
+		case "/":
+			if b.rat.Sign() == 0 {
+				return approx(math.NaN())
+			}
+			r.Quo(a.rat, b.rat)
+		}
+		return limit(r)
+	}
+	x, y := a.float(), b.float()
+	switch op {
+	case "+":
+		return approx(x + y)
+	case "-":
+		return approx(x - y)
+	case "*":
+		return approx(x * y)
+	default:
+		if y == 0 {
+			return approx(math.NaN())
+		}
+		return approx(x / y)
+	}
+}
+
+func pow(base, exp value) value {
+	// Exact integer powers of rationals
+	if base.rat != nil && exp.rat != nil && exp.rat.IsInt() && exp.rat.Num().IsInt64() {
+		n := exp.rat.Num().Int64()
+		if n >= -64 && n <= 64 {
+			if n < 0 && base.rat.Sign() == 0 {
+				return approx(math.NaN())
+			}
+			num := new(big.Int).Exp(base.rat.Num(), big.NewInt(abs64(n)), nil)
+			den := new(big.Int).Exp(base.rat.Denom(), big.NewInt(abs64(n)), nil)
+			if n < 0 {
+				num, den = den, num
+			}
+			return limit(new(big.Rat).SetFrac(num, den))
+		}
+	}
+	// Exact square roots of perfect squares: 4^(1/2), (9/4)^(1/2)
+	if base.rat != nil && exp.rat != nil && exp.rat.Cmp(big.NewRat(1, 2)) == 0 {
+		return sqrt(base)
+	}
+	return approx(math.Pow(base.float(), exp.float()))
+}
+
+func sqrt(v value) value {
+	if v.rat != nil {
+		if v.rat.Sign() < 0 {
+			return approx(math.NaN())
+		}
+		if n, ok := exactSqrt(v.rat.Num()); ok {
+			if d, ok := exactSqrt(v.rat.Denom()); ok {
+				return exact(new(big.Rat).SetFrac(n, d))
+			}
+		}
+	}
+	return approx(math.Sqrt(v.float()))
+}
+
+func exactSqrt(n *big.Int) (*big.Int, bool) {
+	r := new(big.Int).Sqrt(n)
+	return r, new(big.Int).Mul(r, r).Cmp(n) == 0
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func equalValues(a, b value) bool {
+	if a.rat != nil && b.rat != nil {
+		return a.rat.Cmp(b.rat) == 0
+	}
+	x, y := a.float(), b.float()
+	scale := math.Max(1, math.Max(math.Abs(x), math.Abs(y)))
+	return math.Abs(x-y) <= 1e-9*scale
+}
+
+const (
+	equivSamples   = 12
+	equivMinPoints = 4
+)
+
+// Equivalent checks whether two expressions agree on random sample points.
+// Points are small rationals so most evaluations stay exact; every other
+// point has negative coordinates, so |x| and x or \sqrt{x^2} and x differ.
+// Points where both sides are undefined are skipped, while a point where only
+// one side is defined is a mismatch. ok is false if too few points could be
+// evaluated to decide.
+func Equivalent(a, b *Expr) (equal bool, ok bool) {
+	vars := mergeVars(a.Vars(), b.Vars())
+	if len(vars) == 0 {
+		va, errA := a.eval(nil)
+		vb, errB := b.eval(nil)
+		if errA != nil || errB != nil {
+			return false, false
+		}
+		return equalValues(va, vb), true
+	}
+
+	// Seed from the expressions so grading is reproducible
+	h := fnv.New64a()
+	h.Write([]byte(a.String() + "|" + b.String()))
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	valid := 0
+	for i := 0; i < equivSamples*3 && valid < equivSamples; i++ {
+		point := samplePoint(rng, vars, i)
+		va, errA := a.eval(point)
+		vb, errB := b.eval(point)
+		if errA != nil && errB != nil {
+			continue
+		}
+		valid++
+		if errA != nil || errB != nil || !equalValues(va, vb) {
+			return false, true
+		}
+	}
+	return true, valid >= equivMinPoints
+}
+
+// samplePoint picks values in (0, 6) for the even rounds. Odd rounds negate
+// them: all of them in every fourth round, a random nonempty subset otherwise.
+func samplePoint(rng *rand.Rand, vars []string, round int) map[string]*big.Rat {
+	point := make(map[string]*big.Rat, len(vars))
+	for _, v := range vars {
+		// Numerators 1..40 over 7..13
+		point[v] = big.NewRat(rng.Int63n(40)+1, rng.Int63n(7)+7)
+	}
+	switch round % 4 {
+	case 1:
+		for _, v := range vars {
+			point[v].Neg(point[v])
+		}
+	case 3:
+		negated := false
+		for _, v := range vars {
+			if rng.Intn(2) == 0 {
+				point[v].Neg(point[v])
+				negated = true
+			}
+		}
+		if !negated {
+			v := vars[rng.Intn(len(vars))]
+			point[v].Neg(point[v])
+		}
+	}
+	return point
+}
+
+func mergeVars(a, b []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, list := range [][]string{a, b} {
+		for _, v := range list {
+			if _, isConst := constants[v]; isConst || seen[v] {
+				continue
+			}
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
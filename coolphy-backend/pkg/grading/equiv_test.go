@@ -0,0 +1,63 @@
+package grading
+
+import "testing"
+
+func TestEquivalent(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		equal bool
+		ok    bool
+	}{
+		{a: `\frac{\sqrt{3}}{2}`, b: "sqrt(3)/2", equal: true, ok: true},
+		{a: `2\sin x\cos x`, b: `\sin(2x)`, equal: true, ok: true},
+		{a: "(x+1)^2", b: "x^2+2x+1", equal: true, ok: true},
+		{a: "x*y-y", b: "y(x-1)", equal: true, ok: true},
+		{a: "a/b", b: "1/(b/a)", equal: true, ok: true},
+		{a: "x+1", b: "x+2", equal: false, ok: true},
+		// Equal only for positive values
+		{a: "|x|", b: "x", equal: false, ok: true},
+		{a: `\sqrt{x^2}`, b: "x", equal: false, ok: true},
+		{a: "|x*y|", b: "x*y", equal: false, ok: true},
+		{a: "|x|+|y|", b: "|x+y|", equal: false, ok: true},
+		// Defined on one side only
+		{a: `\sqrt{x}^2`, b: "x", equal: false, ok: true},
+		{a: `\ln(x^2)`, b: `2\ln x`, equal: false, ok: true},
+		// Undefined on both sides for negative values, equal elsewhere
+		{a: `\sqrt{x}`, b: "x^(1/2)", equal: true, ok: true},
+		{a: `\ln x + \ln y`, b: `\ln(xy)`, equal: false, ok: true},
+		{a: "4", b: "√16", equal: true, ok: true},
+		{a: "1/0", b: "1", equal: false, ok: false},
+	}
+	for _, tt := range tests {
+		a, err := ParseExpr(tt.a)
+		if err != nil {
+			t.Fatalf("ParseExpr(%q): %v", tt.a, err)
+		}
+		b, err := ParseExpr(tt.b)
+		if err != nil {
+			t.Fatalf("ParseExpr(%q): %v", tt.b, err)
+		}
+		equal, ok := Equivalent(a, b)
+		if equal != tt.equal || ok != tt.ok {
+			t.Errorf("Equivalent(%q, %q) = %v, %v, want %v, %v", tt.a, tt.b, equal, ok, tt.equal, tt.ok)
+		}
+	}
+}
+
+func TestCheckExpression(t *testing.T) {
+	tests := []struct {
+		correct, answer string
+		want            Status
+	}{
+		{correct: "y = 2x", answer: "2x", want: StatusCorrect},
+		{correct: "x", answer: "√(x^2)", want: StatusIncorrect},
+		{correct: "4", answer: "√16", want: StatusCorrect},
+		{correct: "x", answer: "x+", want: StatusIncorrect},
+		{correct: `\foo`, answer: "x", want: StatusUndecided},
+	}
+	for _, tt := range tests {
+		if got := CheckExpression(tt.correct, tt.answer); got.Status != tt.want {
+			t.Errorf("CheckExpression(%q, %q) = %s, want %s", tt.correct, tt.answer, got.Status, tt.want)
+		}
+	}
+}
@@ -0,0 +1,551 @@
+package grading
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Expr is a parsed mathematical expression
+type Expr struct {
+	Op string // num, var, neg, +, -, *, /, ^, or a function name
+	// Num holds the value of a literal (Op == "num")
+	Num *big.Rat
+	// Name of a variable (Op == "var")
+	Name string
+	Args []*Expr
+}
+
+func (e *Expr) String() string {
+	switch e.Op {
+	case "num":
+		return e.Num.RatString()
+	case "var":
+		return e.Name
+	case "neg":
+		return "-(" + e.Args[0].String() + ")"
+	case "+", "-", "*", "/", "^":
+		return "(" + e.Args[0].String() + " " + e.Op + " " + e.Args[1].String() + ")"
+	default:
+		parts := make([]string, len(e.Args))
+		for i, a := range e.Args {
+			parts[i] = a.String()
+		}
+		return e.Op + "(" + strings.Join(parts, ", ") + ")"
+	}
+}
+
+// Vars returns the sorted free variables of the expression
+func (e *Expr) Vars() []string {
+	set := map[string]struct{}{}
+	var walk func(*Expr)
+	walk = func(n *Expr) {
+		if n.Op == "var" {
+			set[n.Name] = struct{}{}
+		}
+		for _, a := range n.Args {
+			walk(a)
+		}
+	}
+	walk(e)
+	out := make([]string, 0, len(set))
+	for v := range set {
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Function names recognised with or without a backslash, mapped to the
+// canonical name used by the evaluator
+var exprFunctions = map[string]string{
+	"sin": "sin", "cos": "cos", "tan": "tan", "tg": "tan", "cot": "cot", "ctg": "cot",
+	"sec": "sec", "csc": "csc", "cosec": "csc",
+	"arcsin": "asin", "arccos": "acos", "arctan": "atan", "arctg": "atan", "arcctg": "acot", "arccot": "acot",
+	"sinh": "sinh", "cosh": "cosh", "tanh": "tanh", "sh": "sinh", "ch": "cosh", "th": "tanh",
+	"ln": "ln", "lg": "lg", "log": "log", "exp": "exp", "sqrt": "sqrt", "abs": "abs",
+}
+
+var greekLetters = map[string]bool{
+	"alpha": true, "beta": true, "gamma": true, "delta": true, "epsilon": true, "varepsilon": true,
+	"zeta": true, "eta": true, "theta": true, "vartheta": true, "iota": true, "kappa": true,
+	"lambda": true, "mu": true, "nu": true, "xi": true, "rho": true, "sigma": true, "tau": true,
+	"upsilon": true, "phi": true, "varphi": true, "chi": true, "psi": true, "omega": true,
+	"Gamma": true, "Delta": true, "Theta": true, "Lambda": true, "Xi": true, "Sigma": true,
+	"Phi": true, "Psi": true, "Omega": true,
+}
+
+// LaTeX commands that carry no mathematical meaning
+var ignoredCommands = map[string]bool{
+	"left": true, "right": true, "big": true, "Big": true, "bigl": true, "bigr": true,
+	"Bigl": true, "Bigr": true, "displaystyle": true, "mathrm": true, "text": true,
+	"operatorname": true, "limits": true,
+}
+
+type tokKind int
+
+const (
+	tEOF tokKind = iota
+	tNum
+	tVar
+	tFunc
+	tOp    // + - * / ^ _ |
+	tOpen  // ( [ {
+	tClose // ) ] }
+	tFrac
+	tSqrt
+)
+
+type token struct {
+	kind tokKind
+	text string
+	num  *big.Rat
+}
+
+// NormalizeLaTeX rewrites typographic and LaTeX variants into a canonical
+// plain form: \dfrac -> \frac, \cdot -> *, unicode minus -> -, spacing removed
+func NormalizeLaTeX(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.Trim(s, "$")
+	s = strings.NewReplacer(
+		`\dfrac`, `\frac`, `\tfrac`, `\frac`, `\cfrac`, `\frac`,
+		`\cdot`, "*", `\times`, "*", `\div`, "/", "·", "*", "×", "*", "⋅", "*", ":", "/",
+		"−", "-", "–", "-", "π", `\pi `, "√", `\surd `,
+		`\,`, " ", `\;`, " ", `\:`, " ", `\!`, "", `\ `, " ", "~", " ", `\quad`, " ", `\qquad`, " ",
+		`\{`, "(", `\}`, ")", `\lbrace`, "(", `\rbrace`, ")", `\vert`, "|", `\mid`, "|",
+		"{,}", ".",
+	).Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func tokenizeExpr(s string) ([]token, error) {
+	src := []rune(NormalizeLaTeX(s))
+	var toks []token
+	for i := 0; i < len(src); {
+		r := src[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(src) && unicode.IsDigit(src[i+1])):
+			j := i
+			for j < len(src) && unicode.IsDigit(src[j]) {
+				j++
+			}
+			// Decimal separator, a comma only if followed by a digit
+			if j+1 < len(src) && (src[j] == '.' || src[j] == ',') && unicode.IsDigit(src[j+1]) {
+				j++
+				for j < len(src) && unicode.IsDigit(src[j]) {
+					j++
+				}
+			}
+			text := strings.Replace(string(src[i:j]), ",", ".", 1)
+			n, ok := new(big.Rat).SetString(text)
+			if !ok {
+				return nil, fmt.Errorf("bad number %q", text)
+			}
+			toks = append(toks, token{kind: tNum, text: text, num: n})
+			i = j
+		case r == '\\':
+			j := i + 1
+			for j < len(src) && unicode.IsLetter(src[j]) {
+				j++
+			}
+			name := string(src[i+1 : j])
+			i = j
+			switch {
+			case name == "":
+				return nil, fmt.Errorf("unexpected backslash")
+			case ignoredCommands[name]:
+			case name == "frac":
+				toks = append(toks, token{kind: tFrac})
+			case name == "sqrt":
+				toks = append(toks, token{kind: tSqrt})
+			case name == "surd":
+				// The √ sign: √16 is the root of 16, not of 1 as \sqrt16 would be
+				toks = append(toks, token{kind: tSqrt, text: "√"})
+			case name == "pi":
+				toks = append(toks, token{kind: tVar, text: "pi"})
+			case greekLetters[name]:
+				toks = append(toks, token{kind: tVar, text: name})
+			case exprFunctions[name] != "":
+				toks = append(toks, token{kind: tFunc, text: exprFunctions[name]})
+			default:
+				return nil, fmt.Errorf("unsupported command \\%s", name)
+			}
+		case unicode.IsLetter(r):
+			j := i
+			for j < len(src) && unicode.IsLetter(src[j]) {
+				j++
+			}
+			toks = append(toks, splitIdentifier(string(src[i:j]))...)
+			i = j
+		case strings.ContainsRune("+-*/^_|", r):
+			toks = append(toks, token{kind: tOp, text: string(r)})
+			i++
+		case r == '(' || r == '[' || r == '{':
+			toks = append(toks, token{kind: tOpen, text: string(r)})
+			i++
+		case r == ')' || r == ']' || r == '}':
+			toks = append(toks, token{kind: tClose, text: string(r)})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", string(r))
+		}
+	}
+	return toks, nil
+}
+
+// splitIdentifier breaks a run of letters such as "xsinx" or "pir" into known
+// function names, constants and single-letter variables
+func splitIdentifier(word string) []token {
+	var toks []token
+	runes := []rune(word)
+	for len(runes) > 0 {
+		matched := false
+		for n := len(runes); n >= 2; n-- {
+			w := string(runes[:n])
+			if f, ok := exprFunctions[w]; ok {
+				toks = append(toks, token{kind: tFunc, text: f})
+			} else if w == "pi" {
+				toks = append(toks, token{kind: tVar, text: "pi"})
+			} else {
+				continue
+			}
+			runes = runes[n:]
+			matched = true
+			break
+		}
+		if !matched {
+			toks = append(toks, token{kind: tVar, text: string(runes[0])})
+			runes = runes[1:]
+		}
+	}
+	return toks
+}
+
+// ParseExpr parses a LaTeX or plain-text expression such as
+// `\frac{\sqrt{3}}{2}`, `2\sin x\cos x` or `sqrt(3)/2`
+func ParseExpr(s string) (*Expr, error) {
+	toks, err := tokenizeExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	p := &exprParser{toks: toks}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tEOF {
+		return nil, fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	return e, nil
+}
+
+type exprParser struct {
+	toks []token
+	pos  int
+}
+
+func (p *exprParser) peek() token {
+	if p.pos >= len(p.toks) {
+		return token{kind: tEOF}
+	}
+	return p.toks[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *exprParser) isOp(text string) bool {
+	t := p.peek()
+	return t.kind == tOp && t.text == text
+}
+
+func bin(op string, a, b *Expr) *Expr { return &Expr{Op: op, Args: []*Expr{a, b}} }
+
+// expr := term { (+|-) term }
+func (p *exprParser) expr() (*Expr, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		op := p.next().text
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = bin(op, left, right)
+	}
+	return left, nil
+}
+
+// startsFactor reports whether the next token can begin an implicitly
+// multiplied factor, as in 2x, 2\sin x or (a+b)(a-b)
+func (p *exprParser) startsFactor() bool {
+	switch p.peek().kind {
+	case tNum, tVar, tFunc, tFrac, tSqrt:
+		return true
+	case tOpen:
+		return p.peek().text != "["
+	}
+	return false
+}
+
+// term := unary { (*|/|implicit) unary }
+func (p *exprParser) term() (*Expr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := "*"
+		switch {
+		case p.isOp("*"), p.isOp("/"):
+			op = p.next().text
+		case p.startsFactor():
+		default:
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = bin(op, left, right)
+	}
+}
+
+// unary := (+|-) unary | power
+func (p *exprParser) unary() (*Expr, error) {
+	if p.isOp("-") || p.isOp("+") {
+		op := p.next().text
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if op == "-" {
+			return &Expr{Op: "neg", Args: []*Expr{operand}}, nil
+		}
+		return operand, nil
+	}
+	return p.power()
+}
+
+// power := primary [ ^ exponent ], right associative
+func (p *exprParser) power() (*Expr, error) {
+	base, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("^") {
+		return base, nil
+	}
+	p.next()
+	exp, err := p.exponent()
+	if err != nil {
+		return nil, err
+	}
+	return bin("^", base, exp), nil
+}
+
+func (p *exprParser) exponent() (*Expr, error) {
+	if p.peek().kind == tOpen {
+		return p.group()
+	}
+	return p.unary()
+}
+
+// group parses a braced or parenthesised expression, or a single atom as
+// LaTeX allows for \frac12 style arguments
+func (p *exprParser) group() (*Expr, error) {
+	if t := p.peek(); t.kind == tNum && len(t.text) > 1 && !strings.Contains(t.text, ".") {
+		// Unbraced \frac12 takes one digit per argument
+		first, _ := new(big.Rat).SetString(t.text[:1])
+		rest, _ := new(big.Rat).SetString(t.text[1:])
+		p.toks[p.pos] = token{kind: tNum, text: t.text[1:], num: rest}
+		return &Expr{Op: "num", Num: first}, nil
+	}
+	if p.peek().kind != tOpen {
+		return p.primary()
+	}
+	open := p.next().text
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	cl := p.next()
+	if cl.kind != tClose || !matchingBracket(open, cl.text) {
+		return nil, fmt.Errorf("missing closing bracket for %q", open)
+	}
+	return e, nil
+}
+
+func matchingBracket(open, close string) bool {
+	switch open {
+	case "(":
+		return close == ")"
+	case "[":
+		return close == "]"
+	case "{":
+		return close == "}"
+	}
+	return false
+}
+
+func (p *exprParser) primary() (*Expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tNum:
+		p.next()
+		return &Expr{Op: "num", Num: t.num}, nil
+	case tVar:
+		p.next()
+		e := &Expr{Op: "var", Name: t.text}
+		// Subscripted variables: x_1, v_{0}
+		if p.isOp("_") {
+			p.next()
+			sub := p.next()
+			if sub.kind == tOpen {
+				var parts []string
+				for p.peek().kind != tClose && p.peek().kind != tEOF {
+					parts = append(parts, p.next().text)
+				}
+				p.next()
+				sub.text = strings.Join(parts, "")
+			}
+			e.Name += "_" + sub.text
+		}
+		return e, nil
+	case tOpen:
+		return p.group()
+	case tFrac:
+		p.next()
+		num, err := p.group()
+		if err != nil {
+			return nil, err
+		}
+		den, err := p.group()
+		if err != nil {
+			return nil, err
+		}
+		return bin("/", num, den), nil
+	case tSqrt:
+		p.next()
+		var index *Expr
+		if p.peek().kind == tOpen && p.peek().text == "[" {
+			p.next()
+			idx, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if cl := p.next(); cl.kind != tClose || cl.text != "]" {
+				return nil, fmt.Errorf("missing ] in root index")
+			}
+			index = idx
+		}
+		var arg *Expr
+		var err error
+		if t.text == "√" {
+			arg, err = p.primary()
+		} else {
+			arg, err = p.group()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if index != nil {
+			return bin("^", arg, bin("/", &Expr{Op: "num", Num: big.NewRat(1, 1)}, index)), nil
+		}
+		return &Expr{Op: "sqrt", Args: []*Expr{arg}}, nil
+	case tFunc:
+		return p.function()
+	case tOp:
+		if t.text == "|" {
+			p.next()
+			inner, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.isOp("|") {
+				return nil, fmt.Errorf("missing closing |")
+			}
+			p.next()
+			return &Expr{Op: "abs", Args: []*Expr{inner}}, nil
+		}
+	case tEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+// function parses \sin x, \sin^2 x, \sin(2x), \log_2 8 and similar
+func (p *exprParser) function() (*Expr, error) {
+	name := p.next().text
+	var power, base *Expr
+	for p.isOp("^") || p.isOp("_") {
+		op := p.next().text
+		arg, err := p.exponent()
+		if err != nil {
+			return nil, err
+		}
+		if op == "^" {
+			power = arg
+		} else {
+			base = arg
+		}
+	}
+	arg, err := p.functionArg()
+	if err != nil {
+		return nil, err
+	}
+	var e *Expr
+	if base != nil && name == "log" {
+		e = bin("/", &Expr{Op: "ln", Args: []*Expr{arg}}, &Expr{Op: "ln", Args: []*Expr{base}})
+	} else {
+		e = &Expr{Op: name, Args: []*Expr{arg}}
+	}
+	if power != nil {
+		e = bin("^", e, power)
+	}
+	return e, nil
+}
+
+// functionArg takes a bracketed argument or, without brackets, a run of
+// numbers and variables: \sin 2x is sin(2x) but \sin x \cos x is sin(x)cos(x)
+func (p *exprParser) functionArg() (*Expr, error) {
+	if p.peek().kind == tOpen {
+		return p.group()
+	}
+	if p.isOp("-") {
+		p.next()
+		arg, err := p.functionArg()
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{Op: "neg", Args: []*Expr{arg}}, nil
+	}
+	var arg *Expr
+	for p.peek().kind == tNum || p.peek().kind == tVar || p.peek().kind == tFrac {
+		f, err := p.power()
+		if err != nil {
+			return nil, err
+		}
+		if arg == nil {
+			arg = f
+		} else {
+			arg = bin("*", arg, f)
+		}
+	}
+	if arg == nil {
+		return p.unary()
+	}
+	return arg, nil
+}
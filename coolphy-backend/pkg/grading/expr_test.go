@@ -0,0 +1,52 @@
+package grading
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		in   string
+		vars map[string]*big.Rat
+		want float64
+	}{
+		{in: `\frac12`, want: 0.5},
+		{in: `\frac{\sqrt{3}}{2}`, want: 0.8660254037844386},
+		{in: `\sqrt16`, want: 6},
+		{in: `\sqrt{16}`, want: 4},
+		{in: "√16", want: 4},
+		{in: "√16+1", want: 5},
+		{in: "2√9", want: 6},
+		{in: "√(9+16)", want: 5},
+		{in: "√x", vars: map[string]*big.Rat{"x": big.NewRat(25, 1)}, want: 5},
+		{in: `\sqrt[3]{8}`, want: 2},
+		{in: "sqrt(3)^2", want: 3},
+		{in: "2x", vars: map[string]*big.Rat{"x": big.NewRat(3, 1)}, want: 6},
+		{in: "|-3|", want: 3},
+		{in: "1{,}5", want: 1.5},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpr(tt.in)
+		if err != nil {
+			t.Errorf("ParseExpr(%q): %v", tt.in, err)
+			continue
+		}
+		got, err := e.Eval(tt.vars)
+		if err != nil {
+			t.Errorf("%q: Eval: %v", tt.in, err)
+			continue
+		}
+		if !equalValues(approx(got), approx(tt.want)) {
+			t.Errorf("%q = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	for _, in := range []string{"", "(1+2", `\foo{x}`, "2+", "|x"} {
+		if _, err := ParseExpr(in); err == nil {
+			t.Errorf("ParseExpr(%q) succeeded, want an error", in)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Package grading checks student answers against a task's correct answer
+// without involving the LLM whenever the answer can be compared mechanically.
+package grading
+
+import (
+	"strings"
+
+	"coolphy-backend/pkg/models"
+)
+
+// Status of a grading attempt
+type Status string
+
+const (
+	StatusCorrect   Status = "correct"
+	StatusIncorrect Status = "incorrect"
+	// StatusPartial is a partly correct answer to a structured task
+	StatusPartial Status = "partial"
+	// StatusUndecided means the answer can't be checked mechanically and should
+	// be handed to the LLM (or left pending for a teacher)
+	StatusUndecided Status = "undecided"
+)
+
+// Result of checking a single answer
+type Result struct {
+	Status Status
+	// Score is the percentage of the task's points to award, 0-100
+	Score    int
+	Feedback string
+}
+
+// Decided reports whether the checker reached a verdict
+func (r Result) Decided() bool { return r.Status != StatusUndecided }
+
+// Answer types stored in Task.AnswerType
+const (
+	// AnswerAuto tries a numeric comparison, then an exact text match
+	AnswerAuto    = ""
+	AnswerNumeric = "numeric"
+	AnswerText    = "text"
+	// AnswerExpression compares symbolic expressions by evaluating them
+	AnswerExpression = "expression"
+	// AnswerFree is always graded by the LLM
+	AnswerFree = "free"
+	// AnswerCode is a program run against hidden tests by package judge
+	AnswerCode = "code"
+)
+
+var undecided = Result{Status: StatusUndecided}
+
+// TaskTolerance returns the numeric tolerance configured on the task
+func TaskTolerance(task *models.Task) Tolerance {
+	return Tolerance{Mode: task.ToleranceMode, Value: task.Tolerance}
+}
+
+// Check grades answer against task.CorrectAnswer according to task.AnswerType.
+// Structured answer types are graded against task.AnswerSpec instead.
+func Check(task *models.Task, answer string) Result {
+	if IsStructured(task.AnswerType) {
+		return checkStructured(task, answer)
+	}
+	if strings.TrimSpace(task.CorrectAnswer) == "" {
+		return undecided
+	}
+	switch task.AnswerType {
+	case AnswerNumeric:
+		return checkNumeric(withUnit(task), answer, TaskTolerance(task), true)
+	case AnswerText:
+		return checkText(task.CorrectAnswer, answer, true)
+	case AnswerExpression:
+		return CheckExpression(task.CorrectAnswer, answer)
+	case AnswerAuto:
+		if r := checkNumeric(withUnit(task), answer, TaskTolerance(task), false); r.Decided() {
+			return r
+		}
+		return checkText(task.CorrectAnswer, answer, false)
+	default:
+		return undecided
+	}
+}
+
+// withUnit returns the correct answer with the task's answer unit appended
+// when the answer is a bare number, so "1500 m" can be compared with "1.5" km
+func withUnit(task *models.Task) string {
+	unit := strings.TrimSpace(task.AnswerUnit)
+	if unit == "" {
+		return task.CorrectAnswer
+	}
+	if q, err := ParseQuantity(task.CorrectAnswer); err != nil || q.HasUnit {
+		return task.CorrectAnswer
+	}
+	if _, err := ParseQuantity(task.CorrectAnswer + " " + unit); err != nil {
+		return task.CorrectAnswer
+	}
+	return task.CorrectAnswer + " " + unit
+}
+
+// checkNumeric compares numeric answers. When strict is false an answer that
+// can't be parsed is left undecided instead of being marked wrong.
+func checkNumeric(correct, answer string, tol Tolerance, strict bool) Result {
+	expected, err := ParseQuantity(correct)
+	if err != nil {
+		return undecided
+	}
+	given, err := ParseQuantity(answer)
+	if err != nil {
+		if !strict {
+			return undecided
+		}
+		return Result{Status: StatusIncorrect, Feedback: "Could not read a number from your answer: " + err.Error() + "."}
+	}
+	return CompareQuantities(expected, given, tol)
+}
+
+// checkText compares answers after normalizing case, whitespace and math delimiters
+func checkText(correct, answer string, strict bool) Result {
+	if normalizeText(correct) == normalizeText(answer) {
+		return Result{Status: StatusCorrect, Score: 100, Feedback: "Correct!"}
+	}
+	if !strict {
+		return undecided
+	}
+	return Result{Status: StatusIncorrect, Feedback: "The answer does not match."}
+}
+
+// CheckExpression grades a symbolic answer such as `\frac{\sqrt{3}}{2}` or
+// `2\sin x\cos x` by testing equivalence with the correct expression
+func CheckExpression(correct, answer string) Result {
+	expected, err := ParseExpr(stripAssignment(correct))
+	if err != nil {
+		return undecided
+	}
+	given, err := ParseExpr(stripAssignment(answer))
+	if err != nil {
+		return Result{Status: StatusIncorrect, Feedback: "Could not read your expression: " + err.Error() + "."}
+	}
+	equal, ok := Equivalent(expected, given)
+	if !ok {
+		return undecided
+	}
+	if equal {
+		return Result{Status: StatusCorrect, Score: 100, Feedback: "Correct!"}
+	}
+	return Result{Status: StatusIncorrect, Feedback: "Your expression is not equivalent to the correct answer."}
+}
+
+// stripAssignment drops a leading "y =" or "f(x) =" so that "y = 2x" and "2x" compare equal
+func stripAssignment(s string) string {
+	if i := strings.LastIndex(s, "="); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
+
+func normalizeText(s string) string {
+	return strings.ToLower(normalizeAnswer(s))
+}
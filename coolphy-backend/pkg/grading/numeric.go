@@ -0,0 +1,181 @@
+package grading
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Quantity is a parsed numeric answer with an optional unit
+type Quantity struct {
+	// Number is the value as written, in the written unit
+	Number float64
+	// Scale converts Number to SI base units
+	Scale float64
+	Dim   Dimension
+	// HasUnit is false for bare numbers
+	HasUnit bool
+}
+
+// SI returns the value in SI base units
+func (q Quantity) SI() float64 { return q.Number * q.Scale }
+
+var (
+	numberRe = regexp.MustCompile(`^([+-]?)(\d{1,3}(?: \d{3})+|\d+)?(?:[.,](\d+))?(?:[eE]([+-]?\d+))?`)
+	// "* 10^-3", "*10^(-3)" after the mantissa
+	powerOfTenRe = regexp.MustCompile(`^\s*\*\s*10\s*\^\s*\(?\s*([+-]?\d+)\s*\)?`)
+	latexWrapRe  = regexp.MustCompile(`\\(?:text|mathrm|rm|textrm|operatorname|mbox)\s*\{([^{}]*)\}`)
+)
+
+// normalizeAnswer strips math delimiters, LaTeX spacing and typographic
+// variants so that "$1{,}5\cdot10^{-3}\,\text{м}$" and "1.5e-3 м" look alike
+func normalizeAnswer(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.Trim(s, "$")
+	s = latexWrapRe.ReplaceAllString(s, " $1")
+	s = strings.NewReplacer(
+		`\,`, " ", `\;`, " ", `\:`, " ", `\!`, "", `\ `, " ", "~", " ",
+		" ", " ", " ", " ", " ", " ",
+		"−", "-", "–", "-",
+		"{,}", ",",
+		`\cdot`, "*", `\times`, "*", "·", "*", "×", "*", "⋅", "*",
+		`\left(`, "(", `\right)`, ")",
+	).Replace(s)
+	s = parenthesizeExponents(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// parenthesizeExponents turns braces around exponents into parentheses,
+// 10^{-3} -> 10^(-3), leaving other braces alone
+func parenthesizeExponents(s string) string {
+	var b strings.Builder
+	var opened []bool
+	for i, r := range s {
+		switch {
+		case r == '{':
+			exp := i > 0 && s[i-1] == '^'
+			opened = append(opened, exp)
+			if exp {
+				r = '('
+			}
+		case r == '}' && len(opened) > 0:
+			if opened[len(opened)-1] {
+				r = ')'
+			}
+			opened = opened[:len(opened)-1]
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ParseQuantity parses answers like "12", "-1,5", "3.2e-4", "6.02·10^23",
+// "15 м/с", "2,5 кН" or "36 km/h"
+func ParseQuantity(s string) (Quantity, error) {
+	s = normalizeAnswer(s)
+	m := numberRe.FindStringSubmatch(s)
+	if m == nil || (m[2] == "" && m[3] == "") {
+		return Quantity{}, fmt.Errorf("no number found")
+	}
+	intPart := strings.ReplaceAll(m[2], " ", "")
+	if intPart == "" {
+		intPart = "0"
+	}
+	text := m[1] + intPart
+	if m[3] != "" {
+		text += "." + m[3]
+	}
+	if m[4] != "" {
+		text += "e" + m[4]
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return Quantity{}, fmt.Errorf("bad number %q", text)
+	}
+	rest := s[len(m[0]):]
+	if pm := powerOfTenRe.FindStringSubmatch(rest); pm != nil {
+		exp, _ := strconv.Atoi(pm[1])
+		value *= math.Pow(10, float64(exp))
+		rest = rest[len(pm[0]):]
+	}
+	rest = strings.TrimSpace(rest)
+
+	u, err := parseUnit(rest)
+	if err != nil {
+		return Quantity{}, err
+	}
+	return Quantity{Number: value, Scale: u.Scale, Dim: u.Dim, HasUnit: rest != ""}, nil
+}
+
+// Tolerance modes for numeric comparison
+const (
+	ToleranceRelative = "relative"
+	ToleranceAbsolute = "absolute"
+)
+
+// DefaultRelativeTolerance is used when the task does not specify one. It is
+// loose enough to absorb floating point noise and unit conversion, but not rounding.
+const DefaultRelativeTolerance = 1e-6
+
+// Tolerance describes how close a numeric answer must be. For absolute mode
+// Value is expressed in the unit the correct answer is written in.
+type Tolerance struct {
+	Mode  string
+	Value float64
+}
+
+func (t Tolerance) within(got, want float64) bool {
+	diff := math.Abs(got - want)
+	switch t.Mode {
+	case ToleranceAbsolute:
+		return diff <= t.Value
+	default:
+		rel := t.Value
+		if rel <= 0 {
+			rel = DefaultRelativeTolerance
+		}
+		if want == 0 {
+			return diff <= rel
+		}
+		return diff <= rel*math.Abs(want)
+	}
+}
+
+// CompareQuantities checks a student quantity against the expected one. A bare
+// number is taken to be in the unit of the expected answer, which is how EGE
+// answers are written ("answer in m/s"). A bare expected number is a plain
+// number: the student may write it as a percentage or another dimensionless
+// unit, but "5 kg" is not 5. Tasks whose unit is only in the text should set
+// AnswerUnit.
+func CompareQuantities(expected, given Quantity, tol Tolerance) Result {
+	var got float64
+	switch {
+	case !given.HasUnit:
+		got = given.Number
+	case !expected.HasUnit && !given.Dim.IsDimensionless():
+		return Result{
+			Status:   StatusIncorrect,
+			Feedback: fmt.Sprintf("Units do not match: expected a number without units, got a quantity in %s.", given.Dim),
+		}
+	case !expected.HasUnit:
+		// "50 %" may mean 0.5 or 50
+		got = given.SI()
+		if !tol.within(got, expected.Number) {
+			got = given.Number
+		}
+	case given.Dim != expected.Dim:
+		return Result{
+			Status:   StatusIncorrect,
+			Feedback: fmt.Sprintf("Units do not match: expected a quantity in %s, got %s.", expected.Dim, given.Dim),
+		}
+	default:
+		// Express the answer in the unit of the expected value
+		got = given.SI() / expected.Scale
+	}
+	if tol.within(got, expected.Number) {
+		return Result{Status: StatusCorrect, Score: 100, Feedback: "Correct!"}
+	}
+	return Result{Status: StatusIncorrect, Feedback: "The numeric value is not correct."}
+}
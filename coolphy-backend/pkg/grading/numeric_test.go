@@ -0,0 +1,95 @@
+package grading
+
+import (
+	"math"
+	"testing"
+
+	"coolphy-backend/pkg/models"
+)
+
+func TestNormalizeAnswer(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{in: `$1{,}5\cdot10^{-3}\,\text{м}$`, want: "1,5*10^(-3) м"},
+		{in: `10^{2^{3}}`, want: "10^(2^(3))"},
+		{in: `\{1; 2\}`, want: `\{1; 2\}`},
+		{in: `x_{1}=10^{-3}`, want: "x_{1}=10^(-3)"},
+		{in: "3 }", want: "3 }"},
+	}
+	for _, tt := range tests {
+		if got := normalizeAnswer(tt.in); got != tt.want {
+			t.Errorf("normalizeAnswer(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		in      string
+		si      float64
+		hasUnit bool
+	}{
+		{in: "12", si: 12},
+		{in: "-1,5", si: -1.5},
+		{in: "3.2e-4", si: 3.2e-4},
+		{in: "6.02·10^23", si: 6.02e23},
+		{in: `1{,}5\cdot10^{-3}`, si: 1.5e-3},
+		{in: "15 м/с", si: 15, hasUnit: true},
+		{in: "2,5 кН", si: 2500, hasUnit: true},
+		{in: "36 km/h", si: 10, hasUnit: true},
+		{in: "1 000 000", si: 1e6},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuantity(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuantity(%q): %v", tt.in, err)
+			continue
+		}
+		if math.Abs(q.SI()-tt.si) > 1e-9*math.Max(1, math.Abs(tt.si)) || q.HasUnit != tt.hasUnit {
+			t.Errorf("ParseQuantity(%q) = %v SI, unit %v, want %v, %v", tt.in, q.SI(), q.HasUnit, tt.si, tt.hasUnit)
+		}
+	}
+	for _, in := range []string{"", "abc", "12 furlongs"} {
+		if _, err := ParseQuantity(in); err == nil {
+			t.Errorf("ParseQuantity(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestCheckNumeric(t *testing.T) {
+	tests := []struct {
+		correct, unit, answer string
+		tol                   Tolerance
+		want                  Status
+	}{
+		{correct: "1500", answer: "1500", want: StatusCorrect},
+		{correct: "1500 m", answer: "1.5 km", want: StatusCorrect},
+		{correct: "1500 m", answer: "1.6 km", want: StatusIncorrect},
+		{correct: "1.5", unit: "km", answer: "1500 m", want: StatusCorrect},
+		{correct: "1.5", unit: "km", answer: "1.5 km", want: StatusCorrect},
+		{correct: "1.5", unit: "km", answer: "1.5", want: StatusCorrect},
+		{correct: "1.5", unit: "km", answer: "1.5 s", want: StatusIncorrect},
+		// A bare expected number takes no units but dimensionless ones
+		{correct: "1.5", answer: "1.5 km", want: StatusIncorrect},
+		{correct: "1500", answer: "1.5 km", want: StatusIncorrect},
+		{correct: "5", answer: "5 kg", want: StatusIncorrect},
+		{correct: "5", answer: "5 s", want: StatusIncorrect},
+		{correct: "5", answer: "5 m", want: StatusIncorrect},
+		{correct: "5", answer: "5000 g", want: StatusIncorrect},
+		{correct: "50", answer: "50 %", want: StatusCorrect},
+		{correct: "0.5", answer: "50 %", want: StatusCorrect},
+		{correct: "5", unit: "kg", answer: "5000 g", want: StatusCorrect},
+		{correct: "10 m/s", answer: "36 km/h", want: StatusCorrect},
+		{correct: "10 m/s", answer: "10 kg", want: StatusIncorrect},
+		{correct: "9.8", answer: "9.81", tol: Tolerance{Mode: ToleranceAbsolute, Value: 0.05}, want: StatusCorrect},
+		{correct: "9.8", answer: "9.9", tol: Tolerance{Mode: ToleranceRelative, Value: 0.005}, want: StatusIncorrect},
+		{correct: "1.5e-3", answer: `1{,}5\cdot10^{-3}`, want: StatusCorrect},
+		{correct: "12", answer: "twelve", want: StatusIncorrect},
+	}
+	for _, tt := range tests {
+		task := &models.Task{AnswerType: AnswerNumeric, CorrectAnswer: tt.correct, AnswerUnit: tt.unit,
+			ToleranceMode: tt.tol.Mode, Tolerance: tt.tol.Value}
+		if got := Check(task, tt.answer); got.Status != tt.want {
+			t.Errorf("Check(%q %s, %q) = %s (%s), want %s", tt.correct, tt.unit, tt.answer, got.Status, got.Feedback, tt.want)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package grading
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/big"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"coolphy-backend/pkg/models"
+)
+
+// DefaultParamTolerance is used for parametrized tasks without an explicit
+// tolerance: students round the computed answer, so an exact match is too strict
+const DefaultParamTolerance = 0.01
+
+// Variant is one student's set of parameter values
+type Variant map[string]*big.Rat
+
+// VariantSeed derives the seed of a student's variant of a task, so a student
+// sees the same numbers every time and different students see different ones
+func VariantSeed(userID, taskID uint) int64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%d", userID, taskID)
+	return int64(h.Sum64())
+}
+
+// NewVariant picks a value for every parameter using the given seed
+func NewVariant(params []models.TaskParam, seed int64) (Variant, error) {
+	rng := rand.New(rand.NewSource(seed))
+	v := make(Variant, len(params))
+	for _, p := range params {
+		r, err := pickValue(p, rng)
+		if err != nil {
+			return nil, err
+		}
+		v[p.Name] = r
+	}
+	return v, nil
+}
+
+// maxParamSteps bounds the number of values in a min..max range
+const maxParamSteps = 1 << 30
+
+// paramRange returns the smallest value of a min..max parameter, its step,
+// the number of steps to the largest value and the decimals to round to
+func paramRange(p models.TaskParam) (lo, step float64, n, decimals int, err error) {
+	if p.Min == nil || p.Max == nil {
+		return 0, 0, 0, 0, fmt.Errorf("parameter %q needs either values or min and max", p.Name)
+	}
+	lo, hi := *p.Min, *p.Max
+	if hi < lo {
+		return 0, 0, 0, 0, fmt.Errorf("parameter %q has min above max", p.Name)
+	}
+	step = p.Step
+	if step <= 0 {
+		step = 1
+	}
+	steps := math.Floor((hi-lo)/step + 1e-9)
+	if math.IsNaN(steps) || steps > maxParamSteps {
+		return 0, 0, 0, 0, fmt.Errorf("parameter %q has too many values, use a larger step", p.Name)
+	}
+	return lo, step, int(steps), max(decimalsOf(step), decimalsOf(lo)), nil
+}
+
+func pickValue(p models.TaskParam, rng *rand.Rand) (*big.Rat, error) {
+	if len(p.Values) > 0 {
+		return decimalRat(p.Values[rng.Intn(len(p.Values))], -1), nil
+	}
+	lo, step, n, decimals, err := paramRange(p)
+	if err != nil {
+		return nil, err
+	}
+	return decimalRat(lo+float64(rng.Intn(n+1))*step, decimals), nil
+}
+
+// extremes returns the values of a parameter worth checking the formula on:
+// every listed value, or both ends of the range
+func extremes(p models.TaskParam) ([]*big.Rat, error) {
+	if len(p.Values) > 0 {
+		out := make([]*big.Rat, len(p.Values))
+		for i, x := range p.Values {
+			out[i] = decimalRat(x, -1)
+		}
+		return out, nil
+	}
+	lo, step, n, decimals, err := paramRange(p)
+	if err != nil {
+		return nil, err
+	}
+	return []*big.Rat{decimalRat(lo, decimals), decimalRat(lo+float64(n)*step, decimals)}, nil
+}
+
+// decimalsOf counts the digits after the decimal point
+func decimalsOf(x float64) int {
+	s := strconv.FormatFloat(x, 'f', -1, 64)
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+// decimalRat converts x to an exact decimal, rounding away float noise such
+// as 0.1+0.2 when decimals >= 0
+func decimalRat(x float64, decimals int) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(x, 'f', decimals, 64))
+	return r
+}
+
+// Values formats the variant for display
+func (v Variant) Values() map[string]string {
+	out := make(map[string]string, len(v))
+	for name, r := range v {
+		out[name] = formatRat(r)
+	}
+	return out
+}
+
+func formatRat(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	s := strings.TrimRight(r.FloatString(6), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+var placeholderRe = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// Render replaces {{name}} placeholders with the variant's values. Unknown
+// placeholders are left as they are.
+func (v Variant) Render(text string) string {
+	return placeholderRe.ReplaceAllStringFunc(text, func(m string) string {
+		name := placeholderRe.FindStringSubmatch(m)[1]
+		if r, ok := v[name]; ok {
+			return formatRat(r)
+		}
+		return m
+	})
+}
+
+// Answer evaluates the answer formula for the variant and formats it as a
+// correct answer, with the unit appended if there is one
+func (v Variant) Answer(formula, unit string) (string, error) {
+	e, err := ParseExpr(formula)
+	if err != nil {
+		return "", err
+	}
+	x, err := e.Eval(v)
+	if err != nil {
+		return "", err
+	}
+	answer := strconv.FormatFloat(x, 'g', 12, 64)
+	if unit = strings.TrimSpace(unit); unit != "" {
+		answer += " " + unit
+	}
+	return answer, nil
+}
+
+// ApplyVariant turns a parametrized task into the given student's version:
+// the LaTeX gets the student's numbers and CorrectAnswer is computed from
+// AnswerFormula. Tasks without parameters are left untouched.
+func ApplyVariant(task *models.Task, userID uint) error {
+	params, err := task.DecodeParams()
+	if err != nil || len(params) == 0 {
+		return err
+	}
+	v, err := NewVariant(params, VariantSeed(userID, task.ID))
+	if err != nil {
+		return err
+	}
+	task.DescriptionLaTeX = v.Render(task.DescriptionLaTeX)
+	task.SolutionLaTeX = v.Render(task.SolutionLaTeX)
+	task.HintLaTeX = v.Render(task.HintLaTeX)
+	task.ParamValues = v.Values()
+	if task.Tolerance == 0 {
+		task.ToleranceMode = ToleranceRelative
+		task.Tolerance = DefaultParamTolerance
+	}
+	answer, err := v.Answer(task.AnswerFormula, task.AnswerUnit)
+	if err != nil {
+		return err
+	}
+	task.CorrectAnswer = answer
+	return nil
+}
+
+// paramCheckSeeds is how many variants ValidateParams evaluates the formula on
+const paramCheckSeeds = 20
+
+// ValidateParams checks a parameter spec and that the formula can be
+// evaluated with it
+func ValidateParams(params []models.TaskParam, formula, unit string) error {
+	if len(params) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, p := range params {
+		e, err := ParseExpr(p.Name)
+		if err != nil || e.Op != "var" || e.Name != p.Name {
+			return fmt.Errorf("parameter name %q must be a single variable like m, v_0 or alpha", p.Name)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("parameter %q is defined twice", p.Name)
+		}
+		seen[p.Name] = true
+		if len(p.Values) == 0 {
+			if p.Step < 0 {
+				return fmt.Errorf("parameter %q has a negative step", p.Name)
+			}
+			if _, _, _, _, err := paramRange(p); err != nil {
+				return err
+			}
+		}
+	}
+	if strings.TrimSpace(formula) == "" {
+		return fmt.Errorf("answer_formula is required for a parametrized task")
+	}
+	e, err := ParseExpr(formula)
+	if err != nil {
+		return fmt.Errorf("answer_formula is not a valid expression: %v", err)
+	}
+	for _, name := range e.Vars() {
+		if _, isConst := constants[name]; !isConst && !seen[name] {
+			return fmt.Errorf("answer_formula uses %q, which is not a parameter", name)
+		}
+	}
+	if unit != "" {
+		if _, err := ParseQuantity("1 " + unit); err != nil {
+			return fmt.Errorf("answer_unit: %v", err)
+		}
+	}
+	variants, err := extremeVariants(params)
+	if err != nil {
+		return err
+	}
+	for seed := int64(0); seed < paramCheckSeeds; seed++ {
+		v, err := NewVariant(params, seed)
+		if err != nil {
+			return err
+		}
+		variants = append(variants, v)
+	}
+	for _, v := range variants {
+		if _, err := v.Answer(formula, ""); err != nil {
+			return fmt.Errorf("answer_formula can't be evaluated for %s: %v", describeVariant(params, v), err)
+		}
+	}
+	return nil
+}
+
+// maxExtremeVariants caps the combinations of extreme values ValidateParams
+// tries; past it each parameter goes through its extremes on its own
+const maxExtremeVariants = 1024
+
+// extremeVariants combines the extreme values of the parameters, so a formula
+// that divides by zero or takes the root of a negative number at the end of
+// a range is caught even when no random variant lands there
+func extremeVariants(params []models.TaskParam) ([]Variant, error) {
+	values := make([][]*big.Rat, len(params))
+	total := 1
+	for i, p := range params {
+		vals, err := extremes(p)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = vals
+		total = min(total*len(vals), maxExtremeVariants+1)
+	}
+	var out []Variant
+	if total <= maxExtremeVariants {
+		out = []Variant{{}}
+		for i, p := range params {
+			next := make([]Variant, 0, len(out)*len(values[i]))
+			for _, v := range out {
+				for _, x := range values[i] {
+					w := make(Variant, len(v)+1)
+					for name, r := range v {
+						w[name] = r
+					}
+					w[p.Name] = x
+					next = append(next, w)
+				}
+			}
+			out = next
+		}
+		return out, nil
+	}
+	// Too many combinations: all lows, all highs, and one at a time between them
+	for _, pick := range []func([]*big.Rat) *big.Rat{
+		func(vals []*big.Rat) *big.Rat { return vals[0] },
+		func(vals []*big.Rat) *big.Rat { return vals[len(vals)-1] },
+	} {
+		base := make(Variant, len(params))
+		for i, p := range params {
+			base[p.Name] = pick(values[i])
+		}
+		out = append(out, base)
+		for i, p := range params {
+			for _, x := range values[i] {
+				w := make(Variant, len(base))
+				for name, r := range base {
+					w[name] = r
+				}
+				w[p.Name] = x
+				out = append(out, w)
+			}
+		}
+	}
+	return out, nil
+}
+
+// describeVariant lists the values of a variant in parameter order, e.g. "m = 2, v = 0"
+func describeVariant(params []models.TaskParam, v Variant) string {
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.Name + " = " + formatRat(v[p.Name])
+	}
+	return strings.Join(parts, ", ")
+}
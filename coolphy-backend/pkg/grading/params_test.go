@@ -0,0 +1,82 @@
+package grading
+
+import (
+	"strings"
+	"testing"
+
+	"coolphy-backend/pkg/models"
+)
+
+func ptr(x float64) *float64 { return &x }
+
+func TestNewVariant(t *testing.T) {
+	params := []models.TaskParam{
+		{Name: "m", Min: ptr(1), Max: ptr(2), Step: 0.1},
+		{Name: "v", Values: []float64{3, 4.5}},
+	}
+	for seed := int64(0); seed < 50; seed++ {
+		v, err := NewVariant(params, seed)
+		if err != nil {
+			t.Fatalf("NewVariant: %v", err)
+		}
+		m, _ := v["m"].Float64()
+		if m < 1 || m > 2 || len(formatRat(v["m"])) > 3 {
+			t.Errorf("seed %d: m = %s, want one decimal in [1, 2]", seed, formatRat(v["m"]))
+		}
+		if s := formatRat(v["v"]); s != "3" && s != "4.5" {
+			t.Errorf("seed %d: v = %s, want 3 or 4.5", seed, s)
+		}
+	}
+
+	bad := []models.TaskParam{
+		{Name: "x"},
+		{Name: "x", Min: ptr(1)},
+		{Name: "x", Min: ptr(2), Max: ptr(1)},
+		{Name: "x", Min: ptr(0), Max: ptr(1e12), Step: 1e-6},
+	}
+	for _, p := range bad {
+		if _, err := NewVariant([]models.TaskParam{p}, 1); err == nil {
+			t.Errorf("NewVariant(%+v) succeeded, want an error", p)
+		}
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  []models.TaskParam
+		formula string
+		unit    string
+		wantErr string
+	}{
+		{
+			name:    "valid",
+			params:  []models.TaskParam{{Name: "m", Min: ptr(1), Max: ptr(5)}, {Name: "v", Values: []float64{2, 3}}},
+			formula: `\frac{m v^2}{2}`,
+			unit:    "J",
+		},
+		{name: "no params", formula: ""},
+		{name: "missing range", params: []models.TaskParam{{Name: "m"}}, formula: "m", wantErr: "needs either values or min and max"},
+		{name: "inverted range", params: []models.TaskParam{{Name: "m", Min: ptr(5), Max: ptr(1)}}, formula: "m", wantErr: "min above max"},
+		{name: "negative step", params: []models.TaskParam{{Name: "m", Min: ptr(1), Max: ptr(5), Step: -1}}, formula: "m", wantErr: "negative step"},
+		{name: "bad name", params: []models.TaskParam{{Name: "2m", Values: []float64{1}}}, formula: "1", wantErr: "single variable"},
+		{name: "duplicate", params: []models.TaskParam{{Name: "m", Values: []float64{1}}, {Name: "m", Values: []float64{2}}}, formula: "m", wantErr: "defined twice"},
+		{name: "unknown variable", params: []models.TaskParam{{Name: "m", Values: []float64{1}}}, formula: "m*g", wantErr: `uses "g"`},
+		{name: "no formula", params: []models.TaskParam{{Name: "m", Values: []float64{1}}}, wantErr: "answer_formula is required"},
+		{name: "bad unit", params: []models.TaskParam{{Name: "m", Values: []float64{1}}}, formula: "m", unit: "furlongs", wantErr: "answer_unit"},
+		// Division by zero only at the end of a wide range, which random variants rarely hit
+		{name: "zero at min", params: []models.TaskParam{{Name: "x", Min: ptr(0), Max: ptr(1000)}}, formula: "1/x", wantErr: "x = 0"},
+		{name: "zero at max", params: []models.TaskParam{{Name: "x", Min: ptr(-1000), Max: ptr(0)}}, formula: "1/x", wantErr: "x = 0"},
+		{name: "zero in a list", params: []models.TaskParam{{Name: "x", Values: []float64{5, 0, 7}}}, formula: "1/x", wantErr: "x = 0"},
+		{name: "root of a negative", params: []models.TaskParam{{Name: "a", Min: ptr(1), Max: ptr(100)}, {Name: "b", Min: ptr(0), Max: ptr(101)}}, formula: `\sqrt{a-b}`, wantErr: "can't be evaluated"},
+	}
+	for _, tt := range tests {
+		err := ValidateParams(tt.params, tt.formula, tt.unit)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: error %v, want one containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package grading
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"coolphy-backend/pkg/models"
+)
+
+// Structured answer types, their schema lives in Task.AnswerSpec
+const (
+	AnswerChoice    = "choice"
+	AnswerMultiPart = "multi_part"
+	AnswerInterval  = "interval"
+	AnswerSet       = "set"
+	AnswerOrdered   = "ordered"
+)
+
+// IsStructured reports whether the answer type needs an AnswerSpec
+func IsStructured(answerType string) bool {
+	switch answerType {
+	case AnswerChoice, AnswerMultiPart, AnswerInterval, AnswerSet, AnswerOrdered:
+		return true
+	}
+	return false
+}
+
+// ValidateSpec checks that spec is complete for the given answer type
+func ValidateSpec(answerType string, spec *models.AnswerSpec) error {
+	if spec == nil {
+		return fmt.Errorf("answer_spec is required for answer_type %q", answerType)
+	}
+	switch answerType {
+	case AnswerChoice:
+		if len(spec.Options) < 2 {
+			return fmt.Errorf("choice needs at least two options")
+		}
+		ids := map[string]bool{}
+		for _, o := range spec.Options {
+			if o.ID == "" || ids[o.ID] {
+				return fmt.Errorf("option ids must be unique and non-empty")
+			}
+			ids[o.ID] = true
+		}
+		if len(spec.Correct) == 0 {
+			return fmt.Errorf("choice needs at least one correct option")
+		}
+		if !spec.Multiple && len(spec.Correct) > 1 {
+			return fmt.Errorf("single choice can have only one correct option")
+		}
+		for _, c := range spec.Correct {
+			if !ids[c] {
+				return fmt.Errorf("correct option %q is not among the options", c)
+			}
+		}
+	case AnswerMultiPart:
+		if len(spec.Parts) == 0 {
+			return fmt.Errorf("multi_part needs at least one part")
+		}
+		for i, part := range spec.Parts {
+			if strings.TrimSpace(part.Answer) == "" {
+				return fmt.Errorf("part %d has no answer", i+1)
+			}
+			if part.Weight < 0 {
+				return fmt.Errorf("part %d has a negative weight", i+1)
+			}
+			if err := validateValueType(part.Type, part.Answer); err != nil {
+				return fmt.Errorf("part %d: %v", i+1, err)
+			}
+		}
+	case AnswerInterval:
+		iv := spec.Interval
+		if iv == nil {
+			return fmt.Errorf("interval answer needs an interval")
+		}
+		if iv.Lower != nil && iv.Upper != nil && *iv.Lower > *iv.Upper {
+			return fmt.Errorf("interval lower bound is above the upper bound")
+		}
+	case AnswerSet, AnswerOrdered:
+		if len(spec.Correct) == 0 {
+			return fmt.Errorf("%s answer needs at least one item", answerType)
+		}
+		for _, item := range spec.Correct {
+			if err := validateValueType(spec.ItemType, item); err != nil {
+				return fmt.Errorf("item %q: %v", item, err)
+			}
+		}
+	default:
+		return fmt.Errorf("answer_type %q does not use answer_spec", answerType)
+	}
+	return nil
+}
+
+func validateValueType(kind, value string) error {
+	switch kind {
+	case AnswerAuto, AnswerText:
+	case AnswerNumeric:
+		if _, err := ParseQuantity(value); err != nil {
+			return fmt.Errorf("not a number: %v", err)
+		}
+	case AnswerExpression:
+		if _, err := ParseExpr(value); err != nil {
+			return fmt.Errorf("not a valid expression: %v", err)
+		}
+	default:
+		return fmt.Errorf("unsupported type %q", kind)
+	}
+	return nil
+}
+
+// Form returns what a student needs to see to answer a structured task
+func Form(answerType string, spec *models.AnswerSpec) *models.AnswerForm {
+	if spec == nil || (!IsStructured(answerType) && answerType != AnswerCode) {
+		return nil
+	}
+	form := &models.AnswerForm{Type: answerType}
+	switch answerType {
+	case AnswerChoice:
+		form.Options = spec.Options
+		form.Multiple = spec.Multiple
+	case AnswerMultiPart:
+		for i, p := range spec.Parts {
+			label := p.Label
+			if label == "" {
+				label = fmt.Sprint(i + 1)
+			}
+			form.Parts = append(form.Parts, label)
+		}
+	case AnswerCode:
+		form.TimeLimitMS = spec.TimeLimitMS
+		form.MemoryLimitMB = spec.MemoryLimitMB
+		form.Languages = spec.Languages
+	}
+	return form
+}
+
+func checkStructured(task *models.Task, answer string) Result {
+	spec, err := task.DecodeAnswerSpec()
+	if err != nil || spec == nil {
+		return undecided
+	}
+	tol := TaskTolerance(task)
+	switch task.AnswerType {
+	case AnswerChoice:
+		return checkChoice(spec, answer)
+	case AnswerMultiPart:
+		return checkMultiPart(spec, answer)
+	case AnswerInterval:
+		return checkInterval(spec, answer, tol)
+	case AnswerSet:
+		return checkSet(spec, answer, tol)
+	case AnswerOrdered:
+		return checkOrdered(spec, answer, tol)
+	}
+	return undecided
+}
+
+// scored turns a 0-100 score into a result
+func scored(score int, feedback string) Result {
+	switch {
+	case score >= 100:
+		return Result{Status: StatusCorrect, Score: 100, Feedback: feedback}
+	case score > 0:
+		return Result{Status: StatusPartial, Score: score, Feedback: feedback}
+	default:
+		return Result{Status: StatusIncorrect, Score: 0, Feedback: feedback}
+	}
+}
+
+// checkValue compares a single value of the given kind
+func checkValue(kind, correct, given string, tol Tolerance) bool {
+	var r Result
+	switch kind {
+	case AnswerNumeric:
+		r = checkNumeric(correct, given, tol, true)
+	case AnswerText:
+		r = checkText(correct, given, true)
+	case AnswerExpression:
+		r = CheckExpression(correct, given)
+	default:
+		r = checkNumeric(correct, given, tol, false)
+		if !r.Decided() {
+			r = checkText(correct, given, true)
+		}
+	}
+	return r.Status == StatusCorrect
+}
+
+// splitItems reads a list answer: a JSON array, "{1; 2; 3}", "1, 2, 3" or "1 2 3".
+// Semicolons win over commas so that decimal commas survive.
+func splitItems(s string) []string {
+	s = strings.TrimSpace(strings.Trim(strings.TrimSpace(s), "$"))
+	var arr []string
+	if json.Unmarshal([]byte(s), &arr) == nil {
+		return arr
+	}
+	s = strings.NewReplacer(`\{`, "", `\}`, "", `\left`, "", `\right`, "").Replace(s)
+	s = strings.Trim(s, "{}[]() ")
+	var parts []string
+	switch {
+	case strings.Contains(s, ";"):
+		parts = strings.Split(s, ";")
+	case strings.Contains(s, ","):
+		parts = strings.Split(s, ",")
+	default:
+		parts = strings.Fields(s)
+	}
+	var out []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// splitCompact expands EGE-style answers like "25" or "312" into single
+// characters when every expected item is one character long
+func splitCompact(items []string, expected []string) []string {
+	if len(items) != 1 || utf8.RuneCountInString(items[0]) < 2 {
+		return items
+	}
+	for _, e := range expected {
+		if utf8.RuneCountInString(e) != 1 {
+			return items
+		}
+	}
+	var out []string
+	for _, r := range items[0] {
+		out = append(out, string(r))
+	}
+	return out
+}
+
+func checkChoice(spec *models.AnswerSpec, answer string) Result {
+	ids := make([]string, len(spec.Options))
+	for i, o := range spec.Options {
+		ids[i] = o.ID
+	}
+	given := splitCompact(splitItems(answer), ids)
+	for i := range given {
+		given[i] = strings.ToUpper(given[i])
+	}
+	correct := make([]string, len(spec.Correct))
+	for i, c := range spec.Correct {
+		correct[i] = strings.ToUpper(c)
+	}
+	if !spec.Multiple {
+		if len(given) == 1 && given[0] == correct[0] {
+			return scored(100, "Correct!")
+		}
+		return scored(0, "Wrong option.")
+	}
+	matched, extra := matchItems(correct, given, func(a, b string) bool { return a == b })
+	return scored(setScore(matched, extra, len(correct), spec.PartialCredit),
+		fmt.Sprintf("%d of %d correct options selected, %d wrong.", matched, len(correct), extra))
+}
+
+func checkSet(spec *models.AnswerSpec, answer string, tol Tolerance) Result {
+	given := splitCompact(splitItems(answer), spec.Correct)
+	matched, extra := matchItems(spec.Correct, given, func(want, got string) bool {
+		return checkValue(spec.ItemType, want, got, tol)
+	})
+	return scored(setScore(matched, extra, len(spec.Correct), spec.PartialCredit),
+		fmt.Sprintf("%d of %d elements found, %d extra.", matched, len(spec.Correct), extra))
+}
+
+func checkOrdered(spec *models.AnswerSpec, answer string, tol Tolerance) Result {
+	given := splitCompact(splitItems(answer), spec.Correct)
+	right := 0
+	for i, want := range spec.Correct {
+		if i < len(given) && checkValue(spec.ItemType, want, given[i], tol) {
+			right++
+		}
+	}
+	score := 0
+	if right == len(spec.Correct) && len(given) == len(spec.Correct) {
+		score = 100
+	} else if spec.PartialCredit {
+		score = right * 100 / len(spec.Correct)
+	}
+	return scored(score, fmt.Sprintf("%d of %d positions correct.", right, len(spec.Correct)))
+}
+
+// matchItems pairs each given item with a distinct expected one and returns
+// the number of matches and the number of given items left over
+func matchItems(expected, given []string, eq func(want, got string) bool) (matched, extra int) {
+	used := make([]bool, len(expected))
+	for _, g := range given {
+		found := false
+		for i, e := range expected {
+			if !used[i] && eq(e, g) {
+				used[i] = true
+				found = true
+				break
+			}
+		}
+		if found {
+			matched++
+		} else {
+			extra++
+		}
+	}
+	return matched, extra
+}
+
+// setScore gives full marks for an exact match and, with partial credit,
+// the share of correct items minus wrong ones
+func setScore(matched, extra, total int, partial bool) int {
+	if matched == total && extra == 0 {
+		return 100
+	}
+	if !partial || total == 0 {
+		return 0
+	}
+	score := (matched - extra) * 100 / total
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+func checkMultiPart(spec *models.AnswerSpec, answer string) Result {
+	given := splitParts(answer, spec.Parts)
+	totalWeight, earned := 0, 0
+	var notes []string
+	for i, part := range spec.Parts {
+		weight := part.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		totalWeight += weight
+		label := part.Label
+		if label == "" {
+			label = fmt.Sprint(i + 1)
+		}
+		tol := Tolerance{Mode: part.ToleranceMode, Value: part.Tolerance}
+		if i < len(given) && given[i] != "" && checkValue(part.Type, part.Answer, given[i], tol) {
+			earned += weight
+			notes = append(notes, label+": correct")
+		} else {
+			notes = append(notes, label+": incorrect")
+		}
+	}
+	return scored(earned*100/totalWeight, strings.Join(notes, "; ")+".")
+}
+
+// splitParts reads sub-answers as a JSON object keyed by label, a JSON array,
+// or one answer per line / semicolon
+func splitParts(answer string, parts []models.AnswerPart) []string {
+	out := make([]string, len(parts))
+	var byLabel map[string]string
+	if json.Unmarshal([]byte(answer), &byLabel) == nil {
+		for i, p := range parts {
+			label := p.Label
+			if label == "" {
+				label = fmt.Sprint(i + 1)
+			}
+			out[i] = byLabel[label]
+		}
+		return out
+	}
+	var list []string
+	if json.Unmarshal([]byte(answer), &list) != nil {
+		sep := "\n"
+		if !strings.Contains(answer, "\n") {
+			sep = ";"
+		}
+		list = strings.Split(answer, sep)
+	}
+	for i := range out {
+		if i < len(list) {
+			out[i] = strings.TrimSpace(list[i])
+		}
+	}
+	return out
+}
+
+func checkInterval(spec *models.AnswerSpec, answer string, tol Tolerance) Result {
+	got, err := ParseInterval(answer)
+	if err != nil {
+		return Result{Status: StatusIncorrect, Feedback: "Could not read an interval from your answer: " + err.Error() + "."}
+	}
+	want := spec.Interval
+	boundsOK := sameBound(want.Lower, got.Lower, tol) && sameBound(want.Upper, got.Upper, tol)
+	if !boundsOK {
+		return scored(0, "The interval bounds are not correct.")
+	}
+	closedOK := (want.Lower == nil || want.LowerClosed == got.LowerClosed) &&
+		(want.Upper == nil || want.UpperClosed == got.UpperClosed)
+	if closedOK {
+		return scored(100, "Correct!")
+	}
+	if spec.PartialCredit {
+		return scored(50, "The bounds are right, but check which ends are included.")
+	}
+	return scored(0, "Check which ends of the interval are included.")
+}
+
+func sameBound(want, got *float64, tol Tolerance) bool {
+	if want == nil || got == nil {
+		return want == nil && got == nil
+	}
+	return tol.within(*got, *want)
+}
+
+// ParseInterval reads "[2; 5)", "(-\infty, 3]" or "x \in [1;2]"
+func ParseInterval(s string) (models.AnswerInterval, error) {
+	var iv models.AnswerInterval
+	s = strings.TrimSpace(strings.Trim(strings.TrimSpace(s), "$"))
+	s = strings.NewReplacer(`\left`, "", `\right`, "", `\infty`, "∞", "inf", "∞").Replace(s)
+	for _, sep := range []string{`\in`, "∈"} {
+		if i := strings.Index(s, sep); i >= 0 {
+			s = strings.TrimSpace(s[i+len(sep):])
+		}
+	}
+	if len(s) < 2 {
+		return iv, fmt.Errorf("too short")
+	}
+	open, close := s[0], s[len(s)-1]
+	if (open != '[' && open != '(') || (close != ']' && close != ')') {
+		return iv, fmt.Errorf("expected brackets around the interval")
+	}
+	iv.LowerClosed = open == '['
+	iv.UpperClosed = close == ']'
+	body := s[1 : len(s)-1]
+	sep := ","
+	if strings.Contains(body, ";") {
+		sep = ";"
+	}
+	ends := strings.Split(body, sep)
+	if len(ends) != 2 {
+		return iv, fmt.Errorf("expected two bounds")
+	}
+	var err error
+	if iv.Lower, err = parseBound(ends[0], -1); err != nil {
+		return iv, err
+	}
+	if iv.Upper, err = parseBound(ends[1], 1); err != nil {
+		return iv, err
+	}
+	return iv, nil
+}
+
+func parseBound(s string, side int) (*float64, error) {
+	s = strings.TrimSpace(s)
+	switch strings.TrimPrefix(strings.TrimPrefix(s, "+"), "-") {
+	case "∞":
+		if strings.HasPrefix(s, "-") != (side < 0) {
+			return nil, fmt.Errorf("infinite bound on the wrong side")
+		}
+		return nil, nil
+	}
+	q, err := ParseQuantity(s)
+	if err != nil {
+		return nil, err
+	}
+	v := q.Number
+	if math.IsNaN(v) {
+		return nil, fmt.Errorf("bad bound")
+	}
+	return &v, nil
+}
+
+// KeyAnswer writes out the correct answer of the task for an answer key, in
+// the form the checker accepts. It is empty for code tasks, which are
+// checked by tests.
+func KeyAnswer(task *models.Task) string {
+	if !IsStructured(task.AnswerType) {
+		return task.CorrectAnswer
+	}
+	spec, err := task.DecodeAnswerSpec()
+	if err != nil || spec == nil {
+		return ""
+	}
+	switch task.AnswerType {
+	case AnswerChoice, AnswerSet, AnswerOrdered:
+		return strings.Join(spec.Correct, "; ")
+	case AnswerMultiPart:
+		parts := make([]string, len(spec.Parts))
+		for i, p := range spec.Parts {
+			parts[i] = p.Label + ") " + p.Answer
+		}
+		return strings.Join(parts, "; ")
+	case AnswerInterval:
+		if spec.Interval == nil {
+			return ""
+		}
+		iv := spec.Interval
+		lower, upper := "(", ")"
+		if iv.LowerClosed {
+			lower = "["
+		}
+		if iv.UpperClosed {
+			upper = "]"
+		}
+		return lower + keyBound(iv.Lower, "-inf") + "; " + keyBound(iv.Upper, "+inf") + upper
+	}
+	return ""
+}
+
+func keyBound(v *float64, inf string) string {
+	if v == nil {
+		return inf
+	}
+	return fmt.Sprint(*v)
+}
@@ -0,0 +1,315 @@
+package grading
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Dimension holds the exponents of the SI base units in the order
+// m, kg, s, A, K, mol, cd
+type Dimension [7]int
+
+var dimensionless = Dimension{}
+
+func (d Dimension) add(o Dimension, sign int) Dimension {
+	for i := range d {
+		d[i] += sign * o[i]
+	}
+	return d
+}
+
+func (d Dimension) scale(n int) Dimension {
+	for i := range d {
+		d[i] *= n
+	}
+	return d
+}
+
+func (d Dimension) IsDimensionless() bool { return d == dimensionless }
+
+func (d Dimension) String() string {
+	names := [7]string{"m", "kg", "s", "A", "K", "mol", "cd"}
+	var parts []string
+	for i, e := range d {
+		switch {
+		case e == 0:
+		case e == 1:
+			parts = append(parts, names[i])
+		default:
+			parts = append(parts, fmt.Sprintf("%s^%d", names[i], e))
+		}
+	}
+	if len(parts) == 0 {
+		return "1"
+	}
+	return strings.Join(parts, "·")
+}
+
+// unit is a scale factor to SI base units together with its dimension
+type unit struct {
+	Scale float64
+	Dim   Dimension
+	// Prefixable units accept SI prefixes (km, мкс, ...)
+	Prefixable bool
+}
+
+func dim(m, kg, s, a, k, mol, cd int) Dimension { return Dimension{m, kg, s, a, k, mol, cd} }
+
+var (
+	dLength      = dim(1, 0, 0, 0, 0, 0, 0)
+	dMass        = dim(0, 1, 0, 0, 0, 0, 0)
+	dTime        = dim(0, 0, 1, 0, 0, 0, 0)
+	dCurrent     = dim(0, 0, 0, 1, 0, 0, 0)
+	dTemperature = dim(0, 0, 0, 0, 1, 0, 0)
+	dAmount      = dim(0, 0, 0, 0, 0, 1, 0)
+	dLuminous    = dim(0, 0, 0, 0, 0, 0, 1)
+	dForce       = dim(1, 1, -2, 0, 0, 0, 0)
+	dEnergy      = dim(2, 1, -2, 0, 0, 0, 0)
+	dPower       = dim(2, 1, -3, 0, 0, 0, 0)
+	dPressure    = dim(-1, 1, -2, 0, 0, 0, 0)
+	dFrequency   = dim(0, 0, -1, 0, 0, 0, 0)
+	dCharge      = dim(0, 0, 1, 1, 0, 0, 0)
+	dVoltage     = dim(2, 1, -3, -1, 0, 0, 0)
+	dResistance  = dim(2, 1, -3, -2, 0, 0, 0)
+	dCapacitance = dim(-2, -1, 4, 2, 0, 0, 0)
+	dInduction   = dim(0, 1, -2, -1, 0, 0, 0)
+	dFlux        = dim(2, 1, -2, -1, 0, 0, 0)
+	dInductance  = dim(2, 1, -2, -2, 0, 0, 0)
+	dVolume      = dim(3, 0, 0, 0, 0, 0, 0)
+)
+
+const electronVolt = 1.602176634e-19
+
+// units maps symbols, including the Russian ones used in EGE papers, to SI
+var units = map[string]unit{
+	// Base units
+	"m": {1, dLength, true}, "м": {1, dLength, true},
+	"g": {1e-3, dMass, true}, "г": {1e-3, dMass, true},
+	"s": {1, dTime, true}, "с": {1, dTime, true}, "sec": {1, dTime, false},
+	"A": {1, dCurrent, true}, "А": {1, dCurrent, true},
+	"K": {1, dTemperature, true}, "К": {1, dTemperature, true},
+	"mol": {1, dAmount, true}, "моль": {1, dAmount, true},
+	"cd": {1, dLuminous, true}, "кд": {1, dLuminous, true},
+	// Derived units
+	"N": {1, dForce, true}, "Н": {1, dForce, true},
+	"J": {1, dEnergy, true}, "Дж": {1, dEnergy, true},
+	"W": {1, dPower, true}, "Вт": {1, dPower, true},
+	"Pa": {1, dPressure, true}, "Па": {1, dPressure, true},
+	"Hz": {1, dFrequency, true}, "Гц": {1, dFrequency, true},
+	"C": {1, dCharge, true}, "Кл": {1, dCharge, true},
+	"V": {1, dVoltage, true}, "В": {1, dVoltage, true},
+	"Ω": {1, dResistance, true}, "Ohm": {1, dResistance, true}, "ohm": {1, dResistance, true}, "Ом": {1, dResistance, true},
+	"F": {1, dCapacitance, true}, "Ф": {1, dCapacitance, true},
+	"T": {1, dInduction, true}, "Тл": {1, dInduction, true},
+	"Wb": {1, dFlux, true}, "Вб": {1, dFlux, true},
+	"H": {1, dInductance, true}, "Гн": {1, dInductance, true},
+	// Non-SI units in common use
+	"eV": {electronVolt, dEnergy, true}, "эВ": {electronVolt, dEnergy, true},
+	"L": {1e-3, dVolume, true}, "l": {1e-3, dVolume, true}, "л": {1e-3, dVolume, true},
+	"t": {1e3, dMass, false}, "т": {1e3, dMass, false},
+	"min": {60, dTime, false}, "мин": {60, dTime, false},
+	"h": {3600, dTime, false}, "ч": {3600, dTime, false},
+	"d": {86400, dTime, false}, "сут": {86400, dTime, false},
+	"atm": {101325, dPressure, false}, "атм": {101325, dPressure, false},
+	"bar": {1e5, dPressure, true}, "бар": {1e5, dPressure, true},
+	"cal": {4.184, dEnergy, true}, "кал": {4.184, dEnergy, true},
+	"rad": {1, dimensionless, false}, "рад": {1, dimensionless, false},
+	"°": {math.Pi / 180, dimensionless, false}, "deg": {math.Pi / 180, dimensionless, false},
+	"%": {0.01, dimensionless, false},
+}
+
+var prefixes = map[string]float64{
+	"Y": 1e24, "Z": 1e21, "E": 1e18, "P": 1e15, "T": 1e12, "G": 1e9, "M": 1e6,
+	"k": 1e3, "h": 1e2, "da": 1e1, "d": 1e-1, "c": 1e-2, "m": 1e-3,
+	"µ": 1e-6, "μ": 1e-6, "u": 1e-6, "n": 1e-9, "p": 1e-12, "f": 1e-15, "a": 1e-18,
+	// Russian prefixes
+	"Т": 1e12, "Г": 1e9, "М": 1e6, "к": 1e3, "г": 1e2, "да": 1e1, "д": 1e-1,
+	"с": 1e-2, "м": 1e-3, "мк": 1e-6, "н": 1e-9, "п": 1e-12, "ф": 1e-15,
+}
+
+// lookupUnit resolves a single unit symbol, trying an exact match before
+// splitting off an SI prefix
+func lookupUnit(sym string) (unit, bool) {
+	if u, ok := units[sym]; ok {
+		return u, true
+	}
+	runes := []rune(sym)
+	for n := 2; n >= 1; n-- {
+		if len(runes) <= n {
+			continue
+		}
+		p, ok := prefixes[string(runes[:n])]
+		if !ok {
+			continue
+		}
+		if u, ok := units[string(runes[n:])]; ok && u.Prefixable {
+			u.Scale *= p
+			return u, true
+		}
+	}
+	return unit{}, false
+}
+
+// parseUnit parses a compound unit such as "km/h", "kg*m/s^2", "Н·м" or
+// "м/с²" and returns its scale to SI and its dimension. An empty string is
+// dimensionless with scale 1.
+func parseUnit(s string) (unit, error) {
+	p := &unitParser{src: []rune(normalizeUnitString(s))}
+	p.skipSpaces()
+	if p.done() {
+		return unit{Scale: 1}, nil
+	}
+	u, err := p.expr()
+	if err != nil {
+		return unit{}, err
+	}
+	p.skipSpaces()
+	if !p.done() {
+		return unit{}, fmt.Errorf("unexpected %q in unit", string(p.src[p.pos:]))
+	}
+	return u, nil
+}
+
+func normalizeUnitString(s string) string {
+	r := strings.NewReplacer(
+		"·", "*", "⋅", "*", "×", "*", `\cdot`, "*", `\times`, "*",
+		"²", "^2", "³", "^3", "⁻¹", "^-1", "⁻²", "^-2", "⁻³", "^-3",
+		"−", "-", `\Omega`, "Ω", `\mu`, "µ", `\%`, "%", `^\circ`, "°", `\circ`, "°",
+		"{", "", "}", "",
+	)
+	return strings.TrimSpace(r.Replace(s))
+}
+
+type unitParser struct {
+	src []rune
+	pos int
+}
+
+func (p *unitParser) done() bool { return p.pos >= len(p.src) }
+
+func (p *unitParser) peek() rune {
+	if p.done() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *unitParser) skipSpaces() {
+	for !p.done() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+// expr := term { ('*' | '/' | ' ') term }
+func (p *unitParser) expr() (unit, error) {
+	acc, err := p.term()
+	if err != nil {
+		return unit{}, err
+	}
+	for {
+		start := p.pos
+		p.skipSpaces()
+		if p.done() || p.peek() == ')' {
+			p.pos = start
+			return acc, nil
+		}
+		sign := 1
+		switch p.peek() {
+		case '*', '.':
+			p.pos++
+		case '/':
+			sign = -1
+			p.pos++
+		default:
+			// Juxtaposition ("N m") multiplies, but only if we skipped a space
+			if p.pos == start {
+				return unit{}, fmt.Errorf("unexpected %q in unit", string(p.peek()))
+			}
+		}
+		p.skipSpaces()
+		next, err := p.term()
+		if err != nil {
+			return unit{}, err
+		}
+		if sign > 0 {
+			acc.Scale *= next.Scale
+		} else {
+			acc.Scale /= next.Scale
+		}
+		acc.Dim = acc.Dim.add(next.Dim, sign)
+	}
+}
+
+// term := ( atom | '(' expr ')' ) [ '^' int ]
+func (p *unitParser) term() (unit, error) {
+	var u unit
+	if p.peek() == '(' {
+		p.pos++
+		inner, err := p.expr()
+		if err != nil {
+			return unit{}, err
+		}
+		p.skipSpaces()
+		if p.peek() != ')' {
+			return unit{}, fmt.Errorf("missing ) in unit")
+		}
+		p.pos++
+		u = inner
+	} else {
+		start := p.pos
+		for !p.done() && isUnitRune(p.peek()) {
+			p.pos++
+		}
+		sym := string(p.src[start:p.pos])
+		if sym == "" {
+			return unit{}, fmt.Errorf("expected unit at %q", string(p.src[start:]))
+		}
+		found, ok := lookupUnit(sym)
+		if !ok {
+			return unit{}, fmt.Errorf("unknown unit %q", sym)
+		}
+		u = found
+	}
+	if p.peek() == '^' {
+		p.pos++
+		exp, err := p.exponent()
+		if err != nil {
+			return unit{}, err
+		}
+		u.Scale = math.Pow(u.Scale, float64(exp))
+		u.Dim = u.Dim.scale(exp)
+	}
+	return u, nil
+}
+
+func (p *unitParser) exponent() (int, error) {
+	paren := p.peek() == '('
+	if paren {
+		p.pos++
+	}
+	start := p.pos
+	if p.peek() == '-' || p.peek() == '+' {
+		p.pos++
+	}
+	for !p.done() && unicode.IsDigit(p.peek()) {
+		p.pos++
+	}
+	n, err := strconv.Atoi(string(p.src[start:p.pos]))
+	if err != nil {
+		return 0, fmt.Errorf("bad exponent in unit")
+	}
+	if paren {
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("missing ) in exponent")
+		}
+		p.pos++
+	}
+	return n, nil
+}
+
+func isUnitRune(r rune) bool {
+	return unicode.IsLetter(r) || r == 'Ω' || r == 'µ' || r == '°' || r == '%'
+}
@@ -0,0 +1,275 @@
+// Package judge compiles and runs code submissions against the hidden tests
+// of a code task and reports a verdict for every test.
+package judge
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"coolphy-backend/pkg/models"
+)
+
+// Verdicts, named as in ejudge/Codeforces
+const (
+	VerdictOK  = "OK"  // accepted
+	VerdictWA  = "WA"  // wrong answer
+	VerdictTLE = "TLE" // time limit exceeded
+	VerdictMLE = "MLE" // memory limit exceeded
+	VerdictRE  = "RE"  // runtime error
+	VerdictCE  = "CE"  // compilation error
+)
+
+// Limits for a single test and their bounds
+const (
+	DefaultTimeLimitMS   = 1000
+	DefaultMemoryLimitMB = 256
+	MaxTimeLimitMS       = 10000
+	MaxMemoryLimitMB     = 1024
+	MaxTests             = 200
+
+	compileTimeout = 30 * time.Second
+	maxSourceBytes = 64 << 10
+)
+
+// Language describes how to build and run a submission
+type Language struct {
+	ID      string
+	Name    string
+	Source  string   // file name the source is saved as
+	Compile []string // nil for interpreted languages
+	Run     []string
+}
+
+var languages = map[string]Language{
+	"python": {ID: "python", Name: "Python 3", Source: "main.py",
+		Run: []string{"python3", "-S", "main.py"}},
+	"cpp": {ID: "cpp", Name: "C++17 (g++)", Source: "main.cpp",
+		Compile: []string{"g++", "-O2", "-std=c++17", "-o", "main", "main.cpp"},
+		Run:     []string{"./main"}},
+	"c": {ID: "c", Name: "C11 (gcc)", Source: "main.c",
+		Compile: []string{"gcc", "-O2", "-std=c11", "-o", "main", "main.c", "-lm"},
+		Run:     []string{"./main"}},
+	"go": {ID: "go", Name: "Go", Source: "main.go",
+		Compile: []string{"go", "build", "-o", "main", "main.go"},
+		Run:     []string{"./main"}},
+	"pascal": {ID: "pascal", Name: "Free Pascal", Source: "main.pas",
+		Compile: []string{"fpc", "-O2", "-omain", "main.pas"},
+		Run:     []string{"./main"}},
+}
+
+// LookupLanguage returns the language with the given ID
+func LookupLanguage(id string) (Language, bool) {
+	l, ok := languages[id]
+	return l, ok
+}
+
+// LanguageIDs lists the supported languages
+func LanguageIDs() []string {
+	ids := make([]string, 0, len(languages))
+	for id := range languages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ValidateSpec checks the code part of a task's answer spec
+func ValidateSpec(spec *models.AnswerSpec) error {
+	if spec == nil || len(spec.Tests) == 0 {
+		return fmt.Errorf("code tasks need at least one test in answer_spec.tests")
+	}
+	if len(spec.Tests) > MaxTests {
+		return fmt.Errorf("code tasks can have at most %d tests", MaxTests)
+	}
+	if spec.TimeLimitMS < 0 || spec.TimeLimitMS > MaxTimeLimitMS {
+		return fmt.Errorf("time_limit_ms must be between 1 and %d", MaxTimeLimitMS)
+	}
+	if spec.MemoryLimitMB < 0 || spec.MemoryLimitMB > MaxMemoryLimitMB {
+		return fmt.Errorf("memory_limit_mb must be between 1 and %d", MaxMemoryLimitMB)
+	}
+	for _, id := range spec.Languages {
+		if _, ok := languages[id]; !ok {
+			return fmt.Errorf("unknown language %q", id)
+		}
+	}
+	return nil
+}
+
+// Allows reports whether submissions in the language are accepted for the task
+func Allows(spec *models.AnswerSpec, lang string) bool {
+	if _, ok := languages[lang]; !ok {
+		return false
+	}
+	if len(spec.Languages) == 0 {
+		return true
+	}
+	for _, id := range spec.Languages {
+		if id == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// Submission is a program to judge against a task's tests
+type Submission struct {
+	Language      string
+	Source        string
+	Tests         []models.CodeTest
+	TimeLimit     time.Duration
+	MemoryLimitMB int
+}
+
+// NewSubmission builds a submission with the task's tests and limits
+func NewSubmission(spec *models.AnswerSpec, lang, source string) Submission {
+	s := Submission{
+		Language:      lang,
+		Source:        source,
+		Tests:         spec.Tests,
+		TimeLimit:     time.Duration(spec.TimeLimitMS) * time.Millisecond,
+		MemoryLimitMB: spec.MemoryLimitMB,
+	}
+	if s.TimeLimit <= 0 {
+		s.TimeLimit = DefaultTimeLimitMS * time.Millisecond
+	}
+	if s.MemoryLimitMB <= 0 {
+		s.MemoryLimitMB = DefaultMemoryLimitMB
+	}
+	return s
+}
+
+// TestResult is the outcome of one test
+type TestResult struct {
+	Test     int    `json:"test"`
+	Verdict  string `json:"verdict"`
+	TimeMS   int64  `json:"time_ms"`
+	MemoryKB int64  `json:"memory_kb"`
+}
+
+// Report is the outcome of judging a submission
+type Report struct {
+	// Verdict is OK if every test passed, otherwise the verdict of the first failed test
+	Verdict       string
+	Tests         []TestResult
+	Passed        int
+	CompileOutput string
+}
+
+// Score is the share of passed tests, 0-100
+func (r Report) Score() int {
+	if len(r.Tests) == 0 {
+		return 0
+	}
+	return r.Passed * 100 / len(r.Tests)
+}
+
+// Judge builds submissions in a scratch directory and runs them with a Runner
+type Judge struct {
+	Runner  Runner
+	WorkDir string // scratch directories are created here, os.TempDir() if empty
+}
+
+// Evaluate compiles the submission and runs it on every test. An error means
+// the judge itself failed, not the submission.
+func (j *Judge) Evaluate(ctx context.Context, s Submission) (Report, error) {
+	lang, ok := languages[s.Language]
+	if !ok {
+		return Report{}, fmt.Errorf("unknown language %q", s.Language)
+	}
+	if len(s.Source) > maxSourceBytes {
+		return Report{Verdict: VerdictCE, CompileOutput: "source code is too long"}, nil
+	}
+	dir, err := os.MkdirTemp(j.WorkDir, "judge-")
+	if err != nil {
+		return Report{}, err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, lang.Source), []byte(s.Source), 0o644); err != nil {
+		return Report{}, err
+	}
+
+	if lang.Compile != nil {
+		res, err := j.Runner.Run(ctx, RunRequest{Dir: dir, Args: lang.Compile, TimeLimit: compileTimeout})
+		if err != nil {
+			return Report{}, err
+		}
+		if res.ExitCode != 0 || res.TimedOut {
+			out := strings.TrimSpace(res.Stderr + "\n" + res.Stdout)
+			if res.TimedOut {
+				out = "compilation timed out"
+			}
+			return Report{Verdict: VerdictCE, CompileOutput: out}, nil
+		}
+	}
+
+	report := Report{Verdict: VerdictOK}
+	for i, t := range s.Tests {
+		res, err := j.Runner.Run(ctx, RunRequest{
+			Dir:           dir,
+			Args:          lang.Run,
+			Stdin:         t.Input,
+			TimeLimit:     s.TimeLimit,
+			MemoryLimitMB: s.MemoryLimitMB,
+		})
+		if err != nil {
+			return Report{}, err
+		}
+		tr := TestResult{Test: i + 1, Verdict: verdict(res, s, t.Output), TimeMS: res.CPUTime.Milliseconds(), MemoryKB: res.MemoryKB}
+		if tr.Verdict == VerdictOK {
+			report.Passed++
+		} else if report.Verdict == VerdictOK {
+			report.Verdict = tr.Verdict
+		}
+		report.Tests = append(report.Tests, tr)
+	}
+	return report, nil
+}
+
+func verdict(res RunResult, s Submission, expected string) string {
+	memLimitKB := int64(s.MemoryLimitMB) * 1024
+	switch {
+	case res.TimedOut || res.CPUTime > s.TimeLimit:
+		return VerdictTLE
+	case res.MemoryKB > memLimitKB:
+		return VerdictMLE
+	case res.ExitCode != 0:
+		// An allocation failing under the address space limit looks like a crash
+		if res.MemoryKB*10 >= memLimitKB*9 || outOfMemory(res.Stderr) {
+			return VerdictMLE
+		}
+		return VerdictRE
+	case res.OutputTruncated || !sameOutput(res.Stdout, expected):
+		return VerdictWA
+	}
+	return VerdictOK
+}
+
+var oomMessages = []string{"MemoryError", "bad_alloc", "out of memory", "Cannot allocate memory", "Heap Overflow"}
+
+func outOfMemory(stderr string) bool {
+	for _, m := range oomMessages {
+		if strings.Contains(stderr, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameOutput compares outputs token by token, so spacing and line breaks don't matter
+func sameOutput(got, want string) bool {
+	g, w := strings.Fields(got), strings.Fields(want)
+	if len(g) != len(w) {
+		return false
+	}
+	for i := range g {
+		if g[i] != w[i] {
+			return false
+		}
+	}
+	return true
+}
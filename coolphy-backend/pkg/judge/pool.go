@@ -0,0 +1,96 @@
+package judge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"coolphy-backend/internal/config"
+)
+
+// ErrUnavailable is returned when the judge isn't running or its queue is full
+var ErrUnavailable = errors.New("code judge is unavailable")
+
+// Job is a submission together with what to do with its report
+type Job struct {
+	Submission Submission
+	Done       func(Report, error)
+}
+
+// Pool judges submissions on a fixed number of workers
+type Pool struct {
+	judge *Judge
+	jobs  chan Job
+}
+
+// NewPool starts workers goroutines judging with j
+func NewPool(j *Judge, workers, queue int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &Pool{judge: j, jobs: make(chan Job, queue)}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *Pool) work() {
+	for job := range p.jobs {
+		report, err := p.judge.Evaluate(context.Background(), job.Submission)
+		if err != nil {
+			log.Printf("judge error: %v", err)
+		}
+		job.Done(report, err)
+	}
+}
+
+// Submit queues a job without blocking
+func (p *Pool) Submit(job Job) error {
+	select {
+	case p.jobs <- job:
+		return nil
+	default:
+		return ErrUnavailable
+	}
+}
+
+var pool *Pool
+
+// SandboxRunner returns the runner for untrusted input: code submissions,
+// and TeX, which can read and write files. It fails when JUDGE_ISOLATE is
+// off or the sandbox doesn't work here; callers then stay off.
+func SandboxRunner(cfg config.Config) (LocalRunner, error) {
+	runner := NewLocalRunner(cfg)
+	if !runner.Isolate {
+		return runner, errors.New("JUDGE_ISOLATE is false")
+	}
+	if err := runner.Check(); err != nil {
+		return runner, fmt.Errorf("the sandbox doesn't work here: %w", err)
+	}
+	return runner, nil
+}
+
+// Start runs the shared worker pool used by the handlers. Submissions are
+// untrusted code, so the judge stays off unless the sandbox works.
+func Start(cfg config.Config) {
+	runner, err := SandboxRunner(cfg)
+	if err != nil {
+		log.Printf("judge: %v, code submissions are disabled", err)
+		return
+	}
+	j := &Judge{Runner: runner, WorkDir: cfg.JudgeWorkDir}
+	pool = NewPool(j, cfg.JudgeWorkers, cfg.JudgeWorkers*32)
+}
+
+// Running reports whether the shared pool is judging submissions
+func Running() bool { return pool != nil }
+
+// Submit queues a job on the shared pool
+func Submit(job Job) error {
+	if pool == nil {
+		return ErrUnavailable
+	}
+	return pool.Submit(job)
+}
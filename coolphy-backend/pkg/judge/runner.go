@@ -0,0 +1,150 @@
+package judge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"coolphy-backend/internal/config"
+)
+
+// RunRequest is a single program run inside a scratch directory
+type RunRequest struct {
+	Dir           string
+	Args          []string
+	Stdin         string
+	TimeLimit     time.Duration
+	MemoryLimitMB int // 0 means no limit, used for compilers
+}
+
+// RunResult describes how the program finished
+type RunResult struct {
+	Stdout          string
+	Stderr          string
+	ExitCode        int
+	CPUTime         time.Duration
+	MemoryKB        int64 // peak resident set size
+	TimedOut        bool
+	OutputTruncated bool
+}
+
+// Runner executes programs in a sandbox. LocalRunner is the default; other
+// implementations can run them in containers or on a remote service.
+type Runner interface {
+	Run(ctx context.Context, req RunRequest) (RunResult, error)
+}
+
+const (
+	maxOutputBytes = 16 << 20
+	maxStderrBytes = 64 << 10
+	maxFileBytes   = 16 << 20
+	maxProcs       = 256 // processes and threads of one run
+)
+
+// LocalRunner runs programs on this machine. With Isolate, on Linux only,
+// each run is sandboxed in its own namespaces with a minimal read-only root
+// (see sandbox); memory, CPU time, file size and process count are capped
+// with rlimits and, given a delegated cgroup, with cgroup limits.
+type LocalRunner struct {
+	Isolate bool
+	UID     int      // host uid of sandboxed runs when the server is root, nobody if 0
+	Cgroup  string   // cgroup v2 directory for per-run groups, optional
+	Binds   []string // extra host paths visible read-only, e.g. a toolchain in /srv
+}
+
+// NewLocalRunner configures a runner from the JUDGE_* settings
+func NewLocalRunner(cfg config.Config) LocalRunner {
+	return LocalRunner{Isolate: cfg.JudgeIsolate, UID: cfg.JudgeUID, Cgroup: cfg.JudgeCgroup, Binds: cfg.JudgeBinds}
+}
+
+// Check runs a trivial program to see that the sandbox can be set up here
+func (r LocalRunner) Check() error {
+	dir, err := os.MkdirTemp("", "judge-check-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	res, err := r.Run(context.Background(), RunRequest{Dir: dir, Args: []string{"true"}, TimeLimit: 5 * time.Second})
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("exit code %d: %s", res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+	return nil
+}
+
+func (r LocalRunner) Run(ctx context.Context, req RunRequest) (RunResult, error) {
+	// Wall clock limit is generous so that a slow machine doesn't turn an
+	// accepted solution into TLE; CPU time is what gets compared to the limit
+	wall := 2*req.TimeLimit + time.Second
+	ctx, cancel := context.WithTimeout(ctx, wall)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", append([]string{"-c", limitScript(req), "sh"}, req.Args...)...)
+	cmd.Dir = req.Dir
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + req.Dir, "GOCACHE=" + req.Dir + "/.cache", "LANG=C.UTF-8"}
+	cmd.Stdin = strings.NewReader(req.Stdin)
+	stdout := &cappedBuffer{limit: maxOutputBytes}
+	stderr := &cappedBuffer{limit: maxStderrBytes}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	cmd.WaitDelay = time.Second
+	cleanup, err := r.sandbox(cmd, req)
+	if err != nil {
+		return RunResult{}, fmt.Errorf("sandbox: %w", err)
+	}
+	defer cleanup()
+
+	err = cmd.Run()
+	res := RunResult{
+		Stdout:          stdout.String(),
+		Stderr:          stderr.String(),
+		OutputTruncated: stdout.truncated,
+		TimedOut:        ctx.Err() == context.DeadlineExceeded,
+	}
+	if cmd.ProcessState == nil {
+		return res, fmt.Errorf("start %s: %w", req.Args[0], err)
+	}
+	res.ExitCode = cmd.ProcessState.ExitCode()
+	res.CPUTime = cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	res.MemoryKB = maxRSSKB(cmd.ProcessState)
+	return res, nil
+}
+
+// limitScript sets rlimits in the shell before exec-ing the program
+func limitScript(req RunRequest) string {
+	var b strings.Builder
+	cpu := int(req.TimeLimit/time.Second) + 1
+	fmt.Fprintf(&b, "ulimit -t %d; ulimit -f %d; ", cpu, maxFileBytes/512)
+	if req.MemoryLimitMB > 0 {
+		// Address space limit with headroom for the runtime's own mappings;
+		// the peak RSS is compared to the real limit afterwards
+		fmt.Fprintf(&b, "ulimit -v %d; ", (req.MemoryLimitMB+64)*1024)
+	}
+	b.WriteString(`exec "$@"`)
+	return b.String()
+}
+
+// cappedBuffer keeps at most limit bytes and silently drops the rest
+type cappedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.limit - b.Len(); room < len(p) {
+		b.truncated = true
+		if room <= 0 {
+			return n, nil
+		}
+		p = p[:room]
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
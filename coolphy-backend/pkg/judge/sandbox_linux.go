@@ -0,0 +1,425 @@
+//go:build linux
+
+package judge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// helperName is argv[0] of the server binary re-executed inside the new
+// namespaces to build the sandbox before it runs the program
+const helperName = "coolphy-sandbox"
+
+// Host paths visible read-only inside the sandbox: the toolchains and what
+// the dynamic loader, compilers and TeX read from /etc and /var
+var sandboxBinds = []string{
+	"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/libx32", "/opt",
+	"/etc/alternatives", "/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d",
+	"/etc/passwd", "/etc/group", "/etc/nsswitch.conf", "/etc/localtime",
+	"/etc/texmf", "/etc/fonts", "/etc/fpc.cfg", "/etc/fpc-*.cfg", "/etc/python3*",
+	"/var/lib/texmf", "/var/cache/fontconfig",
+}
+
+// boxSpec is what the helper needs to build the sandbox
+type boxSpec struct {
+	Root  string   // empty directory the new root is mounted on
+	Dir   string   // the run's scratch directory, the only writable host path
+	Binds []string // read-only host paths, globs allowed
+	NProc uint64
+}
+
+func init() {
+	if len(os.Args) < 3 || os.Args[0] != helperName {
+		return
+	}
+	// Capabilities and the bounding set are per thread: drop them on the
+	// thread that calls execve
+	runtime.LockOSThread()
+	var spec boxSpec
+	err := json.Unmarshal([]byte(os.Args[1]), &spec)
+	if err == nil {
+		err = enterSandbox(spec, os.Args[2:])
+	}
+	fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+	os.Exit(125)
+}
+
+// sandbox sets cmd up to run req. Without isolation the program only gets
+// its own process group. With it, the server binary is started again as
+// helperName in fresh user, mount, PID, network, IPC and UTS namespaces; it
+// pivots into a tmpfs root holding read-only binds of the toolchains, the
+// scratch directory, a private /tmp and a few devices, drops every
+// capability and execs the program. Killing the program, PID 1 of its
+// namespace, takes all its descendants with it. A server running as root
+// maps the sandbox to r.UID, so the program has no host privileges at all.
+func (r LocalRunner) sandbox(cmd *exec.Cmd, req RunRequest) (func(), error) {
+	if !r.Isolate {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+		cmd.Cancel = func() error {
+			return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+		return func() {}, nil
+	}
+
+	var undo []func()
+	cleanup := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}
+	fail := func(err error) (func(), error) {
+		cleanup()
+		return nil, err
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fail(err)
+	}
+	// Opened here and exec'd through /proc/self/fd, so the sandbox user needs
+	// no access to the directory the server is installed in
+	bin, err := os.Open(self)
+	if err != nil {
+		return fail(err)
+	}
+	undo = append(undo, func() { bin.Close() })
+	root, err := os.MkdirTemp("", "sandbox-")
+	if err != nil {
+		return fail(err)
+	}
+	undo = append(undo, func() { os.Remove(root) })
+
+	uid, gid := os.Getuid(), os.Getgid()
+	attr := &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+			syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		Pdeathsig:   syscall.SIGKILL,
+		Credential:  &syscall.Credential{Uid: 0, Gid: 0, NoSetGroups: true},
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: uid, Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: gid, Size: 1}},
+	}
+	if uid == 0 {
+		// Root may map any uid: the sandbox becomes r.UID with no
+		// supplementary groups, and gets the directories it writes to
+		host := r.sandboxUID()
+		attr.UidMappings[0].HostID, attr.GidMappings[0].HostID = host, host
+		attr.GidMappingsEnableSetgroups = true
+		attr.Credential = &syscall.Credential{Uid: 0, Gid: 0, Groups: []uint32{}}
+		for _, p := range []string{root, req.Dir} {
+			if err := chownTree(p, host); err != nil {
+				return fail(err)
+			}
+		}
+	}
+
+	if r.Cgroup != "" {
+		cg, err := newCgroup(r.Cgroup, req)
+		if err != nil {
+			return fail(err)
+		}
+		undo = append(undo, cg.remove)
+		attr.UseCgroupFD, attr.CgroupFD = true, int(cg.dir.Fd())
+		cmd.Cancel = func() error {
+			cg.kill()
+			return cmd.Process.Kill()
+		}
+	} else {
+		cmd.Cancel = func() error { return cmd.Process.Kill() }
+	}
+
+	spec, _ := json.Marshal(boxSpec{Root: root, Dir: req.Dir, Binds: append(sandboxBinds, r.Binds...), NProc: maxProcs})
+	cmd.Path = "/proc/self/fd/3"
+	cmd.Args = append([]string{helperName, string(spec)}, cmd.Args...)
+	cmd.ExtraFiles = []*os.File{bin}
+	cmd.SysProcAttr = attr
+	return cleanup, nil
+}
+
+func (r LocalRunner) sandboxUID() int {
+	if r.UID > 0 {
+		return r.UID
+	}
+	return 65534 // nobody
+}
+
+func chownTree(root string, uid int) error {
+	return filepath.Walk(root, func(p string, _ os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(p, uid, uid)
+	})
+}
+
+// enterSandbox runs in the helper as root of the new user namespace
+func enterSandbox(s boxSpec, args []string) error {
+	syscall.CloseOnExec(3)
+	if err := mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+	if err := mount("tmpfs", s.Root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "size=1m,mode=0755"); err != nil {
+		return err
+	}
+	for _, pattern := range s.Binds {
+		paths, _ := filepath.Glob(pattern)
+		for _, p := range paths {
+			if err := bindInto(s.Root, p, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	dev := filepath.Join(s.Root, "dev")
+	if err := os.Mkdir(dev, 0o755); err != nil {
+		return err
+	}
+	for _, d := range []string{"null", "zero", "full", "random", "urandom"} {
+		if err := bindInto(s.Root, "/dev/"+d, false); err != nil {
+			return err
+		}
+	}
+	for name, target := range map[string]string{"fd": "/proc/self/fd", "stdin": "/proc/self/fd/0", "stdout": "/proc/self/fd/1", "stderr": "/proc/self/fd/2"} {
+		if err := os.Symlink(target, filepath.Join(dev, name)); err != nil {
+			return err
+		}
+	}
+	tmp := filepath.Join(s.Root, "tmp")
+	if err := os.Mkdir(tmp, 0o755); err != nil {
+		return err
+	}
+	if err := mount("tmpfs", tmp, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "size=256m,mode=1777"); err != nil {
+		return err
+	}
+	proc := filepath.Join(s.Root, "proc")
+	if err := os.Mkdir(proc, 0o755); err != nil {
+		return err
+	}
+	// Fails where the host masks parts of /proc, e.g. in a container; the
+	// common toolchains run without it
+	_ = mount("proc", proc, "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "")
+	// After /tmp, which the scratch directory usually is in
+	if err := bindInto(s.Root, s.Dir, false); err != nil {
+		return err
+	}
+
+	old := filepath.Join(s.Root, ".old")
+	if err := os.Mkdir(old, 0o700); err != nil {
+		return err
+	}
+	if err := syscall.PivotRoot(s.Root, old); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := syscall.Chdir("/"); err != nil {
+		return err
+	}
+	if err := syscall.Unmount("/.old", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("unmount old root: %w", err)
+	}
+	if err := os.Remove("/.old"); err != nil {
+		return err
+	}
+	if err := mount("", "/", "", syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, ""); err != nil {
+		return err
+	}
+	if err := syscall.Chdir(s.Dir); err != nil {
+		return err
+	}
+
+	// Counted per user namespace since Linux 5.14, so it caps this run only
+	if err := syscall.Setrlimit(rlimitNproc, &syscall.Rlimit{Cur: s.NProc, Max: s.NProc}); err != nil {
+		return fmt.Errorf("rlimit nproc: %w", err)
+	}
+	if err := syscall.Setrlimit(rlimitCore, &syscall.Rlimit{}); err != nil {
+		return err
+	}
+	if err := dropCapabilities(); err != nil {
+		return err
+	}
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, args, os.Environ())
+}
+
+func mount(src, dst, fstype string, flags uintptr, data string) error {
+	if err := syscall.Mount(src, dst, fstype, flags, data); err != nil {
+		return fmt.Errorf("mount %s: %w", dst, err)
+	}
+	return nil
+}
+
+// Statfs flags of a mount, which a bind in a user namespace has to keep
+const (
+	stRdonly     = 0x1
+	stNosuid     = 0x2
+	stNodev      = 0x4
+	stNoexec     = 0x8
+	stNoatime    = 0x400
+	stNodiratime = 0x800
+	stRelatime   = 0x1000
+)
+
+// bindInto makes the host path src appear at the same path under root.
+// Symlinks are recreated rather than followed, so /bin -> usr/bin stays one.
+func bindInto(root, src string, readOnly bool) error {
+	fi, err := os.Lstat(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(root, src)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	case fi.IsDir():
+		if err := os.MkdirAll(dst, 0o755); err != nil {
+			return err
+		}
+	default:
+		f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	if err := mount(src, dst, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(src, &st); err != nil {
+		return err
+	}
+	flags := uintptr(syscall.MS_REMOUNT | syscall.MS_BIND | syscall.MS_NOSUID)
+	if fi.Mode()&os.ModeDevice == 0 {
+		flags |= syscall.MS_NODEV
+	}
+	if readOnly || st.Flags&stRdonly != 0 {
+		flags |= syscall.MS_RDONLY
+	}
+	for sf, ms := range map[int64]uintptr{stNodev: syscall.MS_NODEV, stNoexec: syscall.MS_NOEXEC, stNoatime: syscall.MS_NOATIME, stNodiratime: syscall.MS_NODIRATIME} {
+		if st.Flags&sf != 0 {
+			flags |= ms
+		}
+	}
+	if st.Flags&stRelatime == 0 && st.Flags&stNoatime == 0 {
+		flags |= syscall.MS_STRICTATIME
+	}
+	return mount("", dst, "", flags, "")
+}
+
+const (
+	rlimitNproc = 6 // RLIMIT_NPROC, missing from package syscall
+	rlimitCore  = 4 // RLIMIT_CORE
+
+	prSetNoNewPrivs      = 38
+	linuxCapabilityV3    = 0x20080522
+	capabilitySetEntries = 2
+)
+
+// dropCapabilities empties the bounding set, so that execve doesn't hand
+// the namespace root its capabilities back, and then clears the rest
+func dropCapabilities() error {
+	for c := uintptr(0); c < 64; c++ {
+		_, _, e := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_CAPBSET_DROP, c, 0)
+		if e == syscall.EINVAL {
+			break // past the last capability this kernel knows
+		}
+		if e != 0 {
+			return fmt.Errorf("dropping capability %d: %w", c, e)
+		}
+	}
+	if _, _, e := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); e != 0 {
+		return fmt.Errorf("no_new_privs: %w", e)
+	}
+	hdr := struct {
+		version uint32
+		pid     int32
+	}{version: linuxCapabilityV3}
+	var data [capabilitySetEntries]struct{ effective, permitted, inheritable uint32 }
+	if _, _, e := syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0); e != 0 {
+		return fmt.Errorf("capset: %w", e)
+	}
+	return nil
+}
+
+// cgroup is the cgroup v2 group of one run
+type cgroup struct {
+	path string
+	dir  *os.File
+}
+
+// newCgroup creates a group for the run under parent, a cgroup v2
+// directory delegated to the server, capping its tasks and memory
+func newCgroup(parent string, req RunRequest) (*cgroup, error) {
+	path, err := os.MkdirTemp(parent, "run-")
+	if err != nil {
+		return nil, fmt.Errorf("cgroup: %w", err)
+	}
+	cg := &cgroup{path: path}
+	limits := map[string]string{"pids.max": strconv.Itoa(maxProcs)}
+	if req.MemoryLimitMB > 0 {
+		limits["memory.max"] = strconv.Itoa((req.MemoryLimitMB + 64) << 20)
+		limits["memory.swap.max"] = "0"
+	}
+	for file, v := range limits {
+		err := os.WriteFile(filepath.Join(path, file), []byte(v), 0)
+		if err != nil && file != "memory.swap.max" {
+			cg.remove()
+			return nil, fmt.Errorf("cgroup: %s (are the pids and memory controllers enabled for %s?): %w", file, parent, err)
+		}
+	}
+	if cg.dir, err = os.Open(path); err != nil {
+		cg.remove()
+		return nil, fmt.Errorf("cgroup: %w", err)
+	}
+	return cg, nil
+}
+
+// kill ends every process in the group (Linux 5.14+)
+func (cg *cgroup) kill() {
+	_ = os.WriteFile(filepath.Join(cg.path, "cgroup.kill"), []byte("1"), 0)
+}
+
+func (cg *cgroup) remove() {
+	if cg.dir != nil {
+		cg.dir.Close()
+	}
+	cg.kill()
+	// The group can be removed once the kernel has reaped its last task
+	for i := 0; i < 50; i++ {
+		err := os.Remove(cg.path)
+		if err == nil || errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), "busy") {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func maxRSSKB(state *os.ProcessState) int64 {
+	if ru, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return ru.Maxrss // kilobytes on Linux
+	}
+	return 0
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package judge
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// sandbox has no isolation outside Linux; only the rlimits apply
+func (r LocalRunner) sandbox(cmd *exec.Cmd, req RunRequest) (func(), error) {
+	if r.Isolate {
+		return nil, errors.New("isolated runs need Linux")
+	}
+	return func() {}, nil
+}
+
+func maxRSSKB(state *os.ProcessState) int64 { return 0 }
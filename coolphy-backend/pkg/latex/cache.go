@@ -0,0 +1,51 @@
+package latex
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+)
+
+// cacheSize is how many rendered fragments are kept in memory
+const cacheSize = 2048
+
+type cacheEntry struct {
+	key  [sha256.Size]byte
+	html string
+}
+
+var cache = struct {
+	sync.Mutex
+	order *list.List // most recently used first
+	items map[[sha256.Size]byte]*list.Element
+}{order: list.New(), items: map[[sha256.Size]byte]*list.Element{}}
+
+// HTML is ToHTML with the result cached by the hash of the source, so
+// popular lectures are rendered once
+func HTML(src string) string {
+	if src == "" {
+		return ""
+	}
+	key := sha256.Sum256([]byte(src))
+	cache.Lock()
+	if el, ok := cache.items[key]; ok {
+		cache.order.MoveToFront(el)
+		cache.Unlock()
+		return el.Value.(*cacheEntry).html
+	}
+	cache.Unlock()
+
+	out := ToHTML(src)
+
+	cache.Lock()
+	defer cache.Unlock()
+	if _, ok := cache.items[key]; !ok {
+		cache.items[key] = cache.order.PushFront(&cacheEntry{key: key, html: out})
+		if cache.order.Len() > cacheSize {
+			oldest := cache.order.Back()
+			cache.order.Remove(oldest)
+			delete(cache.items, oldest.Value.(*cacheEntry).key)
+		}
+	}
+	return out
+}
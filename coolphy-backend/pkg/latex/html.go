@@ -0,0 +1,554 @@
+// Package latex turns the LaTeX of lectures and tasks into HTML with MathML
+// math, so clients, emails and previews don't need a TeX renderer of their
+// own.
+//
+// The output is built from a fixed set of tags and every piece of text is
+// escaped, so it is safe to embed as is. Macros the renderer doesn't know
+// are dropped and their arguments are rendered as text.
+package latex
+
+import (
+	"html"
+	"net/url"
+	"strings"
+)
+
+// DiagramURL, when set, gives the URL of the image compiled from a
+// tikzpicture environment (package tikz sets it). Without it diagrams render
+// as empty figures.
+var DiagramURL func(source string) string
+
+// ToHTML renders a LaTeX fragment, such as the body of a lecture
+func ToHTML(src string) string {
+	r := &renderer{}
+	r.render(stripComments(src))
+	r.closePara()
+	return r.out.String()
+}
+
+type renderer struct {
+	out    strings.Builder
+	inPara bool
+	// inline is set inside headings, list items and table cells, which
+	// can't hold paragraphs
+	inline bool
+}
+
+func (r *renderer) openPara() {
+	if !r.inPara && !r.inline {
+		r.out.WriteString("<p>")
+		r.inPara = true
+	}
+}
+
+func (r *renderer) closePara() {
+	if r.inPara {
+		r.out.WriteString("</p>")
+		r.inPara = false
+	}
+}
+
+// block starts a block element, which ends the current paragraph
+func (r *renderer) block(s string) {
+	r.closePara()
+	r.out.WriteString(s)
+}
+
+func (r *renderer) text(s string) {
+	if s == "" {
+		return
+	}
+	if strings.TrimSpace(s) != "" {
+		r.openPara()
+	} else if !r.inPara {
+		return
+	}
+	r.out.WriteString(html.EscapeString(s))
+}
+
+func (r *renderer) raw(s string) {
+	r.openPara()
+	r.out.WriteString(s)
+}
+
+// sub renders src on its own, inline or as blocks
+func sub(src string, inline bool) string {
+	r := &renderer{inline: inline}
+	r.render(src)
+	r.closePara()
+	return r.out.String()
+}
+
+func (r *renderer) render(s string) {
+	var text strings.Builder
+	flush := func() {
+		r.text(text.String())
+		text.Reset()
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\n' && blankLineAt(s, i):
+			flush()
+			r.closePara()
+			for i < len(s) && (s[i] == '\n' || s[i] == ' ' || s[i] == '\t' || s[i] == '\r') {
+				i++
+			}
+		case strings.HasPrefix(s[i:], "$$"):
+			flush()
+			end := indexUnescaped(s, "$$", i+2)
+			r.displayMath(s[i+2 : end])
+			i = min(end+2, len(s))
+		case c == '$':
+			flush()
+			end := indexUnescaped(s, "$", i+1)
+			r.raw(MathML(s[i+1:end], false))
+			i = min(end+1, len(s))
+		case strings.HasPrefix(s[i:], `\(`):
+			flush()
+			end := indexUnescaped(s, `\)`, i+2)
+			r.raw(MathML(s[i+2:end], false))
+			i = min(end+2, len(s))
+		case strings.HasPrefix(s[i:], `\[`):
+			flush()
+			end := indexUnescaped(s, `\]`, i+2)
+			r.displayMath(s[i+2 : end])
+			i = min(end+2, len(s))
+		case c == '\\':
+			flush()
+			i = r.command(s, i)
+		case c == '{':
+			flush()
+			end := matchBrace(s, i)
+			r.render(s[i+1 : end])
+			i = min(end+1, len(s))
+		case c == '}':
+			i++
+		case c == '~':
+			text.WriteString(" ")
+			i++
+		case strings.HasPrefix(s[i:], "---"):
+			text.WriteString("—")
+			i += 3
+		case strings.HasPrefix(s[i:], "--"):
+			text.WriteString("–")
+			i += 2
+		case strings.HasPrefix(s[i:], "``"):
+			text.WriteString("“")
+			i += 2
+		case strings.HasPrefix(s[i:], "''"):
+			text.WriteString("”")
+			i += 2
+		default:
+			text.WriteByte(c)
+			i++
+		}
+	}
+	flush()
+}
+
+func (r *renderer) displayMath(src string) {
+	if r.inline {
+		r.out.WriteString(MathML(src, true))
+		return
+	}
+	r.block(`<div class="math-display">` + MathML(src, true) + "</div>")
+}
+
+// Text commands and the elements they become
+var textStyles = map[string]string{
+	"textbf": "strong", "bf": "strong", "textit": "em", "emph": "em", "textsl": "em", "it": "em",
+	"underline": "u", "texttt": "code", "textsuperscript": "sup", "textsubscript": "sub",
+}
+
+var headings = map[string]string{
+	"chapter": "h2", "section": "h2", "subsection": "h3", "subsubsection": "h4", "paragraph": "h5",
+}
+
+var textSymbols = map[string]string{
+	"%": "%", "$": "$", "&": "&", "#": "#", "_": "_", "{": "{", "}": "}", " ": " ",
+	",": " ", ";": " ", ":": " ", "quad": " ", "qquad": "  ",
+	"ldots": "…", "dots": "…", "textbackslash": `\`, "S": "§", "P": "¶", "copyright": "©",
+	"LaTeX": "LaTeX", "TeX": "TeX", "textendash": "–", "textemdash": "—", "textdegree": "°",
+	"guillemotleft": "«", "guillemotright": "»", "No": "№",
+}
+
+// Commands whose arguments are dropped along with them
+var droppedWithArgs = map[string]int{
+	"label": 1, "ref": 1, "eqref": 1, "cite": 1, "index": 1, "vspace": 1, "hspace": 1,
+	"includegraphics": 1, "input": 1, "include": 1, "usepackage": 1, "documentclass": 1,
+	"newcommand": 2, "renewcommand": 2, "setlength": 2, "title": 1, "author": 1, "date": 1,
+	"pagestyle": 1, "thispagestyle": 1, "write": 0, "immediate": 0,
+}
+
+// command renders the command at s[i] and returns the index after it
+func (r *renderer) command(s string, i int) int {
+	i++
+	if i >= len(s) {
+		return i
+	}
+	start := i
+	for i < len(s) && isLetter(s[i]) {
+		i++
+	}
+	if i == start {
+		// Control symbol
+		c := s[i : i+1]
+		i++
+		switch {
+		case c == `\`:
+			r.raw("<br>")
+			i = skipOptional(s, i)
+		case textSymbols[c] != "":
+			r.text(textSymbols[c])
+		}
+		return i
+	}
+	name := s[start:i]
+	if i < len(s) && s[i] == '*' {
+		i++
+	}
+	arg := func() string {
+		var a string
+		a, i = readArg(s, i)
+		return a
+	}
+
+	if tag, ok := headings[name]; ok {
+		i = skipOptional(s, i)
+		r.block("<" + tag + ">" + sub(arg(), true) + "</" + tag + ">")
+		return i
+	}
+	if tag, ok := textStyles[name]; ok {
+		if name == "bf" || name == "it" {
+			// Old style switches apply to the rest of the group
+			r.raw("<" + tag + ">" + sub(s[i:], true) + "</" + tag + ">")
+			return len(s)
+		}
+		r.raw("<" + tag + ">" + sub(arg(), true) + "</" + tag + ">")
+		return i
+	}
+	if v, ok := textSymbols[name]; ok {
+		r.text(v)
+		return skipEmptyGroup(s, i)
+	}
+	if n, ok := droppedWithArgs[name]; ok {
+		for ; n > 0; n-- {
+			i = skipOptional(s, i)
+			arg()
+		}
+		return i
+	}
+
+	switch name {
+	case "begin":
+		env := arg()
+		return r.environment(s, i, env)
+	case "end":
+		arg()
+	case "newline", "linebreak":
+		r.raw("<br>")
+	case "par":
+		r.closePara()
+	case "href":
+		target, label := arg(), arg()
+		r.link(target, sub(label, true))
+	case "url":
+		target := arg()
+		r.link(target, html.EscapeString(target))
+	case "footnote":
+		r.raw(`<span class="footnote">(` + sub(arg(), true) + ")</span>")
+	case "caption":
+		i = skipOptional(s, i)
+		r.block(`<p class="caption">` + sub(arg(), true) + "</p>")
+	case "item":
+		// Outside a list
+		i = skipOptional(s, i)
+		r.text("• ")
+	}
+	// Anything else is dropped, its arguments render as plain groups
+	return i
+}
+
+// link writes an anchor for http(s) and mailto targets and just the label
+// for anything else, such as javascript: URLs
+func (r *renderer) link(target, label string) {
+	if SafeURL(target) {
+		r.raw(`<a href="` + html.EscapeString(strings.TrimSpace(target)) + `" rel="nofollow noopener" target="_blank">` + label + "</a>")
+		return
+	}
+	r.raw(label)
+}
+
+// SafeURL reports whether a link target may be put into an href
+func SafeURL(target string) bool {
+	u, err := url.Parse(strings.TrimSpace(target))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return true
+	}
+	return false
+}
+
+// Math environments rendered as display math
+var mathEnvironments = map[string]bool{
+	"equation": true, "equation*": true, "align": true, "align*": true, "gather": true,
+	"gather*": true, "multline": true, "multline*": true, "displaymath": true, "eqnarray": true,
+	"eqnarray*": true, "alignat": true, "alignat*": true, "flalign": true, "flalign*": true,
+}
+
+// environment renders the environment whose body starts at s[i] and
+// returns the index after its \end
+func (r *renderer) environment(s string, i int, name string) int {
+	var body string
+	endTag := `\end{` + name + `}`
+	if name == "verbatim" || name == "lstlisting" || name == "minted" {
+		// No nesting and no markup inside
+		end := strings.Index(s[i:], endTag)
+		if end < 0 {
+			end = len(s) - i
+		}
+		body = s[i : i+end]
+		if name == "minted" {
+			_, n := readArg(body, skipOptional(body, 0))
+			body = body[n:]
+		} else {
+			body = body[skipOptional(body, 0):]
+		}
+		r.block("<pre><code>" + html.EscapeString(strings.Trim(body, "\n")) + "</code></pre>")
+		return min(i+end+len(endTag), len(s))
+	}
+	end := findEnd(s[i:], name)
+	next := len(s)
+	if end < 0 {
+		body = s[i:]
+	} else {
+		body = s[i : i+end]
+		next = i + end + len(endTag)
+	}
+
+	switch {
+	case mathEnvironments[name]:
+		if strings.HasPrefix(name, "alignat") {
+			_, n := readArg(body, 0)
+			body = body[n:]
+		}
+		r.displayMath(body)
+	case name == "itemize" || name == "enumerate" || name == "description":
+		r.list(name, body)
+	case name == "center" || name == "flushleft" || name == "flushright":
+		r.block(`<div class="` + name + `">` + sub(body, false) + "</div>")
+	case name == "quote" || name == "quotation" || name == "abstract":
+		r.block("<blockquote>" + sub(body, false) + "</blockquote>")
+	case name == "figure" || name == "figure*" || name == "table" || name == "table*" || name == "wrapfigure":
+		if name == "wrapfigure" {
+			_, n := readArg(body, skipOptional(body, 0))
+			_, n = readArg(body, skipOptional(body, n))
+			body = body[n:]
+		} else {
+			body = body[skipOptional(body, 0):]
+		}
+		r.block("<figure>" + sub(body, false) + "</figure>")
+	case name == "tabular" || name == "tabular*" || name == "tabularx" || name == "array":
+		r.table(name, body)
+	case name == "tikzpicture":
+		if DiagramURL == nil {
+			r.block(`<figure class="tikz"></figure>`)
+			break
+		}
+		source := `\begin{tikzpicture}` + body + endTag
+		r.block(`<figure class="tikz"><img src="` + html.EscapeString(DiagramURL(source)) + `" alt="diagram"></figure>`)
+	default:
+		r.render(body)
+	}
+	return next
+}
+
+func (r *renderer) list(name, body string) {
+	tag := "ul"
+	if name == "enumerate" {
+		tag = "ol"
+	}
+	var b strings.Builder
+	b.WriteString("<" + tag + ">")
+	for n, item := range splitItems(body) {
+		if n == 0 {
+			// Text before the first \item
+			continue
+		}
+		var label string
+		if strings.HasPrefix(item, "[") {
+			if end := strings.IndexByte(item, ']'); end > 0 {
+				label, item = item[1:end], item[end+1:]
+			}
+		}
+		b.WriteString("<li>")
+		if label != "" {
+			b.WriteString("<strong>" + sub(label, true) + "</strong> ")
+		}
+		b.WriteString(strings.TrimSpace(sub(item, true)))
+		b.WriteString("</li>")
+	}
+	b.WriteString("</" + tag + ">")
+	r.block(b.String())
+}
+
+func (r *renderer) table(name, body string) {
+	if name == "tabular*" || name == "tabularx" {
+		_, n := readArg(body, 0)
+		body = body[n:]
+	}
+	_, n := readArg(body, skipOptional(body, 0))
+	body = body[n:]
+	var b strings.Builder
+	b.WriteString("<table>")
+	for _, row := range splitTop(body, `\\`) {
+		for _, rule := range []string{`\hline`, `\toprule`, `\midrule`, `\bottomrule`} {
+			row = strings.ReplaceAll(row, rule, "")
+		}
+		if strings.TrimSpace(row) == "" {
+			continue
+		}
+		b.WriteString("<tr>")
+		for _, cell := range splitTop(row, "&") {
+			b.WriteString("<td>" + strings.TrimSpace(sub(cell, true)) + "</td>")
+		}
+		b.WriteString("</tr>")
+	}
+	b.WriteString("</table>")
+	r.block(b.String())
+}
+
+// splitItems splits a list body at its own \item commands
+func splitItems(s string) []string {
+	var parts []string
+	depth, envs, last := 0, 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '\\':
+			switch {
+			case strings.HasPrefix(s[i:], `\item`) && !isLetterAt(s, i+5) && depth == 0 && envs == 0:
+				parts = append(parts, s[last:i])
+				last = i + 5
+			case strings.HasPrefix(s[i:], `\begin{`):
+				envs++
+			case strings.HasPrefix(s[i:], `\end{`):
+				envs--
+			}
+			i++
+		}
+	}
+	return append(parts, s[last:])
+}
+
+// readArg reads the braced argument at s[i], skipping spaces before it, or a
+// single character if there are no braces. It returns the argument and the
+// index after it.
+func readArg(s string, i int) (string, int) {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\n' || s[i] == '\t' || s[i] == '\r') {
+		i++
+	}
+	if i >= len(s) {
+		return "", i
+	}
+	if s[i] == '{' {
+		end := matchBrace(s, i)
+		return s[i+1 : end], min(end+1, len(s))
+	}
+	if s[i] == '\\' {
+		j := i + 1
+		for j < len(s) && isLetter(s[j]) {
+			j++
+		}
+		if j == i+1 && j < len(s) {
+			j++
+		}
+		return s[i:j], j
+	}
+	_, size := decodeRune(s[i:])
+	return s[i : i+size], i + size
+}
+
+// skipOptional skips an [optional] argument at s[i]
+func skipOptional(s string, i int) int {
+	j := i
+	for j < len(s) && (s[j] == ' ' || s[j] == '\n') {
+		j++
+	}
+	if j < len(s) && s[j] == '[' {
+		if end := strings.IndexByte(s[j:], ']'); end >= 0 {
+			return j + end + 1
+		}
+	}
+	return i
+}
+
+func skipEmptyGroup(s string, i int) int {
+	if strings.HasPrefix(s[i:], "{}") {
+		return i + 2
+	}
+	return i
+}
+
+func blankLineAt(s string, i int) bool {
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\n':
+			return true
+		case ' ', '\t', '\r':
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// indexUnescaped finds delim at or after from, not preceded by a
+// backslash, or returns len(s)
+func indexUnescaped(s, delim string, from int) int {
+	for i := from; i <= len(s)-len(delim); i++ {
+		if s[i] == '\\' && !strings.HasPrefix(s[i:], delim) {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], delim) {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// stripComments removes % comments, keeping \%
+func stripComments(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			b.WriteByte(s[i])
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '%':
+			// Keep the newline so a blank line after a comment still ends the paragraph
+			for i+1 < len(s) && s[i+1] != '\n' {
+				i++
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
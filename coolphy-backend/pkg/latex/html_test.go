@@ -0,0 +1,61 @@
+package latex
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+		not  []string
+	}{
+		{name: "section", src: `\section{Intro}`, want: []string{"<h2>Intro</h2>"}},
+		{name: "bold", src: `\textbf{bold}`, want: []string{"<strong>bold</strong>"}},
+		{name: "paragraphs", src: "one\n\ntwo", want: []string{"<p>one</p><p>two</p>"}},
+		{name: "inline math", src: `$x^2$`, want: []string{"<math", "<msup>"}, not: []string{`display="block"`}},
+		{name: "display math", src: `\[x\]`, want: []string{`display="block"`}},
+		{name: "align", src: `\begin{align} a &= b \end{align}`, want: []string{`display="block"`, "<mtable"}},
+		{name: "list", src: `\begin{itemize}\item one \item two\end{itemize}`, want: []string{"<ul><li>one</li><li>two</li></ul>"}},
+		{name: "table", src: `\begin{tabular}{ll} a & b \\ \hline c & d \end{tabular}`, want: []string{"<td>a</td><td>b</td>", "<td>c</td><td>d</td>"}},
+		{name: "link", src: `\href{https://example.com}{site}`, want: []string{`<a href="https://example.com" rel="nofollow noopener" target="_blank">site</a>`}},
+		{name: "script link", src: `\href{javascript:alert(1)}{site}`, want: []string{"site"}, not: []string{"<a", "javascript"}},
+		{name: "html", src: `<script>alert(1)</script>`, want: []string{"&lt;script&gt;"}, not: []string{"<script>"}},
+		{name: "comment", src: "shown % hidden", want: []string{"shown"}, not: []string{"hidden"}},
+		{name: "verbatim", src: `\begin{verbatim}<b>\textbf{x}</b>\end{verbatim}`, want: []string{`<pre><code>&lt;b&gt;\textbf{x}&lt;/b&gt;</code></pre>`}},
+		{name: "unclosed", src: `\begin{center}text`, want: []string{`<div class="center">`, "text"}},
+	}
+	for _, tt := range tests {
+		got := ToHTML(tt.src)
+		for _, w := range tt.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s: ToHTML(%q) = %s, want it to contain %s", tt.name, tt.src, got, w)
+			}
+		}
+		for _, n := range tt.not {
+			if strings.Contains(got, n) {
+				t.Errorf("%s: ToHTML(%q) = %s, must not contain %s", tt.name, tt.src, got, n)
+			}
+		}
+	}
+}
+
+func TestSafeURL(t *testing.T) {
+	for target, want := range map[string]bool{
+		"https://example.com/a": true,
+		"http://example.com":    true,
+		"mailto:a@example.com":  true,
+		" https://example.com ": true,
+		"javascript:alert(1)":   false,
+		"JavaScript:alert(1)":   false,
+		"data:text/html,x":      false,
+		"//example.com":         false,
+		"https:relative":        false,
+	} {
+		if got := SafeURL(target); got != want {
+			t.Errorf("SafeURL(%q) = %v, want %v", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package latex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Issue severities. Errors block saving, warnings are informational.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Issue is a problem found by Lint. Line and Column are 1-based, the column
+// counts characters rather than bytes.
+type Issue struct {
+	Field    string `json:"field,omitempty"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+// Commands that read or write files, run programs or redefine the parser.
+// They do nothing in the HTML renderer but would run in a real TeX engine.
+var forbiddenCommands = map[string]bool{
+	"input": true, "include": true, "InputIfFileExists": true, "openin": true, "openout": true,
+	"read": true, "readline": true, "write": true, "immediate": true, "catcode": true,
+	"csname": true, "special": true, "directlua": true, "latelua": true, "luaexec": true,
+	"verbatiminput": true, "lstinputlisting": true, "usepackage": true, "RequirePackage": true,
+	"documentclass": true,
+}
+
+// Commands the renderers handle outside of their lookup tables
+var knownCommands = map[string]bool{
+	"begin": true, "end": true, "newline": true, "linebreak": true, "par": true, "href": true,
+	"url": true, "footnote": true, "caption": true, "item": true, "frac": true, "dfrac": true,
+	"tfrac": true, "cfrac": true, "binom": true, "sqrt": true, "text": true, "textrm": true,
+	"mbox": true, "operatorname": true, "left": true, "right": true, "big": true, "Big": true,
+	"bigg": true, "Bigg": true, "bigl": true, "bigr": true, "Bigl": true, "Bigr": true,
+	"underbrace": true, "overbrace": true, "not": true, "displaystyle": true, "textstyle": true,
+	"limits": true, "nolimits": true, "nonumber": true, "notag": true, "tag": true, "hline": true,
+	"newcommand": true, "renewcommand": true, "def": true, "let": true,
+	// Layout commands that are dropped without harm
+	"noindent": true, "centering": true, "indent": true, "maketitle": true, "small": true,
+	"footnotesize": true, "scriptsize": true, "tiny": true, "normalsize": true, "large": true,
+	"Large": true, "LARGE": true, "huge": true, "Huge": true, "smallskip": true, "medskip": true,
+	"bigskip": true, "hfill": true, "vfill": true, "newpage": true, "clearpage": true,
+	"pagebreak": true, "textsc": true, "textsf": true, "textup": true, "textnormal": true,
+	"multicolumn": true, "toprule": true, "midrule": true, "bottomrule": true, "cline": true,
+	"scriptstyle": true, "phantom": true, "mathstrut": true, "boxed": true, "fbox": true,
+}
+
+// Environments the renderers handle
+var knownEnvironments = map[string]bool{
+	"verbatim": true, "lstlisting": true, "minted": true, "itemize": true, "enumerate": true,
+	"description": true, "center": true, "flushleft": true, "flushright": true, "quote": true,
+	"quotation": true, "abstract": true, "figure": true, "figure*": true, "table": true,
+	"table*": true, "wrapfigure": true, "tabular": true, "tabular*": true, "tabularx": true,
+	"array": true, "tikzpicture": true, "matrix": true, "pmatrix": true, "bmatrix": true,
+	"vmatrix": true, "Bmatrix": true, "cases": true, "aligned": true, "split": true,
+	"gathered": true, "minipage": true,
+}
+
+func knownCommand(name string) bool {
+	if knownCommands[name] || mathFunctions[name] {
+		return true
+	}
+	for _, m := range []map[string]string{textStyles, headings, textSymbols, mathIdentifiers,
+		mathOperators, mathLargeOperators, mathAccents, mathVariants, mathSpaces} {
+		if _, ok := m[name]; ok {
+			return true
+		}
+	}
+	_, ok := droppedWithArgs[name]
+	return ok
+}
+
+// HasErrors reports whether any of the issues blocks saving
+func HasErrors(issues []Issue) bool {
+	for _, is := range issues {
+		if is.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// opener is a brace, math delimiter or \begin waiting to be closed
+type opener struct {
+	token, close, code string
+	pos                int
+}
+
+type linter struct {
+	src    string
+	stack  []opener
+	macros map[string]bool // defined with \newcommand or \def
+	issues []Issue
+	pos    []int // byte offset of each issue
+}
+
+// Lint checks a piece of LaTeX content for unbalanced braces, math and
+// environments, unknown commands, file and shell access and unsafe links.
+// Issues are sorted by position.
+func Lint(src string) []Issue {
+	l := &linter{src: src, macros: map[string]bool{}}
+	l.run()
+	for _, o := range l.stack {
+		l.unclosed(o)
+	}
+	lines := lineStarts(src)
+	for k := range l.issues {
+		l.issues[k].Line, l.issues[k].Column = position(src, lines, l.pos[k])
+	}
+	sort.SliceStable(l.issues, func(a, b int) bool {
+		ia, ib := l.issues[a], l.issues[b]
+		return ia.Line < ib.Line || ia.Line == ib.Line && ia.Column < ib.Column
+	})
+	return l.issues
+}
+
+func (l *linter) add(pos int, severity, code, format string, args ...any) {
+	l.issues = append(l.issues, Issue{Severity: severity, Code: code, Message: fmt.Sprintf(format, args...)})
+	l.pos = append(l.pos, pos)
+}
+
+func (l *linter) push(token, close, code string, pos int) {
+	l.stack = append(l.stack, opener{token: token, close: close, code: code, pos: pos})
+}
+
+func (l *linter) unclosed(o opener) {
+	l.add(o.pos, SeverityError, o.code, "%s is never closed with %s", o.token, o.close)
+}
+
+// closeWith pops the innermost opener closed by token. Anything opened after
+// it is reported as unclosed.
+func (l *linter) closeWith(token, code string, pos int) {
+	for j := len(l.stack) - 1; j >= 0; j-- {
+		if l.stack[j].close != token {
+			continue
+		}
+		for _, o := range l.stack[j+1:] {
+			l.unclosed(o)
+		}
+		l.stack = l.stack[:j]
+		return
+	}
+	l.add(pos, SeverityError, code, "%s has nothing to close", token)
+}
+
+// toggle opens or closes $ and $$ math
+func (l *linter) toggle(token string, pos int) {
+	if n := len(l.stack); n > 0 && l.stack[n-1].token == token {
+		l.stack = l.stack[:n-1]
+		return
+	}
+	l.push(token, token, "unclosed_math", pos)
+}
+
+func (l *linter) inTikz() bool {
+	for _, o := range l.stack {
+		if o.token == `\begin{tikzpicture}` {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *linter) run() {
+	s := l.src
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '%':
+			if end := strings.IndexByte(s[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(s)
+			}
+		case '{':
+			l.push("{", "}", "unbalanced_brace", i)
+			i++
+		case '}':
+			l.closeWith("}", "unbalanced_brace", i)
+			i++
+		case '$':
+			if strings.HasPrefix(s[i:], "$$") {
+				l.toggle("$$", i)
+				i += 2
+			} else {
+				l.toggle("$", i)
+				i++
+			}
+		case '\\':
+			i = l.command(i)
+		default:
+			i++
+		}
+	}
+}
+
+// arg reads the braced argument at s[i]. ok is false if there is none or
+// it is never closed, in which case scanning goes on from i.
+func (l *linter) arg(i int) (arg string, next int, ok bool) {
+	j := i
+	for j < len(l.src) && (l.src[j] == ' ' || l.src[j] == '\n' || l.src[j] == '\t' || l.src[j] == '\r') {
+		j++
+	}
+	if j >= len(l.src) || l.src[j] != '{' {
+		return "", i, false
+	}
+	end := matchBrace(l.src, j)
+	if end >= len(l.src) {
+		return "", i, false
+	}
+	return l.src[j+1 : end], end + 1, true
+}
+
+// command checks the command at s[i] and returns the index to go on from
+func (l *linter) command(i int) int {
+	s := l.src
+	j := i + 1
+	if j >= len(s) {
+		return j
+	}
+	if !isLetter(s[j]) {
+		switch s[j] {
+		case '(':
+			l.push(`\(`, `\)`, "unclosed_math", i)
+		case '[':
+			l.push(`\[`, `\]`, "unclosed_math", i)
+		case ')', ']':
+			l.closeWith(s[i:j+1], "unclosed_math", i)
+		}
+		_, size := decodeRune(s[j:])
+		return j + size
+	}
+	for j < len(s) && isLetter(s[j]) {
+		j++
+	}
+	name := s[i+1 : j]
+	if j < len(s) && s[j] == '*' {
+		j++
+	}
+
+	switch {
+	case forbiddenCommands[name]:
+		l.add(i, SeverityError, "forbidden_command", `\%s is not allowed in content`, name)
+		return j
+	case name == "begin":
+		env, next, ok := l.arg(j)
+		if !ok {
+			l.add(i, SeverityError, "unclosed_environment", `\begin needs an environment name in braces`)
+			return j
+		}
+		if env == "verbatim" || env == "lstlisting" || env == "minted" {
+			// The body is not LaTeX
+			endTag := `\end{` + env + `}`
+			end := strings.Index(s[next:], endTag)
+			if end < 0 {
+				l.add(i, SeverityError, "unclosed_environment", `\begin{%s} is never closed with %s`, env, endTag)
+				return len(s)
+			}
+			return next + end + len(endTag)
+		}
+		if !knownEnvironments[env] && !mathEnvironments[env] && !l.inTikz() {
+			l.add(i, SeverityWarning, "unknown_environment", "environment %s is not supported and renders as plain text", env)
+		}
+		l.push(`\begin{`+env+`}`, `\end{`+env+`}`, "unclosed_environment", i)
+		return next
+	case name == "end":
+		env, next, ok := l.arg(j)
+		if !ok {
+			l.add(i, SeverityError, "unclosed_environment", `\end needs an environment name in braces`)
+			return j
+		}
+		l.closeWith(`\end{`+env+`}`, "unclosed_environment", i)
+		return next
+	case name == "href" || name == "url":
+		target, next, ok := l.arg(j)
+		if !ok {
+			return j
+		}
+		if !SafeURL(target) {
+			l.add(i, SeverityError, "unsafe_link", "link target %q must be an http(s) or mailto URL", strings.TrimSpace(target))
+		}
+		// The href label is scanned as usual
+		return next
+	case name == "newcommand" || name == "renewcommand" || name == "def" || name == "let":
+		def, _ := readArg(s, j)
+		if strings.HasPrefix(def, `\`) {
+			l.macros[def[1:]] = true
+		}
+		if !l.inTikz() {
+			l.add(i, SeverityWarning, "custom_macro", `\%s definitions are not expanded when rendering`, name)
+		}
+		return j
+	case !knownCommand(name) && !l.macros[name] && !l.inTikz():
+		l.add(i, SeverityWarning, "unknown_macro", `unknown command \%s`, name)
+	}
+	return j
+}
+
+// lineStarts returns the byte offset at which each line of s starts
+func lineStarts(s string) []int {
+	starts := []int{0}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+func position(s string, lines []int, pos int) (line, column int) {
+	n := sort.Search(len(lines), func(k int) bool { return lines[k] > pos })
+	return n, utf8.RuneCountInString(s[lines[n-1]:pos]) + 1
+}
@@ -0,0 +1,71 @@
+package latex
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// issues lists the issues as "line:column severity code"
+func issues(src string) []string {
+	out := []string{}
+	for _, is := range Lint(src) {
+		out = append(out, fmt.Sprintf("%d:%d %s %s", is.Line, is.Column, is.Severity, is.Code))
+	}
+	return out
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"clean", `Speed $v = \frac{s}{t}$, see \textbf{Fig. 1} and \href{https://example.com}{this}.`, nil},
+		{"display math", "$$E = mc^2$$ and \\[ a^2 \\] and \\( b \\)", nil},
+		{"comment hides everything", "ok % \\input{x} { $", nil},
+		{"escaped characters", `100\% of \$5 costs \{x\}`, nil},
+		{"unclosed brace", `\textbf{bold`, []string{"1:8 error unbalanced_brace"}},
+		{"extra brace", "a}\nb", []string{"1:2 error unbalanced_brace"}},
+		{"unclosed math", "cost $5", []string{"1:6 error unclosed_math"}},
+		{"unclosed display", `\[ x`, []string{"1:1 error unclosed_math"}},
+		{"stray close", `x \)`, []string{"1:3 error unclosed_math"}},
+		{"crossed", `$\begin{cases} x$ \end{cases}`, []string{"1:1 error unclosed_math", "1:17 error unclosed_math"}},
+		{"unclosed environment", "\\begin{itemize}\n\\item a", []string{"1:1 error unclosed_environment"}},
+		{"environment name", `\begin x`, []string{"1:1 error unclosed_environment"}},
+		{"verbatim body", "\\begin{verbatim}\n{ $ \\input\n\\end{verbatim}", nil},
+		{"unclosed verbatim", `\begin{verbatim} {`, []string{"1:1 error unclosed_environment"}},
+		{"forbidden", "line\n  \\input{/etc/passwd} \\write18{rm}", []string{"2:3 error forbidden_command", "2:23 error forbidden_command"}},
+		{"forbidden in math", `$\immediate$`, []string{"1:2 error forbidden_command"}},
+		{"javascript link", `\href{javascript:alert(1)}{x}`, []string{"1:1 error unsafe_link"}},
+		{"url", `\url{ftp://example.com}`, []string{"1:1 error unsafe_link"}},
+		{"mailto", `\href{mailto:a@example.com}{mail}`, nil},
+		{"unknown macro", `\foo{x}`, []string{"1:1 warning unknown_macro"}},
+		{"user macro", `\newcommand{\vv}{\vec v} $\vv$`, []string{"1:1 warning custom_macro"}},
+		{"unknown environment", `\begin{theorem}x\end{theorem}`, []string{"1:1 warning unknown_environment"}},
+		{"tikz", `\begin{tikzpicture}\draw (0,0) -- (1,1); \begin{scope}\end{scope}\end{tikzpicture}`, nil},
+		{"columns count characters", "ёжик $x", []string{"1:6 error unclosed_math"}},
+	}
+	for _, tt := range tests {
+		got := issues(tt.src)
+		want := tt.want
+		if want == nil {
+			want = []string{}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Lint(%q) = %v, want %v", tt.name, tt.src, got, want)
+		}
+	}
+}
+
+func TestHasErrors(t *testing.T) {
+	if HasErrors(Lint(`\foo`)) {
+		t.Errorf("a warning blocks saving")
+	}
+	if !HasErrors(Lint(`\foo{`)) {
+		t.Errorf("an error doesn't block saving")
+	}
+	if HasErrors(nil) {
+		t.Errorf("no issues block saving")
+	}
+}
@@ -0,0 +1,450 @@
+package latex
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Identifiers written as a single symbol
+var mathIdentifiers = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε",
+	"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+	"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "varpi": "ϖ", "rho": "ρ",
+	"varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+	"infty": "∞", "partial": "∂", "nabla": "∇", "hbar": "ℏ", "ell": "ℓ", "emptyset": "∅",
+	"varnothing": "∅", "Re": "ℜ", "Im": "ℑ", "aleph": "ℵ", "angle": "∠", "triangle": "△",
+	"degree": "°", "circ": "∘",
+}
+
+// Operators, relations and arrows
+var mathOperators = map[string]string{
+	"cdot": "⋅", "times": "×", "div": "÷", "pm": "±", "mp": "∓", "ast": "∗", "star": "⋆",
+	"le": "≤", "leq": "≤", "ge": "≥", "geq": "≥", "neq": "≠", "ne": "≠", "approx": "≈",
+	"sim": "∼", "simeq": "≃", "equiv": "≡", "propto": "∝", "ll": "≪", "gg": "≫",
+	"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "subseteq": "⊆", "supset": "⊃",
+	"supseteq": "⊇", "cup": "∪", "cap": "∩", "setminus": "∖", "wedge": "∧", "land": "∧",
+	"vee": "∨", "lor": "∨", "neg": "¬", "lnot": "¬", "forall": "∀", "exists": "∃",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←", "leftrightarrow": "↔",
+	"Rightarrow": "⇒", "Leftarrow": "⇐", "Leftrightarrow": "⇔", "implies": "⟹", "iff": "⟺",
+	"mapsto": "↦", "uparrow": "↑", "downarrow": "↓", "perp": "⊥", "parallel": "∥",
+	"mid": "∣", "ldots": "…", "dots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱",
+	"prime": "′", "oplus": "⊕", "otimes": "⊗", "bullet": "∙",
+	"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉",
+	"{": "{", "}": "}", "|": "‖", "lvert": "|", "rvert": "|", "lVert": "‖", "rVert": "‖",
+	"vert": "|", "Vert": "‖",
+}
+
+// Operators with limits, written under and over them in display math
+var mathLargeOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "int": "∫", "iint": "∬", "iiint": "∭",
+	"oint": "∮", "bigcup": "⋃", "bigcap": "⋂",
+}
+
+// Function names set upright
+var mathFunctions = map[string]bool{
+	"sin": true, "cos": true, "tan": true, "cot": true, "sec": true, "csc": true,
+	"arcsin": true, "arccos": true, "arctan": true, "sinh": true, "cosh": true, "tanh": true,
+	"log": true, "ln": true, "lg": true, "exp": true, "lim": true, "max": true, "min": true,
+	"sup": true, "inf": true, "det": true, "dim": true, "deg": true, "arg": true, "gcd": true,
+	"sgn": true, "tg": true, "ctg": true, "arctg": true, "arcctg": true,
+}
+
+// Accents over their argument
+var mathAccents = map[string]string{
+	"vec": "→", "overrightarrow": "→", "hat": "^", "widehat": "^", "bar": "¯", "overline": "¯",
+	"dot": "˙", "ddot": "¨", "tilde": "~", "widetilde": "~",
+}
+
+var mathVariants = map[string]string{
+	"mathbf": "bold", "boldsymbol": "bold-italic", "mathit": "italic", "mathbb": "double-struck",
+	"mathcal": "script", "mathfrak": "fraktur", "mathsf": "sans-serif", "mathtt": "monospace",
+	"mathrm": "normal",
+}
+
+var mathSpaces = map[string]string{
+	",": "0.167em", ":": "0.222em", ">": "0.222em", ";": "0.278em", "quad": "1em",
+	"qquad": "2em", " ": "0.333em", "~": "0.333em",
+}
+
+// MathML renders TeX math as a MathML element with the source kept as an
+// annotation
+func MathML(src string, display bool) string {
+	var b strings.Builder
+	b.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML"`)
+	if display {
+		b.WriteString(` display="block"`)
+	}
+	b.WriteString("><semantics>")
+	b.WriteString(mathBody(src))
+	b.WriteString(`<annotation encoding="application/x-tex">`)
+	b.WriteString(html.EscapeString(strings.TrimSpace(src)))
+	b.WriteString("</annotation></semantics></math>")
+	return b.String()
+}
+
+// mathBody lays out rows separated by \\ and columns separated by & as a
+// table, anything else as a single row
+func mathBody(src string) string {
+	rows := splitTop(src, `\\`)
+	if len(rows) == 1 && len(splitTop(src, "&")) == 1 {
+		return "<mrow>" + parseMath(src, 0) + "</mrow>"
+	}
+	return mathTable(rows, "right left", 0)
+}
+
+// Environments nested deeper than this inside one formula are shown as
+// source instead of laid out
+const maxMathDepth = 16
+
+func mathTable(rows []string, align string, depth int) string {
+	var b strings.Builder
+	b.WriteString(`<mtable columnalign="` + align + `">`)
+	for _, row := range rows {
+		if strings.TrimSpace(strings.ReplaceAll(row, `\hline`, "")) == "" {
+			continue
+		}
+		b.WriteString("<mtr>")
+		for _, cell := range splitTop(row, "&") {
+			b.WriteString("<mtd><mrow>" + parseMath(strings.ReplaceAll(cell, `\hline`, ""), depth) + "</mrow></mtd>")
+		}
+		b.WriteString("</mtr>")
+	}
+	b.WriteString("</mtable>")
+	return b.String()
+}
+
+func parseMath(src string, depth int) string {
+	p := mathParser{src: src, depth: depth}
+	return p.row("")
+}
+
+type mathParser struct {
+	src string
+	pos int
+	// depth counts the environments around src
+	depth int
+}
+
+// sub parses a nested group at the same environment depth
+func (p *mathParser) sub(src string) string { return parseMath(src, p.depth) }
+
+func (p *mathParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *mathParser) skipSpace() {
+	for !p.eof() && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\n' || p.src[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+// row parses atoms until the end of input or the \right that closes a \left
+func (p *mathParser) row(until string) string {
+	var b strings.Builder
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return b.String()
+		}
+		if until != "" && strings.HasPrefix(p.src[p.pos:], until) && !isLetterAt(p.src, p.pos+len(until)) {
+			return b.String()
+		}
+		b.WriteString(p.scripted())
+	}
+}
+
+// scripted parses an atom with its sub- and superscripts
+func (p *mathParser) scripted() string {
+	base, limits := p.atom()
+	var sub, sup string
+	for {
+		p.skipSpace()
+		if p.eof() {
+			break
+		}
+		switch c := p.src[p.pos]; {
+		case c == '_' && sub == "":
+			p.pos++
+			sub, _ = p.argument()
+			continue
+		case c == '^' && sup == "":
+			p.pos++
+			sup, _ = p.argument()
+			continue
+		case c == '\'' && sup == "":
+			p.pos++
+			sup = "<mo>′</mo>"
+			continue
+		}
+		break
+	}
+	if base == "" {
+		base = "<mrow></mrow>"
+	}
+	under, over, both := "msub", "msup", "msubsup"
+	if limits {
+		under, over, both = "munder", "mover", "munderover"
+	}
+	switch {
+	case sub != "" && sup != "":
+		return "<" + both + ">" + base + sub + sup + "</" + both + ">"
+	case sub != "":
+		return "<" + under + ">" + base + sub + "</" + under + ">"
+	case sup != "":
+		return "<" + over + ">" + base + sup + "</" + over + ">"
+	}
+	return base
+}
+
+// argument parses a braced group or a single atom as an mrow
+func (p *mathParser) argument() (string, bool) {
+	p.skipSpace()
+	if p.eof() {
+		return "<mrow></mrow>", false
+	}
+	if p.src[p.pos] == '{' {
+		inner := p.group()
+		return "<mrow>" + p.sub(inner) + "</mrow>", true
+	}
+	a, _ := p.atom()
+	return a, true
+}
+
+// group returns the contents of the braced group at pos and skips past it
+func (p *mathParser) group() string {
+	end := matchBrace(p.src, p.pos)
+	inner := p.src[p.pos+1 : end]
+	p.pos = end
+	if p.pos < len(p.src) {
+		p.pos++
+	}
+	return inner
+}
+
+// rawArgument returns the text of the next braced group or character
+func (p *mathParser) rawArgument() string {
+	p.skipSpace()
+	if p.eof() {
+		return ""
+	}
+	if p.src[p.pos] == '{' {
+		return p.group()
+	}
+	if p.src[p.pos] == '\\' {
+		start := p.pos
+		p.pos++
+		for !p.eof() && isLetter(p.src[p.pos]) {
+			p.pos++
+		}
+		if p.pos == start+1 && !p.eof() {
+			p.pos++
+		}
+		return p.src[start:p.pos]
+	}
+	r, size := decodeRune(p.src[p.pos:])
+	p.pos += size
+	return string(r)
+}
+
+// atom parses one element. limits reports a large operator whose scripts
+// go under and over it.
+func (p *mathParser) atom() (string, bool) {
+	c := p.src[p.pos]
+	switch {
+	case c == '{':
+		return "<mrow>" + p.sub(p.group()) + "</mrow>", false
+	case c >= '0' && c <= '9' || c == '.' && p.pos+1 < len(p.src) && p.src[p.pos+1] >= '0' && p.src[p.pos+1] <= '9':
+		start := p.pos
+		for !p.eof() && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.' && p.pos+1 < len(p.src) && p.src[p.pos+1] >= '0' && p.src[p.pos+1] <= '9') {
+			p.pos++
+		}
+		return "<mn>" + p.src[start:p.pos] + "</mn>", false
+	case c == '\\':
+		return p.command()
+	case c == '}':
+		p.pos++
+		return "", false
+	case c == '&':
+		p.pos++
+		return "", false
+	}
+	r, size := decodeRune(p.src[p.pos:])
+	p.pos += size
+	if unicode.IsLetter(r) {
+		return "<mi>" + html.EscapeString(string(r)) + "</mi>", false
+	}
+	if c == '~' {
+		return `<mspace width="0.333em"></mspace>`, false
+	}
+	return "<mo>" + html.EscapeString(string(r)) + "</mo>", false
+}
+
+func (p *mathParser) command() (string, bool) {
+	p.pos++ // backslash
+	if p.eof() {
+		return "", false
+	}
+	start := p.pos
+	for !p.eof() && isLetter(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		p.pos++
+	}
+	name := p.src[start:p.pos]
+
+	if v, ok := mathIdentifiers[name]; ok {
+		return "<mi>" + v + "</mi>", false
+	}
+	if v, ok := mathOperators[name]; ok {
+		return "<mo>" + html.EscapeString(v) + "</mo>", false
+	}
+	if v, ok := mathLargeOperators[name]; ok {
+		return "<mo>" + v + "</mo>", name != "int" && name != "iint" && name != "iiint" && name != "oint"
+	}
+	if mathFunctions[name] {
+		limits := name == "lim" || name == "max" || name == "min" || name == "sup" || name == "inf"
+		return `<mi mathvariant="normal">` + name + "</mi><mo>⁡</mo>", limits
+	}
+	if w, ok := mathSpaces[name]; ok {
+		return `<mspace width="` + w + `"></mspace>`, false
+	}
+	if v, ok := mathAccents[name]; ok {
+		arg, _ := p.argument()
+		return `<mover accent="true">` + arg + "<mo>" + html.EscapeString(v) + "</mo></mover>", false
+	}
+	if v, ok := mathVariants[name]; ok {
+		return `<mstyle mathvariant="` + v + `">` + "<mrow>" + p.sub(p.rawArgument()) + "</mrow></mstyle>", false
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num, _ := p.argument()
+		den, _ := p.argument()
+		return "<mfrac>" + num + den + "</mfrac>", false
+	case "binom":
+		top, _ := p.argument()
+		bottom, _ := p.argument()
+		return `<mrow><mo>(</mo><mfrac linethickness="0">` + top + bottom + "</mfrac><mo>)</mo></mrow>", false
+	case "sqrt":
+		p.skipSpace()
+		if !p.eof() && p.src[p.pos] == '[' {
+			end := strings.IndexByte(p.src[p.pos:], ']')
+			if end > 0 {
+				index := p.sub(p.src[p.pos+1 : p.pos+end])
+				p.pos += end + 1
+				arg, _ := p.argument()
+				return "<mroot>" + arg + "<mrow>" + index + "</mrow></mroot>", false
+			}
+		}
+		arg, _ := p.argument()
+		return "<msqrt>" + arg + "</msqrt>", false
+	case "text", "textrm", "mbox", "textit", "textbf", "operatorname":
+		text := p.rawArgument()
+		if name == "operatorname" {
+			return `<mi mathvariant="normal">` + html.EscapeString(text) + "</mi>", false
+		}
+		return "<mtext>" + html.EscapeString(plainText(text)) + "</mtext>", false
+	case "left", "right", "big", "Big", "bigg", "Bigg", "bigl", "bigr", "Bigl", "Bigr":
+		delim := p.rawArgument()
+		mo := delimiter(delim)
+		if name != "left" {
+			return mo, false
+		}
+		inner := p.row(`\right`)
+		closing := ""
+		if !p.eof() {
+			p.pos += len(`\right`)
+			closing = delimiter(p.rawArgument())
+		}
+		return "<mrow>" + mo + inner + closing + "</mrow>", false
+	case "begin":
+		return p.environment(p.rawArgument()), false
+	case "underbrace", "overbrace":
+		arg, _ := p.argument()
+		tag, brace := "munder", "⏟"
+		if name == "overbrace" {
+			tag, brace = "mover", "⏞"
+		}
+		return "<" + tag + ">" + arg + "<mo>" + brace + "</mo></" + tag + ">", true
+	case "not":
+		next, _ := p.atom()
+		return "<menclose notation=\"updiagonalstrike\">" + next + "</menclose>", false
+	case "displaystyle", "textstyle", "limits", "nolimits", "label", "nonumber", "notag", "tag", "hline", "!":
+		if name == "label" || name == "tag" {
+			p.rawArgument()
+		}
+		return "", false
+	case "\\":
+		return "", false
+	case "%", "$", "#", "_", "&":
+		return "<mo>" + html.EscapeString(name) + "</mo>", false
+	}
+	// Unknown macros show as their name rather than vanish
+	return `<mtext mathcolor="red">\` + html.EscapeString(name) + "</mtext>", false
+}
+
+// environment renders matrices and cases inside math
+func (p *mathParser) environment(name string) string {
+	endTag := `\end{` + name + `}`
+	body := p.src[p.pos:]
+	end := findEnd(body, name)
+	if end < 0 {
+		p.pos = len(p.src)
+	} else {
+		p.pos += end + len(endTag)
+		body = body[:end]
+	}
+	if name == "array" {
+		// Column spec
+		tmp := mathParser{src: body}
+		tmp.skipSpace()
+		if !tmp.eof() && tmp.src[0] == '{' {
+			tmp.group()
+			body = body[tmp.pos:]
+		}
+	}
+	if p.depth >= maxMathDepth {
+		return `<mtext mathcolor="red">` + html.EscapeString(`\begin{`+name+`}`+body+endTag) + "</mtext>"
+	}
+	align := "center"
+	switch name {
+	case "cases":
+		align = "left left"
+	case "aligned", "split", "gathered", "align", "align*":
+		align = "right left"
+	}
+	table := mathTable(splitTop(body, `\\`), align, p.depth+1)
+	switch name {
+	case "pmatrix":
+		return "<mrow><mo>(</mo>" + table + "<mo>)</mo></mrow>"
+	case "bmatrix":
+		return "<mrow><mo>[</mo>" + table + "<mo>]</mo></mrow>"
+	case "vmatrix":
+		return "<mrow><mo>|</mo>" + table + "<mo>|</mo></mrow>"
+	case "Bmatrix":
+		return "<mrow><mo>{</mo>" + table + "<mo>}</mo></mrow>"
+	case "cases":
+		return "<mrow><mo>{</mo>" + table + "</mrow>"
+	}
+	return table
+}
+
+func delimiter(d string) string {
+	switch d {
+	case ".", "":
+		return ""
+	case `\{`, `\lbrace`:
+		return `<mo fence="true">{</mo>`
+	case `\}`, `\rbrace`:
+		return `<mo fence="true">}</mo>`
+	}
+	if strings.HasPrefix(d, `\`) {
+		if v, ok := mathOperators[d[1:]]; ok {
+			return `<mo fence="true">` + html.EscapeString(v) + "</mo>"
+		}
+	}
+	return `<mo fence="true">` + html.EscapeString(d) + "</mo>"
+}
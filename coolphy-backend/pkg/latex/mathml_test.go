@@ -0,0 +1,63 @@
+package latex
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMathML(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{src: `x^2`, want: []string{"<msup><mi>x</mi><mn>2</mn></msup>"}},
+		{src: `\frac{a}{b}`, want: []string{"<mfrac><mrow><mi>a</mi></mrow><mrow><mi>b</mi></mrow></mfrac>"}},
+		{src: `\sqrt[3]{8}`, want: []string{"<mroot><mrow><mn>8</mn></mrow><mrow><mn>3</mn></mrow></mroot>"}},
+		{src: `\alpha \le \beta`, want: []string{"<mi>α</mi><mo>≤</mo><mi>β</mi>"}},
+		{src: `\sin x`, want: []string{`<mi mathvariant="normal">sin</mi>`}},
+		{src: `\foo`, want: []string{`<mtext mathcolor="red">\foo</mtext>`}},
+		{src: `a < b`, want: []string{"<mo>&lt;</mo>", `<annotation encoding="application/x-tex">a &lt; b</annotation>`}},
+		{
+			src:  `\begin{cases} x & x>0 \\ -x & x<0 \end{cases}`,
+			want: []string{`<mrow><mo>{</mo><mtable columnalign="left left"><mtr>`, "</mtr><mtr>"},
+		},
+		{src: `\begin{pmatrix} 1 & 0 \\ 0 & 1 \end{pmatrix}`, want: []string{`<mo>(</mo><mtable columnalign="center">`}},
+		{src: `a &= b \\ c &= d`, want: []string{`<mtable columnalign="right left">`}},
+	}
+	for _, tt := range tests {
+		got := MathML(tt.src, false)
+		for _, w := range tt.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("MathML(%q) = %s, want it to contain %s", tt.src, got, w)
+			}
+		}
+	}
+}
+
+func TestMathMLNestedEnvironments(t *testing.T) {
+	// Each level used to be laid out twice, so the time doubled with every
+	// \begin{cases}
+	for _, closed := range []bool{false, true} {
+		src := strings.Repeat(`\begin{cases}x\\`, 40) + "y"
+		if closed {
+			src += strings.Repeat(`\end{cases}`, 40)
+		}
+		start := time.Now()
+		out := MathML(src, true)
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("40 nested cases (closed %v) took %v", closed, d)
+		}
+		if n := strings.Count(out, "<mtable"); n != maxMathDepth {
+			t.Errorf("40 nested cases (closed %v) gave %d tables, want %d", closed, n, maxMathDepth)
+		}
+		if !strings.Contains(out, `<mtext mathcolor="red">\begin{cases}`) {
+			t.Errorf("environments past the depth limit aren't shown as source: %s", out)
+		}
+	}
+
+	src := strings.Repeat(`\begin{cases}`, 3) + "x" + strings.Repeat(`\end{cases}`, 3)
+	if out := MathML(src, false); strings.Count(out, "<mtable") != 3 || strings.Contains(out, "mathcolor") {
+		t.Errorf("MathML(%q) = %s, want 3 tables", src, out)
+	}
+}
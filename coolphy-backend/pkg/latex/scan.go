@@ -0,0 +1,147 @@
+package latex
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+
+func isLetterAt(s string, i int) bool { return i < len(s) && isLetter(s[i]) }
+
+func decodeRune(s string) (rune, int) {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 {
+		size = 1
+	}
+	return r, size
+}
+
+// matchBrace returns the index of the brace closing the one at open, or
+// len(s) if it is never closed
+func matchBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+// findEnd returns the index of the \end{name} closing an environment whose
+// body is s, skipping nested environments of the same name, or -1
+func findEnd(s, name string) int {
+	begin, end := `\begin{`+name+`}`, `\end{`+name+`}`
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(s[i:], begin):
+			depth++
+			i += len(begin) - 1
+		case strings.HasPrefix(s[i:], end):
+			if depth == 0 {
+				return i
+			}
+			depth--
+			i += len(end) - 1
+		default:
+			i++
+		}
+	}
+	return -1
+}
+
+// splitTop splits s at sep (`\\` or "&") outside braces and nested
+// environments
+func splitTop(s, sep string) []string {
+	var parts []string
+	depth, envs, last := 0, 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '&':
+			if sep == "&" && depth == 0 && envs == 0 {
+				parts = append(parts, s[last:i])
+				last = i + 1
+			}
+		case '\\':
+			switch {
+			case strings.HasPrefix(s[i:], `\\`):
+				if sep == `\\` && depth == 0 && envs == 0 {
+					parts = append(parts, s[last:i])
+					last = i + 2
+				}
+			case strings.HasPrefix(s[i:], `\begin{`):
+				envs++
+			case strings.HasPrefix(s[i:], `\end{`):
+				envs--
+			}
+			i++
+		}
+	}
+	return append(parts, s[last:])
+}
+
+// plainText drops the markup from a short piece of text mode LaTeX, such as
+// the argument of \text
+func plainText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '{' || c == '}':
+		case c == '~':
+			b.WriteByte(' ')
+		case c == '\\' && i+1 < len(s) && !isLetter(s[i+1]):
+			i++
+			if s[i] == ',' || s[i] == ' ' {
+				b.WriteByte(' ')
+			} else {
+				b.WriteByte(s[i])
+			}
+		case c == '\\':
+			for i+1 < len(s) && isLetter(s[i+1]) {
+				i++
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Environments returns every top-level name environment in s, from \begin
+// to \end inclusive. Unclosed ones are left out.
+func Environments(s, name string) []string {
+	begin, endTag := `\begin{`+name+`}`, `\end{`+name+`}`
+	s = stripComments(s)
+	var envs []string
+	for {
+		i := strings.Index(s, begin)
+		if i < 0 {
+			return envs
+		}
+		body := s[i+len(begin):]
+		end := findEnd(body, name)
+		if end < 0 {
+			return envs
+		}
+		envs = append(envs, s[i:i+len(begin)+end+len(endTag)])
+		s = body[end+len(endTag):]
+	}
+}
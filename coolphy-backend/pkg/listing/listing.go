@@ -0,0 +1,282 @@
+// Package listing implements filtering, sorting and cursor pagination shared
+// by the list endpoints.
+//
+// Query parameters:
+//
+//	subject=physics,math   any of the values (every filter in the Spec works this way)
+//	tags=kinematics,ege    rows with any of the tags; tags_match=all requires all of them
+//	topic_id=3             rows attached to the topic or one of its subtopics
+//	sort=-created_at       sort key from the Spec, "-" for descending
+//	limit=20               page size
+//	cursor=...             opaque token from the previous page's next cursor
+package listing
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// Kind of a column value, used to parse filter values and cursors
+type Kind int
+
+const (
+	String Kind = iota
+	Int
+	Time
+	Bool
+)
+
+// Column is a filterable or sortable column
+type Column struct {
+	Name string
+	Kind Kind
+}
+
+// zeroSQL is the Go zero value of each kind, which a NULL scans into
+var zeroSQL = map[Kind]string{String: "''", Int: "0", Time: "'0001-01-01 00:00:00+00'", Bool: "false"}
+
+// sortExpr is what rows are ordered and compared by. NULLs count as the zero
+// value, the same as in the cursor of a row loaded with one, so a nullable
+// column neither drops nor repeats rows across pages.
+func (c Column) sortExpr() string {
+	if c.Name == "id" {
+		return c.Name
+	}
+	return "COALESCE(" + c.Name + ", " + zeroSQL[c.Kind] + ")"
+}
+
+// TopicJoin is the many2many table linking rows to topics
+type TopicJoin struct {
+	Table  string // task_topics
+	Column string // task_id
+}
+
+// Spec describes what a list endpoint supports
+type Spec struct {
+	Filters      map[string]Column // query parameter -> column
+	Tags         string            // text[] column filtered by tags, "" if not supported
+	Topics       *TopicJoin
+	Sorts        map[string]Column // sort key -> column
+	DefaultSort  string            // e.g. "-id"
+	DefaultLimit int
+	MaxLimit     int
+	Select       []string // columns to load, all if empty
+}
+
+// Page is what the client needs to fetch the rest of the list
+type Page struct {
+	Total      int64
+	NextCursor string
+}
+
+// ParamError is a bad query parameter; handlers report it as 400
+type ParamError struct{ msg string }
+
+func (e *ParamError) Error() string { return e.msg }
+
+func paramErr(format string, args ...interface{}) error {
+	return &ParamError{fmt.Sprintf(format, args...)}
+}
+
+type cursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v"`
+	ID    uint64      `json:"id"`
+}
+
+// Find loads one page of T matching the query parameters into out. tx may
+// carry conditions of its own, such as the current user's ID.
+func Find[T any](tx *gorm.DB, q url.Values, spec Spec, out *[]T) (Page, error) {
+	var page Page
+	tx = tx.Model(new(T))
+
+	for param, col := range spec.Filters {
+		raw := q.Get(param)
+		if raw == "" {
+			continue
+		}
+		var values []interface{}
+		for _, s := range strings.Split(raw, ",") {
+			v, err := parseValue(col.Kind, strings.TrimSpace(s))
+			if err != nil {
+				return page, paramErr("invalid %s: %v", param, err)
+			}
+			values = append(values, v)
+		}
+		tx = tx.Where(col.Name+" IN ?", values)
+	}
+	if raw := q.Get("tags"); raw != "" && spec.Tags != "" {
+		tags := pq.StringArray(strings.Split(raw, ","))
+		switch q.Get("tags_match") {
+		case "", "any":
+			tx = tx.Where(spec.Tags+" && ?", tags)
+		case "all":
+			tx = tx.Where(spec.Tags+" @> ?", tags)
+		default:
+			return page, paramErr("tags_match must be any or all")
+		}
+	}
+	if raw := q.Get("topic_id"); raw != "" && spec.Topics != nil {
+		topicID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return page, paramErr("invalid topic_id")
+		}
+		tx = tx.Where("id IN (SELECT "+spec.Topics.Column+" FROM "+spec.Topics.Table+" WHERE topic_id IN ("+
+			"WITH RECURSIVE sub AS (SELECT id FROM topics WHERE id = ? UNION ALL SELECT t.id FROM topics t JOIN sub ON t.parent_id = sub.id) SELECT id FROM sub))", topicID)
+	}
+
+	sortKey := q.Get("sort")
+	if sortKey == "" {
+		sortKey = spec.DefaultSort
+	}
+	desc := strings.HasPrefix(sortKey, "-")
+	col, ok := spec.Sorts[strings.TrimPrefix(sortKey, "-")]
+	if !ok {
+		return page, paramErr("unsupported sort %q", sortKey)
+	}
+	dir, cmp := "asc", ">"
+	if desc {
+		dir, cmp = "desc", "<"
+	}
+
+	limit := spec.DefaultLimit
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return page, paramErr("invalid limit")
+		}
+		limit = n
+	}
+	if limit > spec.MaxLimit {
+		limit = spec.MaxLimit
+	}
+
+	base := tx.Session(&gorm.Session{})
+	if err := base.Count(&page.Total).Error; err != nil {
+		return page, err
+	}
+
+	query := base
+	if raw := q.Get("cursor"); raw != "" {
+		cur, err := decodeCursor(raw, sortKey, col.Kind)
+		if err != nil {
+			return page, err
+		}
+		if col.Name == "id" {
+			query = query.Where("id "+cmp+" ?", cur.ID)
+		} else {
+			expr := col.sortExpr()
+			query = query.Where("("+expr+" "+cmp+" ? OR ("+expr+" = ? AND id "+cmp+" ?))", cur.Value, cur.Value, cur.ID)
+		}
+	}
+
+	if len(spec.Select) > 0 {
+		query = query.Select(spec.Select)
+	}
+	order := "id " + dir
+	if col.Name != "id" {
+		order = col.sortExpr() + " " + dir + ", " + order
+	}
+	// One extra row tells whether there is a next page
+	if err := query.Order(order).Limit(limit + 1).Find(out).Error; err != nil {
+		return page, err
+	}
+	if len(*out) <= limit {
+		return page, nil
+	}
+	*out = (*out)[:limit]
+	next, err := encodeCursor(tx, sortKey, col, &(*out)[limit-1])
+	if err != nil {
+		return page, err
+	}
+	page.NextCursor = next
+	return page, nil
+}
+
+func parseValue(kind Kind, s string) (interface{}, error) {
+	switch kind {
+	case Int:
+		return strconv.ParseInt(s, 10, 64)
+	case Bool:
+		return strconv.ParseBool(s)
+	case Time:
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	return s, nil
+}
+
+// encodeCursor reads the sort column and ID of the last row on the page
+func encodeCursor(tx *gorm.DB, sortKey string, col Column, row interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(row); err != nil {
+		return "", err
+	}
+	rv := reflect.ValueOf(row).Elem()
+	ctx := context.Background()
+	cur := cursor{Sort: sortKey}
+	if f := stmt.Schema.LookUpField("id"); f != nil {
+		id, _ := f.ValueOf(ctx, rv)
+		cur.ID = reflect.ValueOf(id).Convert(reflect.TypeOf(uint64(0))).Uint()
+	}
+	if f := stmt.Schema.LookUpField(col.Name); f != nil {
+		v, _ := f.ValueOf(ctx, rv)
+		if p := reflect.ValueOf(v); p.Kind() == reflect.Pointer {
+			v = nil
+			if !p.IsNil() {
+				v = p.Elem().Interface()
+			}
+		}
+		if t, ok := v.(time.Time); ok {
+			v = t.Format(time.RFC3339Nano)
+		}
+		cur.Value = v
+	}
+	b, err := json.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(raw, sortKey string, kind Kind) (cursor, error) {
+	var cur cursor
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cur, paramErr("invalid cursor")
+	}
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.UseNumber()
+	if err := dec.Decode(&cur); err != nil {
+		return cur, paramErr("invalid cursor")
+	}
+	if cur.Sort != sortKey {
+		return cur, paramErr("cursor was issued for a different sort")
+	}
+	// Give the value back its column type so Postgres compares it correctly
+	var s string
+	switch v := cur.Value.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	case bool:
+		return cur, nil
+	case nil:
+		// A NULL in a pointer field, sorted as the zero value
+		s = map[Kind]string{Int: "0", Time: time.Time{}.Format(time.RFC3339Nano), Bool: "false"}[kind]
+	}
+	if cur.Value, err = parseValue(kind, s); err != nil {
+		return cur, paramErr("invalid cursor")
+	}
+	return cur, nil
+}
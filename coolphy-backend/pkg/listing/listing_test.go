@@ -0,0 +1,165 @@
+package listing
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"coolphy-backend/pkg/db/dbtest"
+)
+
+type item struct {
+	ID    uint
+	Kind  string
+	Score *int
+	Name  *string
+}
+
+var itemSpec = Spec{
+	Filters: map[string]Column{"kind": {Name: "kind"}},
+	Sorts: map[string]Column{
+		"id":    {Name: "id", Kind: Int},
+		"score": {Name: "score", Kind: Int},
+		"name":  {Name: "name", Kind: String},
+	},
+	DefaultSort:  "id",
+	DefaultLimit: 2,
+	MaxLimit:     3,
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	d := dbtest.Open(t)
+	score, name := 7, "b"
+	when := time.Date(2024, 5, 1, 12, 30, 0, 500, time.UTC)
+	tests := []struct {
+		sort string
+		col  Column
+		row  any
+		want any
+	}{
+		{"-score", Column{"score", Int}, &item{ID: 3, Score: &score}, int64(7)},
+		{"score", Column{"score", Int}, &item{ID: 4}, int64(0)},
+		{"name", Column{"name", String}, &item{ID: 5, Name: &name}, "b"},
+		{"name", Column{"name", String}, &item{ID: 6}, ""},
+		{"created", Column{"created_at", Time}, &struct {
+			ID        uint
+			CreatedAt time.Time
+		}{ID: 7, CreatedAt: when}, when},
+	}
+	for _, tt := range tests {
+		raw, err := encodeCursor(d, tt.sort, tt.col, tt.row)
+		if err != nil {
+			t.Fatalf("%s: encode: %v", tt.sort, err)
+		}
+		cur, err := decodeCursor(raw, tt.sort, tt.col.Kind)
+		if err != nil {
+			t.Fatalf("%s: decode: %v", tt.sort, err)
+		}
+		if got, ok := cur.Value.(time.Time); ok {
+			if !got.Equal(tt.want.(time.Time)) {
+				t.Errorf("%s: cursor value %v, want %v", tt.sort, got, tt.want)
+			}
+		} else if cur.Value != tt.want {
+			t.Errorf("%s: cursor value %#v, want %#v", tt.sort, cur.Value, tt.want)
+		}
+		if cur.ID == 0 {
+			t.Errorf("%s: cursor lost the row ID", tt.sort)
+		}
+	}
+}
+
+func TestBadCursors(t *testing.T) {
+	good := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"score","v":3,"id":1}`))
+	for _, tt := range []struct{ raw, sort string }{
+		{"not base64!", "score"},
+		{base64.RawURLEncoding.EncodeToString([]byte("{")), "score"},
+		{good, "-score"},
+		{base64.RawURLEncoding.EncodeToString([]byte(`{"s":"score","v":"x","id":1}`)), "score"},
+	} {
+		var perr *ParamError
+		if _, err := decodeCursor(tt.raw, tt.sort, Int); !errors.As(err, &perr) {
+			t.Errorf("cursor %q for sort %s: %v, want a ParamError", tt.raw, tt.sort, err)
+		}
+	}
+}
+
+// TestNullSortValues pages through rows sorted by a column with NULLs, which
+// sort as zero, and checks every row comes exactly once in order
+func TestNullSortValues(t *testing.T) {
+	d := dbtest.Open(t)
+	if err := d.AutoMigrate(&item{}); err != nil {
+		t.Fatal(err)
+	}
+	n := func(v int) *int { return &v }
+	rows := []item{
+		{Kind: "a", Score: n(2)}, {Kind: "a"}, {Kind: "a", Score: n(-1)}, {Kind: "a"},
+		{Kind: "a", Score: n(2)}, {Kind: "a", Score: n(0)}, {Kind: "b", Score: n(5)},
+	}
+	if err := d.Create(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	score := func(it item) int {
+		if it.Score == nil {
+			return 0
+		}
+		return *it.Score
+	}
+
+	for _, sort := range []string{"score", "-score"} {
+		q := url.Values{"sort": {sort}, "kind": {"a"}}
+		seen := map[uint]bool{}
+		var all []item
+		for pages := 0; ; pages++ {
+			if pages > len(rows) {
+				t.Fatalf("%s: paging doesn't end", sort)
+			}
+			var out []item
+			page, err := Find(d, q, itemSpec, &out)
+			if err != nil {
+				t.Fatalf("%s: %v", sort, err)
+			}
+			if page.Total != 6 || len(out) > 2 {
+				t.Fatalf("%s: total %d with %d rows, want 6 in pages of 2", sort, page.Total, len(out))
+			}
+			all = append(all, out...)
+			if page.NextCursor == "" {
+				break
+			}
+			q.Set("cursor", page.NextCursor)
+		}
+		if len(all) != 6 {
+			t.Fatalf("%s: %d rows over all pages, want 6", sort, len(all))
+		}
+		for i, it := range all {
+			if seen[it.ID] {
+				t.Errorf("%s: row %d repeated", sort, it.ID)
+			}
+			seen[it.ID] = true
+			if i == 0 {
+				continue
+			}
+			prev := all[i-1]
+			inOrder := score(prev) < score(it) || score(prev) == score(it) && prev.ID < it.ID
+			if sort == "-score" {
+				inOrder = score(prev) > score(it) || score(prev) == score(it) && prev.ID > it.ID
+			}
+			if !inOrder {
+				t.Errorf("%s: row %d (%d) after row %d (%d)", sort, it.ID, score(it), prev.ID, score(prev))
+			}
+		}
+	}
+
+	var out []item
+	q := url.Values{"sort": {"score"}, "cursor": {"x"}}
+	if _, err := Find(d, url.Values{"sort": {"rank"}}, itemSpec, &out); err == nil {
+		t.Errorf("unknown sort gave no error")
+	}
+	if _, err := Find(d, q, itemSpec, &out); err == nil {
+		t.Errorf("bad cursor gave no error")
+	}
+	if _, err := Find(d, url.Values{"limit": {"10"}}, itemSpec, &out); err != nil || len(out) != 3 {
+		t.Errorf("limit above the maximum: %d rows (%v), want 3", len(out), err)
+	}
+}
@@ -0,0 +1,80 @@
+package models
+
+import "encoding/json"
+
+// AnswerSpec is the typed answer schema stored as JSONB on Task for the
+// structured answer types (choice, multi_part, interval, set, ordered).
+// It contains the correct answer and is never sent to students.
+type AnswerSpec struct {
+	// Choice: the options shown to the student and whether several may be picked
+	Options  []AnswerOption `json:"options,omitempty"`
+	Multiple bool           `json:"multiple,omitempty"`
+	// Correct option IDs for choice, correct items for set and ordered
+	Correct []string `json:"correct,omitempty"`
+	// ItemType of set and ordered items: "" (auto), numeric, text or expression
+	ItemType string `json:"item_type,omitempty"`
+	// Multi-part: numbered sub-answers, each graded on its own
+	Parts []AnswerPart `json:"parts,omitempty"`
+	// Interval: the correct numeric interval
+	Interval *AnswerInterval `json:"interval,omitempty"`
+	// PartialCredit awards a proportional score for multi-select, set, ordered and code answers
+	PartialCredit bool `json:"partial_credit,omitempty"`
+	// Code: hidden test cases, limits per test and the allowed languages (all if empty)
+	Tests         []CodeTest `json:"tests,omitempty"`
+	TimeLimitMS   int        `json:"time_limit_ms,omitempty"`
+	MemoryLimitMB int        `json:"memory_limit_mb,omitempty"`
+	Languages     []string   `json:"languages,omitempty"`
+}
+
+type AnswerOption struct {
+	ID   string `json:"id"`   // "1", "A", ...
+	Text string `json:"text"` // LaTeX
+}
+
+type AnswerPart struct {
+	Label         string  `json:"label"`
+	Type          string  `json:"type"` // "" (auto), numeric, text, expression
+	Answer        string  `json:"answer"`
+	Weight        int     `json:"weight"` // relative share of the task points, defaults to 1
+	Tolerance     float64 `json:"tolerance,omitempty"`
+	ToleranceMode string  `json:"tolerance_mode,omitempty"`
+}
+
+// CodeTest is a hidden test of a code task; output is compared token by token
+type CodeTest struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+// AnswerInterval bounds are inclusive when Closed; a nil bound is infinite
+type AnswerInterval struct {
+	Lower       *float64 `json:"lower"`
+	Upper       *float64 `json:"upper"`
+	LowerClosed bool     `json:"lower_closed"`
+	UpperClosed bool     `json:"upper_closed"`
+}
+
+// AnswerForm is the part of the answer schema students need to answer:
+// the options to pick from and the labels of the sub-answers
+type AnswerForm struct {
+	Type     string         `json:"type"`
+	Options  []AnswerOption `json:"options,omitempty"`
+	Multiple bool           `json:"multiple,omitempty"`
+	Parts    []string       `json:"parts,omitempty"`
+	// Code tasks
+	TimeLimitMS   int      `json:"time_limit_ms,omitempty"`
+	MemoryLimitMB int      `json:"memory_limit_mb,omitempty"`
+	Languages     []string `json:"languages,omitempty"`
+}
+
+// DecodeAnswerSpec returns the task's answer schema, or nil if it has none
+func (t *Task) DecodeAnswerSpec() (*AnswerSpec, error) {
+	if len(t.AnswerSpec) == 0 || string(t.AnswerSpec) == "null" {
+		return nil, nil
+	}
+	var spec AnswerSpec
+	if err := json.Unmarshal(t.AnswerSpec, &spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
@@ -4,7 +4,10 @@ import "time"
 
 type AppSettings struct {
 	ID                   uint      `gorm:"primaryKey" json:"id"`
+	LLMProvider          string    `gorm:"column:llm_provider;default:'openrouter'" json:"llm_provider"` // openrouter, openai_compatible, fake
 	OpenRouterAPIKey     string    `gorm:"column:openrouter_api_key;type:text" json:"openrouter_api_key,omitempty"`
+	LLMBaseURL           string    `gorm:"column:llm_base_url;type:text" json:"llm_base_url"`                   // For openai_compatible, e.g. http://localhost:11434/v1
+	LLMAPIKey            string    `gorm:"column:llm_api_key;type:text" json:"llm_api_key,omitempty"`           // For openai_compatible, optional
 	SystemPrompt         string    `gorm:"type:text" json:"system_prompt"`          // Legacy field, kept for backwards compat
 	ProfessorPrompt      string    `gorm:"type:text" json:"professor_prompt"`        // For professor chat
 	TaskAssistantPrompt  string    `gorm:"type:text" json:"task_assistant_prompt"`  // For in-task chat
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Asset statuses
+const (
+	AssetPending = "pending"
+	AssetReady   = "ready"
+	AssetFailed  = "failed"
+)
+
+// Asset is a file generated from content, such as the SVG compiled from a
+// TikZ diagram. Hash is the SHA-256 of the source, so the same diagram used
+// in several places is compiled and stored once.
+type Asset struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Hash        string    `gorm:"size:64;not null;uniqueIndex" json:"hash"`
+	Kind        string    `gorm:"not null" json:"kind"` // tikz
+	Source      string    `gorm:"type:text;not null" json:"-"`
+	Status      string    `gorm:"default:'pending';index" json:"status"`
+	Error       string    `gorm:"type:text" json:"error,omitempty"` // compiler log of a failed build
+	MimeType    string    `json:"mime_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	StoragePath string    `json:"-"`
+	URL         string    `gorm:"-" json:"url,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Assignment is homework for a class: tasks to solve and lectures to read
+// between OpensAt and DueAt
+type Assignment struct {
+	ID                 uint       `gorm:"primaryKey" json:"id"`
+	ClassID            uint       `gorm:"not null;index" json:"class_id"`
+	Title              string     `gorm:"not null" json:"title"`
+	Description        string     `gorm:"type:text" json:"description"`
+	OpensAt            time.Time  `gorm:"not null" json:"opens_at"`
+	DueAt              time.Time  `gorm:"not null;index" json:"due_at"`
+	LatePolicy         string     `gorm:"default:'none'" json:"late_policy"`     // none, accept, penalty
+	LatePenaltyPercent int        `gorm:"default:0" json:"late_penalty_percent"` // taken off late work with the penalty policy
+	LateUntil          *time.Time `json:"late_until,omitempty"`                  // late work is not accepted after this, open-ended if nil
+	ReminderSentAt     *time.Time `json:"-"`
+	CreatedBy          uint       `json:"created_by"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+
+	Class    Class     `gorm:"foreignKey:ClassID;constraint:OnDelete:CASCADE" json:"-"`
+	Tasks    []Task    `gorm:"many2many:assignment_tasks;" json:"tasks"`
+	Lectures []Lecture `gorm:"many2many:assignment_lectures;" json:"lectures"`
+}
+
+// LectureCompletion records when a user marked a lecture as studied
+type LectureCompletion struct {
+	UserID      uint      `gorm:"primaryKey" json:"user_id"`
+	LectureID   uint      `gorm:"primaryKey;index" json:"lecture_id"`
+	CompletedAt time.Time `gorm:"not null" json:"completed_at"`
+}
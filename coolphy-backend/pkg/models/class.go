@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Class is a group of students run by a teacher. Students join with JoinCode.
+type Class struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"not null" json:"name"`
+	Description string    `gorm:"type:text" json:"description"`
+	Subject     string    `json:"subject"`
+	TeacherID   uint      `gorm:"not null;index" json:"teacher_id"`
+	JoinCode    string    `gorm:"type:varchar(16);uniqueIndex" json:"join_code,omitempty"` // shown to the teacher only
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	Teacher User          `gorm:"foreignKey:TeacherID" json:"-"`
+	Members []ClassMember `gorm:"foreignKey:ClassID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// ClassMember is a student in a class
+type ClassMember struct {
+	ClassID  uint      `gorm:"primaryKey" json:"class_id"`
+	UserID   uint      `gorm:"primaryKey;index" json:"user_id"`
+	JoinedAt time.Time `gorm:"autoCreateTime" json:"joined_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Contest is a timed olympiad round or mock exam over a fixed list of tasks.
+// Participants start any time between StartsAt and EndsAt and then have
+// DurationMinutes of their own, cut off at EndsAt.
+type Contest struct {
+	ID              uint          `gorm:"primaryKey" json:"id"`
+	Title           string        `gorm:"not null" json:"title"`
+	Description     string        `gorm:"type:text" json:"description"`
+	StartsAt        time.Time     `gorm:"not null;index" json:"starts_at"`
+	EndsAt          time.Time     `gorm:"not null;index" json:"ends_at"`
+	DurationMinutes int           `gorm:"default:0" json:"duration_minutes"`  // 0: until EndsAt
+	FreezeMinutes   int           `gorm:"default:0" json:"freeze_minutes"`    // scoreboard hides each participant's last minutes until the end
+	Scoring         string        `gorm:"default:'ioi'" json:"scoring"`       // ioi, icpc, ege
+	PenaltyMinutes  int           `gorm:"default:0" json:"penalty_minutes"`   // icpc, 20 if 0
+	EGEScale        pq.Int64Array `gorm:"type:integer[]" json:"ege_scale"`    // ege, test score for each primary score
+	ShowVerdicts    bool          `gorm:"default:false" json:"show_verdicts"` // tell participants right away whether an answer is correct
+	ClassID         *uint         `gorm:"index" json:"class_id,omitempty"`    // only members of the class may take part
+	CreatedBy       uint          `json:"created_by"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+
+	Tasks []ContestTask `gorm:"foreignKey:ContestID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// ContestTask is a task in a contest, in the order Position
+type ContestTask struct {
+	ContestID uint   `gorm:"primaryKey" json:"contest_id"`
+	TaskID    uint   `gorm:"primaryKey" json:"task_id"`
+	Position  int    `json:"position"`
+	Label     string `json:"label"`  // A, B, ... or 1, 2, ...
+	Points    int    `json:"points"` // full score in the contest
+
+	Task Task `gorm:"foreignKey:TaskID" json:"-"`
+}
+
+// ContestParticipant is one user's run through a contest
+type ContestParticipant struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	ContestID  uint       `gorm:"not null;uniqueIndex:idx_contest_participant" json:"contest_id"`
+	UserID     uint       `gorm:"not null;uniqueIndex:idx_contest_participant" json:"user_id"`
+	StartedAt  time.Time  `gorm:"not null" json:"started_at"`
+	EndsAt     time.Time  `gorm:"not null" json:"ends_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"` // handed in early
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// ContestSubmission is an answer given during a contest. Contest answers
+// don't create SolutionAttempts or award user points.
+type ContestSubmission struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ContestID     uint      `gorm:"not null;index" json:"contest_id"`
+	ParticipantID uint      `gorm:"not null;index" json:"participant_id"`
+	UserID        uint      `gorm:"not null" json:"user_id"`
+	TaskID        uint      `gorm:"not null" json:"task_id"`
+	Answer        string    `gorm:"type:text;not null" json:"answer"`
+	Language      string    `json:"language,omitempty"`
+	Status        string    `json:"status"` // correct, incorrect, partial, pending, judging
+	Score         int       `json:"score"`  // 0-100
+	Verdict       string    `json:"verdict,omitempty"`
+	Feedback      string    `gorm:"type:text" json:"feedback,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
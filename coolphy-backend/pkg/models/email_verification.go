@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type EmailVerificationToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	TokenHash string    `gorm:"type:varchar(255);not null;uniqueIndex" json:"-"` // SHA-256 of the emailed token
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	Used      bool      `gorm:"default:false" json:"used"`
+	CreatedAt time.Time `json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID"`
+}
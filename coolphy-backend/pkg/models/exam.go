@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ExamBlueprint describes an exam paper position by position, e.g. the EGE
+// physics structure. Variants are assembled from it out of the task bank.
+type ExamBlueprint struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Title       string    `gorm:"not null" json:"title"`
+	Subject     string    `gorm:"not null;index" json:"subject"`
+	Description string    `gorm:"type:text" json:"description"`
+	CreatedBy   uint      `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	Positions []ExamPosition `gorm:"foreignKey:BlueprintID;constraint:OnDelete:CASCADE" json:"positions"`
+}
+
+// ExamPosition constrains the task at one position of the paper. Empty
+// constraints match any task of the blueprint's subject.
+type ExamPosition struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	BlueprintID uint           `gorm:"not null;index" json:"blueprint_id"`
+	Number      int            `gorm:"not null" json:"number"`    // 1..N
+	TopicID     *uint          `json:"topic_id,omitempty"`        // the topic or one of its subtopics
+	Type        string         `json:"type,omitempty"`            // Task.Type: ege, olympiad, practice
+	Levels      pq.StringArray `gorm:"type:text[]" json:"levels"` // any of these Task.Level values
+	Tags        pq.StringArray `gorm:"type:text[]" json:"tags"`   // any of these tags
+	Points      int            `gorm:"default:0" json:"points"`   // primary points, the task's points if 0
+}
+
+// ExamVariant is one generated paper. The picked tasks are stored so the
+// paper can be printed again exactly; parametrized tasks get the numbers of
+// UserID.
+type ExamVariant struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	BlueprintID uint      `gorm:"not null;index" json:"blueprint_id"`
+	UserID      *uint     `gorm:"index" json:"user_id,omitempty"` // the student the paper is for
+	Seed        int64     `json:"seed"`
+	CreatedBy   uint      `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	Blueprint ExamBlueprint     `gorm:"foreignKey:BlueprintID;constraint:OnDelete:CASCADE" json:"-"`
+	Items     []ExamVariantItem `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"items"`
+}
+
+// ExamVariantItem is the task at one position of a variant
+type ExamVariantItem struct {
+	VariantID uint `gorm:"primaryKey" json:"variant_id"`
+	Number    int  `gorm:"primaryKey" json:"number"`
+	TaskID    uint `gorm:"not null;index" json:"task_id"`
+	Points    int  `json:"points"`
+}
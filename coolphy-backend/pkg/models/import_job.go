@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Import job statuses
+const (
+	ImportPending = "pending"
+	ImportRunning = "running"
+	ImportDone    = "done"
+	ImportFailed  = "failed"
+)
+
+// ImportJob is a bulk task import running in the background. Rows that
+// can't be imported are listed in Errors, the others become draft tasks.
+type ImportJob struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	UserID     uint           `gorm:"not null;index" json:"user_id"`
+	Format     string         `gorm:"not null" json:"format"` // csv, xlsx, moodle, qti
+	FileName   string         `json:"file_name"`
+	Options    datatypes.JSON `gorm:"type:jsonb" json:"options"`
+	DryRun     bool           `json:"dry_run"`
+	Status     string         `gorm:"default:'pending';index" json:"status"`
+	Total      int            `json:"total"`     // rows or questions found
+	Processed  int            `json:"processed"` // checked so far
+	Created    int            `json:"created"`   // tasks created, or that would be on a dry run
+	Failed     int            `json:"failed"`
+	Errors     datatypes.JSON `gorm:"type:jsonb" json:"errors"`         // []taskimport.RowError
+	TaskIDs    datatypes.JSON `gorm:"type:jsonb" json:"task_ids"`       // IDs of the created tasks
+	Error      string         `gorm:"type:text" json:"error,omitempty"` // why the whole file failed
+	StartedAt  *time.Time     `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
@@ -11,6 +11,7 @@ type Lecture struct {
 	Title        string         `gorm:"not null" json:"title"`
 	Subject      string         `gorm:"not null;index" json:"subject"` // math, physics, cs
 	ContentLaTeX string         `gorm:"type:text;not null" json:"content_latex"`
+	ContentHTML  string         `gorm:"-" json:"content_html,omitempty"` // ContentLaTeX rendered by package latex
 	Summary      string         `gorm:"type:text" json:"summary"`
 	Tags         pq.StringArray `gorm:"type:text[]" json:"tags"`
 	Level        string         `gorm:"default:'basic'" json:"level"` // basic, advanced, olympiad
@@ -19,7 +20,10 @@ type Lecture struct {
 	VideoAsset   *VideoAsset    `json:"video_asset,omitempty"`
 	AuthorID     uint           `json:"author_id"`
 	ViewCount    int            `gorm:"default:0" json:"view_count"`
-	Status       string         `gorm:"default:'active'" json:"status"` // active, draft, archived
+	Status       string         `gorm:"default:'draft';index" json:"status"` // draft, review, scheduled, published, archived
+	ReviewerID   *uint          `json:"reviewer_id"`
+	PublishAt    *time.Time     `json:"publish_at"` // when a scheduled lecture goes live
+	PublishedAt  *time.Time     `json:"published_at"`
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Kinds of editable content, used by revisions and reviews
+const (
+	ContentLecture = "lecture"
+	ContentTask    = "task"
+)
+
+// Publication states of lectures and tasks, see package workflow. Only
+// published content is shown to students.
+const (
+	StatusDraft     = "draft"
+	StatusReview    = "review"
+	StatusScheduled = "scheduled" // approved, published at PublishAt
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+// ReviewComment is a note on a lecture or task under review. Status
+// changes are logged as comments too, with Transition set.
+type ReviewComment struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	EntityType string    `gorm:"size:16;not null;index:idx_review_comment_entity,priority:1" json:"entity_type"` // ContentLecture or ContentTask
+	EntityID   uint      `gorm:"not null;index:idx_review_comment_entity,priority:2" json:"entity_id"`
+	AuthorID   uint      `gorm:"not null" json:"author_id"`
+	Transition string    `gorm:"size:32" json:"transition,omitempty"` // "draft->review", ...
+	Body       string    `gorm:"type:text" json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	Author *User `gorm:"foreignKey:AuthorID" json:"author,omitempty"`
+}
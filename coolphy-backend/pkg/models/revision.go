@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Revision actions
+const (
+	RevisionBaseline = "baseline" // state found on the first edit of content saved before revisions existed
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionRestore  = "restore"
+)
+
+// Revision is an append-only snapshot of a lecture or task, taken each
+// time it is saved. Rows are never updated or deleted.
+type Revision struct {
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	EntityType   string         `gorm:"size:16;not null;uniqueIndex:idx_revision_number,priority:1" json:"entity_type"` // ContentLecture or ContentTask
+	EntityID     uint           `gorm:"not null;uniqueIndex:idx_revision_number,priority:2" json:"entity_id"`
+	Number       int            `gorm:"not null;uniqueIndex:idx_revision_number,priority:3" json:"number"` // 1, 2, ... per entity
+	Action       string         `gorm:"size:16;not null" json:"action"`
+	RestoredFrom *int           `json:"restored_from,omitempty"` // revision number, for restores
+	AuthorID     *uint          `json:"author_id"`
+	Snapshot     datatypes.JSON `gorm:"type:jsonb;not null" json:"snapshot,omitempty"` // all columns, hidden answers included
+	CreatedAt    time.Time      `json:"created_at"`
+
+	Author *User `gorm:"foreignKey:AuthorID" json:"author,omitempty"`
+}
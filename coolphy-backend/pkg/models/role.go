@@ -0,0 +1,76 @@
+package models
+
+import "sort"
+
+// Roles a user can have
+const (
+	RoleUser      = "user"
+	RoleTeacher   = "teacher"
+	RoleEditor    = "editor"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Permissions checked by middleware.Permission
+const (
+	PermContentWrite   = "content.write"   // create, edit and delete lectures, tasks, topics and videos
+	PermUsersManage    = "users.manage"    // view, edit and delete user accounts
+	PermRolesAssign    = "roles.assign"    // change a user's role
+	PermSettingsManage = "settings.manage" // AI settings, API keys, logs
+	PermGradesView     = "grades.view"     // see other users' solutions and stats
+	PermClassesManage  = "classes.manage"  // create classes and follow their students
+)
+
+var rolePermissions = map[string][]string{
+	RoleUser:      {},
+	RoleTeacher:   {PermGradesView, PermClassesManage},
+	RoleEditor:    {PermContentWrite},
+	RoleModerator: {PermUsersManage, PermGradesView},
+	RoleAdmin:     {PermContentWrite, PermUsersManage, PermRolesAssign, PermSettingsManage, PermGradesView, PermClassesManage},
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Roles lists the known roles
+func Roles() []string {
+	roles := make([]string, 0, len(rolePermissions))
+	for r := range rolePermissions {
+		roles = append(roles, r)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Permissions lists what a role may do
+func Permissions(role string) []string {
+	perms := rolePermissions[role]
+	if perms == nil {
+		return []string{}
+	}
+	return perms
+}
+
+// HasPermission reports whether the role grants perm
+func HasPermission(role, perm string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Outranks reports whether role has every permission of other, so a
+// moderator can't edit or delete an admin
+func Outranks(role, other string) bool {
+	for _, p := range rolePermissions[other] {
+		if !HasPermission(role, p) {
+			return false
+		}
+	}
+	return true
+}
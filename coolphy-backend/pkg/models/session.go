@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Session is a login on one device. The refresh token is stored only as a
+// SHA-256 hash and rotated on every refresh; access tokens carry the session
+// ID so revoking the session cuts them off too.
+type Session struct {
+	ID                uint       `gorm:"primaryKey" json:"id"`
+	UserID            uint       `gorm:"not null;index" json:"user_id"`
+	RefreshTokenHash  string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	PreviousTokenHash string     `gorm:"type:varchar(64);index" json:"-"` // the token rotated out last, reuse means it leaked
+	UserAgent         string     `json:"user_agent"`
+	IP                string     `json:"ip"`
+	ExpiresAt         time.Time  `gorm:"not null" json:"expires_at"`
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	RevokedAt         *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// Active reports whether the session can still be used
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
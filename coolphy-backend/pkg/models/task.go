@@ -4,23 +4,38 @@ import (
 	"time"
 
 	"github.com/lib/pq"
+	"gorm.io/datatypes"
 )
 
 type Task struct {
-	ID               uint           `gorm:"primaryKey" json:"id"`
-	Title            string         `gorm:"not null" json:"title"`
-	DescriptionLaTeX string         `gorm:"type:text;not null" json:"description_latex"`
-	Subject          string         `gorm:"not null;index" json:"subject"`
-	Tags             pq.StringArray `gorm:"type:text[]" json:"tags"`
-	Level            string         `gorm:"not null" json:"level"` // 1-10 or basic/advanced/olympiad
-	Type             string         `gorm:"not null" json:"type"`  // ege, olympiad, practice
-	CorrectAnswer    string         `gorm:"type:text" json:"-"`    // Hidden from regular users
-	SolutionLaTeX    string         `gorm:"type:text" json:"solution_latex"`
-	HintLaTeX        string         `gorm:"type:text" json:"hint_latex"`
-	Points           int            `gorm:"default:10" json:"points"`
-	Status           string         `gorm:"default:'active'" json:"status"`
-	CreatedAt        time.Time      `json:"created_at"`
-	UpdatedAt        time.Time      `json:"updated_at"`
+	ID               uint              `gorm:"primaryKey" json:"id"`
+	Title            string            `gorm:"not null" json:"title"`
+	DescriptionLaTeX string            `gorm:"type:text;not null" json:"description_latex"`
+	ContentHTML      string            `gorm:"-" json:"content_html,omitempty"` // DescriptionLaTeX rendered by package latex
+	Subject          string            `gorm:"not null;index" json:"subject"`
+	Tags             pq.StringArray    `gorm:"type:text[]" json:"tags"`
+	Level            string            `gorm:"not null" json:"level"` // 1-10 or basic/advanced/olympiad
+	Type             string            `gorm:"not null" json:"type"`  // ege, olympiad, practice
+	CorrectAnswer    string            `gorm:"type:text" json:"-"`    // Hidden from regular users
+	AnswerType       string            `json:"answer_type"`           // "" (auto), numeric, text, expression, free, choice, multi_part, interval, set, ordered, code
+	AnswerSpec       datatypes.JSON    `gorm:"type:jsonb" json:"-"`   // AnswerSpec for structured types, hidden like CorrectAnswer
+	AnswerForm       *AnswerForm       `gorm:"-" json:"answer_form,omitempty"`
+	Params           datatypes.JSON    `gorm:"type:jsonb" json:"params,omitempty"` // []TaskParam, {{name}} in the LaTeX is replaced per student
+	AnswerFormula    string            `gorm:"type:text" json:"-"`                 // Computes the answer of a parametrized task
+	AnswerUnit       string            `json:"answer_unit"`
+	ParamValues      map[string]string `gorm:"-" json:"param_values,omitempty"`
+	Tolerance        float64           `gorm:"default:0" json:"tolerance"`
+	ToleranceMode    string            `json:"tolerance_mode"` // relative (default) or absolute
+	SolutionLaTeX    string            `gorm:"type:text" json:"solution_latex"`
+	SolutionHTML     string            `gorm:"-" json:"solution_html,omitempty"`
+	HintLaTeX        string            `gorm:"type:text" json:"hint_latex"`
+	Points           int               `gorm:"default:10" json:"points"`
+	Status           string            `gorm:"default:'draft';index" json:"status"` // draft, review, scheduled, published, archived
+	ReviewerID       *uint             `json:"reviewer_id"`
+	PublishAt        *time.Time        `json:"publish_at"` // when a scheduled task goes live
+	PublishedAt      *time.Time        `json:"published_at"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
 
 	Topics           []Topic           `gorm:"many2many:task_topics;"`
 	RelatedLectures  []Lecture         `gorm:"many2many:lecture_tasks;"`
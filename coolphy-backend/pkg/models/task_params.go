@@ -0,0 +1,25 @@
+package models
+
+import "encoding/json"
+
+// TaskParam is a variable of a parametrized task. Each student gets a value
+// picked either from Values or from the range Min..Max in steps of Step.
+type TaskParam struct {
+	Name   string    `json:"name"` // as written in the formula: m, v_0, alpha
+	Min    *float64  `json:"min,omitempty"`
+	Max    *float64  `json:"max,omitempty"`
+	Step   float64   `json:"step,omitempty"` // defaults to 1
+	Values []float64 `json:"values,omitempty"`
+}
+
+// DecodeParams returns the task's parameters, or nil if the task isn't parametrized
+func (t *Task) DecodeParams() ([]TaskParam, error) {
+	if len(t.Params) == 0 || string(t.Params) == "null" {
+		return nil, nil
+	}
+	var params []TaskParam
+	if err := json.Unmarshal(t.Params, &params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
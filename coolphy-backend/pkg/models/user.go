@@ -8,17 +8,21 @@ import (
 )
 
 type User struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	Email        string         `gorm:"uniqueIndex;not null" json:"email"`
-	Name         string         `gorm:"not null" json:"name"`
-	PasswordHash string         `gorm:"not null" json:"-"`
-	Points       int            `gorm:"default:0" json:"points"`
-	Subjects     pq.StringArray `gorm:"type:text[]" json:"subjects"` // [math, physics, cs]
-	Role         string         `gorm:"default:'user'" json:"role"`  // user, admin
-	Achievements datatypes.JSON `gorm:"type:jsonb" json:"achievements"`
-	Settings     datatypes.JSON `gorm:"type:jsonb" json:"settings"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	Email           string         `gorm:"uniqueIndex;not null" json:"email"`
+	Name            string         `gorm:"not null" json:"name"`
+	PasswordHash    string         `gorm:"not null" json:"-"`
+	Points          int            `gorm:"default:0" json:"points"`
+	Subjects        pq.StringArray `gorm:"type:text[]" json:"subjects"` // [math, physics, cs]
+	Role            string         `gorm:"default:'user'" json:"role"`  // see role.go
+	Achievements    datatypes.JSON `gorm:"type:jsonb" json:"achievements"`
+	Settings        datatypes.JSON `gorm:"type:jsonb" json:"settings"`
+	EmailVerifiedAt *time.Time     `json:"email_verified_at"`
+	TOTPSecret      string         `gorm:"column:totp_secret" json:"-"` // set on 2FA setup, used once enabled
+	TOTPEnabled     bool           `gorm:"column:totp_enabled;default:false" json:"totp_enabled"`
+	TOTPLastStep    int64          `gorm:"column:totp_last_step;default:0" json:"-"` // last accepted time step, blocks replays
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
 
 	SolutionAttempts []SolutionAttempt `gorm:"foreignKey:UserID"`
 	Notes            []Note            `gorm:"foreignKey:UserID"`
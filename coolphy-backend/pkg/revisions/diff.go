@@ -0,0 +1,193 @@
+package revisions
+
+import "strings"
+
+// DefaultContext is the number of unchanged lines shown around a change
+const DefaultContext = 3
+
+// Edits beyond this many lines are not minimized; the rest of the text is
+// shown as removed and added again. It bounds time and memory on rewrites.
+const maxEdits = 2000
+
+// Line ops
+const (
+	OpEqual  = " "
+	OpDelete = "-"
+	OpInsert = "+"
+)
+
+type Line struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Hunk is a group of changed lines with their context, like a hunk of a
+// unified diff. Starts are 1-based.
+type Hunk struct {
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Lines    []Line `json:"lines"`
+}
+
+// LineDiff compares two texts line by line and groups the changes into
+// hunks with context unchanged lines around them
+func LineDiff(a, b string, context int) []Hunk {
+	lines := diffLines(splitLines(a), splitLines(b))
+	var hunks []Hunk
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].Op == OpEqual {
+			i++
+			oldLine++
+			newLine++
+			continue
+		}
+		// Back up over the leading context
+		start := max(i-context, 0)
+		for k := start; k < i; k++ {
+			if lines[k].Op != OpEqual {
+				start = k + 1
+			}
+		}
+		h := Hunk{OldStart: oldLine - (i - start), NewStart: newLine - (i - start)}
+		// Extend while the next change is within two contexts
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].Op != OpEqual {
+				end = j + 1
+			} else if j-end >= 2*context {
+				break
+			}
+		}
+		end = min(end+context, len(lines))
+		for _, l := range lines[start:end] {
+			h.Lines = append(h.Lines, l)
+			if l.Op != OpInsert {
+				h.OldLines++
+			}
+			if l.Op != OpDelete {
+				h.NewLines++
+			}
+		}
+		for _, l := range lines[i:end] {
+			if l.Op != OpInsert {
+				oldLine++
+			}
+			if l.Op != OpDelete {
+				newLine++
+			}
+		}
+		hunks = append(hunks, h)
+		i = end
+	}
+	return hunks
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines returns a shortest edit script from a to b (Myers' algorithm)
+func diffLines(a, b []string) []Line {
+	// Common ends don't need the search
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	out := make([]Line, 0, len(a)+len(b))
+	for _, s := range a[:pre] {
+		out = append(out, Line{OpEqual, s})
+	}
+	out = append(out, myers(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, s := range a[len(a)-suf:] {
+		out = append(out, Line{OpEqual, s})
+	}
+	return out
+}
+
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxEdits)
+	// v[k+off] is the furthest x reached on diagonal k; trace[d] keeps the
+	// diagonals -d..d of v as they were before step d
+	off := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[off+k-1] < v[off+k+1] {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	out := make([]Line, 0, n+m)
+	for _, s := range a {
+		out = append(out, Line{OpDelete, s})
+	}
+	for _, s := range b {
+		out = append(out, Line{OpInsert, s})
+	}
+	return out
+}
+
+func backtrack(a, b []string, trace [][]int) []Line {
+	var rev []Line
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d] }
+		k := x - y
+		var prev int
+		if k == -d || k != d && at(k-1) < at(k+1) {
+			prev = k + 1
+		} else {
+			prev = k - 1
+		}
+		px := at(prev)
+		py := px - prev
+		for x > px && y > py {
+			x--
+			y--
+			rev = append(rev, Line{OpEqual, a[x]})
+		}
+		if x == px {
+			y--
+			rev = append(rev, Line{OpInsert, b[y]})
+		} else {
+			x--
+			rev = append(rev, Line{OpDelete, a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		rev = append(rev, Line{OpEqual, a[x]})
+	}
+	out := make([]Line, len(rev))
+	for i, l := range rev {
+		out[len(rev)-1-i] = l
+	}
+	return out
+}
@@ -0,0 +1,159 @@
+package revisions
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"coolphy-backend/pkg/models"
+)
+
+func lines(n int, change map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if s, ok := change[i]; ok {
+			b.WriteString(s)
+		} else {
+			fmt.Fprintf(&b, "line %d", i)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// sides rebuilds the old and new texts from an edit script
+func sides(script []Line) (old, cur []string) {
+	for _, l := range script {
+		if l.Op != OpInsert {
+			old = append(old, l.Text)
+		}
+		if l.Op != OpDelete {
+			cur = append(cur, l.Text)
+		}
+	}
+	return old, cur
+}
+
+func edits(script []Line) int {
+	n := 0
+	for _, l := range script {
+		if l.Op != OpEqual {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDiffLinesIsShortest(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		edits int
+	}{
+		{"", "", 0},
+		{"", "a\nb", 2},
+		{"a\nb", "", 2},
+		{"a\nb\nc", "a\nb\nc", 0},
+		{"a\nb\nc", "a\nx\nc", 2},
+		{"a\nb\nc\na\nb\nb\na", "c\nb\na\nb\na\nc", 5},
+		{"x\na\nb", "a\nb\nx", 2},
+	}
+	for _, tt := range tests {
+		script := diffLines(splitLines(tt.a), splitLines(tt.b))
+		old, cur := sides(script)
+		if !reflect.DeepEqual(old, splitLines(tt.a)) || !reflect.DeepEqual(cur, splitLines(tt.b)) {
+			t.Errorf("diff %q -> %q does not rebuild the texts: %v", tt.a, tt.b, script)
+		}
+		if n := edits(script); n != tt.edits {
+			t.Errorf("diff %q -> %q has %d edits, want %d", tt.a, tt.b, n, tt.edits)
+		}
+	}
+}
+
+func TestDiffLinesRebuildsRandomTexts(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	text := func() []string {
+		out := make([]string, r.Intn(30))
+		for i := range out {
+			out[i] = string(rune('a' + r.Intn(4)))
+		}
+		return out
+	}
+	for i := 0; i < 500; i++ {
+		a, b := text(), text()
+		old, cur := sides(diffLines(a, b))
+		if strings.Join(old, "") != strings.Join(a, "") || strings.Join(cur, "") != strings.Join(b, "") {
+			t.Fatalf("diff %v -> %v rebuilds %v -> %v", a, b, old, cur)
+		}
+	}
+}
+
+func TestDiffLinesGivesUpOnRewrites(t *testing.T) {
+	var a, b []string
+	for i := 0; i < maxEdits; i++ {
+		a = append(a, fmt.Sprintf("old %d", i))
+		b = append(b, fmt.Sprintf("new %d", i))
+	}
+	script := diffLines(a, b)
+	old, cur := sides(script)
+	if !reflect.DeepEqual(old, a) || !reflect.DeepEqual(cur, b) || edits(script) != 2*maxEdits {
+		t.Errorf("a full rewrite is not shown as removed and added")
+	}
+}
+
+func TestLineDiffHunks(t *testing.T) {
+	a := lines(20, nil)
+
+	h := LineDiff(a, lines(20, map[int]string{5: "five"}), DefaultContext)
+	if len(h) != 1 {
+		t.Fatalf("got %d hunks, want 1", len(h))
+	}
+	if h[0].OldStart != 2 || h[0].OldLines != 7 || h[0].NewStart != 2 || h[0].NewLines != 7 || len(h[0].Lines) != 8 {
+		t.Errorf("hunk %+v, want -2,7 +2,7 with 8 lines", h[0])
+	}
+
+	// Changes more than two contexts apart get their own hunks
+	h = LineDiff(a, lines(20, map[int]string{2: "two", 15: "fifteen"}), DefaultContext)
+	if len(h) != 2 || h[0].OldStart != 1 || h[1].OldStart != 12 || h[1].NewStart != 12 {
+		t.Errorf("hunks %+v, want two starting at lines 1 and 12", h)
+	}
+	h = LineDiff(a, lines(20, map[int]string{5: "five", 10: "ten"}), DefaultContext)
+	if len(h) != 1 || h[0].OldLines != 12 {
+		t.Errorf("hunks %+v, want one covering both changes", h)
+	}
+
+	// Inserting shifts the new side only
+	h = LineDiff("a\nb\n", "a\nx\nb\n", 0)
+	if len(h) != 1 || h[0].OldStart != 2 || h[0].OldLines != 0 || h[0].NewStart != 2 || h[0].NewLines != 1 {
+		t.Errorf("hunks %+v, want one insertion at line 2", h)
+	}
+	if h := LineDiff(a, a, DefaultContext); len(h) != 0 {
+		t.Errorf("equal texts give hunks %+v", h)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	from := &models.Revision{EntityType: models.ContentTask, Number: 1,
+		Snapshot: []byte(`{"title":"Speed","description_latex":"a\nb","points":1,"tags":["x"]}`)}
+	to := &models.Revision{EntityType: models.ContentTask, Number: 2,
+		Snapshot: []byte(`{"title":"Speed","description_latex":"a\nc","points":2,"tags":["x"]}`)}
+	changes, err := Compare(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Field != "description_latex" || changes[1].Field != "points" {
+		t.Fatalf("changes %+v, want description_latex and points", changes)
+	}
+	if len(changes[0].Hunks) != 1 || changes[0].Old != nil {
+		t.Errorf("text change %+v, want a line diff", changes[0])
+	}
+	if changes[1].Old != float64(1) || changes[1].New != float64(2) {
+		t.Errorf("points change %+v, want 1 -> 2", changes[1])
+	}
+
+	from.EntityType = "video"
+	if _, err := Compare(from, to); err == nil {
+		t.Errorf("comparing an unknown entity gave no error")
+	}
+}
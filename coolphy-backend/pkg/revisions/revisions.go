@@ -0,0 +1,255 @@
+// Package revisions keeps the append-only history of lectures and tasks:
+// a full snapshot per save, diffs between snapshots and restoring one.
+package revisions
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/lib/pq"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"coolphy-backend/pkg/models"
+)
+
+// LectureSnapshot is the content of a lecture kept in a revision
+type LectureSnapshot struct {
+	Title        string         `json:"title"`
+	Subject      string         `json:"subject"`
+	ContentLaTeX string         `json:"content_latex"`
+	Summary      string         `json:"summary"`
+	Tags         pq.StringArray `json:"tags"`
+	Level        string         `json:"level"`
+	VideoURL     string         `json:"video_url"`
+	VideoAssetID *uint          `json:"video_asset_id"`
+	AuthorID     uint           `json:"author_id"`
+	Status       string         `json:"status"`
+}
+
+// TaskSnapshot is the content of a task kept in a revision, the answers
+// hidden from students included
+type TaskSnapshot struct {
+	Title            string         `json:"title"`
+	DescriptionLaTeX string         `json:"description_latex"`
+	Subject          string         `json:"subject"`
+	Tags             pq.StringArray `json:"tags"`
+	Level            string         `json:"level"`
+	Type             string         `json:"type"`
+	CorrectAnswer    string         `json:"correct_answer"`
+	AnswerType       string         `json:"answer_type"`
+	AnswerSpec       datatypes.JSON `json:"answer_spec"`
+	Params           datatypes.JSON `json:"params"`
+	AnswerFormula    string         `json:"answer_formula"`
+	AnswerUnit       string         `json:"answer_unit"`
+	Tolerance        float64        `json:"tolerance"`
+	ToleranceMode    string         `json:"tolerance_mode"`
+	SolutionLaTeX    string         `json:"solution_latex"`
+	HintLaTeX        string         `json:"hint_latex"`
+	Points           int            `json:"points"`
+	Status           string         `json:"status"`
+}
+
+// Fields that describe who owns the content and whether it is visible
+// rather than what it says. Restoring a revision leaves them alone.
+var notRestored = map[string]bool{"AuthorID": true, "Status": true}
+
+func lectureSnapshot(l models.Lecture) LectureSnapshot {
+	return LectureSnapshot{
+		Title: l.Title, Subject: l.Subject, ContentLaTeX: l.ContentLaTeX, Summary: l.Summary,
+		Tags: l.Tags, Level: l.Level, VideoURL: l.VideoURL, VideoAssetID: l.VideoAssetID,
+		AuthorID: l.AuthorID, Status: l.Status,
+	}
+}
+
+func taskSnapshot(t models.Task) TaskSnapshot {
+	return TaskSnapshot{
+		Title: t.Title, DescriptionLaTeX: t.DescriptionLaTeX, Subject: t.Subject, Tags: t.Tags,
+		Level: t.Level, Type: t.Type, CorrectAnswer: t.CorrectAnswer, AnswerType: t.AnswerType,
+		AnswerSpec: t.AnswerSpec, Params: t.Params, AnswerFormula: t.AnswerFormula,
+		AnswerUnit: t.AnswerUnit, Tolerance: t.Tolerance, ToleranceMode: t.ToleranceMode,
+		SolutionLaTeX: t.SolutionLaTeX, HintLaTeX: t.HintLaTeX, Points: t.Points, Status: t.Status,
+	}
+}
+
+// snapshot loads the entity, locking its row until the transaction ends so
+// concurrent saves get consecutive revision numbers
+func snapshot(tx *gorm.DB, entityType string, id uint) (any, error) {
+	locked := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	switch entityType {
+	case models.ContentLecture:
+		var l models.Lecture
+		if err := locked.First(&l, id).Error; err != nil {
+			return nil, err
+		}
+		return lectureSnapshot(l), nil
+	case models.ContentTask:
+		var t models.Task
+		if err := locked.First(&t, id).Error; err != nil {
+			return nil, err
+		}
+		return taskSnapshot(t), nil
+	}
+	return nil, fmt.Errorf("unknown revision entity %q", entityType)
+}
+
+// Record appends a revision with the current state of the lecture or task.
+// Call it in the transaction that saved the entity.
+func Record(tx *gorm.DB, entityType string, id uint, authorID *uint, action string, restoredFrom *int) (*models.Revision, error) {
+	snap, err := snapshot(tx, entityType, id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+	var last int
+	if err := tx.Model(&models.Revision{}).
+		Where("entity_type = ? AND entity_id = ?", entityType, id).
+		Select("COALESCE(MAX(number), 0)").Scan(&last).Error; err != nil {
+		return nil, err
+	}
+	rev := models.Revision{
+		EntityType:   entityType,
+		EntityID:     id,
+		Number:       last + 1,
+		Action:       action,
+		RestoredFrom: restoredFrom,
+		AuthorID:     authorID,
+		Snapshot:     data,
+	}
+	if err := tx.Create(&rev).Error; err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// Baseline records the state of content saved before revisions existed, so
+// the first edit can be undone. It does nothing if there is a revision.
+func Baseline(tx *gorm.DB, entityType string, id uint) error {
+	var n int64
+	if err := tx.Model(&models.Revision{}).
+		Where("entity_type = ? AND entity_id = ?", entityType, id).Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := Record(tx, entityType, id, nil, models.RevisionBaseline, nil)
+	return err
+}
+
+// Find returns revision number of the entity
+func Find(tx *gorm.DB, entityType string, id uint, number int) (*models.Revision, error) {
+	var rev models.Revision
+	err := tx.Where("entity_type = ? AND entity_id = ? AND number = ?", entityType, id, number).First(&rev).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// Latest returns the newest revision of the entity
+func Latest(tx *gorm.DB, entityType string, id uint) (*models.Revision, error) {
+	var rev models.Revision
+	err := tx.Where("entity_type = ? AND entity_id = ?", entityType, id).Order("number DESC").First(&rev).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// Restore writes the content of revision number back to the entity and
+// records that as a new revision; history is never rewritten
+func Restore(tx *gorm.DB, entityType string, id uint, number int, authorID *uint) (*models.Revision, error) {
+	rev, err := Find(tx, entityType, id, number)
+	if err != nil {
+		return nil, err
+	}
+	var snap any
+	var model any
+	switch entityType {
+	case models.ContentLecture:
+		snap, model = &LectureSnapshot{}, &models.Lecture{ID: id}
+	case models.ContentTask:
+		snap, model = &TaskSnapshot{}, &models.Task{ID: id}
+	default:
+		return nil, fmt.Errorf("unknown revision entity %q", entityType)
+	}
+	if err := json.Unmarshal(rev.Snapshot, snap); err != nil {
+		return nil, fmt.Errorf("revision %d: %w", number, err)
+	}
+	if err := tx.Model(model).Updates(columns(snap)).Error; err != nil {
+		return nil, err
+	}
+	return Record(tx, entityType, id, authorID, models.RevisionRestore, &number)
+}
+
+// columns maps the restorable snapshot fields to the model fields of the
+// same name. A map makes gorm write empty values too.
+func columns(snap any) map[string]any {
+	v := reflect.ValueOf(snap).Elem()
+	cols := map[string]any{}
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if !notRestored[name] {
+			cols[name] = v.Field(i).Interface()
+		}
+	}
+	return cols
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	return name
+}
+
+// Change is a field that differs between two revisions. Text fields get a
+// line diff, other fields their old and new values.
+type Change struct {
+	Field string `json:"field"`
+	Hunks []Hunk `json:"hunks,omitempty"`
+	Old   any    `json:"old,omitempty"`
+	New   any    `json:"new,omitempty"`
+}
+
+// Compare lists the fields changed from one revision to another, in the
+// order of the snapshot type
+func Compare(from, to *models.Revision) ([]Change, error) {
+	var fields reflect.Type
+	switch from.EntityType {
+	case models.ContentLecture:
+		fields = reflect.TypeOf(LectureSnapshot{})
+	case models.ContentTask:
+		fields = reflect.TypeOf(TaskSnapshot{})
+	default:
+		return nil, fmt.Errorf("unknown revision entity %q", from.EntityType)
+	}
+	var a, b map[string]any
+	if err := json.Unmarshal(from.Snapshot, &a); err != nil {
+		return nil, fmt.Errorf("revision %d: %w", from.Number, err)
+	}
+	if err := json.Unmarshal(to.Snapshot, &b); err != nil {
+		return nil, fmt.Errorf("revision %d: %w", to.Number, err)
+	}
+	changes := []Change{}
+	for i := 0; i < fields.NumField(); i++ {
+		name := jsonName(fields.Field(i))
+		old, cur := a[name], b[name]
+		if reflect.DeepEqual(old, cur) {
+			continue
+		}
+		if fields.Field(i).Type.Kind() == reflect.String {
+			s, _ := old.(string)
+			t, _ := cur.(string)
+			changes = append(changes, Change{Field: name, Hunks: LineDiff(s, t, DefaultContext)})
+			continue
+		}
+		changes = append(changes, Change{Field: name, Old: old, New: cur})
+	}
+	return changes, nil
+}
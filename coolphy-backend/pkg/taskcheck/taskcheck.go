@@ -0,0 +1,82 @@
+// Package taskcheck holds the grading checks every way of saving a task goes
+// through: the task editor, the bulk import and bundle import. A task that
+// passes can be graded; one that doesn't would fail or panic when a student
+// answers it.
+package taskcheck
+
+import (
+	"fmt"
+
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/judge"
+	"coolphy-backend/pkg/models"
+)
+
+// FieldError is a problem with one field of the task, named as in the task
+// editor's JSON
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string { return e.Message }
+
+func fail(field, format string, args ...any) *FieldError {
+	return &FieldError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// Validate checks the grading settings of the task as it will be stored: the
+// answer type and spec, the correct answer, the tolerance and the parameters.
+// The error is a *FieldError.
+func Validate(t *models.Task) error {
+	spec, err := t.DecodeAnswerSpec()
+	if err != nil {
+		return fail("answer_spec", "answer_spec: %v", err)
+	}
+	switch t.AnswerType {
+	case grading.AnswerAuto, grading.AnswerNumeric, grading.AnswerText, grading.AnswerExpression, grading.AnswerFree:
+	case grading.AnswerChoice, grading.AnswerMultiPart, grading.AnswerInterval, grading.AnswerSet, grading.AnswerOrdered:
+		if err := grading.ValidateSpec(t.AnswerType, spec); err != nil {
+			return fail("answer_spec", "%v", err)
+		}
+	case grading.AnswerCode:
+		if err := judge.ValidateSpec(spec); err != nil {
+			return fail("answer_spec", "%v", err)
+		}
+	default:
+		return fail("answer_type", "unknown answer_type %q", t.AnswerType)
+	}
+	switch t.ToleranceMode {
+	case "", grading.ToleranceRelative, grading.ToleranceAbsolute:
+	default:
+		return fail("tolerance_mode", "tolerance_mode must be relative or absolute")
+	}
+	if t.Tolerance < 0 {
+		return fail("tolerance", "tolerance must not be negative")
+	}
+	if t.AnswerType == grading.AnswerNumeric && t.CorrectAnswer != "" {
+		if _, err := grading.ParseQuantity(t.CorrectAnswer); err != nil {
+			return fail("correct_answer", "correct_answer is not a number: %v", err)
+		}
+	}
+	if t.AnswerType == grading.AnswerExpression && t.CorrectAnswer != "" {
+		if _, err := grading.ParseExpr(t.CorrectAnswer); err != nil {
+			return fail("correct_answer", "correct_answer is not a valid expression: %v", err)
+		}
+	}
+
+	params, err := t.DecodeParams()
+	if err != nil {
+		return fail("params", "params: %v", err)
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	if t.AnswerType != grading.AnswerAuto && t.AnswerType != grading.AnswerNumeric {
+		return fail("params", "params are only supported for numeric answers")
+	}
+	if err := grading.ValidateParams(params, t.AnswerFormula, t.AnswerUnit); err != nil {
+		return fail("params", "%v", err)
+	}
+	return nil
+}
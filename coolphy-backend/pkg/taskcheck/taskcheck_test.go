@@ -0,0 +1,51 @@
+package taskcheck
+
+import (
+	"errors"
+	"testing"
+
+	"coolphy-backend/pkg/models"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		task  models.Task
+		field string // empty when valid
+	}{
+		{name: "auto", task: models.Task{CorrectAnswer: "42"}},
+		{name: "numeric", task: models.Task{AnswerType: "numeric", CorrectAnswer: "1.5 km"}},
+		{name: "numeric without an answer", task: models.Task{AnswerType: "numeric"}},
+		{name: "not a number", task: models.Task{AnswerType: "numeric", CorrectAnswer: "many"}, field: "correct_answer"},
+		{name: "bad expression", task: models.Task{AnswerType: "expression", CorrectAnswer: "(x"}, field: "correct_answer"},
+		{name: "unknown type", task: models.Task{AnswerType: "essay"}, field: "answer_type"},
+		{name: "choice without spec", task: models.Task{AnswerType: "choice"}, field: "answer_spec"},
+		{
+			name: "choice",
+			task: models.Task{AnswerType: "choice", AnswerSpec: []byte(`{"options":[{"id":"a","text":"1"},{"id":"b","text":"2"}],"correct":["a"]}`)},
+		},
+		{name: "broken spec", task: models.Task{AnswerType: "choice", AnswerSpec: []byte(`{"options":`)}, field: "answer_spec"},
+		{name: "code without tests", task: models.Task{AnswerType: "code", AnswerSpec: []byte(`{}`)}, field: "answer_spec"},
+		{name: "tolerance mode", task: models.Task{ToleranceMode: "percent"}, field: "tolerance_mode"},
+		{name: "negative tolerance", task: models.Task{Tolerance: -1}, field: "tolerance"},
+		{
+			name: "params",
+			task: models.Task{Params: []byte(`[{"name":"m","min":1,"max":5}]`), AnswerFormula: "2m", AnswerUnit: "kg"},
+		},
+		{name: "params on text", task: models.Task{AnswerType: "text", Params: []byte(`[{"name":"m","values":[1]}]`), AnswerFormula: "m"}, field: "params"},
+		{name: "params without range", task: models.Task{Params: []byte(`[{"name":"m"}]`), AnswerFormula: "m"}, field: "params"},
+		{name: "formula divides by zero", task: models.Task{Params: []byte(`[{"name":"m","min":0,"max":9}]`), AnswerFormula: "1/m"}, field: "params"},
+	}
+	for _, tt := range tests {
+		err := Validate(&tt.task)
+		var fe *FieldError
+		switch {
+		case tt.field == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.field != "" && !errors.As(err, &fe):
+			t.Errorf("%s: error %v, want a FieldError on %s", tt.name, err, tt.field)
+		case tt.field != "" && fe.Field != tt.field:
+			t.Errorf("%s: error on %s (%v), want %s", tt.name, fe.Field, err, tt.field)
+		}
+	}
+}
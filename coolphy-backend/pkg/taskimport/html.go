@@ -0,0 +1,205 @@
+package taskimport
+
+import (
+	"encoding/xml"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// converter turns the HTML of question banks into LaTeX: paragraphs,
+// emphasis, lists and sub/superscripts are kept, math written as \( \),
+// \[ \] or $ $ passes through, and characters special to LaTeX outside math
+// are escaped. Images and MathML can't be carried over and are noted.
+type converter struct {
+	b      strings.Builder
+	closer string // end of the math span we are in, "" outside math
+	notes  []string
+	// hook handles an element itself, e.g. a QTI interaction, consuming it
+	// from d; it returns false to let the converter handle it
+	hook func(d *xml.Decoder, se xml.StartElement) (bool, error)
+}
+
+var inlineTags = map[string][2]string{
+	"b": {`\textbf{`, "}"}, "strong": {`\textbf{`, "}"},
+	"i": {`\emph{`, "}"}, "em": {`\emph{`, "}"},
+	"u":   {`\underline{`, "}"},
+	"sup": {`\textsuperscript{`, "}"}, "sub": {`\textsubscript{`, "}"},
+	"ul": {"\n\\begin{itemize}\n", "\n\\end{itemize}\n"},
+	"ol": {"\n\\begin{enumerate}\n", "\n\\end{enumerate}\n"},
+	"li": {"\n\\item ", ""},
+}
+
+var blockTags = map[string]bool{
+	"p": true, "div": true, "br": true, "tr": true, "table": true, "blockquote": true, "pre": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// htmlToLaTeX converts a fragment of HTML
+func htmlToLaTeX(src string) (string, []string) {
+	var c converter
+	return c.convert(src)
+}
+
+// textToLaTeX converts plain text, escaping it the same way
+func textToLaTeX(src string) string {
+	var c converter
+	c.text(src, true)
+	return tidy(c.b.String())
+}
+
+func (c *converter) convert(src string) (string, []string) {
+	c.b.Reset()
+	c.closer, c.notes = "", nil
+	d := xml.NewDecoder(strings.NewReader("<root>" + src + "</root>"))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	if err := c.walk(d); err != nil {
+		// Broken markup: keep the text
+		c.b.Reset()
+		c.closer = ""
+		c.text(html.UnescapeString(tagRe.ReplaceAllString(src, " ")), false)
+	}
+	return tidy(c.b.String()), c.notes
+}
+
+var tagRe = regexp.MustCompile(`<[^>]*>`)
+
+func (c *converter) walk(d *xml.Decoder) error {
+	var open []string // closing text of the open elements
+	var names []string
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			if c.hook != nil {
+				handled, err := c.hook(d, t)
+				if err != nil {
+					return err
+				}
+				if handled {
+					continue
+				}
+			}
+			switch {
+			case name == "img":
+				c.note("an image was left out")
+				d.Skip()
+				continue
+			case name == "math":
+				c.note("MathML was left out; write formulas in LaTeX")
+				d.Skip()
+				continue
+			case name == "script" || name == "style":
+				d.Skip()
+				continue
+			case name == "td" || name == "th":
+				c.b.WriteString(" ")
+			case blockTags[name]:
+				c.b.WriteString("\n\n")
+			}
+			tags := inlineTags[name]
+			c.b.WriteString(tags[0])
+			open, names = append(open, tags[1]), append(names, name)
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			for i := len(names) - 1; i >= 0; i-- {
+				if names[i] != name {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					c.b.WriteString(open[j])
+				}
+				open, names = open[:i], names[:i]
+				break
+			}
+			if blockTags[name] {
+				c.b.WriteString("\n\n")
+			}
+		case xml.CharData:
+			c.text(string(t), false)
+		}
+	}
+}
+
+func (c *converter) note(msg string) {
+	for _, n := range c.notes {
+		if n == msg {
+			return
+		}
+	}
+	c.notes = append(c.notes, msg)
+}
+
+// text writes text, escaping outside math; HTML whitespace collapses unless
+// keepLines
+func (c *converter) text(s string, keepLines bool) {
+	rs := []rune(strings.ReplaceAll(s, "\u00a0", " "))
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		next := rune(0)
+		if i+1 < len(rs) {
+			next = rs[i+1]
+		}
+		if c.closer != "" {
+			c.b.WriteRune(r)
+			if strings.HasPrefix(string(rs[i:]), c.closer) {
+				c.b.WriteString(c.closer[1:])
+				i += len([]rune(c.closer)) - 1
+				c.closer = ""
+			}
+			continue
+		}
+		switch {
+		case r == '\\' && (next == '(' || next == '['):
+			c.closer = map[rune]string{'(': `\)`, '[': `\]`}[next]
+			c.b.WriteRune(r)
+			c.b.WriteRune(next)
+			i++
+		case r == '\\' && next != 0:
+			// An escape or a command, kept as written
+			c.b.WriteRune(r)
+			c.b.WriteRune(next)
+			i++
+		case r == '$' && next == '$':
+			c.closer = "$$"
+			c.b.WriteString("$$")
+			i++
+		case r == '$':
+			c.closer = "$"
+			c.b.WriteRune(r)
+		case r == '%' || r == '&' || r == '#' || r == '_':
+			c.b.WriteRune('\\')
+			c.b.WriteRune(r)
+		case r == '\n' && keepLines:
+			c.b.WriteRune(r)
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			c.b.WriteRune(' ')
+		default:
+			c.b.WriteRune(r)
+		}
+	}
+}
+
+var (
+	spacesRe = regexp.MustCompile(`[ \t]+`)
+	breaksRe = regexp.MustCompile(`\n{3,}`)
+)
+
+// tidy collapses spaces and blank lines
+func tidy(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(spacesRe.ReplaceAllString(l, " "))
+	}
+	return strings.TrimSpace(breaksRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
@@ -0,0 +1,150 @@
+package taskimport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/revisions"
+)
+
+// ErrUnavailable is returned when the import queue isn't running or is full
+var ErrUnavailable = errors.New("task import is unavailable")
+
+// progressEvery is how many rows pass between progress saves
+const progressEvery = 25
+
+type job struct {
+	id   uint
+	data []byte
+}
+
+var queue chan job
+
+// Start runs the import worker. Uploads are kept in memory only, so jobs
+// left unfinished by a previous run are marked failed.
+func Start() {
+	now := time.Now()
+	db.Get().Model(&models.ImportJob{}).Where("status IN ?", []string{models.ImportPending, models.ImportRunning}).
+		Updates(map[string]interface{}{"status": models.ImportFailed, "error": "the server restarted before the import finished", "finished_at": now})
+	queue = make(chan job, 16)
+	go func() {
+		for j := range queue {
+			run(j)
+		}
+	}()
+}
+
+// Submit queues a saved job with the uploaded file without blocking
+func Submit(id uint, data []byte) error {
+	if queue == nil {
+		return ErrUnavailable
+	}
+	select {
+	case queue <- job{id: id, data: data}:
+		return nil
+	default:
+		return ErrUnavailable
+	}
+}
+
+func run(j job) {
+	var ij models.ImportJob
+	if err := db.Get().First(&ij, j.id).Error; err != nil {
+		log.Printf("taskimport: job %d: %v", j.id, err)
+		return
+	}
+	now := time.Now()
+	ij.Status, ij.StartedAt = models.ImportRunning, &now
+	db.Get().Model(&ij).Updates(map[string]interface{}{"status": ij.Status, "started_at": now})
+
+	if err := process(&ij, j.data); err != nil {
+		log.Printf("taskimport: job %d: %v", ij.ID, err)
+		ij.Status, ij.Error = models.ImportFailed, err.Error()
+	} else {
+		ij.Status = models.ImportDone
+	}
+	done := time.Now()
+	ij.FinishedAt = &done
+	if err := db.Get().Save(&ij).Error; err != nil {
+		log.Printf("taskimport: job %d: %v", ij.ID, err)
+	}
+}
+
+// process validates every record and, unless it is a dry run, creates the
+// valid ones as draft tasks, each in its own transaction
+func process(ij *models.ImportJob, data []byte) error {
+	var opts Options
+	if len(ij.Options) > 0 {
+		if err := json.Unmarshal(ij.Options, &opts); err != nil {
+			return err
+		}
+	}
+	recs, errs, err := Parse(ij.Format, data, opts)
+	if err != nil {
+		return err
+	}
+	failedRows := map[int]bool{}
+	for _, e := range errs {
+		failedRows[e.Row] = true
+	}
+	ij.Total, ij.Failed = len(recs)+len(failedRows), len(failedRows)
+	ij.Processed = ij.Failed
+	taskIDs := []uint{}
+	for i := range recs {
+		rec := &recs[i]
+		rowErrs := Check(rec)
+		errs = append(errs, rowErrs...)
+		switch {
+		case HasErrors(rowErrs):
+			ij.Failed++
+		case ij.DryRun:
+			ij.Created++
+		default:
+			id, err := create(rec, ij.UserID, opts.TopicID)
+			if err != nil {
+				log.Printf("taskimport: job %d row %d: %v", ij.ID, rec.Row, err)
+				errs = append(errs, rowError(rec.Row, rec.Ref, "", "could not save the task"))
+				ij.Failed++
+				break
+			}
+			taskIDs = append(taskIDs, id)
+			ij.Created++
+		}
+		ij.Processed++
+		if ij.Processed%progressEvery == 0 {
+			db.Get().Model(ij).Updates(map[string]interface{}{
+				"total": ij.Total, "processed": ij.Processed, "created": ij.Created, "failed": ij.Failed,
+			})
+		}
+	}
+	if errs == nil {
+		errs = []RowError{}
+	}
+	ij.Errors, _ = json.Marshal(errs)
+	ij.TaskIDs, _ = json.Marshal(taskIDs)
+	return nil
+}
+
+func create(rec *Record, userID uint, topicID *uint) (uint, error) {
+	t := rec.Task
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&t).Error; err != nil {
+			return err
+		}
+		if topicID != nil {
+			if err := tx.Exec("INSERT INTO task_topics (task_id, topic_id) VALUES (?, ?) ON CONFLICT DO NOTHING", t.ID, *topicID).Error; err != nil {
+				return fmt.Errorf("topic: %w", err)
+			}
+		}
+		_, err := revisions.Record(tx, models.ContentTask, t.ID, &userID, models.RevisionCreate, nil)
+		return err
+	})
+	return t.ID, err
+}
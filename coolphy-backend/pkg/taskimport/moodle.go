@@ -0,0 +1,191 @@
+package taskimport
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/models"
+)
+
+type moodleText struct {
+	Format string `xml:"format,attr"`
+	Text   string `xml:"text"`
+}
+
+type moodleQuestion struct {
+	Type            string     `xml:"type,attr"`
+	Category        moodleText `xml:"category"`
+	Name            moodleText `xml:"name"`
+	QuestionText    moodleText `xml:"questiontext"`
+	GeneralFeedback moodleText `xml:"generalfeedback"`
+	DefaultGrade    string     `xml:"defaultgrade"`
+	Single          string     `xml:"single"`
+	Answers         []struct {
+		Fraction  string `xml:"fraction,attr"`
+		Format    string `xml:"format,attr"`
+		Text      string `xml:"text"`
+		Tolerance string `xml:"tolerance"`
+	} `xml:"answer"`
+	Units []struct {
+		Name       string `xml:"unit_name"`
+		Multiplier string `xml:"multiplier"`
+	} `xml:"units>unit"`
+	Hints []moodleText `xml:"hint"`
+	Tags  []string     `xml:"tags>tag>text"`
+}
+
+// readMoodle reads a Moodle XML question bank. Categories become tags of
+// the questions that follow them; description questions are skipped.
+func readMoodle(data []byte) ([]Record, []RowError, error) {
+	var quiz struct {
+		Questions []moodleQuestion `xml:"question"`
+	}
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&quiz); err != nil {
+		return nil, nil, fmt.Errorf("not a Moodle XML file: %v", err)
+	}
+	var recs []Record
+	var errs []RowError
+	var category []string
+	n := 0
+	for _, q := range quiz.Questions {
+		switch q.Type {
+		case "category":
+			category = categoryTags(q.Category.Text)
+			continue
+		case "description":
+			continue
+		}
+		n++
+		rec, err := fromMoodle(n, q)
+		if err != nil {
+			errs = append(errs, *err)
+			continue
+		}
+		rec.Task.Tags = append(rec.Task.Tags, category...)
+		recs = append(recs, rec)
+	}
+	return recs, errs, nil
+}
+
+// categoryTags turns "$course$/top/Mechanics/Kinematics" into its named
+// levels
+func categoryTags(path string) []string {
+	var tags []string
+	for _, p := range strings.Split(path, "/") {
+		p = strings.TrimSpace(p)
+		if p == "" || p == "top" || strings.HasPrefix(p, "$") {
+			continue
+		}
+		tags = append(tags, p)
+	}
+	return tags
+}
+
+func (r *Record) moodleText(field string, t moodleText) string {
+	return r.markup(field, t.Format, t.Text)
+}
+
+// markup converts text in a Moodle format to LaTeX
+func (r *Record) markup(field, format, text string) string {
+	if format != "" && format != "html" {
+		return textToLaTeX(text)
+	}
+	s, notes := htmlToLaTeX(text)
+	for _, n := range notes {
+		r.warn(field, "%s", n)
+	}
+	return s
+}
+
+func fraction(s string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return f
+}
+
+func fromMoodle(n int, q moodleQuestion) (Record, *RowError) {
+	r := Record{Row: n, Ref: strings.TrimSpace(q.Name.Text)}
+	fail := func(field, format string, args ...any) (Record, *RowError) {
+		e := rowError(n, r.Ref, field, format, args...)
+		return r, &e
+	}
+	t := &r.Task
+	t.Title = r.Ref
+	t.DescriptionLaTeX = r.moodleText("description", q.QuestionText)
+	t.SolutionLaTeX = r.moodleText("solution", q.GeneralFeedback)
+	if len(q.Hints) > 0 {
+		t.HintLaTeX = r.moodleText("hint", q.Hints[0])
+	}
+	for _, tag := range q.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			t.Tags = append(t.Tags, tag)
+		}
+	}
+	if g, err := strconv.ParseFloat(strings.TrimSpace(q.DefaultGrade), 64); err == nil && g > 0 {
+		t.Points = int(math.Round(g))
+	}
+
+	switch q.Type {
+	case "multichoice", "truefalse":
+		t.AnswerType = grading.AnswerChoice
+		spec := &models.AnswerSpec{Multiple: q.Type == "multichoice" && q.Single == "false"}
+		best := 0.0
+		for _, a := range q.Answers {
+			best = math.Max(best, fraction(a.Fraction))
+		}
+		for i, a := range q.Answers {
+			text := r.markup(fmt.Sprintf("options[%d]", i), a.Format, a.Text)
+			if q.Type == "truefalse" {
+				text = map[string]string{"true": "True", "false": "False"}[strings.ToLower(strings.TrimSpace(a.Text))]
+			}
+			spec.Options = append(spec.Options, models.AnswerOption{ID: optionID(i), Text: text})
+			f := fraction(a.Fraction)
+			if spec.Multiple && f > 0 || !spec.Multiple && f == best && f > 0 {
+				spec.Correct = append(spec.Correct, optionID(i))
+			}
+		}
+		if spec.Multiple {
+			spec.PartialCredit = true
+		}
+		r.Spec = spec
+	case "shortanswer", "numerical":
+		t.AnswerType = grading.AnswerText
+		if q.Type == "numerical" {
+			t.AnswerType = grading.AnswerNumeric
+		}
+		var correct []int
+		for i, a := range q.Answers {
+			if fraction(a.Fraction) == 100 {
+				correct = append(correct, i)
+			}
+		}
+		if len(correct) == 0 {
+			return fail("answer", "no answer with full marks")
+		}
+		a := q.Answers[correct[0]]
+		t.CorrectAnswer = strings.TrimSpace(a.Text)
+		if len(correct) > 1 {
+			r.warn("answer", "only the first of %d accepted answers was kept", len(correct))
+		}
+		if q.Type == "numerical" {
+			if tol, err := strconv.ParseFloat(strings.TrimSpace(a.Tolerance), 64); err == nil && tol > 0 {
+				t.Tolerance, t.ToleranceMode = tol, grading.ToleranceAbsolute
+			}
+			for _, u := range q.Units {
+				if m, err := strconv.ParseFloat(strings.TrimSpace(u.Multiplier), 64); err == nil && m == 1 {
+					t.AnswerUnit = strings.TrimSpace(u.Name)
+					break
+				}
+			}
+		}
+	case "essay":
+		t.AnswerType = grading.AnswerFree
+	default:
+		return fail("type", "Moodle question type %q is not supported", q.Type)
+	}
+	return r, nil
+}
@@ -0,0 +1,282 @@
+package taskimport
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/models"
+)
+
+type qtiResponse struct {
+	Identifier  string   `xml:"identifier,attr"`
+	Cardinality string   `xml:"cardinality,attr"`
+	BaseType    string   `xml:"baseType,attr"`
+	Correct     []string `xml:"correctResponse>value"`
+	Mapping     []struct {
+		Key string `xml:"mapKey,attr"`
+	} `xml:"mapping>mapEntry"`
+}
+
+// answers are the correct values, or the first mapped one
+func (r qtiResponse) answers() []string {
+	var out []string
+	for _, v := range r.Correct {
+		out = append(out, strings.TrimSpace(v))
+	}
+	if len(out) == 0 && len(r.Mapping) > 0 {
+		out = append(out, strings.TrimSpace(r.Mapping[0].Key))
+	}
+	return out
+}
+
+type qtiInner struct {
+	Inner string `xml:",innerxml"`
+}
+
+type qtiItem struct {
+	XMLName    xml.Name
+	Identifier string        `xml:"identifier,attr"`
+	Title      string        `xml:"title,attr"`
+	Responses  []qtiResponse `xml:"responseDeclaration"`
+	Body       qtiInner      `xml:"itemBody"`
+	Feedback   []qtiInner    `xml:"modalFeedback"`
+}
+
+// qtiInteraction is an interaction of the item body
+type qtiInteraction struct {
+	Kind     string // choice, order, text, extended or the unsupported element name
+	Response string
+	Choices  []qtiChoice
+}
+
+type qtiChoice struct {
+	Identifier string `xml:"identifier,attr"`
+	Inner      string `xml:",innerxml"`
+}
+
+// readQTI reads a QTI 2.1 assessment item, or the items of a content
+// package zip in file name order
+func readQTI(data []byte) ([]Record, []RowError, error) {
+	docs := [][]byte{data}
+	if bytes.HasPrefix(data, []byte("PK")) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, nil, errors.New("not a QTI package")
+		}
+		docs = nil
+		var names []string
+		files := map[string]*zip.File{}
+		for _, f := range zr.File {
+			if strings.EqualFold(path.Ext(f.Name), ".xml") && path.Base(f.Name) != "imsmanifest.xml" {
+				names = append(names, f.Name)
+				files[f.Name] = f
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			rc, err := files[name].Open()
+			if err != nil {
+				return nil, nil, err
+			}
+			doc, err := io.ReadAll(io.LimitReader(rc, maxXMLPart))
+			rc.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+			docs = append(docs, doc)
+		}
+	}
+	var recs []Record
+	var errs []RowError
+	n := 0
+	for _, doc := range docs {
+		var item qtiItem
+		if err := xml.NewDecoder(bytes.NewReader(doc)).Decode(&item); err != nil || item.XMLName.Local != "assessmentItem" {
+			// Tests, stylesheets and other package files
+			continue
+		}
+		n++
+		rec, err := fromQTI(n, item)
+		if err != nil {
+			errs = append(errs, *err)
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	if n == 0 {
+		return nil, nil, errors.New("no QTI assessment items found")
+	}
+	return recs, errs, nil
+}
+
+// entryBlank stands for a text entry in the description until they are counted
+const entryBlank = "\x00blank\x00"
+
+func fromQTI(n int, item qtiItem) (Record, *RowError) {
+	r := Record{Row: n, Ref: item.Identifier}
+	fail := func(field, format string, args ...any) (Record, *RowError) {
+		e := rowError(n, r.Ref, field, format, args...)
+		return r, &e
+	}
+	var interactions []qtiInteraction
+	var c converter
+	c.hook = func(d *xml.Decoder, se xml.StartElement) (bool, error) {
+		name := se.Name.Local
+		if !strings.HasSuffix(name, "Interaction") {
+			return false, nil
+		}
+		var v struct {
+			Response string      `xml:"responseIdentifier,attr"`
+			Prompt   qtiInner    `xml:"prompt"`
+			Choices  []qtiChoice `xml:"simpleChoice"`
+		}
+		if err := d.DecodeElement(&v, &se); err != nil {
+			return false, err
+		}
+		kind := map[string]string{
+			"choiceInteraction":       "choice",
+			"orderInteraction":        "order",
+			"textEntryInteraction":    "text",
+			"extendedTextInteraction": "extended",
+		}[name]
+		if kind == "" {
+			kind = name
+		}
+		interactions = append(interactions, qtiInteraction{Kind: kind, Response: v.Response, Choices: v.Choices})
+		if v.Prompt.Inner != "" {
+			prompt, notes := htmlToLaTeX(v.Prompt.Inner)
+			for _, note := range notes {
+				r.warn("description", "%s", note)
+			}
+			fmt.Fprintf(&c.b, "\n\n%s\n\n", prompt)
+		}
+		if kind == "text" {
+			c.b.WriteString(" " + entryBlank + " ")
+		}
+		return true, nil
+	}
+	desc, notes := c.convert(item.Body.Inner)
+	// Number the blanks when there are several
+	for k := 1; strings.Contains(desc, entryBlank); k++ {
+		label := `\underline{\hspace{2cm}}`
+		if strings.Count(desc, entryBlank) > 1 || k > 1 {
+			label += fmt.Sprintf(" (%d)", k)
+		}
+		desc = strings.Replace(desc, entryBlank, label, 1)
+	}
+	for _, note := range notes {
+		r.warn("description", "%s", note)
+	}
+	t := &r.Task
+	t.Title = strings.TrimSpace(item.Title)
+	t.DescriptionLaTeX = desc
+	var feedback []string
+	for _, f := range item.Feedback {
+		text, notes := htmlToLaTeX(f.Inner)
+		for _, note := range notes {
+			r.warn("solution", "%s", note)
+		}
+		if text != "" {
+			feedback = append(feedback, text)
+		}
+	}
+	t.SolutionLaTeX = strings.Join(feedback, "\n\n")
+
+	responses := map[string]qtiResponse{}
+	for _, rd := range item.Responses {
+		responses[rd.Identifier] = rd
+	}
+	if len(interactions) == 0 {
+		return fail("type", "the item has no interaction")
+	}
+	kinds := map[string]bool{}
+	for _, in := range interactions {
+		kinds[in.Kind] = true
+	}
+	if len(interactions) > 1 && !(len(kinds) == 1 && kinds["text"]) {
+		return fail("type", "items with several interactions are only supported when all are text entries")
+	}
+	in := interactions[0]
+	rd := responses[in.Response]
+	switch in.Kind {
+	case "choice":
+		t.AnswerType = grading.AnswerChoice
+		spec := &models.AnswerSpec{Multiple: rd.Cardinality == "multiple"}
+		ids := map[string]string{}
+		for i, ch := range in.Choices {
+			text, _ := htmlToLaTeX(ch.Inner)
+			spec.Options = append(spec.Options, models.AnswerOption{ID: optionID(i), Text: text})
+			ids[ch.Identifier] = optionID(i)
+		}
+		for _, v := range rd.answers() {
+			id, ok := ids[v]
+			if !ok {
+				return fail("answer", "correct response %q is not one of the choices", v)
+			}
+			spec.Correct = append(spec.Correct, id)
+		}
+		spec.PartialCredit = spec.Multiple
+		r.Spec = spec
+	case "order":
+		// Students type the items in order, so the description lists them
+		t.AnswerType = grading.AnswerOrdered
+		texts := map[string]string{}
+		var list strings.Builder
+		list.WriteString("\n\n\\begin{itemize}\n")
+		for _, ch := range in.Choices {
+			text, _ := htmlToLaTeX(ch.Inner)
+			texts[ch.Identifier] = text
+			fmt.Fprintf(&list, "\\item %s\n", text)
+		}
+		list.WriteString("\\end{itemize}")
+		t.DescriptionLaTeX += list.String()
+		spec := &models.AnswerSpec{ItemType: grading.AnswerText}
+		for _, v := range rd.answers() {
+			text, ok := texts[v]
+			if !ok {
+				return fail("answer", "correct response %q is not one of the choices", v)
+			}
+			spec.Correct = append(spec.Correct, text)
+		}
+		r.Spec = spec
+	case "text":
+		if len(interactions) == 1 {
+			t.AnswerType = qtiValueType(rd.BaseType)
+			if answers := rd.answers(); len(answers) > 0 {
+				t.CorrectAnswer = answers[0]
+			}
+			break
+		}
+		t.AnswerType = grading.AnswerMultiPart
+		spec := &models.AnswerSpec{}
+		for i, in := range interactions {
+			rd := responses[in.Response]
+			part := models.AnswerPart{Label: fmt.Sprint(i + 1), Type: qtiValueType(rd.BaseType), Weight: 1}
+			if answers := rd.answers(); len(answers) > 0 {
+				part.Answer = answers[0]
+			}
+			spec.Parts = append(spec.Parts, part)
+		}
+		r.Spec = spec
+	case "extended":
+		t.AnswerType = grading.AnswerFree
+	default:
+		return fail("type", "QTI %s is not supported", in.Kind)
+	}
+	return r, nil
+}
+
+func qtiValueType(baseType string) string {
+	if baseType == "float" || baseType == "integer" {
+		return grading.AnswerNumeric
+	}
+	return grading.AnswerText
+}
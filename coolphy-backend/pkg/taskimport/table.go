@@ -0,0 +1,332 @@
+package taskimport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/models"
+)
+
+// tableRow is a spreadsheet line with its number, from 1
+type tableRow struct {
+	n     int
+	cells []string
+}
+
+// Header names understood without a column mapping, normalized by
+// headerKey. The task fields are those of the task editor.
+var columnAliases = map[string]string{
+	"title": "title", "name": "title", "название": "title",
+	"description": "description", "description_latex": "description", "question": "description",
+	"text": "description", "statement": "description", "условие": "description", "задача": "description",
+	"subject": "subject", "предмет": "subject",
+	"level": "level", "difficulty": "level", "уровень": "level", "сложность": "level",
+	"type": "type", "тип": "type",
+	"tags": "tags", "теги": "tags",
+	"answer_type": "answer_type", "тип_ответа": "answer_type",
+	"answer": "answer", "correct_answer": "answer", "ответ": "answer",
+	"unit": "unit", "answer_unit": "unit", "единица": "unit",
+	"tolerance": "tolerance", "погрешность": "tolerance", "tolerance_mode": "tolerance_mode",
+	"solution": "solution", "solution_latex": "solution", "решение": "solution",
+	"hint": "hint", "hint_latex": "hint", "подсказка": "hint",
+	"points": "points", "баллы": "points",
+	"options": "options", "choices": "options", "варианты": "options",
+	"answer_spec": "answer_spec", "spec": "answer_spec",
+}
+
+// Spreadsheet spellings of the answer types
+var answerTypeAliases = map[string]string{
+	"": grading.AnswerAuto, "auto": grading.AnswerAuto,
+	"number": grading.AnswerNumeric, "numerical": grading.AnswerNumeric,
+	"string": grading.AnswerText, "short": grading.AnswerText, "shortanswer": grading.AnswerText,
+	"formula": grading.AnswerExpression, "essay": grading.AnswerFree, "multipart": grading.AnswerMultiPart,
+	"multichoice": grading.AnswerChoice, "multiple_choice": grading.AnswerChoice, "mcq": grading.AnswerChoice,
+}
+
+func headerKey(h string) string {
+	h = strings.ToLower(strings.TrimSpace(h))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(h)
+}
+
+// readCSV reads comma, semicolon or tab separated text, whichever the
+// header line uses most
+func readCSV(data []byte) ([]tableRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	first, _, _ := bytes.Cut(data, []byte("\n"))
+	sep, best := ',', bytes.Count(first, []byte(","))
+	for _, c := range []rune{';', '\t'} {
+		if n := bytes.Count(first, []byte(string(c))); n > best {
+			sep, best = c, n
+		}
+	}
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = sep
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	var rows []tableRow
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		rows = append(rows, tableRow{n: line, cells: rec})
+	}
+	return rows, nil
+}
+
+// fromTable maps the rows under the first non-empty one, the header, to
+// records
+func fromTable(rows []tableRow, opts Options) ([]Record, []RowError, error) {
+	for len(rows) > 0 && blank(rows[0].cells) {
+		rows = rows[1:]
+	}
+	if len(rows) == 0 {
+		return nil, nil, errors.New("the file is empty")
+	}
+	mapping := map[string]string{}
+	for h, f := range opts.Columns {
+		mapping[headerKey(h)] = f
+	}
+	cols := map[string]int{}
+	var headers []string
+	for i, h := range rows[0].cells {
+		key := headerKey(h)
+		field, ok := mapping[key]
+		if !ok {
+			field, ok = columnAliases[key]
+		}
+		if ok {
+			if _, dup := cols[field]; !dup {
+				cols[field] = i
+			}
+		}
+		headers = append(headers, strings.TrimSpace(h))
+	}
+	if _, ok := cols["description"]; !ok {
+		return nil, nil, fmt.Errorf("no description column among %q; map one with columns", headers)
+	}
+
+	var recs []Record
+	var errs []RowError
+	for _, row := range rows[1:] {
+		if blank(row.cells) {
+			continue
+		}
+		get := func(field string) string {
+			if i, ok := cols[field]; ok && i < len(row.cells) {
+				return strings.TrimSpace(row.cells[i])
+			}
+			return ""
+		}
+		rec, err := fromRow(row.n, get)
+		if err != nil {
+			errs = append(errs, *err)
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	return recs, errs, nil
+}
+
+func blank(cells []string) bool {
+	for _, c := range cells {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func fromRow(n int, get func(string) string) (Record, *RowError) {
+	r := Record{Row: n}
+	fail := func(field, format string, args ...any) (Record, *RowError) {
+		e := rowError(n, "", field, format, args...)
+		return r, &e
+	}
+	t := &r.Task
+	t.Title = get("title")
+	t.DescriptionLaTeX = get("description")
+	t.Subject = get("subject")
+	t.Level = get("level")
+	t.Type = get("type")
+	t.Tags = splitList(get("tags"))
+	t.AnswerUnit = get("unit")
+	t.ToleranceMode = get("tolerance_mode")
+	t.SolutionLaTeX = get("solution")
+	t.HintLaTeX = get("hint")
+	if v := get("tolerance"); v != "" {
+		f, err := strconv.ParseFloat(strings.Replace(v, ",", ".", 1), 64)
+		if err != nil {
+			return fail("tolerance", "tolerance %q is not a number", v)
+		}
+		t.Tolerance = f
+	}
+	if v := get("points"); v != "" {
+		f, err := strconv.ParseFloat(strings.Replace(v, ",", ".", 1), 64)
+		if err != nil {
+			return fail("points", "points %q is not a number", v)
+		}
+		t.Points = int(math.Round(f))
+	}
+
+	answerType := headerKey(get("answer_type"))
+	if alias, ok := answerTypeAliases[answerType]; ok {
+		answerType = alias
+	}
+	options := splitOptions(get("options"))
+	if answerType == grading.AnswerAuto && len(options) > 0 {
+		answerType = grading.AnswerChoice
+	}
+	t.AnswerType = answerType
+	answer := get("answer")
+
+	if raw := get("answer_spec"); raw != "" {
+		var spec models.AnswerSpec
+		if err := json.Unmarshal([]byte(raw), &spec); err != nil {
+			return fail("answer_spec", "answer_spec is not valid JSON: %v", err)
+		}
+		r.Spec = &spec
+		if !grading.IsStructured(answerType) && answerType != grading.AnswerCode {
+			t.CorrectAnswer = answer
+		}
+		return r, nil
+	}
+	switch answerType {
+	case grading.AnswerChoice:
+		spec := &models.AnswerSpec{}
+		for i, o := range options {
+			spec.Options = append(spec.Options, models.AnswerOption{ID: optionID(i), Text: o})
+		}
+		for _, a := range splitList(answer) {
+			id, ok := choiceID(a, options)
+			if !ok {
+				return fail("answer", "answer %q is not one of the %d options", a, len(options))
+			}
+			spec.Correct = append(spec.Correct, id)
+		}
+		spec.Multiple = len(spec.Correct) > 1
+		r.Spec = spec
+	case grading.AnswerSet, grading.AnswerOrdered:
+		r.Spec = &models.AnswerSpec{Correct: splitItems(answer)}
+	case grading.AnswerInterval:
+		iv, err := parseInterval(answer)
+		if err != nil {
+			return fail("answer", "%v", err)
+		}
+		r.Spec = &models.AnswerSpec{Interval: iv}
+	case grading.AnswerMultiPart, grading.AnswerCode:
+		return fail("answer_spec", "%s tasks need an answer_spec column with the JSON of the task editor", answerType)
+	default:
+		t.CorrectAnswer = answer
+	}
+	return r, nil
+}
+
+// splitList splits tags and choice answers on commas or semicolons
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' }) {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// splitItems splits set and ordered answers on semicolons, since the items
+// may be decimals with commas
+func splitItems(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ";") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// splitOptions splits the options column on "|" or line breaks
+func splitOptions(s string) []string {
+	var out []string
+	for _, p := range strings.FieldsFunc(s, func(r rune) bool { return r == '|' || r == '\n' }) {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// optionID names options A, B, ..., Z, then by number
+func optionID(i int) string {
+	if i < 26 {
+		return string(rune('A' + i))
+	}
+	return strconv.Itoa(i + 1)
+}
+
+// choiceID resolves a correct answer given as letter, number or option text
+func choiceID(a string, options []string) (string, bool) {
+	for i := range options {
+		if strings.EqualFold(a, optionID(i)) {
+			return optionID(i), true
+		}
+	}
+	if k, err := strconv.Atoi(a); err == nil && k >= 1 && k <= len(options) {
+		return optionID(k - 1), true
+	}
+	for i, o := range options {
+		if o == a {
+			return optionID(i), true
+		}
+	}
+	return "", false
+}
+
+// parseInterval reads "[1, 2)", "(-inf; 3]" and the like
+func parseInterval(s string) (*models.AnswerInterval, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || !strings.ContainsAny(s[:1], "[(") || !strings.ContainsAny(s[len(s)-1:], "])") {
+		return nil, fmt.Errorf("interval %q must look like [a, b) or (-inf; b]", s)
+	}
+	iv := &models.AnswerInterval{LowerClosed: s[0] == '[', UpperClosed: s[len(s)-1] == ']'}
+	inner := s[1 : len(s)-1]
+	parts := strings.Split(inner, ";")
+	if len(parts) != 2 {
+		parts = strings.Split(inner, ",")
+	}
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("interval %q needs two bounds", s)
+	}
+	bound := func(b string) (*float64, error) {
+		b = strings.TrimSpace(b)
+		switch strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(b), "-"), "+") {
+		case "inf", "infinity", "∞", "\\infty":
+			return nil, nil
+		}
+		f, err := strconv.ParseFloat(strings.Replace(b, ",", ".", 1), 64)
+		if err != nil {
+			return nil, fmt.Errorf("interval bound %q is not a number", b)
+		}
+		return &f, nil
+	}
+	var err error
+	if iv.Lower, err = bound(parts[0]); err != nil {
+		return nil, err
+	}
+	if iv.Upper, err = bound(parts[1]); err != nil {
+		return nil, err
+	}
+	return iv, nil
+}
@@ -0,0 +1,232 @@
+// Package taskimport turns spreadsheets (CSV, XLSX) and question banks
+// (Moodle XML, QTI 2.1) into draft tasks. Files are parsed into Records,
+// every record is validated on its own, and the rows that pass are created
+// by a background job; the others are reported as RowErrors.
+package taskimport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/latex"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/taskcheck"
+)
+
+// Supported formats
+const (
+	FormatCSV    = "csv"
+	FormatXLSX   = "xlsx"
+	FormatMoodle = "moodle"
+	FormatQTI    = "qti"
+)
+
+// Options apply to every task of an import
+type Options struct {
+	Subject string `json:"subject"` // for rows without one
+	Level   string `json:"level"`   // for rows without one, basic by default
+	Type    string `json:"type"`    // for rows without one, practice by default
+	TopicID *uint  `json:"topic_id,omitempty"`
+	// Columns maps spreadsheet headers to task fields on top of the
+	// built-in names, e.g. {"Question": "description"}
+	Columns map[string]string `json:"columns,omitempty"`
+	Sheet   string            `json:"sheet,omitempty"` // XLSX sheet, the first by default
+}
+
+// RowError is a problem with one row or question. Rows with errors are not
+// imported; warnings are informational.
+type RowError struct {
+	Row      int    `json:"row"`           // spreadsheet line or question number, from 1
+	Ref      string `json:"ref,omitempty"` // question name or item identifier
+	Field    string `json:"field,omitempty"`
+	Severity string `json:"severity"` // error or warning, as in latex.Issue
+	Message  string `json:"message"`
+}
+
+// Record is one task read from a file, before validation
+type Record struct {
+	Row      int
+	Ref      string
+	Task     models.Task
+	Spec     *models.AnswerSpec
+	Warnings []RowError
+}
+
+func rowError(row int, ref, field, format string, args ...any) RowError {
+	return RowError{Row: row, Ref: ref, Field: field, Severity: latex.SeverityError, Message: fmt.Sprintf(format, args...)}
+}
+
+func (r *Record) warn(field, format string, args ...any) {
+	e := rowError(r.Row, r.Ref, field, format, args...)
+	e.Severity = latex.SeverityWarning
+	r.Warnings = append(r.Warnings, e)
+}
+
+// Detect guesses the format of an uploaded file from its name and content
+func Detect(name string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv", ".tsv", ".txt":
+		return FormatCSV
+	case ".xlsx":
+		return FormatXLSX
+	case ".zip":
+		return FormatQTI
+	case ".xml":
+		head := data
+		if len(head) > 4096 {
+			head = head[:4096]
+		}
+		switch {
+		case bytes.Contains(head, []byte("<quiz")):
+			return FormatMoodle
+		case bytes.Contains(head, []byte("assessmentItem")):
+			return FormatQTI
+		}
+	}
+	return ""
+}
+
+// Parse reads the records of a file. Errors returned concern the whole
+// file; problems with single rows are in the RowErrors.
+func Parse(format string, data []byte, opts Options) ([]Record, []RowError, error) {
+	var recs []Record
+	var errs []RowError
+	var err error
+	switch format {
+	case FormatCSV:
+		var rows []tableRow
+		if rows, err = readCSV(data); err == nil {
+			recs, errs, err = fromTable(rows, opts)
+		}
+	case FormatXLSX:
+		var rows []tableRow
+		if rows, err = readXLSX(data, opts.Sheet); err == nil {
+			recs, errs, err = fromTable(rows, opts)
+		}
+	case FormatMoodle:
+		recs, errs, err = readMoodle(data)
+	case FormatQTI:
+		recs, errs, err = readQTI(data)
+	default:
+		return nil, nil, fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range recs {
+		applyDefaults(&recs[i], opts)
+	}
+	return recs, errs, nil
+}
+
+func applyDefaults(r *Record, opts Options) {
+	t := &r.Task
+	if t.Subject == "" {
+		t.Subject = opts.Subject
+	}
+	if t.Level == "" {
+		t.Level = opts.Level
+	}
+	if t.Level == "" {
+		t.Level = "basic"
+	}
+	if t.Type == "" {
+		t.Type = opts.Type
+	}
+	if t.Type == "" {
+		t.Type = "practice"
+	}
+	if t.Title == "" {
+		t.Title = titleFrom(t.DescriptionLaTeX)
+	}
+	t.Status = models.StatusDraft
+	if r.Spec != nil {
+		t.AnswerSpec, _ = json.Marshal(r.Spec)
+	}
+}
+
+// titleFrom makes a title of the first line of the description
+func titleFrom(desc string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(desc), "\n")
+	line = strings.TrimSpace(line)
+	if utf8.RuneCountInString(line) <= 80 {
+		return line
+	}
+	return string([]rune(line)[:77]) + "..."
+}
+
+// Check validates a record with the task editor's checks from package
+// taskcheck, plus the fields every imported row needs, adding the LaTeX lint
+// issues. It returns errors and warnings.
+func Check(r *Record) []RowError {
+	errs := append([]RowError{}, r.Warnings...)
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, rowError(r.Row, r.Ref, field, format, args...))
+	}
+	t := &r.Task
+	if strings.TrimSpace(t.DescriptionLaTeX) == "" {
+		fail("description", "description is required")
+	}
+	if t.Title == "" {
+		fail("title", "title is required")
+	}
+	if t.Subject == "" {
+		fail("subject", "subject is required")
+	}
+	switch t.AnswerType {
+	case grading.AnswerAuto, grading.AnswerNumeric, grading.AnswerText, grading.AnswerExpression:
+		if strings.TrimSpace(t.CorrectAnswer) == "" {
+			fail("answer", "answer is required")
+		}
+	}
+	if err := taskcheck.Validate(t); err != nil {
+		var fe *taskcheck.FieldError
+		errors.As(err, &fe)
+		fail(importField(fe.Field, t.AnswerType), "%s", fe.Message)
+	}
+	if t.Points < 0 {
+		fail("points", "points must not be negative")
+	}
+
+	fields := [][2]string{{"description", t.DescriptionLaTeX}, {"solution", t.SolutionLaTeX}, {"hint", t.HintLaTeX}}
+	if r.Spec != nil {
+		for k, o := range r.Spec.Options {
+			fields = append(fields, [2]string{fmt.Sprintf("options[%d]", k), o.Text})
+		}
+	}
+	for _, f := range fields {
+		for _, is := range latex.Lint(f[1]) {
+			errs = append(errs, RowError{
+				Row: r.Row, Ref: r.Ref, Field: f[0], Severity: is.Severity,
+				Message: fmt.Sprintf("line %d, column %d: %s", is.Line, is.Column, is.Message),
+			})
+		}
+	}
+	return errs
+}
+
+// importField names a task editor field after the column it is read from;
+// a structured answer is written in the answer column, only code tests come
+// as an answer_spec
+func importField(field, answerType string) string {
+	if field == "correct_answer" || field == "answer_spec" && answerType != grading.AnswerCode {
+		return "answer"
+	}
+	return field
+}
+
+// HasErrors reports whether any of the row errors is more than a warning
+func HasErrors(errs []RowError) bool {
+	for _, e := range errs {
+		if e.Severity == latex.SeverityError {
+			return true
+		}
+	}
+	return false
+}
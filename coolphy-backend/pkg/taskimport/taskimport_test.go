@@ -0,0 +1,441 @@
+package taskimport
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/latex"
+	"coolphy-backend/pkg/models"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"tasks.csv", "", FormatCSV},
+		{"TASKS.TSV", "", FormatCSV},
+		{"book.xlsx", "", FormatXLSX},
+		{"package.zip", "", FormatQTI},
+		{"bank.xml", `<?xml version="1.0"?><quiz><question type="essay"/></quiz>`, FormatMoodle},
+		{"item.xml", `<?xml version="1.0"?><assessmentItem identifier="q1"/>`, FormatQTI},
+		{"other.xml", `<html/>`, ""},
+		{"tasks.pdf", "", ""},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.name, []byte(tt.data)); got != tt.want {
+			t.Errorf("Detect(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func parse(t *testing.T, format string, data []byte, opts Options) ([]Record, []RowError) {
+	t.Helper()
+	recs, errs, err := Parse(format, data, opts)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return recs, errs
+}
+
+func float(f float64) *float64 { return &f }
+
+func TestParseCSV(t *testing.T) {
+	data := "\xef\xbb\xbfУсловие;Ответ;Тип ответа;Варианты;Теги;Баллы;Погрешность\n" +
+		"Find $v$.;12,5;number;;kinematics, speed;2;0,1\n" +
+		"\n" +
+		"Pick the vector.;B;;force|mass|time;;;\n" +
+		"Pick the first.;1;mcq;force|mass|time;;;\n" +
+		"Where is $f > 0$?;\"[1; +inf)\";interval;;;;\n" +
+		"Two parts.;;multipart;;;;\n" +
+		"Pick one.;D;choice;a|b;;;\n"
+	recs, errs := parse(t, FormatCSV, []byte(data), Options{Subject: "physics"})
+	if len(recs) != 4 {
+		t.Fatalf("got %d records, want 4", len(recs))
+	}
+
+	r := recs[0]
+	if r.Row != 2 || r.Task.Title != "Find $v$." || r.Task.Subject != "physics" || r.Task.Level != "basic" ||
+		r.Task.Type != "practice" || r.Task.Status != models.StatusDraft {
+		t.Errorf("defaults not applied: row %d, %+v", r.Row, r.Task)
+	}
+	if r.Task.AnswerType != grading.AnswerNumeric || r.Task.CorrectAnswer != "12,5" || r.Task.Points != 2 || r.Task.Tolerance != 0.1 {
+		t.Errorf("numeric row = %+v", r.Task)
+	}
+	if want := []string{"kinematics", "speed"}; !reflect.DeepEqual([]string(r.Task.Tags), want) {
+		t.Errorf("tags = %q, want %q", r.Task.Tags, want)
+	}
+
+	choice := &models.AnswerSpec{
+		Options: []models.AnswerOption{{ID: "A", Text: "force"}, {ID: "B", Text: "mass"}, {ID: "C", Text: "time"}},
+		Correct: []string{"B"},
+	}
+	if r := recs[1]; r.Row != 4 || r.Task.AnswerType != grading.AnswerChoice || !reflect.DeepEqual(r.Spec, choice) {
+		t.Errorf("options without a type: row %d, %s, %+v", r.Row, r.Task.AnswerType, r.Spec)
+	}
+	if r := recs[2]; len(r.Spec.Correct) != 1 || r.Spec.Correct[0] != "A" || len(r.Task.AnswerSpec) == 0 {
+		t.Errorf("answer by number: %+v", r.Spec)
+	}
+
+	iv := &models.AnswerInterval{Lower: float(1), LowerClosed: true}
+	if r := recs[3]; r.Task.AnswerType != grading.AnswerInterval || r.Spec == nil || !reflect.DeepEqual(r.Spec.Interval, iv) {
+		t.Errorf("interval: %s, %+v, want %+v", r.Task.AnswerType, r.Spec, iv)
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("errors = %+v, want 2", errs)
+	}
+	if e := errs[0]; e.Row != 7 || e.Field != "answer_spec" || e.Severity != latex.SeverityError {
+		t.Errorf("multipart error = %+v", e)
+	}
+	if e := errs[1]; e.Row != 8 || e.Field != "answer" || !strings.Contains(e.Message, `"D"`) {
+		t.Errorf("choice error = %+v", e)
+	}
+}
+
+func TestParseCSVColumns(t *testing.T) {
+	data := "Question,Key,Extra\n\"Say \"\"hi\"\".\",hi,x\n"
+	recs, errs := parse(t, FormatCSV, []byte(data), Options{Subject: "english", Columns: map[string]string{"Key": "answer"}})
+	if len(recs) != 1 || len(errs) != 0 {
+		t.Fatalf("got %d records and %+v", len(recs), errs)
+	}
+	if r := recs[0]; r.Task.DescriptionLaTeX != `Say "hi".` || r.Task.CorrectAnswer != "hi" {
+		t.Errorf("record = %+v", r.Task)
+	}
+
+	if _, _, err := Parse(FormatCSV, []byte("Key,Extra\nhi,x\n"), Options{}); err == nil {
+		t.Error("a file without a description column parsed")
+	}
+	if _, _, err := Parse(FormatCSV, []byte("\n\n"), Options{}); err == nil {
+		t.Error("an empty file parsed")
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		in   string
+		want *models.AnswerInterval
+	}{
+		{"[1, 2)", &models.AnswerInterval{Lower: float(1), Upper: float(2), LowerClosed: true}},
+		{"(-inf; 3,5]", &models.AnswerInterval{Upper: float(3.5), UpperClosed: true}},
+		{`(0; \infty)`, &models.AnswerInterval{Lower: float(0)}},
+	}
+	for _, tt := range tests {
+		got, err := parseInterval(tt.in)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseInterval(%q) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"1, 2", "[1]", "[a, 2]", "[1, 2, 3]"} {
+		if _, err := parseInterval(in); err == nil {
+			t.Errorf("parseInterval(%q) succeeded", in)
+		}
+	}
+}
+
+// workbook builds an xlsx file of the given parts
+func workbook(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseXLSX(t *testing.T) {
+	data := workbook(t, map[string]string{
+		"xl/workbook.xml": `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>
+			<sheet name="Notes" r:id="rId1"/><sheet name="Tasks" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships>
+			<Relationship Id="rId1" Target="worksheets/sheet1.xml"/>
+			<Relationship Id="rId2" Target="/xl/worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml":     `<sst><si><t>Description</t></si><si><r><t>Is </t></r><r><t>it true?</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData/></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet><sheetData>
+			<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="inlineStr"><is><t>Answer</t></is></c></row>
+			<row r="3"><c r="A3" t="s"><v>1</v></c><c r="C3" t="b"><v>1</v></c></row>
+		</sheetData></worksheet>`,
+	})
+	recs, errs := parse(t, FormatXLSX, data, Options{Sheet: "Tasks"})
+	if len(recs) != 1 || len(errs) != 0 {
+		t.Fatalf("got %d records and %+v", len(recs), errs)
+	}
+	if r := recs[0]; r.Row != 3 || r.Task.DescriptionLaTeX != "Is it true?" || r.Task.CorrectAnswer != "TRUE" {
+		t.Errorf("record: row %d, %+v", r.Row, r.Task)
+	}
+
+	if _, _, err := Parse(FormatXLSX, data, Options{Sheet: "Missing"}); err == nil {
+		t.Error("a missing sheet parsed")
+	}
+	if _, _, err := Parse(FormatXLSX, data, Options{}); err == nil {
+		t.Error("the empty first sheet parsed")
+	}
+	if _, _, err := Parse(FormatXLSX, []byte("not a zip"), Options{}); err == nil {
+		t.Error("a file that isn't a zip parsed")
+	}
+}
+
+const moodleBank = `<?xml version="1.0" encoding="UTF-8"?>
+<quiz>
+  <question type="category"><category><text>$course$/top/Mechanics/Kinematics</text></category></question>
+  <question type="description"><name><text>Intro</text></name></question>
+  <question type="numerical">
+    <name><text>Speed</text></name>
+    <questiontext format="html"><text><![CDATA[<p>A car drives <b>100 m</b> in 5 s. Find \(v\).</p>]]></text></questiontext>
+    <generalfeedback format="html"><text><![CDATA[<p>\(v = s/t\)</p>]]></text></generalfeedback>
+    <defaultgrade>2.0000000</defaultgrade>
+    <answer fraction="100"><text>20</text><tolerance>0.5</tolerance></answer>
+    <answer fraction="100"><text>72</text><tolerance>1</tolerance></answer>
+    <units><unit><unit_name>km/h</unit_name><multiplier>3.6</multiplier></unit><unit><unit_name>m/s</unit_name><multiplier>1</multiplier></unit></units>
+    <tags><tag><text>speed</text></tag></tags>
+  </question>
+  <question type="multichoice">
+    <name><text>Scalars</text></name>
+    <questiontext format="html"><text>Which are scalars?</text></questiontext>
+    <single>false</single>
+    <answer fraction="50"><text>mass</text></answer>
+    <answer fraction="-100"><text>force</text></answer>
+    <answer fraction="50"><text>time &amp; 5%</text></answer>
+  </question>
+  <question type="truefalse">
+    <name><text>Earth</text></name>
+    <questiontext format="plain_text"><text>The Earth is flat: 100%</text></questiontext>
+    <answer fraction="0"><text>true</text></answer>
+    <answer fraction="100"><text>false</text></answer>
+  </question>
+  <question type="shortanswer">
+    <name><text>Nothing right</text></name>
+    <questiontext><text>?</text></questiontext>
+    <answer fraction="50"><text>maybe</text></answer>
+  </question>
+  <question type="matching"><name><text>Pairs</text></name></question>
+</quiz>`
+
+func TestParseMoodle(t *testing.T) {
+	recs, errs := parse(t, FormatMoodle, []byte(moodleBank), Options{Subject: "physics"})
+	if len(recs) != 3 {
+		t.Fatalf("got %d records, want 3", len(recs))
+	}
+
+	r := recs[0]
+	if r.Row != 1 || r.Ref != "Speed" || r.Task.Title != "Speed" || r.Task.Points != 2 {
+		t.Errorf("numerical: %+v", r)
+	}
+	if r.Task.DescriptionLaTeX != `A car drives \textbf{100 m} in 5 s. Find \(v\).` || r.Task.SolutionLaTeX != `\(v = s/t\)` {
+		t.Errorf("markup: %q, %q", r.Task.DescriptionLaTeX, r.Task.SolutionLaTeX)
+	}
+	if r.Task.AnswerType != grading.AnswerNumeric || r.Task.CorrectAnswer != "20" || r.Task.Tolerance != 0.5 ||
+		r.Task.ToleranceMode != grading.ToleranceAbsolute || r.Task.AnswerUnit != "m/s" {
+		t.Errorf("numerical answer: %+v", r.Task)
+	}
+	if want := []string{"speed", "Mechanics", "Kinematics"}; !reflect.DeepEqual([]string(r.Task.Tags), want) {
+		t.Errorf("tags = %q, want %q", r.Task.Tags, want)
+	}
+	if len(r.Warnings) != 1 || r.Warnings[0].Field != "answer" || r.Warnings[0].Severity != latex.SeverityWarning {
+		t.Errorf("warnings = %+v, want one about the second answer", r.Warnings)
+	}
+
+	multi := &models.AnswerSpec{
+		Options:       []models.AnswerOption{{ID: "A", Text: "mass"}, {ID: "B", Text: "force"}, {ID: "C", Text: `time \& 5\%`}},
+		Correct:       []string{"A", "C"},
+		Multiple:      true,
+		PartialCredit: true,
+	}
+	if r := recs[1]; r.Row != 2 || r.Task.AnswerType != grading.AnswerChoice || !reflect.DeepEqual(r.Spec, multi) {
+		t.Errorf("multichoice: row %d, %+v", r.Row, r.Spec)
+	}
+
+	tf := &models.AnswerSpec{Options: []models.AnswerOption{{ID: "A", Text: "True"}, {ID: "B", Text: "False"}}, Correct: []string{"B"}}
+	if r := recs[2]; r.Task.DescriptionLaTeX != `The Earth is flat: 100\%` || !reflect.DeepEqual(r.Spec, tf) {
+		t.Errorf("truefalse: %q, %+v", r.Task.DescriptionLaTeX, r.Spec)
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("errors = %+v, want 2", errs)
+	}
+	if e := errs[0]; e.Row != 4 || e.Ref != "Nothing right" || e.Field != "answer" {
+		t.Errorf("shortanswer error = %+v", e)
+	}
+	if e := errs[1]; e.Row != 5 || e.Field != "type" || !strings.Contains(e.Message, "matching") {
+		t.Errorf("matching error = %+v", e)
+	}
+
+	if _, _, err := Parse(FormatMoodle, []byte("<quiz>"), Options{}); err == nil {
+		t.Error("broken XML parsed")
+	}
+}
+
+const qtiChoiceItem = `<?xml version="1.0" encoding="UTF-8"?>
+<assessmentItem xmlns="http://www.imsglobal.org/xsd/imsqti_v2p1" identifier="q-choice" title="Units">
+  <responseDeclaration identifier="RESPONSE" cardinality="single" baseType="identifier">
+    <correctResponse><value>joule</value></correctResponse>
+  </responseDeclaration>
+  <itemBody>
+    <p>Energy is measured in</p>
+    <choiceInteraction responseIdentifier="RESPONSE" maxChoices="1">
+      <prompt>Pick <em>one</em>.</prompt>
+      <simpleChoice identifier="newton">newtons</simpleChoice>
+      <simpleChoice identifier="joule">joules</simpleChoice>
+    </choiceInteraction>
+  </itemBody>
+  <modalFeedback outcomeIdentifier="FEEDBACK" identifier="x" showHide="show"><p>Work is energy.</p></modalFeedback>
+</assessmentItem>`
+
+const qtiEntries = `<?xml version="1.0" encoding="UTF-8"?>
+<assessmentItem identifier="q-entries" title="Two blanks">
+  <responseDeclaration identifier="R1" cardinality="single" baseType="float">
+    <correctResponse><value>9.8</value></correctResponse>
+  </responseDeclaration>
+  <responseDeclaration identifier="R2" cardinality="single" baseType="string">
+    <mapping><mapEntry mapKey="down" mappedValue="1"/></mapping>
+  </responseDeclaration>
+  <itemBody>
+    <p>g is <textEntryInteraction responseIdentifier="R1"/> m/s<sup>2</sup>, pointing <textEntryInteraction responseIdentifier="R2"/>.</p>
+  </itemBody>
+</assessmentItem>`
+
+const qtiMixed = `<assessmentItem identifier="q-mixed" title="Mixed">
+  <itemBody><choiceInteraction responseIdentifier="A"/><textEntryInteraction responseIdentifier="B"/></itemBody>
+</assessmentItem>`
+
+func TestParseQTI(t *testing.T) {
+	recs, errs := parse(t, FormatQTI, []byte(qtiChoiceItem), Options{Subject: "physics"})
+	if len(recs) != 1 || len(errs) != 0 {
+		t.Fatalf("got %d records and %+v", len(recs), errs)
+	}
+	r := recs[0]
+	if r.Ref != "q-choice" || r.Task.Title != "Units" || r.Task.SolutionLaTeX != "Work is energy." {
+		t.Errorf("item: %+v", r.Task)
+	}
+	if !strings.Contains(r.Task.DescriptionLaTeX, "Energy is measured in") || !strings.Contains(r.Task.DescriptionLaTeX, `Pick \emph{one}.`) {
+		t.Errorf("description = %q", r.Task.DescriptionLaTeX)
+	}
+	choice := &models.AnswerSpec{Options: []models.AnswerOption{{ID: "A", Text: "newtons"}, {ID: "B", Text: "joules"}}, Correct: []string{"B"}}
+	if !reflect.DeepEqual(r.Spec, choice) {
+		t.Errorf("spec = %+v, want %+v", r.Spec, choice)
+	}
+
+	// A package is read in file name order, skipping the manifest and
+	// anything that isn't an item
+	pkg := workbook(t, map[string]string{
+		"imsmanifest.xml":      `<manifest/>`,
+		"items/b.xml":          qtiEntries,
+		"items/a.xml":          qtiChoiceItem,
+		"items/c.xml":          qtiMixed,
+		"style.css":            `p {}`,
+		"tests/assessment.xml": `<assessmentTest identifier="t"/>`,
+	})
+	recs, errs = parse(t, FormatQTI, pkg, Options{})
+	if len(recs) != 2 || recs[0].Ref != "q-choice" || recs[1].Ref != "q-entries" {
+		t.Fatalf("records = %+v", recs)
+	}
+	r = recs[1]
+	if r.Row != 2 || r.Task.AnswerType != grading.AnswerMultiPart {
+		t.Errorf("entries: row %d, %s", r.Row, r.Task.AnswerType)
+	}
+	if want := `g is \underline{\hspace{2cm}} (1) m/s\textsuperscript{2}, pointing \underline{\hspace{2cm}} (2) .`; r.Task.DescriptionLaTeX != want {
+		t.Errorf("description = %q, want %q", r.Task.DescriptionLaTeX, want)
+	}
+	parts := []models.AnswerPart{
+		{Label: "1", Type: grading.AnswerNumeric, Answer: "9.8", Weight: 1},
+		{Label: "2", Type: grading.AnswerText, Answer: "down", Weight: 1},
+	}
+	if !reflect.DeepEqual(r.Spec.Parts, parts) {
+		t.Errorf("parts = %+v, want %+v", r.Spec.Parts, parts)
+	}
+	if len(errs) != 1 || errs[0].Row != 3 || errs[0].Ref != "q-mixed" || errs[0].Field != "type" {
+		t.Errorf("errors = %+v, want the mixed item", errs)
+	}
+
+	if _, _, err := Parse(FormatQTI, []byte(`<assessmentTest/>`), Options{}); err == nil {
+		t.Error("a file without items parsed")
+	}
+}
+
+func TestHTMLToLaTeX(t *testing.T) {
+	tests := []struct {
+		in, want string
+		notes    int
+	}{
+		{`<p>Tom &amp; Jerry: 10% of #1_a</p>`, `Tom \& Jerry: 10\% of \#1\_a`, 0},
+		{`<p>Math \(a_1 + b^2\) and $x_1$ stay</p>`, `Math \(a_1 + b^2\) and $x_1$ stay`, 0},
+		{`<ul><li>one</li><li>two</li></ul>`, "\\begin{itemize}\n\n\\item one\n\\item two\n\\end{itemize}", 0},
+		{`H<sub>2</sub>O`, `H\textsubscript{2}O`, 0},
+		{`<p>See <img src="a.png"/></p>`, `See`, 1},
+	}
+	for _, tt := range tests {
+		got, notes := htmlToLaTeX(tt.in)
+		if got != tt.want || len(notes) != tt.notes {
+			t.Errorf("htmlToLaTeX(%q) = %q, %q; want %q with %d notes", tt.in, got, notes, tt.want, tt.notes)
+		}
+	}
+	if got := textToLaTeX("50% &\n$x_1$"); got != "50\\% \\&\n$x_1$" {
+		t.Errorf("textToLaTeX = %q", got)
+	}
+}
+
+func TestTitleFrom(t *testing.T) {
+	long := strings.Repeat("ж", 100)
+	tests := map[string]string{
+		"  First line\nsecond":  "First line",
+		"":                      "",
+		long:                    strings.Repeat("ж", 77) + "...",
+		strings.Repeat("a", 80): strings.Repeat("a", 80),
+	}
+	for in, want := range tests {
+		if got := titleFrom(in); got != want {
+			t.Errorf("titleFrom(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// messages lists the issues of a record as "severity field"
+func messages(errs []RowError) []string {
+	out := []string{}
+	for _, e := range errs {
+		out = append(out, e.Severity+" "+e.Field)
+	}
+	return out
+}
+
+func TestCheck(t *testing.T) {
+	ok := Record{Row: 1, Task: models.Task{
+		Title: "Speed", DescriptionLaTeX: "Find $v$.", Subject: "physics",
+		AnswerType: grading.AnswerNumeric, CorrectAnswer: "20",
+	}}
+	if errs := Check(&ok); len(errs) != 0 {
+		t.Errorf("a good record has issues %+v", errs)
+	}
+
+	bad := Record{Row: 2, Task: models.Task{DescriptionLaTeX: "Find $v.", AnswerType: grading.AnswerText, Points: -1}}
+	bad.warn("solution", "an image was dropped")
+	errs := Check(&bad)
+	want := []string{"warning solution", "error title", "error subject", "error answer", "error points", "error description"}
+	if got := messages(errs); !reflect.DeepEqual(got, want) {
+		t.Errorf("issues = %q, want %q", got, want)
+	}
+	if !HasErrors(errs) || HasErrors(errs[:1]) {
+		t.Error("HasErrors doesn't tell errors from warnings")
+	}
+
+	choice := Record{Row: 3, Task: models.Task{Title: "Pick", DescriptionLaTeX: "Pick.", Subject: "physics", AnswerType: grading.AnswerChoice},
+		Spec: &models.AnswerSpec{Options: []models.AnswerOption{{ID: "A", Text: `\textbf{x`}, {ID: "B", Text: "y"}}, Correct: []string{"A"}}}
+	applyDefaults(&choice, Options{})
+	if got := messages(Check(&choice)); !reflect.DeepEqual(got, []string{"error options[0]"}) {
+		t.Errorf("option issues = %q", got)
+	}
+}
@@ -0,0 +1,115 @@
+// Package tikz compiles the tikzpicture diagrams found in lectures, tasks
+// and AI replies to SVG with the locally installed TeX toolchain (latex and
+// dvisvgm) and keeps the results as assets.
+package tikz
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"coolphy-backend/pkg/judge"
+)
+
+// Compiler turns a tikzpicture environment into an SVG image. LocalCompiler
+// is the default; another implementation can call a remote TeX service.
+type Compiler interface {
+	Compile(ctx context.Context, source string) ([]byte, error)
+}
+
+// CompileError is a diagram that TeX rejected; Log holds the end of its output
+type CompileError struct {
+	Reason string
+	Log    string
+}
+
+func (e *CompileError) Error() string { return e.Reason }
+
+// Primitives that reach outside the picture: files, the shell, catcodes
+var forbidden = regexp.MustCompile(`\\(input|include|openin|openout|read|write|immediate|catcode|csname|special|directlua|lua\w*|pdfobj|pdffile\w*|verbatiminput|lstinputlisting|includegraphics|usepackage|documentclass)(?:[^A-Za-z]|$)|\\(begin|end)\{document\}`)
+
+// Check rejects sources with commands a diagram has no business using
+func Check(source string) error {
+	if m := forbidden.FindStringSubmatch(source); m != nil {
+		cmd := m[0]
+		if m[1] != "" {
+			cmd = `\` + m[1]
+		}
+		return &CompileError{Reason: fmt.Sprintf("%s is not allowed in diagrams", cmd)}
+	}
+	return nil
+}
+
+// Libraries are the TikZ libraries diagrams may use
+const Libraries = "arrows.meta,calc,patterns,angles,quotes,decorations.pathmorphing,decorations.markings,positioning,shapes"
+
+// Document wraps a tikzpicture in a standalone document
+func Document(source string) string {
+	return `\documentclass[tikz,border=2pt]{standalone}
+\usepackage[utf8]{inputenc}
+\usepackage[T2A]{fontenc}
+\usepackage[russian,english]{babel}
+\usepackage{amsmath,amssymb}
+\usetikzlibrary{` + Libraries + `}
+\begin{document}
+` + source + `
+\end{document}
+`
+}
+
+// LocalCompiler runs latex and dvisvgm in a scratch directory through the
+// judge's sandboxed runner, so the toolchain gets no network, capped memory
+// and a time limit
+type LocalCompiler struct {
+	Runner  judge.Runner
+	WorkDir string // scratch directories go here, the system temp dir if empty
+	Timeout time.Duration
+}
+
+const memoryLimitMB = 1024
+
+func (lc LocalCompiler) Compile(ctx context.Context, source string) ([]byte, error) {
+	if err := Check(source); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(lc.WorkDir, "tikz-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "diagram.tex"), []byte(Document(source)), 0o644); err != nil {
+		return nil, err
+	}
+
+	steps := [][]string{
+		{"latex", "-no-shell-escape", "-interaction=nonstopmode", "-halt-on-error",
+			"-cnf-line=openin_any=p", "-cnf-line=openout_any=p", "diagram.tex"},
+		{"dvisvgm", "--no-fonts", "--exact-bbox", "--output=diagram.svg", "diagram.dvi"},
+	}
+	for _, args := range steps {
+		res, err := lc.Runner.Run(ctx, judge.RunRequest{Dir: dir, Args: args, TimeLimit: lc.Timeout, MemoryLimitMB: memoryLimitMB})
+		if err != nil {
+			return nil, err
+		}
+		if res.TimedOut {
+			return nil, &CompileError{Reason: args[0] + " timed out"}
+		}
+		if res.ExitCode != 0 {
+			return nil, &CompileError{Reason: args[0] + " failed", Log: tail(res.Stdout+res.Stderr, 4000)}
+		}
+	}
+	return os.ReadFile(filepath.Join(dir, "diagram.svg"))
+}
+
+// tail keeps the last n bytes of a log, where TeX puts the error
+func tail(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) > n {
+		s = s[len(s)-n:]
+	}
+	return s
+}
@@ -0,0 +1,241 @@
+package tikz
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"coolphy-backend/internal/config"
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/judge"
+	"coolphy-backend/pkg/latex"
+	"coolphy-backend/pkg/models"
+)
+
+// URLPrefix is where the API serves assets
+const URLPrefix = "/api/v1/assets/"
+
+// Hash identifies a diagram by its source
+func Hash(source string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(source)))
+	return hex.EncodeToString(sum[:])
+}
+
+// URL is where the SVG of the diagram is served once compiled
+func URL(source string) string { return URLPrefix + Hash(source) + ".svg" }
+
+// Diagrams returns the tikzpicture environments in the texts
+func Diagrams(texts ...string) []string {
+	var out []string
+	for _, t := range texts {
+		if strings.Contains(t, "tikzpicture") {
+			out = append(out, latex.Environments(t, "tikzpicture")...)
+		}
+	}
+	return out
+}
+
+type service struct {
+	compiler Compiler // nil when TeX can't run sandboxed
+	dir      string
+	jobs     chan uint
+
+	mu     sync.Mutex
+	queued map[uint]bool // handed to the workers and not built yet
+}
+
+// Diagrams that didn't fit in the queue are picked up this often
+const sweepInterval = time.Minute
+
+var svc *service
+
+// Start runs the compile workers, makes rendered HTML point at the diagram
+// URLs and picks up pending diagrams, those left by a previous run included.
+// TeX gets the sandbox of the code judge; without it diagrams are only
+// recorded and served once compiled elsewhere.
+func Start(cfg config.Config) {
+	dir, err := filepath.Abs(filepath.Join(cfg.UploadDir, "assets"))
+	if err == nil {
+		err = os.MkdirAll(dir, 0o755)
+	}
+	if err != nil {
+		log.Printf("tikz: asset dir: %v", err)
+		return
+	}
+	s := &service{dir: dir, jobs: make(chan uint, 256), queued: map[uint]bool{}}
+	svc = s
+	latex.DiagramURL = URL
+
+	runner, err := judge.SandboxRunner(cfg)
+	if err != nil {
+		log.Printf("tikz: %v, diagrams are not compiled", err)
+		return
+	}
+	s.compiler = LocalCompiler{Runner: runner, WorkDir: cfg.JudgeWorkDir, Timeout: cfg.TikZTimeout}
+	workers := cfg.TikZWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	go func() {
+		s.sweep()
+		for range time.Tick(sweepInterval) {
+			s.sweep()
+		}
+	}()
+}
+
+// queue hands a diagram to the workers unless it is waiting already. It
+// reports false when the queue is full.
+func (s *service) queue(id uint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queued[id] {
+		return true
+	}
+	select {
+	case s.jobs <- id:
+		s.queued[id] = true
+		return true
+	default:
+		return false
+	}
+}
+
+// sweep queues the pending diagrams, oldest first, as far as they fit
+func (s *service) sweep() {
+	var pending []uint
+	if err := db.Get().Model(&models.Asset{}).Where("kind = ? AND status = ?", "tikz", models.AssetPending).
+		Order("id").Pluck("id", &pending).Error; err != nil {
+		log.Printf("tikz: listing pending diagrams: %v", err)
+		return
+	}
+	for _, id := range pending {
+		if !s.queue(id) {
+			return
+		}
+	}
+}
+
+// Enqueue records the diagrams in the texts and compiles the new ones in
+// the background. It returns their URLs in order of appearance.
+func Enqueue(texts ...string) []string {
+	diagrams := Diagrams(texts...)
+	urls := make([]string, 0, len(diagrams))
+	for _, source := range diagrams {
+		urls = append(urls, URL(source))
+		if svc == nil {
+			continue
+		}
+		a := models.Asset{Hash: Hash(source), Kind: "tikz", Source: strings.TrimSpace(source), Status: models.AssetPending, MimeType: "image/svg+xml"}
+		res := db.Get().Clauses(clause.OnConflict{DoNothing: true}).Create(&a)
+		if res.Error != nil {
+			log.Printf("tikz: saving diagram: %v", res.Error)
+			continue
+		}
+		if res.RowsAffected == 0 {
+			// Known diagram
+			continue
+		}
+		if svc.compiler != nil && !svc.queue(a.ID) {
+			log.Printf("tikz: queue full, diagram %s left for the next sweep", a.Hash)
+		}
+	}
+	return urls
+}
+
+func (s *service) work() {
+	for id := range s.jobs {
+		s.run(id)
+	}
+}
+
+// run builds a queued diagram and lets it be queued again
+func (s *service) run(id uint) {
+	s.build(id)
+	s.mu.Lock()
+	delete(s.queued, id)
+	s.mu.Unlock()
+}
+
+func (s *service) build(id uint) {
+	var a models.Asset
+	if err := db.Get().First(&a, id).Error; err != nil || a.Status != models.AssetPending {
+		return
+	}
+	svg, err := s.compiler.Compile(context.Background(), a.Source)
+	updates := map[string]interface{}{}
+	if err == nil {
+		path := filepath.Join(s.dir, a.Hash+".svg")
+		if err = os.WriteFile(path, svg, 0o644); err == nil {
+			updates["status"], updates["storage_path"], updates["size_bytes"], updates["error"] = models.AssetReady, path, int64(len(svg)), ""
+		}
+	}
+	if err != nil {
+		var ce *CompileError
+		if !errors.As(err, &ce) {
+			// Toolchain missing or a storage problem, not the author's fault
+			log.Printf("tikz: diagram %s: %v", a.Hash, err)
+		}
+		msg := err.Error()
+		if ce != nil && ce.Log != "" {
+			msg += "\n" + ce.Log
+		}
+		updates["status"], updates["error"] = models.AssetFailed, msg
+	}
+	if err := db.Get().Model(&a).Updates(updates).Error; err != nil {
+		log.Printf("tikz: saving diagram %s: %v", a.Hash, err)
+	}
+}
+
+// Rebuild compiles a failed diagram again, e.g. after the toolchain was fixed
+func Rebuild(a *models.Asset) error {
+	if svc == nil || svc.compiler == nil {
+		return errors.New("diagram compiler is not running")
+	}
+	if err := db.Get().Model(a).Updates(map[string]interface{}{"status": models.AssetPending, "error": ""}).Error; err != nil {
+		return err
+	}
+	if !svc.queue(a.ID) {
+		return errors.New("diagram queue is full")
+	}
+	return nil
+}
+
+// Store saves an SVG compiled elsewhere, e.g. on the instance a content
+// bundle came from, so the diagram doesn't have to be built again. Ready
+// diagrams are left alone.
+func Store(source string, svg []byte) error {
+	if svc == nil {
+		return errors.New("diagram compiler is not running")
+	}
+	source = strings.TrimSpace(source)
+	a := models.Asset{Hash: Hash(source), Kind: "tikz", Source: source, Status: models.AssetPending, MimeType: "image/svg+xml"}
+	if err := db.Get().Clauses(clause.OnConflict{DoNothing: true}).Create(&a).Error; err != nil {
+		return err
+	}
+	if err := db.Get().Where("hash = ?", a.Hash).First(&a).Error; err != nil {
+		return err
+	}
+	if a.Status == models.AssetReady {
+		return nil
+	}
+	path := filepath.Join(svc.dir, a.Hash+".svg")
+	if err := os.WriteFile(path, svg, 0o644); err != nil {
+		return err
+	}
+	return db.Get().Model(&a).Updates(map[string]interface{}{
+		"status": models.AssetReady, "storage_path": path, "size_bytes": int64(len(svg)), "error": "",
+	}).Error
+}
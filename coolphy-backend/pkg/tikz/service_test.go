@@ -0,0 +1,70 @@
+package tikz
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"coolphy-backend/pkg/db/dbtest"
+	"coolphy-backend/pkg/models"
+)
+
+type fakeCompiler struct{}
+
+func (fakeCompiler) Compile(_ context.Context, source string) ([]byte, error) {
+	return []byte("<svg/>"), nil
+}
+
+func diagram(n int) string {
+	return fmt.Sprintf(`\begin{tikzpicture}\draw (0,0) -- (%d,0);\end{tikzpicture}`, n)
+}
+
+func TestFullQueueIsSwept(t *testing.T) {
+	d := dbtest.Open(t)
+	s := &service{compiler: fakeCompiler{}, dir: t.TempDir(), jobs: make(chan uint, 1), queued: map[uint]bool{}}
+	svc = s
+	t.Cleanup(func() { svc = nil })
+
+	// No workers yet: the second diagram doesn't fit
+	Enqueue(diagram(1), diagram(2))
+	Enqueue(diagram(1))
+	if len(s.jobs) != 1 {
+		t.Fatalf("%d jobs queued, want 1", len(s.jobs))
+	}
+	s.sweep()
+	if len(s.jobs) != 1 {
+		t.Fatalf("sweeping queued a diagram twice or past the limit: %d jobs", len(s.jobs))
+	}
+
+	for i := 0; i < 2; i++ {
+		s.run(<-s.jobs)
+		s.sweep()
+	}
+	var pending int64
+	d.Model(&models.Asset{}).Where("status = ?", models.AssetPending).Count(&pending)
+	if pending != 0 || len(s.jobs) != 0 {
+		t.Errorf("%d diagrams pending and %d queued after the sweeps, want none", pending, len(s.jobs))
+	}
+}
+
+func TestDisabledCompilerOnlyRecords(t *testing.T) {
+	d := dbtest.Open(t)
+	s := &service{dir: t.TempDir(), jobs: make(chan uint, 4), queued: map[uint]bool{}}
+	svc = s
+	t.Cleanup(func() { svc = nil })
+
+	Enqueue(diagram(1))
+	var a models.Asset
+	if err := d.Where("hash = ?", Hash(diagram(1))).First(&a).Error; err != nil || a.Status != models.AssetPending {
+		t.Fatalf("diagram %+v (%v), want it recorded as pending", a, err)
+	}
+	if len(s.jobs) != 0 {
+		t.Errorf("a diagram was queued with no compiler")
+	}
+	if err := Rebuild(&a); err == nil {
+		t.Errorf("rebuilding with no compiler gave no error")
+	}
+	if err := Store(diagram(1), []byte("<svg/>")); err != nil {
+		t.Errorf("storing a compiled diagram: %v", err)
+	}
+}
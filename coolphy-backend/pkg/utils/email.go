@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"html"
 	"net/smtp"
 	"os"
 	"strings"
@@ -103,3 +104,59 @@ func SendPasswordResetEmail(to, name, resetToken string) error {
 	
 	return SendEmail(to, subject, body)
 }
+
+func SendVerificationEmail(to, name, verifyToken string) error {
+	frontendURL := getEnv("FRONTEND_URL", "http://178.255.127.62:3000")
+	verifyLink := fmt.Sprintf("%s/verify-email?token=%s", 
+		strings.TrimRight(frontendURL, "/"), verifyToken)
+	
+	subject := "Confirm Your CoolPhy Email"
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>Email Verification</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
+    <div style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); padding: 30px; text-align: center; border-radius: 10px 10px 0 0;">
+        <h1 style="color: white; margin: 0;">CoolPhy</h1>
+        <p style="color: #f0f0f0; margin: 10px 0 0 0;">Email Verification</p>
+    </div>
+    
+    <div style="background: #f9f9f9; padding: 30px; border-radius: 0 0 10px 10px;">
+        <h2 style="color: #667eea; margin-top: 0;">Welcome, %s!</h2>
+        
+        <p>Please confirm that this is your email address to finish setting up your CoolPhy account:</p>
+        
+        <div style="text-align: center; margin: 30px 0;">
+            <a href="%s" style="background: #667eea; color: white; padding: 12px 30px; text-decoration: none; border-radius: 5px; display: inline-block; font-weight: bold;">
+                Confirm Email
+            </a>
+        </div>
+        
+        <p>Or copy and paste this link into your browser:</p>
+        <p style="background: white; padding: 10px; border-left: 4px solid #667eea; word-break: break-all; font-size: 12px;">
+            %s
+        </p>
+        
+        <p style="color: #666; font-size: 14px; margin-top: 30px;">
+            <strong>This link will expire in 24 hours.</strong>
+        </p>
+        
+        <p style="color: #666; font-size: 14px;">
+            If you didn't create an account, please ignore this email.
+        </p>
+        
+        <hr style="border: none; border-top: 1px solid #ddd; margin: 30px 0;">
+        
+        <p style="color: #999; font-size: 12px; text-align: center;">
+            © 2025 CoolPhy. All rights reserved.
+        </p>
+    </div>
+</body>
+</html>
+	`, html.EscapeString(name), verifyLink, verifyLink)
+	
+	return SendEmail(to, subject, body)
+}
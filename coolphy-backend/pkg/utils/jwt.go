@@ -8,15 +8,42 @@ import (
 )
 
 type Claims struct {
-	UserID uint   `json:"uid"`
-	Role   string `json:"role"`
+	UserID    uint   `json:"uid"`
+	Role      string `json:"role"`
+	SessionID uint   `json:"sid,omitempty"`
+	Purpose   string `json:"pur,omitempty"` // empty for access tokens
 	jwt.RegisteredClaims
 }
 
+// PurposeMFAPending marks the token handed out between the password and the
+// second factor; it is only accepted by the 2FA login step
+const PurposeMFAPending = "mfa_pending"
+
 func SignJWT(secret string, userID uint, role string, ttl time.Duration) (string, error) {
+	return SignSessionJWT(secret, userID, role, 0, ttl)
+}
+
+// SignSessionJWT signs an access token bound to a session
+func SignSessionJWT(secret string, userID uint, role string, sessionID uint, ttl time.Duration) (string, error) {
+	claims := Claims{
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return t.SignedString([]byte(secret))
+}
+
+// SignMFAPendingJWT signs a token proving the password step of a 2FA login passed
+func SignMFAPendingJWT(secret string, userID uint, role string, ttl time.Duration) (string, error) {
 	claims := Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:  userID,
+		Role:    role,
+		Purpose: PurposeMFAPending,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Provider names as stored in AppSettings.LLMProvider
+const (
+	LLMProviderOpenRouter       = "openrouter"
+	LLMProviderOpenAICompatible = "openai_compatible"
+	LLMProviderFake             = "fake"
+)
+
+// ErrLLMNotConfigured is returned when the selected provider is missing required settings
+var ErrLLMNotConfigured = errors.New("AI provider not configured")
+
+// LLMMessage is a single chat turn sent to a provider
+type LLMMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// LLMProvider is a chat completion backend
+type LLMProvider interface {
+	// Chat returns the complete reply for the conversation
+	Chat(ctx context.Context, messages []LLMMessage) (string, error)
+	// ChatStream calls onToken for every content delta as it arrives and returns
+	// the full reply when the stream ends. Cancelling ctx aborts the request.
+	ChatStream(ctx context.Context, messages []LLMMessage, onToken func(string) error) (string, error)
+}
+
+// LLMOptions holds everything needed to build any of the providers
+type LLMOptions struct {
+	Provider      string
+	APIKey        string
+	BaseURL       string
+	PrimaryModel  string
+	FallbackModel string
+}
+
+// NewLLMProvider builds the provider selected in opts
+func NewLLMProvider(opts LLMOptions) (LLMProvider, error) {
+	switch opts.Provider {
+	case "", LLMProviderOpenRouter:
+		if opts.APIKey == "" {
+			return nil, fmt.Errorf("%w: OpenRouter API key is empty", ErrLLMNotConfigured)
+		}
+		return NewOpenRouterClient(opts.APIKey, opts.PrimaryModel, opts.FallbackModel), nil
+	case LLMProviderOpenAICompatible:
+		if opts.BaseURL == "" {
+			return nil, fmt.Errorf("%w: base URL is empty", ErrLLMNotConfigured)
+		}
+		return NewOpenAICompatibleClient(opts.BaseURL, opts.APIKey, opts.PrimaryModel, opts.FallbackModel), nil
+	case LLMProviderFake:
+		return &FakeLLMProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", opts.Provider)
+	}
+}
+
+// IsValidLLMProvider reports whether name is one of the supported providers
+func IsValidLLMProvider(name string) bool {
+	switch name {
+	case LLMProviderOpenRouter, LLMProviderOpenAICompatible, LLMProviderFake:
+		return true
+	}
+	return false
+}
+
+// FakeLLMProvider is a deterministic provider for tests and local development.
+// It returns Reply if set, otherwise echoes the last user message.
+type FakeLLMProvider struct {
+	Reply string
+	// Err, if set, is returned from every call
+	Err error
+	// Calls records every conversation the provider was asked about
+	Calls [][]LLMMessage
+}
+
+func (f *FakeLLMProvider) reply(messages []LLMMessage) string {
+	if f.Reply != "" {
+		return f.Reply
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return "echo: " + messages[i].Content
+		}
+	}
+	return "echo:"
+}
+
+func (f *FakeLLMProvider) Chat(ctx context.Context, messages []LLMMessage) (string, error) {
+	f.Calls = append(f.Calls, messages)
+	if f.Err != nil {
+		return "", f.Err
+	}
+	return f.reply(messages), nil
+}
+
+// ChatStream emits the reply word by word, keeping the separating spaces so that
+// the concatenated tokens equal the full reply
+func (f *FakeLLMProvider) ChatStream(ctx context.Context, messages []LLMMessage, onToken func(string) error) (string, error) {
+	f.Calls = append(f.Calls, messages)
+	if f.Err != nil {
+		return "", f.Err
+	}
+	full := f.reply(messages)
+	var sent strings.Builder
+	for _, word := range strings.SplitAfter(full, " ") {
+		if err := ctx.Err(); err != nil {
+			return sent.String(), err
+		}
+		if err := onToken(word); err != nil {
+			return sent.String(), err
+		}
+		sent.WriteString(word)
+	}
+	return full, nil
+}
@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAICompatibleClient talks to any server exposing the OpenAI
+// /chat/completions API (OpenRouter, llama.cpp server, Ollama, vLLM, ...)
+type OpenAICompatibleClient struct {
+	BaseURL       string
+	APIKey        string
+	PrimaryModel  string
+	FallbackModel string
+	// Headers are added to every request
+	Headers    map[string]string
+	HTTPClient *http.Client
+	// StreamClient has no overall timeout; streams are bounded by the caller's context
+	StreamClient *http.Client
+}
+
+type chatCompletionRequest struct {
+	Model    string       `json:"model"`
+	Messages []LLMMessage `json:"messages"`
+	Stream   bool         `json:"stream,omitempty"`
+}
+
+type chatCompletionResponse struct {
+	ID      string `json:"id"`
+	Choices []struct {
+		Message struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *chatCompletionError `json:"error,omitempty"`
+}
+
+// chatCompletionChunk is a single SSE "data:" payload of a streamed completion
+type chatCompletionChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *chatCompletionError `json:"error,omitempty"`
+}
+
+type chatCompletionError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+// NewOpenAICompatibleClient creates a client for baseURL, e.g. http://localhost:11434/v1.
+// apiKey may be empty for local servers.
+func NewOpenAICompatibleClient(baseURL, apiKey, primaryModel, fallbackModel string) *OpenAICompatibleClient {
+	return &OpenAICompatibleClient{
+		BaseURL:       strings.TrimRight(baseURL, "/"),
+		APIKey:        apiKey,
+		PrimaryModel:  primaryModel,
+		FallbackModel: fallbackModel,
+		HTTPClient:    &http.Client{Timeout: 60 * time.Second},
+		StreamClient:  &http.Client{},
+	}
+}
+
+func (c *OpenAICompatibleClient) Chat(ctx context.Context, messages []LLMMessage) (string, error) {
+	// Try primary model first
+	response, err := c.callAPI(ctx, c.PrimaryModel, messages)
+	if err != nil {
+		// Check if error is due to insufficient credits
+		if c.isInsufficientCreditsError(err) && c.FallbackModel != "" {
+			fmt.Printf("Primary model failed with insufficient credits, trying fallback model: %s\n", c.FallbackModel)
+			// Try fallback model
+			response, err = c.callAPI(ctx, c.FallbackModel, messages)
+			if err != nil {
+				return "", fmt.Errorf("fallback model also failed: %w", err)
+			}
+			return response, nil
+		}
+		return "", err
+	}
+	return response, nil
+}
+
+func (c *OpenAICompatibleClient) ChatStream(ctx context.Context, messages []LLMMessage, onToken func(string) error) (string, error) {
+	emitted := false
+	track := func(tok string) error {
+		emitted = true
+		return onToken(tok)
+	}
+	response, err := c.callStreamAPI(ctx, c.PrimaryModel, messages, track)
+	if err != nil {
+		// Only fall back if nothing was sent to the caller yet, otherwise the
+		// client would see two different replies glued together
+		if !emitted && ctx.Err() == nil && c.isInsufficientCreditsError(err) && c.FallbackModel != "" {
+			fmt.Printf("Primary model failed with insufficient credits, trying fallback model: %s\n", c.FallbackModel)
+			response, err = c.callStreamAPI(ctx, c.FallbackModel, messages, track)
+			if err != nil {
+				return "", fmt.Errorf("fallback model also failed: %w", err)
+			}
+			return response, nil
+		}
+		return response, err
+	}
+	return response, nil
+}
+
+func (c *OpenAICompatibleClient) newRequest(ctx context.Context, model string, messages []LLMMessage, stream bool) (*http.Request, error) {
+	reqBody := chatCompletionRequest{
+		Model:    model,
+		Messages: messages,
+		Stream:   stream,
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+func (c *OpenAICompatibleClient) callAPI(ctx context.Context, model string, messages []LLMMessage) (string, error) {
+	req, err := c.newRequest(ctx, model, messages, false)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result chatCompletionResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if result.Error != nil {
+		return "", fmt.Errorf("API error: %s (code: %d)", result.Error.Message, result.Error.Code)
+	}
+
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("no response choices returned")
+	}
+
+	return result.Choices[0].Message.Content, nil
+}
+
+func (c *OpenAICompatibleClient) callStreamAPI(ctx context.Context, model string, messages []LLMMessage, onToken func(string) error) (string, error) {
+	req, err := c.newRequest(ctx, model, messages, true)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.StreamClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var full strings.Builder
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return full.String(), nil
+			}
+			return full.String(), fmt.Errorf("failed to read stream: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		// Skip blank separators and SSE comments (OpenRouter sends keep-alives as ": ...")
+		if line == "" || strings.HasPrefix(line, ":") || !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return full.String(), nil
+		}
+
+		var chunk chatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return full.String(), fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return full.String(), fmt.Errorf("API error: %s (code: %d)", chunk.Error.Message, chunk.Error.Code)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		tok := chunk.Choices[0].Delta.Content
+		full.WriteString(tok)
+		if err := onToken(tok); err != nil {
+			return full.String(), err
+		}
+	}
+}
+
+func (c *OpenAICompatibleClient) isInsufficientCreditsError(err error) bool {
+	if err == nil {
+		return false
+	}
+	errMsg := err.Error()
+	// Check for common insufficient credits error messages
+	return contains(errMsg, "insufficient") ||
+		contains(errMsg, "credits") ||
+		contains(errMsg, "quota") ||
+		contains(errMsg, "429") ||
+		contains(errMsg, "rate limit")
+}
+
+func contains(s, substr string) bool {
+	return strings.Contains(s, substr)
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+)
+
+// RandomToken returns a random 256-bit token, hex encoded
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken returns the SHA-256 of a token for storage, so a database leak
+// doesn't hand out usable tokens
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomCode returns a random code of n characters that are easy to read out
+// loud and type: no 0/O, 1/I/L
+func RandomCode(n int) (string, error) {
+	return randomString(rand.Reader, "ABCDEFGHJKMNPQRSTUVWXYZ23456789", n)
+}
+
+// randomString returns n characters of alphabet read from r, each equally
+// likely. Bytes past the last whole multiple of the alphabet size would make
+// the first characters more common, so they are drawn again.
+func randomString(r io.Reader, alphabet string, n int) (string, error) {
+	limit := 256 - 256%len(alphabet)
+	out := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(out) < n {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(out) < n {
+				out = append(out, alphabet[int(b)%len(alphabet)])
+			}
+		}
+	}
+	return string(out), nil
+}
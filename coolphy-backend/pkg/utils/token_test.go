@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRandomStringSkipsBiasedBytes(t *testing.T) {
+	const alphabet = "abc" // 256 = 3*85 + 1, so byte 255 would favour "a"
+	got, err := randomString(bytes.NewReader([]byte{255, 255, 0, 255, 4, 254, 255, 2}), alphabet, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "abcc" {
+		t.Errorf("got %q, want abcc with every 255 skipped", got)
+	}
+	if _, err := randomString(bytes.NewReader([]byte{255, 255, 255}), alphabet, 2); err == nil {
+		t.Errorf("running out of randomness gave no error")
+	}
+}
+
+func TestRandomCode(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		code, err := RandomCode(8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != 8 || strings.ContainsAny(code, "0O1IL") {
+			t.Errorf("code %q, want 8 unambiguous characters", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) < 100 {
+		t.Errorf("%d distinct codes out of 100", len(seen))
+	}
+}
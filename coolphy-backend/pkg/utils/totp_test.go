@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := regexp.MustCompile(`^[a-hjkmnp-z2-9]{4}-[a-hjkmnp-z2-9]{4}-[a-hjkmnp-z2-9]{4}$`)
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if !format.MatchString(c) {
+			t.Errorf("code %q doesn't look like k3f9-x2mp-7qwd", c)
+		}
+		if seen[c] {
+			t.Errorf("code %q repeated", c)
+		}
+		seen[c] = true
+		if n := NormalizeRecoveryCode(" " + c[:4] + " " + c[5:9] + c[10:] + " "); n != c[:4]+c[5:9]+c[10:] {
+			t.Errorf("normalized %q to %q", c, n)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package workflow
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/db"
+	"coolphy-backend/pkg/models"
+)
+
+const schedulerInterval = time.Minute
+
+// StartScheduler publishes scheduled lectures and tasks once their
+// publish_at has come, checking every minute
+func StartScheduler() {
+	go func() {
+		for {
+			if n, err := PublishDue(time.Now()); err != nil {
+				log.Printf("publish scheduler: %v", err)
+			} else if n > 0 {
+				log.Printf("publish scheduler: published %d items", n)
+			}
+			time.Sleep(schedulerInterval)
+		}
+	}()
+}
+
+// PublishDue publishes everything scheduled at or before now and returns
+// how many lectures and tasks went live
+func PublishDue(now time.Time) (int64, error) {
+	var total int64
+	for _, kind := range []string{models.ContentLecture, models.ContentTask} {
+		res := db.Get().Model(model(kind)).
+			Where("status = ? AND publish_at <= ?", models.StatusScheduled, now).
+			Updates(map[string]any{"status": models.StatusPublished, "published_at": gorm.Expr("publish_at")})
+		if res.Error != nil {
+			return total, res.Error
+		}
+		total += res.RowsAffected
+	}
+	return total, nil
+}
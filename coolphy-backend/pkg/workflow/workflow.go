@@ -0,0 +1,274 @@
+// Package workflow moves lectures and tasks through the editorial states:
+// draft → review → published, with scheduled in between when the reviewer
+// sets a future publish_at, and archived from anywhere. Every change is
+// logged as a models.ReviewComment.
+//
+// Only these status changes are reviewed. Saving a lecture or task, or
+// restoring one of its revisions, changes the content in place whatever its
+// status, so an edit to published content is live at once; editors who want
+// an edit reviewed move the content back to draft first.
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"coolphy-backend/pkg/models"
+)
+
+// Allowed moves. Admins may also publish a draft without review.
+var transitions = map[string][]string{
+	models.StatusDraft:     {models.StatusReview, models.StatusArchived},
+	models.StatusReview:    {models.StatusDraft, models.StatusScheduled, models.StatusPublished, models.StatusArchived},
+	models.StatusScheduled: {models.StatusDraft, models.StatusReview, models.StatusScheduled, models.StatusPublished, models.StatusArchived},
+	models.StatusPublished: {models.StatusDraft, models.StatusArchived},
+	models.StatusArchived:  {models.StatusDraft},
+}
+
+// TransitionError is a move the state machine doesn't allow
+type TransitionError struct{ From, To string }
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("can't move from %s to %s", e.From, e.To)
+}
+
+var (
+	ErrNotReviewer     = errors.New("only the assigned reviewer or an admin can decide on this review")
+	ErrOwnSubmission   = errors.New("content can't be approved by whoever sent it to review, only by another editor or an admin")
+	ErrInvalidReviewer = errors.New("the reviewer must be a user who can edit content")
+	ErrPastPublishAt   = errors.New("publish_at must be in the future")
+)
+
+// Actor is the user asking for a change
+type Actor struct {
+	UserID uint
+	Admin  bool
+}
+
+// Request asks to move a lecture or task to status To
+type Request struct {
+	To         string     `json:"status" binding:"required"`
+	ReviewerID *uint      `json:"reviewer_id"` // assign when submitting for review
+	PublishAt  *time.Time `json:"publish_at"`  // with published: schedule instead of publishing now
+	Comment    string     `json:"comment"`
+}
+
+// State is the editorial state of a lecture or task
+type State struct {
+	ID          uint       `json:"id"`
+	Title       string     `json:"title"`
+	Status      string     `json:"status"`
+	ReviewerID  *uint      `json:"reviewer_id"`
+	PublishAt   *time.Time `json:"publish_at"`
+	PublishedAt *time.Time `json:"published_at"`
+}
+
+func model(kind string) any {
+	if kind == models.ContentTask {
+		return &models.Task{}
+	}
+	return &models.Lecture{}
+}
+
+// Load returns the state of the lecture or task, locked for update when tx
+// is a transaction
+func Load(tx *gorm.DB, kind string, id uint) (*State, error) {
+	var st State
+	err := tx.Model(model(kind)).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id, title, status, reviewer_id, publish_at, published_at").
+		Where("id = ?", id).Take(&st).Error
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// Allowed reports whether actor may move content from one status to another
+func Allowed(from, to string, actor Actor) bool {
+	if _, ok := transitions[from]; !ok {
+		// Legacy values such as "active" count as drafts
+		from = models.StatusDraft
+	}
+	if actor.Admin && from == models.StatusDraft && (to == models.StatusPublished || to == models.StatusScheduled) {
+		return true
+	}
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves a lecture or task to req.To and logs it. Approving
+// (review or scheduled to published) is up to the assigned reviewer, or any
+// editor other than the submitter when none is assigned; admins can always
+// do it.
+func Transition(tx *gorm.DB, kind string, id uint, actor Actor, req Request, now time.Time) (*State, error) {
+	st, err := Load(tx, kind, id)
+	if err != nil {
+		return nil, err
+	}
+	to := req.To
+	if to == models.StatusScheduled && req.PublishAt == nil {
+		return nil, ErrPastPublishAt
+	}
+	if to == models.StatusPublished && req.PublishAt != nil {
+		to = models.StatusScheduled
+	}
+	if to == models.StatusScheduled && !req.PublishAt.After(now) {
+		return nil, ErrPastPublishAt
+	}
+	if !Allowed(st.Status, to, actor) {
+		return nil, &TransitionError{From: st.Status, To: req.To}
+	}
+	approving := to == models.StatusPublished || to == models.StatusScheduled
+	deciding := st.Status == models.StatusReview && (approving || to == models.StatusDraft)
+	if (deciding || st.Status == models.StatusScheduled && approving) && !mayDecide(st, actor) {
+		return nil, ErrNotReviewer
+	}
+	if approving && !actor.Admin {
+		submitter, err := lastSubmitter(tx, kind, id)
+		if err != nil {
+			return nil, err
+		}
+		if submitter != nil && *submitter == actor.UserID {
+			return nil, ErrOwnSubmission
+		}
+	}
+
+	updates := map[string]any{"status": to}
+	switch to {
+	case models.StatusReview:
+		if req.ReviewerID != nil {
+			if err := checkReviewer(tx, *req.ReviewerID); err != nil {
+				return nil, err
+			}
+			updates["reviewer_id"] = *req.ReviewerID
+		}
+	case models.StatusScheduled:
+		updates["publish_at"] = *req.PublishAt
+	case models.StatusPublished:
+		updates["publish_at"], updates["published_at"] = nil, now
+	default:
+		updates["publish_at"] = nil
+	}
+	if err := tx.Model(model(kind)).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	comment := models.ReviewComment{
+		EntityType: kind,
+		EntityID:   id,
+		AuthorID:   actor.UserID,
+		Transition: st.Status + "->" + to,
+		Body:       req.Comment,
+	}
+	if err := tx.Create(&comment).Error; err != nil {
+		return nil, err
+	}
+
+	if to == models.StatusReview && req.ReviewerID != nil && *req.ReviewerID != actor.UserID {
+		if err := notifyReviewer(tx, *req.ReviewerID, kind, st.Title); err != nil {
+			return nil, err
+		}
+	}
+	if deciding {
+		if err := notifySubmitter(tx, kind, st, actor, to, req.Comment); err != nil {
+			return nil, err
+		}
+	}
+	return Load(tx, kind, id)
+}
+
+func mayDecide(st *State, actor Actor) bool {
+	return actor.Admin || st.ReviewerID == nil || *st.ReviewerID == actor.UserID
+}
+
+// AssignReviewer sets the reviewer of a lecture or task that isn't
+// published yet and lets them know
+func AssignReviewer(tx *gorm.DB, kind string, id uint, actor Actor, reviewerID uint) (*State, error) {
+	st, err := Load(tx, kind, id)
+	if err != nil {
+		return nil, err
+	}
+	if st.Status == models.StatusPublished || st.Status == models.StatusArchived {
+		return nil, &TransitionError{From: st.Status, To: models.StatusReview}
+	}
+	if err := checkReviewer(tx, reviewerID); err != nil {
+		return nil, err
+	}
+	if err := tx.Model(model(kind)).Where("id = ?", id).Update("reviewer_id", reviewerID).Error; err != nil {
+		return nil, err
+	}
+	if reviewerID != actor.UserID {
+		if err := notifyReviewer(tx, reviewerID, kind, st.Title); err != nil {
+			return nil, err
+		}
+	}
+	return Load(tx, kind, id)
+}
+
+func checkReviewer(tx *gorm.DB, userID uint) error {
+	var u models.User
+	if err := tx.Select("id, role").First(&u, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrInvalidReviewer
+		}
+		return err
+	}
+	if !models.HasPermission(u.Role, models.PermContentWrite) {
+		return ErrInvalidReviewer
+	}
+	return nil
+}
+
+func notifyReviewer(tx *gorm.DB, reviewerID uint, kind, title string) error {
+	return tx.Create(&models.Notification{
+		UserID:  reviewerID,
+		Type:    "review_request",
+		Title:   "Review requested: " + title,
+		Content: fmt.Sprintf("You were asked to review the %s \"%s\".", kind, title),
+	}).Error
+}
+
+// notifySubmitter tells whoever last sent the content to review about the
+// decision
+func notifySubmitter(tx *gorm.DB, kind string, st *State, actor Actor, to, comment string) error {
+	submitter, err := lastSubmitter(tx, kind, st.ID)
+	if err != nil || submitter == nil || *submitter == actor.UserID {
+		return err
+	}
+	title := "Changes requested: " + st.Title
+	if to != models.StatusDraft {
+		title = "Approved: " + st.Title
+	}
+	return tx.Create(&models.Notification{
+		UserID:  *submitter,
+		Type:    "review",
+		Title:   title,
+		Content: comment,
+	}).Error
+}
+
+// lastSubmitter is whoever last sent the content to review, nil if nobody has
+func lastSubmitter(tx *gorm.DB, kind string, id uint) (*uint, error) {
+	var submit models.ReviewComment
+	err := tx.Where("entity_type = ? AND entity_id = ? AND transition LIKE ?", kind, id, "%->"+models.StatusReview).
+		Order("id DESC").First(&submit).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &submit.AuthorID, nil
+}
+
+// Published limits a query on lectures or tasks to what students may see
+func Published(q *gorm.DB) *gorm.DB {
+	return q.Where("status = ?", models.StatusPublished)
+}
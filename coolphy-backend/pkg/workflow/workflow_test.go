@@ -0,0 +1,142 @@
+package workflow
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"coolphy-backend/pkg/db/dbtest"
+	"coolphy-backend/pkg/models"
+)
+
+func TestAllowed(t *testing.T) {
+	editor, admin := Actor{UserID: 1}, Actor{UserID: 2, Admin: true}
+	tests := []struct {
+		from, to string
+		actor    Actor
+		want     bool
+	}{
+		{models.StatusDraft, models.StatusReview, editor, true},
+		{models.StatusDraft, models.StatusPublished, editor, false},
+		{models.StatusDraft, models.StatusPublished, admin, true},
+		{models.StatusDraft, models.StatusScheduled, admin, true},
+		{models.StatusReview, models.StatusPublished, editor, true},
+		{models.StatusReview, models.StatusDraft, editor, true},
+		{models.StatusScheduled, models.StatusScheduled, editor, true},
+		{models.StatusPublished, models.StatusReview, editor, false},
+		{models.StatusPublished, models.StatusDraft, editor, true},
+		{models.StatusPublished, models.StatusArchived, editor, true},
+		{models.StatusArchived, models.StatusPublished, admin, false},
+		{models.StatusArchived, models.StatusDraft, editor, true},
+		{"active", models.StatusReview, editor, true},
+		{"active", models.StatusPublished, editor, false},
+		{"active", models.StatusPublished, admin, true},
+		{models.StatusDraft, "deleted", admin, false},
+	}
+	for _, tt := range tests {
+		if got := Allowed(tt.from, tt.to, tt.actor); got != tt.want {
+			t.Errorf("Allowed(%s -> %s, admin=%v) = %v, want %v", tt.from, tt.to, tt.actor.Admin, got, tt.want)
+		}
+	}
+}
+
+func TestTransition(t *testing.T) {
+	d := dbtest.Open(t)
+	user := func(email, role string) Actor {
+		u := models.User{Email: email, Name: email, PasswordHash: "x", Role: role}
+		if err := d.Create(&u).Error; err != nil {
+			t.Fatal(err)
+		}
+		return Actor{UserID: u.ID, Admin: role == models.RoleAdmin}
+	}
+	author, reviewer, other := user("author@example.com", models.RoleEditor), user("reviewer@example.com", models.RoleEditor), user("other@example.com", models.RoleEditor)
+	student := user("student@example.com", models.RoleUser)
+	now := time.Now()
+
+	task := models.Task{Title: "Speed", Status: models.StatusDraft}
+	d.Create(&task)
+	move := func(actor Actor, req Request) (*State, error) {
+		var st *State
+		err := d.Transaction(func(tx *gorm.DB) error {
+			var err error
+			st, err = Transition(tx, models.ContentTask, task.ID, actor, req, now)
+			return err
+		})
+		return st, err
+	}
+
+	if _, err := move(author, Request{To: models.StatusReview, ReviewerID: &student.UserID}); err != ErrInvalidReviewer {
+		t.Errorf("assigning a student as reviewer: %v, want ErrInvalidReviewer", err)
+	}
+	st, err := move(author, Request{To: models.StatusReview, ReviewerID: &reviewer.UserID})
+	if err != nil || st.Status != models.StatusReview || st.ReviewerID == nil || *st.ReviewerID != reviewer.UserID {
+		t.Fatalf("sending to review: %+v %v", st, err)
+	}
+	var n int64
+	d.Model(&models.Notification{}).Where("user_id = ? AND type = ?", reviewer.UserID, "review_request").Count(&n)
+	if n != 1 {
+		t.Errorf("the reviewer got %d review requests, want 1", n)
+	}
+
+	if _, err := move(other, Request{To: models.StatusPublished}); err != ErrNotReviewer {
+		t.Errorf("approval by an editor who isn't the reviewer: %v, want ErrNotReviewer", err)
+	}
+	past := now.Add(-time.Hour)
+	if _, err := move(reviewer, Request{To: models.StatusPublished, PublishAt: &past}); err != ErrPastPublishAt {
+		t.Errorf("scheduling in the past: %v, want ErrPastPublishAt", err)
+	}
+	if _, err := move(reviewer, Request{To: models.StatusScheduled}); err != ErrPastPublishAt {
+		t.Errorf("scheduling without publish_at: %v, want ErrPastPublishAt", err)
+	}
+	later := now.Add(time.Hour)
+	st, err = move(reviewer, Request{To: models.StatusPublished, PublishAt: &later, Comment: "fine"})
+	if err != nil || st.Status != models.StatusScheduled || st.PublishAt == nil {
+		t.Fatalf("approving with a publish_at: %+v %v, want scheduled", st, err)
+	}
+	d.Model(&models.Notification{}).Where("user_id = ? AND type = ?", author.UserID, "review").Count(&n)
+	if n != 1 {
+		t.Errorf("the author got %d decisions, want 1", n)
+	}
+
+	if published, err := PublishDue(later); err != nil || published != 1 {
+		t.Fatalf("PublishDue: %d %v, want 1", published, err)
+	}
+	st, _ = Load(d, models.ContentTask, task.ID)
+	if st.Status != models.StatusPublished || st.PublishedAt == nil {
+		t.Errorf("after its publish_at the task is %+v, want published", st)
+	}
+
+	var te *TransitionError
+	if _, err := move(author, Request{To: models.StatusReview}); !errors.As(err, &te) {
+		t.Errorf("published -> review: %v, want a TransitionError", err)
+	}
+	if _, err := move(author, Request{To: models.StatusDraft}); err != nil {
+		t.Fatalf("unpublishing: %v", err)
+	}
+
+	// Without a reviewer anyone but the submitter may approve
+	if _, err := move(author, Request{To: models.StatusReview}); err != nil {
+		t.Fatal(err)
+	}
+	d.Model(&task).Update("reviewer_id", nil)
+	if _, err := move(author, Request{To: models.StatusPublished}); err != ErrOwnSubmission {
+		t.Errorf("approving one's own submission: %v, want ErrOwnSubmission", err)
+	}
+	if st, err := move(other, Request{To: models.StatusPublished}); err != nil || st.Status != models.StatusPublished || st.PublishAt != nil {
+		t.Errorf("approval by another editor: %+v %v, want published now", st, err)
+	}
+
+	var log []models.ReviewComment
+	d.Where("entity_type = ? AND entity_id = ?", models.ContentTask, task.ID).Order("id").Find(&log)
+	want := []string{"draft->review", "review->scheduled", "published->draft", "draft->review", "review->published"}
+	if len(log) != len(want) {
+		t.Fatalf("logged %d transitions, want %d", len(log), len(want))
+	}
+	for i, c := range log {
+		if c.Transition != want[i] {
+			t.Errorf("transition %d logged as %s, want %s", i, c.Transition, want[i])
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package worksheet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"coolphy-backend/internal/config"
+	"coolphy-backend/pkg/judge"
+	"coolphy-backend/pkg/latex"
+	"coolphy-backend/pkg/tikz"
+)
+
+// ErrUnavailable is returned for PDFs when there is no TeX toolchain or no
+// sandbox to run it in
+var ErrUnavailable = errors.New("PDF output needs pdflatex and the judge sandbox on the server")
+
+// Hash identifies a document by its source
+func Hash(doc []byte) string {
+	sum := sha256.Sum256(doc)
+	return hex.EncodeToString(sum[:])
+}
+
+// Check returns the forbidden commands in the printed texts, which would run
+// in pdflatex though the HTML renderer ignores them
+func Check(opts Options) []latex.Issue {
+	var texts []string
+	if opts.Lecture != nil {
+		texts = append(texts, opts.Lecture.ContentLaTeX)
+	}
+	for _, it := range opts.Items {
+		texts = append(texts, it.Task.DescriptionLaTeX)
+		if opts.Solutions && !it.HideKey {
+			texts = append(texts, it.Task.SolutionLaTeX)
+		}
+		if spec, err := it.Task.DecodeAnswerSpec(); err == nil && spec != nil {
+			for _, o := range spec.Options {
+				texts = append(texts, o.Text)
+			}
+		}
+	}
+	var out []latex.Issue
+	for _, t := range texts {
+		for _, is := range latex.Lint(t) {
+			if is.Code == "forbidden_command" {
+				out = append(out, is)
+			}
+		}
+	}
+	return out
+}
+
+type cache struct {
+	dir     string
+	runner  judge.Runner // nil when TeX can't run sandboxed
+	workDir string
+	timeout time.Duration
+	slots   chan struct{}
+}
+
+var svc *cache
+
+// Start prepares the output directory. PDFs are compiled on request, at most
+// two at a time, in the sandbox of the code judge; without it only the TeX
+// source is offered.
+func Start(cfg config.Config) {
+	dir, err := filepath.Abs(filepath.Join(cfg.UploadDir, "worksheets"))
+	if err == nil {
+		err = os.MkdirAll(dir, 0o755)
+	}
+	if err != nil {
+		log.Printf("worksheet: output dir: %v", err)
+		return
+	}
+	svc = &cache{
+		dir:     dir,
+		workDir: cfg.JudgeWorkDir,
+		timeout: cfg.PDFTimeout,
+		slots:   make(chan struct{}, 2),
+	}
+	runner, err := judge.SandboxRunner(cfg)
+	if err != nil {
+		log.Printf("worksheet: %v, PDF output is disabled", err)
+		return
+	}
+	svc.runner = runner
+}
+
+// Available reports whether PDFs can be made
+func Available() bool {
+	if svc == nil || svc.runner == nil {
+		return false
+	}
+	_, err := exec.LookPath("pdflatex")
+	return err == nil
+}
+
+// TeX stores the source under its hash and returns the file path
+func TeX(doc []byte) (string, error) {
+	if svc == nil {
+		return "", errors.New("worksheet output is not configured")
+	}
+	path := filepath.Join(svc.dir, Hash(doc)+".tex")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	return path, writeFile(path, doc)
+}
+
+// PDF compiles the source unless a PDF of the same source is cached and
+// returns the file path. TeX errors come back as a *tikz.CompileError.
+func PDF(ctx context.Context, doc []byte) (string, error) {
+	if !Available() {
+		return "", ErrUnavailable
+	}
+	path := filepath.Join(svc.dir, Hash(doc)+".pdf")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	select {
+	case svc.slots <- struct{}{}:
+		defer func() { <-svc.slots }()
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	// Someone else may have built it while we waited
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	pdf, err := svc.compile(ctx, doc)
+	if err != nil {
+		return "", err
+	}
+	return path, writeFile(path, pdf)
+}
+
+func (s *cache) compile(ctx context.Context, doc []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp(s.workDir, "worksheet-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "worksheet.tex"), doc, 0o644); err != nil {
+		return nil, err
+	}
+	args := []string{"pdflatex", "-no-shell-escape", "-interaction=nonstopmode", "-halt-on-error",
+		"-cnf-line=openin_any=p", "-cnf-line=openout_any=p", "worksheet.tex"}
+	res, err := s.runner.Run(ctx, judge.RunRequest{Dir: dir, Args: args, TimeLimit: s.timeout, MemoryLimitMB: 1024})
+	if err != nil {
+		return nil, err
+	}
+	if res.TimedOut {
+		return nil, &tikz.CompileError{Reason: "pdflatex timed out"}
+	}
+	if res.ExitCode != 0 {
+		return nil, &tikz.CompileError{Reason: "pdflatex failed", Log: logTail(res.Stdout + res.Stderr)}
+	}
+	return os.ReadFile(filepath.Join(dir, "worksheet.pdf"))
+}
+
+// writeFile goes through a temporary file so a request never serves half a
+// document
+func writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// logTail keeps the end of the TeX log, where the error is
+func logTail(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 4000 {
+		s = s[len(s)-4000:]
+	}
+	return s
+}
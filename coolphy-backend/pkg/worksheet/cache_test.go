@@ -0,0 +1,29 @@
+package worksheet
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"coolphy-backend/internal/config"
+)
+
+func TestNoPDFsWithoutSandbox(t *testing.T) {
+	t.Cleanup(func() { svc = nil })
+	Start(config.Config{UploadDir: t.TempDir(), JudgeIsolate: false})
+	if Available() {
+		t.Errorf("PDFs are offered with JUDGE_ISOLATE=false")
+	}
+	doc := []byte(`\documentclass{article}\begin{document}x\end{document}`)
+	if _, err := PDF(context.Background(), doc); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("PDF without the sandbox: %v, want ErrUnavailable", err)
+	}
+	path, err := TeX(doc)
+	if err != nil {
+		t.Fatalf("TeX source without the sandbox: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("TeX source not stored: %v", err)
+	}
+}
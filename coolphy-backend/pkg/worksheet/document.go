@@ -0,0 +1,125 @@
+// Package worksheet prints tasks and lectures: a worksheet is a list of
+// tasks, a handout a lecture followed by its tasks. Document builds the
+// LaTeX source; PDF compiles it when a TeX toolchain is installed, and
+// both outputs are kept by the hash of the source.
+package worksheet
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"coolphy-backend/pkg/exam"
+	"coolphy-backend/pkg/grading"
+	"coolphy-backend/pkg/models"
+	"coolphy-backend/pkg/tikz"
+)
+
+// Item is a task as printed. HideKey leaves its answer and solution out,
+// e.g. while it is part of a running contest.
+type Item struct {
+	Number  int
+	Task    *models.Task
+	HideKey bool
+}
+
+// Options describe the document
+type Options struct {
+	Title     string
+	Lecture   *models.Lecture // printed before the tasks for a handout
+	Items     []Item
+	AnswerKey bool // a table of answers on a separate page
+	Solutions bool // the solutions after the answer key
+}
+
+const preamble = `\documentclass[11pt,a4paper]{article}
+\usepackage[T2A]{fontenc}
+\usepackage[utf8]{inputenc}
+\usepackage[english,russian]{babel}
+\usepackage{amsmath,amssymb}
+\usepackage{graphicx}
+\usepackage{tabularx,booktabs,wrapfig}
+\usepackage{listings}
+\usepackage{tikz}
+\usetikzlibrary{` + tikz.Libraries + `}
+\usepackage[margin=2cm]{geometry}
+\usepackage{hyperref}
+\pagestyle{plain}
+`
+
+// Document renders the worksheet or handout as a standalone LaTeX file
+func Document(opts Options) []byte {
+	var b bytes.Buffer
+	b.WriteString(preamble)
+	b.WriteString("\\begin{document}\n\n")
+	fmt.Fprintf(&b, "\\begin{center}\n{\\Large %s}\n\\end{center}\n\n", exam.EscapeLaTeX(opts.Title))
+	if opts.Lecture == nil {
+		b.WriteString("\\noindent Name: \\rule{6cm}{0.4pt} \\hfill Date: \\rule{3cm}{0.4pt}\n\n")
+	}
+
+	if l := opts.Lecture; l != nil {
+		b.WriteString(strings.TrimSpace(l.ContentLaTeX))
+		b.WriteString("\n\n")
+		if len(opts.Items) > 0 {
+			b.WriteString("\\section*{Exercises}\n\n")
+		}
+	}
+
+	for _, it := range opts.Items {
+		t := it.Task
+		fmt.Fprintf(&b, "\\subsection*{%d. %s \\hfill \\normalsize\\textmd{(%d)}}\n", it.Number, exam.EscapeLaTeX(t.Title), t.Points)
+		b.WriteString(strings.TrimSpace(t.DescriptionLaTeX))
+		b.WriteString("\n")
+		if t.AnswerType == grading.AnswerChoice {
+			if spec, err := t.DecodeAnswerSpec(); err == nil && spec != nil && len(spec.Options) > 0 {
+				b.WriteString("\\begin{enumerate}\n")
+				for _, o := range spec.Options {
+					fmt.Fprintf(&b, "\\item[%s)] %s\n", exam.EscapeLaTeX(o.ID), o.Text)
+				}
+				b.WriteString("\\end{enumerate}\n")
+			}
+		}
+		if t.AnswerType != grading.AnswerCode && t.AnswerType != grading.AnswerFree {
+			b.WriteString("\n\\noindent Answer: \\rule{5cm}{0.4pt}\n")
+		}
+		b.WriteString("\n")
+	}
+
+	if opts.AnswerKey && len(opts.Items) > 0 {
+		b.WriteString("\\newpage\n\\section*{Answer key}\n")
+		b.WriteString("\\noindent\\begin{tabularx}{\\textwidth}{|r|X|}\n\\hline\nNo. & Answer \\\\\n\\hline\n")
+		for _, it := range opts.Items {
+			answer := "see solution"
+			if it.HideKey {
+				answer = "hidden"
+			} else if a := grading.KeyAnswer(it.Task); a != "" {
+				answer = a
+			}
+			if it.Task.AnswerUnit != "" && !it.HideKey && !grading.IsStructured(it.Task.AnswerType) {
+				answer += " " + it.Task.AnswerUnit
+			}
+			fmt.Fprintf(&b, "%d & %s \\\\\n\\hline\n", it.Number, exam.EscapeLaTeX(answer))
+		}
+		b.WriteString("\\end{tabularx}\n\n")
+	}
+
+	if opts.Solutions {
+		var sols bytes.Buffer
+		for _, it := range opts.Items {
+			sol := strings.TrimSpace(it.Task.SolutionLaTeX)
+			if it.HideKey || sol == "" {
+				continue
+			}
+			fmt.Fprintf(&sols, "\\subsection*{%d. %s}\n%s\n\n", it.Number, exam.EscapeLaTeX(it.Task.Title), sol)
+		}
+		if sols.Len() > 0 {
+			if !opts.AnswerKey {
+				b.WriteString("\\newpage\n")
+			}
+			b.WriteString("\\section*{Solutions}\n\n")
+			b.Write(sols.Bytes())
+		}
+	}
+	b.WriteString("\\end{document}\n")
+	return b.Bytes()
+}